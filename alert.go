@@ -0,0 +1,195 @@
+// Alerting rules are evaluated every few seconds over counters, lists and
+// locks. Rule fires when its value stays above the threshold for For seconds
+// and resolves when the value drops. Both events are sent to the webhook
+// and/or pushed to a list of the same account.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type AlertRule struct {
+	Name    string `yaml:"Name"`
+	Acc     string `yaml:"Acc"`
+	Counter string `yaml:"Counter"` // counter value > Above
+	List    string `yaml:"List"`    // list length > Above
+	Lock    string `yaml:"Lock"`    // lock held longer than Above seconds
+	// other active instances of the cluster > Above, see registry.go
+	Duplicates bool   `yaml:"Duplicates"`
+	Above      int64  `yaml:"Above"`
+	For        int    `yaml:"For"`     // seconds condition should hold before firing
+	Webhook    string `yaml:"Webhook"` // URL to POST events to
+	Queue      string `yaml:"Queue"`   // list to push events to
+}
+
+type AlertEvent struct {
+	Rule  string
+	State string // firing, resolved
+	Value int64
+	At    int64
+}
+
+type AlertState struct {
+	Rule    string
+	Value   int64
+	Since   int64 `json:",omitempty"` // when value went above threshold
+	Firing  bool
+	Checked int64
+	Error   string `json:",omitempty"`
+}
+
+const alertInterval = time.Second * 5
+
+var alertMu sync.Mutex
+var alertStates []AlertState
+
+var alertClient = &fasthttp.Client{}
+
+func alertValue(r AlertRule) (int64, error) {
+	switch {
+	case r.Counter != "":
+		return getCard(store.DB(), compID(cd.AtomicPrefix, r.Acc, r.Counter))
+	case r.List != "":
+		m, err := getListMeta(store.DB(), r.Acc, r.List)
+		return m.Tail - m.Head, err
+	case r.Lock != "":
+		if memLockTill(r.Acc, r.Lock) == 0 {
+			return 0, nil
+		}
+		st, err := getStats(store.DB(), r.Acc, statsLock, r.Lock)
+		if err != nil || st == nil {
+			return 0, err
+		}
+		return time.Now().Unix() - st.Modified, nil
+	case r.Duplicates:
+		return int64(duplicateInstances()), nil
+	}
+	return 0, fmt.Errorf("rule should have Counter, List, Lock or Duplicates")
+}
+
+func sendAlert(r AlertRule, e AlertEvent) error {
+	d, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if r.Queue != "" {
+		b := store.DB().NewIndexedBatch()
+		var m cd.ListMeta
+		err = store.Singleton([]byte(r.Acc), func() error {
+			m, err = listPush(b, r.Acc, r.Queue, []json.RawMessage{d}, false, 0)
+			if err != nil {
+				return err
+			}
+			return b.Commit(pebble.NoSync)
+		})
+		if err != nil {
+			return err
+		}
+		store.notifier(r.Acc).NotifyVersion(listWatchKey(r.Queue), m.Version)
+	}
+	if r.Webhook != "" {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(r.Webhook)
+		req.Header.SetMethod("POST")
+		req.Header.SetContentType("application/json")
+		req.SetBody(d)
+		signWebhook(req)
+		err = alertClient.DoTimeout(req, resp, time.Second*5)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode() >= 300 {
+			return fmt.Errorf("webhook returned %v", resp.StatusCode())
+		}
+	}
+	return nil
+}
+
+func checkAlert(r AlertRule, s *AlertState) {
+	now := time.Now().Unix()
+	s.Checked = now
+	v, err := alertValue(r)
+	if err != nil {
+		s.Error = err.Error()
+		return
+	}
+	s.Error = ""
+	s.Value = v
+	var state string
+	switch {
+	case v > r.Above && s.Since == 0:
+		s.Since = now
+		fallthrough
+	case v > r.Above:
+		if !s.Firing && now-s.Since >= int64(r.For) {
+			s.Firing = true
+			state = "firing"
+		}
+	default:
+		s.Since = 0
+		if s.Firing {
+			s.Firing = false
+			state = "resolved"
+		}
+	}
+	if state == "" {
+		return
+	}
+	err = sendAlert(r, AlertEvent{Rule: r.Name, State: state, Value: v, At: now})
+	if err != nil {
+		s.Error = err.Error()
+		log.Printf("alert %v: %v", r.Name, err)
+	}
+}
+
+// AlertLoop evaluates rules until the process exits
+func AlertLoop(rules []AlertRule) {
+	if len(rules) == 0 {
+		return
+	}
+	alertMu.Lock()
+	alertStates = make([]AlertState, len(rules))
+	for i, r := range rules {
+		alertStates[i].Rule = r.Name
+	}
+	alertMu.Unlock()
+	t := time.NewTicker(alertInterval)
+	for range t.C {
+		release, err := store.beginWrite()
+		if err != nil {
+			continue // writes are paused or stopped
+		}
+		for i, r := range rules {
+			alertMu.Lock()
+			s := alertStates[i]
+			alertMu.Unlock()
+			checkAlert(r, &s) // don't hold the lock while sending webhooks
+			alertMu.Lock()
+			alertStates[i] = s
+			alertMu.Unlock()
+		}
+		release()
+	}
+}
+
+func GetAlertsHandler(ctx *fasthttp.RequestCtx) {
+	alertMu.Lock()
+	d, err := json.Marshal(alertStates)
+	alertMu.Unlock()
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,348 @@
+// Rename moves KV value or counter to another key atomically, keeping
+// its version, TTL and lease. Aliases are persistent alternative names of
+// KV keys and counters - reads and writes of the alias go to its target,
+// so clients can move to the new naming scheme one by one.
+// Alias shadows the key with the same name, aliases of aliases are not
+// allowed. Aliases are kept in memory to resolve them without reads.
+//
+// Account|0|Kind|0|Alias - target key
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	aliasKV      = "kv"
+	aliasCounter = "counter"
+)
+
+type aliasMap struct {
+	mu sync.RWMutex
+	m  map[string]string // Account|0|Kind|0|Alias -> target
+}
+
+var aliases = aliasMap{m: map[string]string{}}
+
+func aliasID(acc, kind, alias string) string {
+	return acc + string([]byte{0}) + kind + string([]byte{0}) + alias
+}
+
+func InitAliases() {
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.AliasPrefix},
+		UpperBound: []byte{cd.AliasPrefix + 1},
+	})
+	if err != nil {
+		panic(err)
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		aliases.m[string(iter.Key()[1:])] = string(iter.Value())
+	}
+	err = iter.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// resolveAlias returns target of the alias or the key itself
+func resolveAlias(acc, kind, key string) string {
+	aliases.mu.RLock()
+	defer aliases.mu.RUnlock()
+	if len(aliases.m) == 0 {
+		return key
+	}
+	if t, ok := aliases.m[aliasID(acc, kind, key)]; ok {
+		return t
+	}
+	return key
+}
+
+// aliasPurge drops aliases of the account from memory
+func aliasPurge(acc string) {
+	prefix := acc + string([]byte{0})
+	aliases.mu.Lock()
+	defer aliases.mu.Unlock()
+	for k := range aliases.m {
+		if strings.HasPrefix(k, prefix) {
+			delete(aliases.m, k)
+		}
+	}
+}
+
+// checkAliasChain makes sure alias doesn't point to another alias
+func checkAliasChain(acc, kind, alias, to string) error {
+	aliases.mu.RLock()
+	defer aliases.mu.RUnlock()
+	if _, ok := aliases.m[aliasID(acc, kind, to)]; ok {
+		return fmt.Errorf("%q is an alias itself", to)
+	}
+	prefix := aliasID(acc, kind, "")
+	for k, t := range aliases.m {
+		if t == alias && strings.HasPrefix(k, prefix) {
+			return fmt.Errorf("%q is a target of another alias", alias)
+		}
+	}
+	return nil
+}
+
+func getAliasKind(ctx *fasthttp.RequestCtx) (string, error) {
+	kind := string(ctx.QueryArgs().Peek("kind"))
+	switch kind {
+	case "":
+		return aliasKV, nil
+	case aliasKV, aliasCounter:
+		return kind, nil
+	}
+	return "", fmt.Errorf("kind should be kv or counter")
+}
+
+type Alias struct {
+	Kind   string
+	Alias  string
+	Target string
+}
+
+type AliasList struct {
+	Aliases []Alias
+}
+
+// ListAliasesHandler - GET /db/:acc/alias
+func ListAliasesHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	prefix := acc + string([]byte{0})
+	res := AliasList{Aliases: []Alias{}}
+	aliases.mu.RLock()
+	for k, t := range aliases.m {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		kind, alias, _ := strings.Cut(k[len(prefix):], string([]byte{0}))
+		res.Aliases = append(res.Aliases, Alias{Kind: kind, Alias: alias, Target: t})
+	}
+	aliases.mu.RUnlock()
+	sort.Slice(res.Aliases, func(i, j int) bool {
+		a, b := res.Aliases[i], res.Aliases[j]
+		return a.Kind < b.Kind || (a.Kind == b.Kind && a.Alias < b.Alias)
+	})
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// SetAliasHandler - POST /db/:acc/alias/:id?kind=kv|counter&to= makes :id an alias of ?to=
+func SetAliasHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	kind, err := getAliasKind(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	to := string(ctx.QueryArgs().Peek("to"))
+	if to == "" || to == id || strings.IndexByte(to, 0) >= 0 {
+		ctx.Error("to should be a key other than alias", 400)
+		return
+	}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := checkAliasChain(acc, kind, id, to)
+		if err != nil {
+			return err
+		}
+		err = b.Set(compID(cd.AliasPrefix, acc, kind+string([]byte{0})+id), []byte(to), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		err = commitBatch(ctx, b)
+		if err != nil || isDryRun(ctx) {
+			return err
+		}
+		aliases.mu.Lock()
+		aliases.m[aliasID(acc, kind, id)] = to
+		aliases.mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	d, err := json.Marshal(Alias{Kind: kind, Alias: id, Target: to})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// DeleteAliasHandler - DELETE /db/:acc/alias/:id?kind=
+func DeleteAliasHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	kind, err := getAliasKind(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := b.Delete(compID(cd.AliasPrefix, acc, kind+string([]byte{0})+id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		err = commitBatch(ctx, b)
+		if err != nil || isDryRun(ctx) {
+			return err
+		}
+		aliases.mu.Lock()
+		delete(aliases.m, aliasID(acc, kind, id))
+		aliases.mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+}
+
+type RenameRequest struct {
+	Kind      string // kv (default) or counter
+	From      string
+	To        string
+	Overwrite bool // replace existing value of To
+}
+
+func renameKV(b *pebble.Batch, acc string, req RenameRequest) error {
+	v, err := getKV(b, acc, req.From)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("key %q not found", req.From)
+	}
+	if !req.Overwrite {
+		cur, err := getKV(b, acc, req.To)
+		if err != nil {
+			return err
+		}
+		if cur != nil {
+			return fmt.Errorf("key %q already exists", req.To)
+		}
+	}
+	kv := &KV{Key: req.To, Value: v.Data, Version: v.Version, ContentType: v.Type, Lease: v.Lease}
+	if v.Expires != 0 {
+		kv.TTL = max(v.Expires-time.Now().Unix(), 1)
+	}
+	err = handleKVSet(acc, b, kv)
+	if err != nil {
+		return err
+	}
+	return handleKVSet(acc, b, &KV{Key: req.From, Delete: true})
+}
+
+func renameCounter(b *pebble.Batch, acc string, req RenameRequest) error {
+	from, to := compID(cd.AtomicPrefix, acc, req.From), compID(cd.AtomicPrefix, acc, req.To)
+	v, err := GetInt64(from, b)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("counter %q not found", req.From)
+	}
+	if !req.Overwrite {
+		ok, err := exists(b, to)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return fmt.Errorf("counter %q already exists", req.To)
+		}
+	}
+	err = SetInt64(to, *v, b)
+	if err != nil {
+		return err
+	}
+	err = touchStats(b, acc, statsCounter, req.To)
+	if err != nil {
+		return err
+	}
+	rcache.invalidate(from)
+	err = b.Delete(from, pebble.NoSync)
+	if err != nil {
+		return err
+	}
+	return deleteStats(b, acc, statsCounter, req.From)
+}
+
+// RenameHandler - POST /db/:acc/rename moves the value to another key atomically
+func RenameHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req RenameRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if req.From == "" || req.To == "" || req.From == req.To || bytes.IndexByte([]byte(req.From+req.To), 0) >= 0 {
+		ctx.Error("From and To should be different non-empty keys without 0 characters", 400)
+		return
+	}
+	rename := renameKV
+	switch req.Kind {
+	case "", aliasKV:
+	case aliasCounter:
+		rename = renameCounter
+	default:
+		ctx.Error("Kind should be kv or counter", 400)
+		return
+	}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := rename(b, acc, req)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+}
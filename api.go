@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"clouddragon/cd"
 	"fmt"
+	"hash/crc32"
 	"log"
 	"time"
 
@@ -23,6 +25,21 @@ type KV struct {
 	Value   json.RawMessage
 	Delete  bool
 	Version int64
+	TTL     int64  `json:",omitempty"` // seconds till value expires, 0 - never
+	Lease   string `json:",omitempty"` // value is deleted when lease expires
+	Flags   uint64 `json:",omitempty"` // opaque to the server, see consul.go
+
+	IfVersion *int64          `json:",omitempty"` // write only if current version matches, 0 - key doesn't exist
+	IfValue   json.RawMessage `json:",omitempty"` // write only if current value is exactly the same
+	Patch     bool            `json:",omitempty"` // Value is RFC 7396 merge patch of the current value
+	Append    bool            `json:",omitempty"` // Value is appended to the current value
+
+	ContentType string `json:",omitempty"`
+
+	// key stats, returned by KVGet
+	Created  int64 `json:",omitempty"`
+	Modified int64 `json:",omitempty"`
+	Writes   int64 `json:",omitempty"`
 }
 
 type EnqueueOp struct {
@@ -32,17 +49,34 @@ type EnqueueOp struct {
 }
 
 type Request struct {
-	LockWait int
-	LockDur  int
-	LockID   string
+	LockWait  int
+	LockDur   int
+	LockID    string
+	LockOwner json.RawMessage `json:",omitempty"` // holder metadata shown by lock inspection
+	// client ID for deadlock detection, see deadlock.go
+	LockOwnerID string `json:",omitempty"`
 
 	UnlockID string
 	Unlock   int64 // if both lockid & unlockid = extend the lock
 
-	IdempotencyIDs []string // TODO: configure Idempotency Records  TTL (merge function)
+	LockPersist bool `json:",omitempty"` // write extensions of the lock to disk, so they survive restart
+	// damping of re-acquisition storms, milliseconds: lock is held at least
+	// LockMinHold after it's acquired even if released earlier and can't be
+	// acquired again within LockCooldown after release or expiration
+	LockMinHold  int `json:",omitempty"`
+	LockCooldown int `json:",omitempty"`
+	// waiters of higher LockPriority get the lock first, with LockPreempt
+	// (ms) holder of lower priority is force-released after that grace
+	// period, see preempt.go
+	LockPriority int `json:",omitempty"`
+	LockPreempt  int `json:",omitempty"`
+
+	IdempotencyIDs []string // remembered for IdempotencyTTL, see idempotency.go
 	Atomic         []AtomicOp
 	KVSet          []*KV
 	KVGet          []string
+
+	DryRun bool // evaluate request without persisting, not supported with locks
 }
 
 type AtomicRes struct {
@@ -54,7 +88,8 @@ type AtomicRes struct {
 
 // Expectation is that all API
 type Response struct {
-	Lock int64 `json:"l,omitempty"` // id to unlock the lock. 0 - lock failed
+	Lock  int64 `json:"l,omitempty"` // id to unlock the lock. 0 - lock failed
+	Token int64 `json:"f,omitempty"` // fencing token of acquired lock
 	// LockRepair bool  `json:"rep,omitempty"` // previous lock timed out
 	// during repair - any actions are not performed - to allow app to handle repair.
 	// if repair is not needed - app can simply resend requires with
@@ -64,15 +99,14 @@ type Response struct {
 }
 
 func handleIdempotency(acc string, b *pebble.Batch, id string) error {
-	_, closer, err := b.Get(compID(cd.IdempotencyPrefix, acc, id))
-	if err != nil && err == pebble.ErrNotFound {
-		return nil
-	}
+	exp, err := getIdempotency(b, acc, id)
 	if err != nil {
 		return err
 	}
-	closer.Close()
-	return fmt.Errorf("duplicate request: " + id)
+	if exp > time.Now().Unix() {
+		return fmt.Errorf("duplicate request: " + id)
+	}
+	return putIdempotency(b, acc, id, exp) // remember the request to reject its retries
 }
 
 func handleAtomic(acc string, b *pebble.Batch, op AtomicOp, res *Response) error {
@@ -92,6 +126,14 @@ func handleAtomic(acc string, b *pebble.Batch, op AtomicOp, res *Response) error
 			Old: *val - op.Add,
 			New: *val,
 		})
+		err = touchStats(b, acc, statsCounter, op.Key)
+		if err != nil {
+			return err
+		}
+		err = sampleCounter(b, acc, op.Key, *val)
+		if err != nil {
+			return err
+		}
 		return SetInt64(id, *val, b)
 	}
 	if op.Set != 0 {
@@ -110,18 +152,62 @@ func handleAtomic(acc string, b *pebble.Batch, op AtomicOp, res *Response) error
 			PreconditionFailed: true,
 		})
 		val = &op.Set
+		err = touchStats(b, acc, statsCounter, op.Key)
+		if err != nil {
+			return err
+		}
+		err = sampleCounter(b, acc, op.Key, *val)
+		if err != nil {
+			return err
+		}
 		return SetInt64(id, *val, b)
 	}
 	return fmt.Errorf("empty atomic request")
 }
 
 func handleKVSet(acc string, b *pebble.Batch, v *KV) error {
+	rcache.invalidate(compID(cd.KVPrefix, acc, v.Key))
+	err := indexGeo(acc, b, v.Key, v.Value, v.Delete)
+	if err != nil {
+		return err
+	}
+	err = indexSearch(acc, b, v.Key, v.Value, v.Delete)
+	if err != nil {
+		return err
+	}
+	var expires int64
+	if v.TTL > 0 && !v.Delete {
+		expires = time.Now().Unix() + v.TTL
+	}
+	err = updateTTL(b, acc, v.Key, expires)
+	if err != nil {
+		return err
+	}
 	if v.Delete {
+		err = deleteStats(b, acc, statsKV, v.Key)
+		if err != nil {
+			return err
+		}
 		return b.Delete(compID(cd.KVPrefix, acc, v.Key), pebble.NoSync)
 	}
+	if v.Lease != "" {
+		err = attachLease(b, acc, v.Lease, leaseKeys, v.Key)
+		if err != nil {
+			return err
+		}
+	}
+	err = touchStats(b, acc, statsKV, v.Key)
+	if err != nil {
+		return err
+	}
 	dv := cd.KV{
 		Data:    v.Value,
 		Version: v.Version, // TODO: rename to sequence
+		Sum:     crc32.Checksum(v.Value, crcTable),
+		Expires: expires,
+		Type:    v.ContentType,
+		Lease:   v.Lease,
+		Flags:   v.Flags,
 	}
 	d, err := dv.MarshalMsg(nil)
 	if err != nil {
@@ -131,31 +217,114 @@ func handleKVSet(acc string, b *pebble.Batch, v *KV) error {
 	return b.Set(compID(cd.KVPrefix, acc, v.Key), d, pebble.NoSync)
 }
 
-func handleKVGet(acc string, b *pebble.Batch, key string, res *Response) error {
-	d, closer, err := b.Get(compID(cd.KVPrefix, acc, key))
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checkKV verifies checksum of the record if VerifyChecksums is enabled
+func checkKV(v *cd.KV) error {
+	if config.VerifyChecksums && !v.Cold && v.Sum != 0 && v.Sum != crc32.Checksum(v.Data, crcTable) {
+		return cd.ErrChecksum
+	}
+	return nil
+}
+
+func getKV(r pebble.Reader, acc, key string) (*cd.KV, error) {
+	d, closer, err := r.Get(compID(cd.KVPrefix, acc, key))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
 	if err != nil {
-		if err != pebble.ErrNotFound {
-			return err
-		}
-		res.KVGet = append(res.KVGet, KV{
-			Key:     key,
-			Version: 0, // 0 version
-		})
+		return nil, err
 	}
 	defer closer.Close()
 	var v cd.KV
 	_, err = v.UnmarshalMsg(d)
+	if err != nil {
+		return nil, err
+	}
+	err = checkKV(&v)
+	if err != nil {
+		return nil, err
+	}
+	if v.Expires != 0 && v.Expires <= time.Now().Unix() {
+		return nil, nil // expired, but not swept yet
+	}
+	v.Data = append([]byte{}, v.Data...) // msgp references closer's memory
+	err = loadCold(&v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func handleKVGet(acc string, b *pebble.Batch, key string, res *Response) error {
+	target := resolveAlias(acc, aliasKV, key) // response keeps the key as requested
+	v, err := getKV(b, acc, target)
 	if err != nil {
 		return err
 	}
-	res.KVGet = append(res.KVGet, KV{
+	if v == nil {
+		res.KVGet = append(res.KVGet, KV{
+			Key:     key,
+			Version: 0, // 0 version
+		})
+		return nil
+	}
+	kv := KV{
 		Key:     key,
 		Value:   v.Data,
 		Version: v.Version,
-	})
+
+		ContentType: v.Type,
+		Lease:       v.Lease,
+		Flags:       v.Flags,
+	}
+	if v.Expires != 0 {
+		kv.TTL = v.Expires - time.Now().Unix()
+	}
+	if !config.KeyStats {
+		res.KVGet = append(res.KVGet, kv)
+		return nil
+	}
+	st, err := getStats(b, acc, statsKV, target)
+	if err != nil {
+		return err
+	}
+	if st != nil {
+		kv.Created, kv.Modified, kv.Writes = st.Created, st.Modified, st.Writes
+	}
+	res.KVGet = append(res.KVGet, kv)
 	return nil
 }
 
+// putLockRecord issues fencing token of acquired fast lock and writes the
+// lock record with the batch, call inside Store.Singleton of the account
+func putLockRecord(acc string, b *pebble.Batch, req Request, handle int64) (int64, error) {
+	token, err := nextFenceToken(b, acc, req.LockID)
+	if err != nil {
+		return 0, err
+	}
+	c := cd.Lock{
+		Handle: handle,
+		Till:   ttlNow().Add(time.Second * time.Duration(req.LockDur)).Unix(),
+		Token:  token,
+		Owner:  req.LockOwner,
+	}
+	d, err := c.MarshalMsg(nil)
+	if err != nil {
+		return 0, fmt.Errorf(err.Error())
+	}
+	// lock is held, so nobody else updates its stats
+	err = touchStats(b, acc, statsLock, req.LockID)
+	if err != nil {
+		return 0, err
+	}
+	err = b.Set(compID(cd.LocksPrefix, acc, req.LockID), d, pebble.NoSync)
+	if err != nil {
+		return 0, fmt.Errorf(err.Error())
+	}
+	return token, nil
+}
+
 func handle(acc string, req Request) (Response, error) {
 	var res Response
 
@@ -164,13 +333,26 @@ func handle(acc string, req Request) (Response, error) {
 		len(req.KVGet) == 0 &&
 		len(req.KVSet) == 0
 
-	b := store.db.NewIndexedBatch() // TODO: maybe normal batch will work too
+	if req.DryRun && (req.LockID != "" || req.UnlockID != "") {
+		return res, fmt.Errorf("dry run is not supported for lock operations")
+	}
+	err := checkLimits(acc, req)
+	if err != nil {
+		return res, err
+	}
+	b := store.DB().NewIndexedBatch() // TODO: maybe normal batch will work too
 	if req.UnlockID != "" || req.LockID != "" {
 		if req.UnlockID == req.LockID { // extend lock
 			err := memExtendLock(acc, req.LockID, req.Unlock, req.LockDur)
 			if err != nil {
 				return res, err
 			}
+			if req.LockPersist || config.PersistLocks {
+				err = persistExtension(acc, req.LockID, req.Unlock, req.LockDur)
+				if err != nil {
+					return res, err
+				}
+			}
 		} else {
 			if !lockOnly && req.UnlockID != "" { // unlock, but we should unlock only after successful write, so extend for now
 				err := memExtendLock(acc, req.UnlockID, req.Unlock, 30)
@@ -183,29 +365,33 @@ func handle(acc string, req Request) (Response, error) {
 				}
 			}
 			if req.LockID != "" { // lock
-				newHandle, err := memLock(acc, req.LockID, req.LockDur, req.LockWait)
+				newHandle, err := memLock(acc, req.LockID, req.LockDur, req.LockWait, req.LockOwner, req.LockOwnerID, lockDamping{
+					minHold:  time.Millisecond * time.Duration(req.LockMinHold),
+					cooldown: time.Millisecond * time.Duration(req.LockCooldown),
+				}, lockPreemption{
+					priority: req.LockPriority,
+					grace:    time.Millisecond * time.Duration(req.LockPreempt),
+				})
 				if err != nil {
-					return res, fmt.Errorf(err.Error())
+					return res, err
 				}
 				res.Lock = newHandle
-				c := cd.Lock{
-					Handle: newHandle,
-					Till:   time.Now().Add(time.Second * time.Duration(req.LockDur)).Unix(),
-				}
-				d, err := c.MarshalMsg(nil)
-				if err != nil {
-					return res, fmt.Errorf(err.Error())
+				if lockOnly { // otherwise lock is recorded together with the writes
+					err = store.Singleton([]byte(acc), func() error {
+						token, err := putLockRecord(acc, b, req, newHandle)
+						if err != nil {
+							return err
+						}
+						res.Token = token
+						return b.Commit(pebble.NoSync)
+					})
 				}
-				if lockOnly {
-					err = store.db.Set(compID(cd.LocksPrefix, acc, req.LockID), d, pebble.Sync)
-					if err != nil {
-						return res, fmt.Errorf(err.Error())
-					}
-				} else {
-					err = b.Set(compID(cd.LocksPrefix, acc, req.LockID), d, pebble.NoSync)
-					if err != nil {
-						return res, fmt.Errorf(err.Error())
+				if err != nil { // locked, but the lock can't be recorded - unlock
+					if err := memUnlock(acc, req.LockID, newHandle); err != nil {
+						log.Print("failed to unlock after failed lock record")
 					}
+					res.Lock, res.Token = 0, 0
+					return res, err
 				}
 			}
 		}
@@ -216,6 +402,13 @@ func handle(acc string, req Request) (Response, error) {
 		// all updates for single key are performed sequentially, but flushed to
 		// disk together. See store.Update for more info
 		err := store.Singleton(ukey, func() error {
+			if req.LockID != "" && req.LockID != req.UnlockID {
+				token, err := putLockRecord(acc, b, req, res.Lock)
+				if err != nil {
+					return err
+				}
+				res.Token = token
+			}
 			for _, v := range req.IdempotencyIDs {
 				err := handleIdempotency(acc, b, v)
 				if err != nil {
@@ -223,6 +416,7 @@ func handle(acc string, req Request) (Response, error) {
 				}
 			}
 			for _, v := range req.Atomic {
+				v.Key = resolveAlias(acc, aliasCounter, v.Key)
 				err := handleAtomic(acc, b, v, &res)
 				if err != nil {
 					return err
@@ -245,6 +439,59 @@ func handle(acc string, req Request) (Response, error) {
 					v = *ver
 				}
 				for _, val := range req.KVSet {
+					val.Key = resolveAlias(acc, aliasKV, val.Key)
+					if val.IfVersion != nil {
+						cur, err := getKV(b, acc, val.Key)
+						if err != nil {
+							return err
+						}
+						if (cur == nil && *val.IfVersion != 0) || (cur != nil && cur.Version != *val.IfVersion) {
+							return cd.ErrVersionMismatch
+						}
+					}
+					if val.IfValue != nil {
+						cur, err := getKV(b, acc, val.Key)
+						if err != nil {
+							return err
+						}
+						if cur == nil || !bytes.Equal(cur.Data, val.IfValue) {
+							return cd.ErrValueMismatch
+						}
+					}
+					if (val.Patch || val.Append) && !val.Delete {
+						cur, err := getKV(b, acc, val.Key)
+						if err != nil {
+							return err
+						}
+						var data []byte
+						if cur != nil {
+							data = cur.Data
+							if cur.Type != "" { // keep type of updated value
+								val.ContentType = cur.Type
+							}
+							if val.TTL == 0 && cur.Expires != 0 { // keep expiration of updated value
+								val.TTL = max(cur.Expires-time.Now().Unix(), 1)
+							}
+							if val.Lease == "" {
+								val.Lease = cur.Lease
+							}
+							if val.Flags == 0 {
+								val.Flags = cur.Flags
+							}
+						}
+						if val.Patch {
+							val.Value, err = mergePatch(data, val.Value)
+							if err != nil {
+								return err
+							}
+						} else {
+							val.Value = append(data, val.Value...)
+						}
+						err = checkValueSize(accountLimits(acc), val.Value)
+						if err != nil {
+							return err
+						}
+					}
 					val.Version = v
 					v++
 					err = handleKVSet(acc, b, val)
@@ -257,6 +504,9 @@ func handle(acc string, req Request) (Response, error) {
 					panic(err)
 				}
 			}
+			if req.DryRun {
+				return b.Close()
+			}
 			return b.Commit(pebble.NoSync)
 		})
 		if err != nil {
@@ -266,7 +516,7 @@ func handle(acc string, req Request) (Response, error) {
 					log.Print("failed to unlock after lock + failed write")
 				}
 			}
-			return res, fmt.Errorf("err updating: " + err.Error())
+			return res, fmt.Errorf("err updating: %w", err)
 		}
 	}
 	if req.LockID != req.UnlockID && req.UnlockID != "" { // unlock
@@ -275,12 +525,15 @@ func handle(acc string, req Request) (Response, error) {
 			log.Print("failed to unlock after successful write")
 		}
 		if lockOnly {
-			err = store.db.Delete(compID(cd.LocksPrefix, acc, req.UnlockID), pebble.Sync)
+			err = store.DB().Delete(compID(cd.LocksPrefix, acc, req.UnlockID), pebble.Sync)
 			if err != nil {
 				return res, fmt.Errorf(err.Error())
 			}
 		}
 	}
+	if req.DryRun {
+		return res, nil
+	}
 	for _, val := range req.KVSet {
 		store.notifier(acc).NotifyVersion(val.Key, val.Version)
 	}
@@ -302,9 +555,11 @@ func RequestHandler(ctx *fasthttp.RequestCtx) {
 		ctx.Error(err.Error(), 400)
 		return
 	}
+	req.DryRun = req.DryRun || isDryRun(ctx)
+	req.LockPersist = req.LockPersist || ctx.QueryArgs().GetBool("persist")
 	res, err := handle(acc, req)
 	if err != nil {
-		ctx.Error(err.Error(), 400)
+		retryError(ctx, acc, req.LockID, err)
 		return
 	}
 
@@ -354,7 +609,7 @@ func watcher(acc string, key string, ver int64) (KV, error) {
 	n := store.notifier(acc)
 	var kv *KV
 	err := store.Singleton([]byte(acc), func() error {
-		d, closer, err := store.db.Get(compID(cd.KVPrefix, acc, key))
+		d, closer, err := store.DB().Get(compID(cd.KVPrefix, acc, key))
 		if err != nil && err != pebble.ErrNotFound {
 			return err
 		}
@@ -365,6 +620,14 @@ func watcher(acc string, key string, ver int64) (KV, error) {
 			if err != nil {
 				return err
 			}
+			err = checkKV(&v)
+			if err != nil {
+				return err
+			}
+			err = loadCold(&v)
+			if err != nil {
+				return err
+			}
 			if v.Version != ver {
 				kv = &KV{
 					Key:     key,
@@ -387,7 +650,7 @@ func watcher(acc string, key string, ver int64) (KV, error) {
 	if retV == -1 { // timeout
 		return KV{}, fmt.Errorf("no change")
 	}
-	d, closer, err := store.db.Get(compID(cd.KVPrefix, acc, key))
+	d, closer, err := store.DB().Get(compID(cd.KVPrefix, acc, key))
 	if err != nil {
 		return KV{}, err
 	}
@@ -398,6 +661,14 @@ func watcher(acc string, key string, ver int64) (KV, error) {
 	if err != nil {
 		return KV{}, err
 	}
+	err = checkKV(&v)
+	if err != nil {
+		return KV{}, err
+	}
+	err = loadCold(&v)
+	if err != nil {
+		return KV{}, err
+	}
 	return KV{
 		Key:     key,
 		Value:   v.Data,
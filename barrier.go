@@ -0,0 +1,259 @@
+// Barriers coordinate phases of batch jobs - each of ?count= participants
+// arrives at the barrier and waits until all of them arrive, then all are
+// released at once and barrier is reset for the next phase.
+// Participant that gives up waiting after ?wait= seconds is withdrawn,
+// so it can retry later. Named participants (?participant=) are counted
+// once per phase, so retries of the same worker are safe.
+// Barriers are kept in memory only and are lost on restart.
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const maxBarrierCount = 10000
+
+type barrier struct {
+	count        int
+	arrived      int
+	participants map[string]int // name -> waiting requests
+	released     bool
+	aborted      bool
+}
+
+type barrierMutex struct {
+	c *sync.Cond
+	l sync.Mutex
+	m map[string]*barrier
+}
+
+var barriers = func() []*barrierMutex {
+	res := make([]*barrierMutex, mCount)
+	for i := range res {
+		bm := &barrierMutex{m: map[string]*barrier{}}
+		bm.c = sync.NewCond(&bm.l)
+		res[i] = bm
+		go bm.wakeLoop()
+	}
+	return res
+}()
+
+func chooseBarrier(id string) *barrierMutex {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return barriers[h.Sum64()%mCount]
+}
+
+// wakeLoop wakes up waiters to handle their timeouts
+func (bm *barrierMutex) wakeLoop() {
+	for range time.Tick(time.Second) {
+		bm.l.Lock()
+		bm.c.Broadcast()
+		bm.l.Unlock()
+	}
+}
+
+type BarrierResponse struct {
+	ID       string
+	Count    int
+	Arrived  int
+	Released bool `json:",omitempty"` // all participants arrived
+}
+
+func (b *barrier) response() BarrierResponse {
+	return BarrierResponse{Count: b.count, Arrived: b.arrived, Released: b.released}
+}
+
+// withdraw removes participant that stopped waiting, barrier is dropped when nobody waits
+func (bm *barrierMutex) withdraw(key, name string, b *barrier) {
+	if name != "" {
+		b.participants[name]--
+		if b.participants[name] > 0 { // another request of the same participant is still waiting
+			return
+		}
+		delete(b.participants, name)
+	}
+	b.arrived--
+	if b.arrived == 0 && bm.m[key] == b {
+		delete(bm.m, key)
+	}
+}
+
+// Arrive waits till count participants arrive or wait seconds pass
+func (bm *barrierMutex) Arrive(key, name string, count, wait int) (BarrierResponse, error) {
+	start := time.Now()
+	bm.l.Lock()
+	defer bm.l.Unlock()
+	b := bm.m[key]
+	if b == nil {
+		b = &barrier{count: count, participants: map[string]int{}}
+		bm.m[key] = b
+	}
+	if b.count != count {
+		return b.response(), fmt.Errorf("barrier is waiting for %v participants", b.count)
+	}
+	if name == "" || b.participants[name] == 0 {
+		b.arrived++
+	}
+	if name != "" {
+		b.participants[name]++
+	}
+	if b.arrived >= b.count { // last one releases everybody
+		b.released = true
+		delete(bm.m, key) // next arrivals start the next phase
+		bm.c.Broadcast()
+		return b.response(), nil
+	}
+	for !b.released && !b.aborted {
+		if time.Since(start) >= time.Duration(wait)*time.Second {
+			res := b.response()
+			bm.withdraw(key, name, b)
+			return res, errBarrierTimeout
+		}
+		bm.c.Wait()
+	}
+	if b.aborted {
+		return b.response(), errBarrierAborted
+	}
+	return b.response(), nil
+}
+
+var (
+	errBarrierTimeout = fmt.Errorf("barrier timeout")
+	errBarrierAborted = fmt.Errorf("barrier aborted")
+)
+
+// Reset releases waiters of the barrier with an error
+func (bm *barrierMutex) Reset(key string) int {
+	bm.l.Lock()
+	defer bm.l.Unlock()
+	b := bm.m[key]
+	if b == nil {
+		return 0
+	}
+	b.aborted = true
+	delete(bm.m, key)
+	bm.c.Broadcast()
+	return b.arrived
+}
+
+func (bm *barrierMutex) info(key string) BarrierResponse {
+	bm.l.Lock()
+	defer bm.l.Unlock()
+	b := bm.m[key]
+	if b == nil {
+		return BarrierResponse{}
+	}
+	return b.response()
+}
+
+// barrierPurge aborts all barriers of the account, returns number of barriers aborted
+func barrierPurge(acc string) int {
+	prefix := acc + string([]byte{0})
+	n := 0
+	for _, bm := range barriers {
+		bm.l.Lock()
+		for k, b := range bm.m {
+			if strings.HasPrefix(k, prefix) {
+				b.aborted = true
+				delete(bm.m, k)
+				n++
+			}
+		}
+		bm.c.Broadcast()
+		bm.l.Unlock()
+	}
+	return n
+}
+
+func writeBarrierResponse(ctx *fasthttp.RequestCtx, res BarrierResponse) {
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func GetBarrierHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	cid := acc + string([]byte{0}) + id
+	res := chooseBarrier(cid).info(cid)
+	res.ID = id
+	writeBarrierResponse(ctx, res)
+}
+
+// ArriveBarrierHandler arrives at the barrier of ?count= participants and waits
+// up to ?wait= seconds (30 by default) for the rest of them. Responds with 408 on timeout.
+func ArriveBarrierHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	count := ctx.QueryArgs().GetUintOrZero("count")
+	if count <= 0 || count > maxBarrierCount {
+		ctx.Error(fmt.Sprintf("count should be from 1 to %v", maxBarrierCount), 400)
+		return
+	}
+	wait := 30
+	if ctx.QueryArgs().Has("wait") {
+		wait = ctx.QueryArgs().GetUintOrZero("wait")
+	}
+	if wait < 0 || wait > 60 {
+		ctx.Error("wait should be up to 60 seconds", 400)
+		return
+	}
+	cid := acc + string([]byte{0}) + id
+	res, err := chooseBarrier(cid).Arrive(cid, string(ctx.QueryArgs().Peek("participant")), count, wait)
+	res.ID = id
+	switch err {
+	case nil:
+		writeBarrierResponse(ctx, res)
+	case errBarrierTimeout:
+		writeBarrierResponse(ctx, res)
+		ctx.SetStatusCode(408)
+	case errBarrierAborted:
+		ctx.Error(err.Error(), 409)
+	default:
+		ctx.Error(err.Error(), 400)
+	}
+}
+
+// ResetBarrierHandler - DELETE /db/:acc/barrier/:id aborts waiting participants with 409
+func ResetBarrierHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	cid := acc + string([]byte{0}) + id
+	n := chooseBarrier(cid).Reset(cid)
+	writeBarrierResponse(ctx, BarrierResponse{ID: id, Arrived: n})
+}
@@ -0,0 +1,338 @@
+// Read cache keeps recently read KV values and counters in memory, so
+// read-heavy clients (dashboards polling the same keys) don't touch pebble.
+// Disabled by default, enabled with CacheSize in config.
+//
+// Cache is never stale - write path marks keys it changes, and when
+// Store.Singleton of the account returns (batch is committed) marked keys
+// are dropped and their generations bumped, together with generation of
+// the account. Read only fills the cache if no generation changed while it
+// was reading, and cached entry is only returned while generation of its
+// key is the same, so value read before concurrent write can't be served
+// after it. Generations are sharded by hash, so collisions only cause
+// extra misses.
+//
+// Misses are cached too for NegativeCacheTTL milliseconds. Negative entry
+// is dropped on any write to the account, not only to the key, so it's
+// valid for all primitives, even ones written without invalidation.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	cacheGens     = 4096
+	cacheOverhead = 64 // approximate memory used by entry besides key and value
+)
+
+type cacheEntry struct {
+	key     string
+	kv      *cd.KV // nil for counters
+	counter int64
+	size    int64
+	missing bool   // key doesn't exist
+	token   uint64 // of negative entry
+	keyGen  uint64 // generation of the key entry was read at
+	till    int64  // unix nanoseconds negative entry expires at
+}
+
+type readCache struct {
+	mu     sync.Mutex
+	max    int64 // bytes, 0 - disabled
+	negTTL time.Duration
+	size   int64
+	items  map[string]*list.Element
+	lru    *list.List
+	keyGen [cacheGens]uint64   // by hash of the key
+	accGen [cacheGens]uint64   // by hash of the account
+	dirty  map[string][]string // account -> keys written by uncommitted batches
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+var rcache readCache
+
+type CacheStats struct {
+	MaxSize   int64
+	Size      int64
+	Items     int
+	Hits      int64
+	Misses    int64
+	HitRate   float64
+	Evictions int64
+}
+
+func cacheHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64() % cacheGens
+}
+
+// resize sets max size of the cache in bytes dropping cached values, 0 disables the cache
+func (c *readCache) resize(max int64, negTTL time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.max = max
+	c.negTTL = negTTL
+	c.size = 0
+	c.items = map[string]*list.Element{}
+	c.lru = list.New()
+	c.dirty = map[string][]string{}
+}
+
+// reset drops all cached values, for writes that bypass the write path (purge)
+func (c *readCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = 0
+	c.items = map[string]*list.Element{}
+	c.lru = list.New()
+	for i := range c.accGen {
+		c.accGen[i]++
+	}
+}
+
+// token should be taken before reading the value from DB to fill the cache with it
+func (c *readCache) token(acc string, key []byte) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keyGen[cacheHash(key)] + c.accGen[cacheHash([]byte(acc))]
+}
+
+// invalidate marks the key as written, called by the write path before
+// the batch is committed. Cached value is dropped by written.
+func (c *readCache) invalidate(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max == 0 {
+		return
+	}
+	acc := cacheKeyAcc(key)
+	c.dirty[acc] = append(c.dirty[acc], string(key))
+}
+
+// written is called after the account was updated, drops values of the
+// keys written by its batch
+func (c *readCache) written(acc []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max == 0 {
+		return
+	}
+	c.accGen[cacheHash(acc)]++
+	for _, key := range c.dirty[string(acc)] {
+		c.keyGen[cacheHash([]byte(key))]++
+		if el, ok := c.items[key]; ok {
+			c.remove(el)
+		}
+	}
+	delete(c.dirty, string(acc))
+}
+
+// cacheKeyAcc returns account of the key built by compID
+func cacheKeyAcc(key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
+	i := bytes.IndexByte(key[1:], 0)
+	if i < 0 {
+		return ""
+	}
+	return string(key[1 : 1+i])
+}
+
+func (c *readCache) remove(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.items, e.key)
+	c.size -= e.size
+}
+
+func (c *readCache) get(acc string, key []byte) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max == 0 {
+		return nil, false
+	}
+	el, ok := c.items[string(key)]
+	if ok {
+		e := el.Value.(*cacheEntry)
+		if e.missing && (e.till <= time.Now().UnixNano() || c.keyGen[cacheHash(key)]+c.accGen[cacheHash([]byte(acc))] != e.token) ||
+			c.keyGen[cacheHash(key)] != e.keyGen {
+			c.remove(el)
+			ok = false
+		}
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+// put caches the value if nothing was written since token was taken
+func (c *readCache) put(acc string, token uint64, e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max == 0 || e.size > c.max/8 { // don't let single value flush the cache
+		return
+	}
+	key := []byte(e.key)
+	if c.keyGen[cacheHash(key)]+c.accGen[cacheHash([]byte(acc))] != token {
+		return
+	}
+	if el, ok := c.items[e.key]; ok {
+		c.remove(el)
+	}
+	e.keyGen = c.keyGen[cacheHash(key)]
+	c.items[e.key] = c.lru.PushFront(e)
+	c.size += e.size
+	for c.size > c.max {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// putMissing caches that the key doesn't exist
+func (c *readCache) putMissing(acc string, token uint64, key []byte) {
+	c.mu.Lock()
+	negTTL := c.negTTL
+	c.mu.Unlock()
+	if negTTL <= 0 {
+		return
+	}
+	c.put(acc, token, &cacheEntry{
+		key:     string(key),
+		size:    int64(len(key)) + cacheOverhead,
+		missing: true,
+		token:   token,
+		till:    time.Now().Add(negTTL).UnixNano(),
+	})
+}
+
+// isMissing checks negative cache, key might exist even if it returns false
+func (c *readCache) isMissing(acc string, key []byte) bool {
+	e, ok := c.get(acc, key)
+	return ok && e.missing
+}
+
+func (c *readCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{
+		MaxSize:   c.max,
+		Size:      c.size,
+		Items:     len(c.items),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+	if c.hits+c.misses > 0 {
+		s.HitRate = float64(c.hits) / float64(c.hits+c.misses)
+	}
+	return s
+}
+
+// cachedKV reads committed KV value through the cache, returned value should not be modified
+func cachedKV(acc, id string) (*cd.KV, error) {
+	id = resolveAlias(acc, aliasKV, id)
+	key := compID(cd.KVPrefix, acc, id)
+	if e, ok := rcache.get(acc, key); ok {
+		if e.missing {
+			return nil, nil
+		}
+		if e.kv.Expires != 0 && e.kv.Expires <= time.Now().Unix() {
+			return nil, nil
+		}
+		v := *e.kv
+		return &v, nil
+	}
+	token := rcache.token(acc, key)
+	v, err := getKV(store.DB(), acc, id)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		rcache.putMissing(acc, token, key)
+		return nil, nil
+	}
+	c := *v
+	rcache.put(acc, token, &cacheEntry{
+		key:  string(key),
+		kv:   &c,
+		size: int64(len(key)+len(v.Data)+len(v.Type)+len(v.Lease)) + cacheOverhead,
+	})
+	return v, nil
+}
+
+// cachedCounter reads committed counter value through the cache
+func cachedCounter(acc, id string) (int64, error) {
+	id = resolveAlias(acc, aliasCounter, id)
+	key := compID(cd.AtomicPrefix, acc, id)
+	if e, ok := rcache.get(acc, key); ok && !e.missing {
+		return e.counter, nil
+	}
+	token := rcache.token(acc, key)
+	v, err := getCard(store.DB(), key)
+	if err != nil {
+		return 0, err
+	}
+	rcache.put(acc, token, &cacheEntry{
+		key:     string(key),
+		counter: v,
+		size:    int64(len(key)) + cacheOverhead,
+	})
+	return v, nil
+}
+
+type CounterResponse struct {
+	Key   string
+	Value int64
+}
+
+// GetCounterHandler - GET /db/:acc/counter/:id returns value of atomic counter
+func GetCounterHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	v, err := cachedCounter(acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(CounterResponse{Key: id, Value: v})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetCacheStatsHandler - GET /admin/cache
+func GetCacheStatsHandler(ctx *fasthttp.RequestCtx) {
+	d, err := json.Marshal(rcache.stats())
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -3,25 +3,306 @@ package cd
 import "errors"
 
 const (
-	AtomicPrefix      = 1 // storage for atomic counters
-	VerSequencePrefix = 3 // store increasing version numbers for KV
-	LocksPrefix       = 4 // store lock durations to restore in case of reboot
-	IdempotencyPrefix = 5 // store idempotency keys to deduplicate requests
-	KVPrefix          = 6 // store kv values
+	AtomicPrefix      = 1  // storage for atomic counters
+	VerSequencePrefix = 3  // store increasing version numbers for KV
+	LocksPrefix       = 4  // store lock durations to restore in case of reboot
+	IdempotencyPrefix = 5  // store idempotency keys to deduplicate requests
+	KVPrefix          = 6  // store kv values
+	HLCPrefix         = 7  // store high-water mark of hybrid logical clock
+	TSOPrefix         = 8  // store reserved range of timestamp oracle per account
+	VClockPrefix      = 9  // store vector clocks
+	CheckoutPrefix    = 10 // store long-lived checkouts of records
+	ClaimPrefix       = 11 // store claims of kv items processed as jobs
+	PartitionPrefix   = 12 // store partition group configs
+	QuotaPrefix       = 13 // store hierarchical quota counters
+	HoldPrefix        = 14 // store reservations of atomic counters
+	HistogramPrefix   = 15 // store histograms of observations
+	GaugePrefix       = 16 // store gauges
+	SetPrefix         = 17 // store set members and cardinality
+	ZSetPrefix        = 18 // store sorted set members, scores and cardinality
+	ListPrefix        = 19 // store list elements and list metadata
+	HashPrefix        = 20 // store hash fields and field count
+	GeoPrefix         = 21 // store geohash index of kv values
+	SearchPrefix      = 22 // store inverted index of kv keys and values
+	SeriesPrefix      = 23 // store time-series points and retention
+	StatsPrefix       = 24 // store per-key created/modified time and write count
+	RatePrefix        = 25 // store per-minute samples of atomic counters
+	TTLPrefix         = 26 // store expiration index of kv values
+	ExportPrefix      = 27 // store scheduled exports of account data
+	EpochPrefix       = 28 // store instance epoch for split-brain protection
+	PLockPrefix       = 29 // store persistent locks with TTL
+	FenceTokenPrefix  = 30 // store last fencing token issued per fast lock
+	RebuildPrefix     = 31 // store cursor of interrupted index rebuild
+	LeasePrefix       = 32 // store leases and entries attached to them
+	AliasPrefix       = 33 // store aliases of kv keys and counters
+	ResetPrefix       = 34 // store scheduled resets of atomic counters
+	SettingsPrefix    = 35 // store runtime settings changed via admin API
+	SettingsLogPrefix = 36 // store history of runtime setting changes
+	FlagPrefix        = 37 // store feature flags
+	ExperimentPrefix  = 38 // store A/B experiments
+	AssignmentPrefix  = 39 // store buckets keys are assigned to in experiments
+	WebhookKeyPrefix  = 40 // store keys webhook deliveries are signed with
+	SeqPrefix         = 41 // store sequences
+	ClockOffsetPrefix = 42 // store offset of TTL clock from wall clock
+	StealLogPrefix    = 43 // store audit log of stolen locks
+	SnowflakePrefix   = 44 // store reserved time range of snowflake ID generators
+	LockGroupPrefix   = 45 // store named groups of fast locks
+	IdemExpiryPrefix  = 46 // store expiration index of idempotency IDs
+	PLockTokenPrefix  = 47 // store last fencing token issued per persistent lock
+	AccTTLPrefix      = 48 // store expiration index of KV values per account
 )
 
 var ErrNotLocked = errors.New("not_locked")
+var ErrChecksum = errors.New("checksum_mismatch")
+var ErrVersionMismatch = errors.New("version_mismatch")
+var ErrValueMismatch = errors.New("value_mismatch")
 
 //go:generate msgp
 type Lock struct {
-	Handle int64 `json:"o" msg:"o"`
-	Till   int64 `json:"t" msg:"t"`
+	Handle int64  `json:"o" msg:"o"`
+	Till   int64  `json:"t" msg:"t"`
+	Token  int64  `json:"f" msg:"f"` // fencing token issued on acquisition
+	Owner  []byte `json:"w" msg:"w"` // metadata of the holder
+	Lease  string `json:"l" msg:"l"` // lock is released when lease expires
+}
+
+//go:generate msgp
+type Lease struct {
+	TTL   int64    `msg:"t"` // seconds, Till is moved by TTL on keepalive
+	Till  int64    `msg:"e"` // unix milliseconds
+	Keys  []string `msg:"k"` // attached KV keys
+	Locks []string `msg:"l"` // attached persistent locks
+
+	// sessions created via Consul API
+	Name     string `msg:"n"`
+	Behavior string `msg:"b"` // release or delete
 }
 
 //go:generate msgp
 type KV struct {
 	Data    []byte
 	Version int64
+	Sum     uint32 `msg:"c"` // crc32c of Data, 0 for records written before checksums
+	Expires int64  `msg:"e"` // unix seconds, 0 - never
+	Type    string `msg:"t"` // Content-Type of Data, empty if not known
+	Cold    bool   `msg:"d"` // Data is URL of the value moved to object storage
+	Lease   string `msg:"l"` // value is deleted when lease expires
+	Flags   uint64 `msg:"g"` // opaque to the server, kept for Consul API clients
+}
+
+//go:generate msgp
+type VClock struct {
+	Clock map[string]int64 `msg:"c"`
+}
+
+//go:generate msgp
+type Checkout struct {
+	Owner string          `msg:"o"`
+	Since int64           `msg:"s"`
+	Till  int64           `msg:"t"`
+	Audit []CheckoutAudit `msg:"a"` // forced overrides, latest last
+}
+
+type CheckoutAudit struct {
+	At       int64  `msg:"t"`
+	Owner    string `msg:"o"` // who took the checkout
+	Previous string `msg:"p"` // who had it
+	Reason   string `msg:"r"`
+}
+
+//go:generate msgp
+type Claim struct {
+	Handle int64  `msg:"h"`
+	Owner  string `msg:"o"`
+	Till   int64  `msg:"t"`
+}
+
+//go:generate msgp
+type PartitionGroup struct {
+	Partitions int    `msg:"n"`
+	Members    string `msg:"m"` // presence prefix of group members
+}
+
+//go:generate msgp
+type Quota struct {
+	Limit int64 `msg:"l"` // 0 - no limit on this level
+	Used  int64 `msg:"u"`
+}
+
+//go:generate msgp
+type Hold struct {
+	Amount int64 `msg:"a"`
+	Till   int64 `msg:"t"`
+}
+
+//go:generate msgp
+type Histogram struct {
+	Bounds []float64 `msg:"b"` // upper bounds of buckets
+	Counts []int64   `msg:"c"` // len(Bounds)+1, last bucket is +Inf
+	Count  int64     `msg:"n"`
+	Sum    float64   `msg:"s"`
+	Min    float64   `msg:"mi"`
+	Max    float64   `msg:"ma"`
+}
+
+//go:generate msgp
+type Gauge struct {
+	Last    float64 `msg:"l"`
+	Min     float64 `msg:"mi"`
+	Max     float64 `msg:"ma"`
+	Count   int64   `msg:"n"`
+	Sum     float64 `msg:"s"`
+	Updated int64   `msg:"u"`
+}
+
+//go:generate msgp
+type ListMeta struct {
+	Head    int64 `msg:"h"` // index of the first element
+	Tail    int64 `msg:"t"` // index after the last element
+	Version int64 `msg:"v"` // incremented on every push to wake up blocked pops
+}
+
+//go:generate msgp
+type KeyStats struct {
+	Created  int64 `msg:"c"`
+	Modified int64 `msg:"m"`
+	Writes   int64 `msg:"w"`
+}
+
+//go:generate msgp
+type RateSample struct {
+	Minute int64 `msg:"m"` // unix minute
+	Value  int64 `msg:"v"` // counter value after last write in that minute
+}
+
+//go:generate msgp
+type Export struct {
+	URL       string `msg:"u"`
+	Method    string `msg:"m"`
+	Prefix    string `msg:"p"`
+	Interval  int64  `msg:"i"` // seconds
+	Next      int64  `msg:"n"` // unix seconds of the next run
+	LastRun   int64  `msg:"lr"`
+	LastKeys  int64  `msg:"lk"`
+	LastError string `msg:"le"`
+}
+
+//go:generate msgp
+type CounterReset struct {
+	Interval  int64  `msg:"i"` // seconds
+	Cron      string `msg:"c"` // minute hour day month weekday, UTC
+	Start     int64  `msg:"s"` // unix seconds, start of the current period
+	Next      int64  `msg:"n"` // unix seconds of the next reset
+	LastRun   int64  `msg:"lr"`
+	LastValue int64  `msg:"lv"`
+	LastKey   string `msg:"lk"` // counter the last value was archived to
+}
+
+//go:generate msgp
+type Setting struct {
+	Value   []byte `msg:"v"` // JSON
+	Changed int64  `msg:"c"` // unix seconds
+	By      string `msg:"b"`
+}
+
+//go:generate msgp
+type SettingChange struct {
+	Name string `msg:"n"`
+	Old  []byte `msg:"o"` // JSON, empty - value from config file
+	New  []byte `msg:"v"` // JSON, empty - reverted to config file
+	At   int64  `msg:"a"` // unix seconds
+	By   string `msg:"b"`
+}
+
+//go:generate msgp
+type FlagRule struct {
+	Attr    string   `msg:"a"`
+	Op      string   `msg:"o"`
+	Values  []string `msg:"v"`
+	Percent float64  `msg:"p"` // of matching keys the flag is on for
+}
+
+//go:generate msgp
+type Flag struct {
+	Enabled     bool       `msg:"e"`
+	Percent     float64    `msg:"p"` // of keys not matched by rules the flag is on for
+	Rules       []FlagRule `msg:"r"`
+	Description string     `msg:"d"`
+	Version     int64      `msg:"v"`
+	Updated     int64      `msg:"u"` // unix seconds
+	By          string     `msg:"b"`
+}
+
+//go:generate msgp
+type ExperimentBucket struct {
+	Name      string `msg:"n"`
+	Weight    int64  `msg:"w"`
+	Assigned  int64  `msg:"a"` // keys assigned
+	Exposures int64  `msg:"e"` // assignment requests, repeated included
+}
+
+//go:generate msgp
+type Experiment struct {
+	Buckets []ExperimentBucket `msg:"b"`
+	Created int64              `msg:"c"` // unix seconds
+	Updated int64              `msg:"u"`
+}
+
+//go:generate msgp
+type Assignment struct {
+	Bucket string `msg:"b"`
+	At     int64  `msg:"a"` // unix seconds
+}
+
+//go:generate msgp
+type WebhookKey struct {
+	Secret  string `msg:"s"`
+	Created int64  `msg:"c"` // unix seconds
+}
+
+//go:generate msgp
+type Seq struct {
+	Value     int64  `msg:"v"` // last issued value
+	Start     int64  `msg:"s"`
+	Step      int64  `msg:"st"`
+	Format    string `msg:"f"`  // fmt template of issued values, for ex. INV-%08d
+	Cycle     bool   `msg:"cy"` // wraps back to Start after Max
+	Max       int64  `msg:"m"`
+	Rollovers int64  `msg:"r"` // times the sequence wrapped
+	Created   int64  `msg:"c"` // unix seconds
+	Updated   int64  `msg:"u"`
+}
+
+//go:generate msgp
+type LockSteal struct {
+	Acc       string `msg:"a"`
+	ID        string `msg:"i"`
+	Fast      bool   `msg:"f"`
+	PrevOwner []byte `msg:"po"`
+	PrevToken int64  `msg:"pt"` // 0 for fast locks, their tokens aren't stored
+	PrevLease string `msg:"pl"`
+	Owner     []byte `msg:"o"`
+	Token     int64  `msg:"t"`
+	By        string `msg:"b"`
+	Reason    string `msg:"r"`
+	At        int64  `msg:"at"` // unix seconds
+}
+
+//go:generate msgp
+type LockGroup struct {
+	IDs     []string        `msg:"i"` // in lock order
+	Handle  int64           `msg:"h"` // handle of the holder, 0 - not held
+	Till    int64           `msg:"t"` // unix seconds of TTL clock all locks expire at
+	Locks   []LockGroupLock `msg:"l"` // locks of the holder
+	Created int64           `msg:"c"` // unix seconds
+	Updated int64           `msg:"u"`
+}
+
+//go:generate msgp
+type LockGroupLock struct {
+	ID     string `msg:"i"`
+	Handle int64  `msg:"h"`
+	Token  int64  `msg:"f"`
 }
 
 type QueueMeta struct {
@@ -7,7 +7,7 @@ import (
 )
 
 // DecodeMsg implements msgp.Decodable
-func (z *KV) DecodeMsg(dc *msgp.Reader) (err error) {
+func (z *Assignment) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
 	_ = field
 	var zb0001 uint32
@@ -24,16 +24,16 @@ func (z *KV) DecodeMsg(dc *msgp.Reader) (err error) {
 			return
 		}
 		switch msgp.UnsafeString(field) {
-		case "Data":
-			z.Data, err = dc.ReadBytes(z.Data)
+		case "b":
+			z.Bucket, err = dc.ReadString()
 			if err != nil {
-				err = msgp.WrapError(err, "Data")
+				err = msgp.WrapError(err, "Bucket")
 				return
 			}
-		case "Version":
-			z.Version, err = dc.ReadInt64()
+		case "a":
+			z.At, err = dc.ReadInt64()
 			if err != nil {
-				err = msgp.WrapError(err, "Version")
+				err = msgp.WrapError(err, "At")
 				return
 			}
 		default:
@@ -48,46 +48,46 @@ func (z *KV) DecodeMsg(dc *msgp.Reader) (err error) {
 }
 
 // EncodeMsg implements msgp.Encodable
-func (z *KV) EncodeMsg(en *msgp.Writer) (err error) {
+func (z Assignment) EncodeMsg(en *msgp.Writer) (err error) {
 	// map header, size 2
-	// write "Data"
-	err = en.Append(0x82, 0xa4, 0x44, 0x61, 0x74, 0x61)
+	// write "b"
+	err = en.Append(0x82, 0xa1, 0x62)
 	if err != nil {
 		return
 	}
-	err = en.WriteBytes(z.Data)
+	err = en.WriteString(z.Bucket)
 	if err != nil {
-		err = msgp.WrapError(err, "Data")
+		err = msgp.WrapError(err, "Bucket")
 		return
 	}
-	// write "Version"
-	err = en.Append(0xa7, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	// write "a"
+	err = en.Append(0xa1, 0x61)
 	if err != nil {
 		return
 	}
-	err = en.WriteInt64(z.Version)
+	err = en.WriteInt64(z.At)
 	if err != nil {
-		err = msgp.WrapError(err, "Version")
+		err = msgp.WrapError(err, "At")
 		return
 	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
-func (z *KV) MarshalMsg(b []byte) (o []byte, err error) {
+func (z Assignment) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
 	// map header, size 2
-	// string "Data"
-	o = append(o, 0x82, 0xa4, 0x44, 0x61, 0x74, 0x61)
-	o = msgp.AppendBytes(o, z.Data)
-	// string "Version"
-	o = append(o, 0xa7, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
-	o = msgp.AppendInt64(o, z.Version)
+	// string "b"
+	o = append(o, 0x82, 0xa1, 0x62)
+	o = msgp.AppendString(o, z.Bucket)
+	// string "a"
+	o = append(o, 0xa1, 0x61)
+	o = msgp.AppendInt64(o, z.At)
 	return
 }
 
 // UnmarshalMsg implements msgp.Unmarshaler
-func (z *KV) UnmarshalMsg(bts []byte) (o []byte, err error) {
+func (z *Assignment) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	var field []byte
 	_ = field
 	var zb0001 uint32
@@ -104,16 +104,16 @@ func (z *KV) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			return
 		}
 		switch msgp.UnsafeString(field) {
-		case "Data":
-			z.Data, bts, err = msgp.ReadBytesBytes(bts, z.Data)
+		case "b":
+			z.Bucket, bts, err = msgp.ReadStringBytes(bts)
 			if err != nil {
-				err = msgp.WrapError(err, "Data")
+				err = msgp.WrapError(err, "Bucket")
 				return
 			}
-		case "Version":
-			z.Version, bts, err = msgp.ReadInt64Bytes(bts)
+		case "a":
+			z.At, bts, err = msgp.ReadInt64Bytes(bts)
 			if err != nil {
-				err = msgp.WrapError(err, "Version")
+				err = msgp.WrapError(err, "At")
 				return
 			}
 		default:
@@ -129,13 +129,13 @@ func (z *KV) UnmarshalMsg(bts []byte) (o []byte, err error) {
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z *KV) Msgsize() (s int) {
-	s = 1 + 5 + msgp.BytesPrefixSize + len(z.Data) + 8 + msgp.Int64Size
+func (z Assignment) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.Bucket) + 2 + msgp.Int64Size
 	return
 }
 
 // DecodeMsg implements msgp.Decodable
-func (z *Lock) DecodeMsg(dc *msgp.Reader) (err error) {
+func (z *Checkout) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
 	_ = field
 	var zb0001 uint32
@@ -153,9 +153,15 @@ func (z *Lock) DecodeMsg(dc *msgp.Reader) (err error) {
 		}
 		switch msgp.UnsafeString(field) {
 		case "o":
-			z.Handle, err = dc.ReadInt64()
+			z.Owner, err = dc.ReadString()
 			if err != nil {
-				err = msgp.WrapError(err, "Handle")
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "s":
+			z.Since, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Since")
 				return
 			}
 		case "t":
@@ -164,6 +170,25 @@ func (z *Lock) DecodeMsg(dc *msgp.Reader) (err error) {
 				err = msgp.WrapError(err, "Till")
 				return
 			}
+		case "a":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Audit")
+				return
+			}
+			if cap(z.Audit) >= int(zb0002) {
+				z.Audit = (z.Audit)[:zb0002]
+			} else {
+				z.Audit = make([]CheckoutAudit, zb0002)
+			}
+			for za0001 := range z.Audit {
+				err = z.Audit[za0001].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Audit", za0001)
+					return
+				}
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -176,16 +201,26 @@ func (z *Lock) DecodeMsg(dc *msgp.Reader) (err error) {
 }
 
 // EncodeMsg implements msgp.Encodable
-func (z Lock) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 2
+func (z *Checkout) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 4
 	// write "o"
-	err = en.Append(0x82, 0xa1, 0x6f)
+	err = en.Append(0x84, 0xa1, 0x6f)
 	if err != nil {
 		return
 	}
-	err = en.WriteInt64(z.Handle)
+	err = en.WriteString(z.Owner)
 	if err != nil {
-		err = msgp.WrapError(err, "Handle")
+		err = msgp.WrapError(err, "Owner")
+		return
+	}
+	// write "s"
+	err = en.Append(0xa1, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Since)
+	if err != nil {
+		err = msgp.WrapError(err, "Since")
 		return
 	}
 	// write "t"
@@ -198,24 +233,54 @@ func (z Lock) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "Till")
 		return
 	}
+	// write "a"
+	err = en.Append(0xa1, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Audit)))
+	if err != nil {
+		err = msgp.WrapError(err, "Audit")
+		return
+	}
+	for za0001 := range z.Audit {
+		err = z.Audit[za0001].EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "Audit", za0001)
+			return
+		}
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
-func (z Lock) MarshalMsg(b []byte) (o []byte, err error) {
+func (z *Checkout) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 2
+	// map header, size 4
 	// string "o"
-	o = append(o, 0x82, 0xa1, 0x6f)
-	o = msgp.AppendInt64(o, z.Handle)
+	o = append(o, 0x84, 0xa1, 0x6f)
+	o = msgp.AppendString(o, z.Owner)
+	// string "s"
+	o = append(o, 0xa1, 0x73)
+	o = msgp.AppendInt64(o, z.Since)
 	// string "t"
 	o = append(o, 0xa1, 0x74)
 	o = msgp.AppendInt64(o, z.Till)
+	// string "a"
+	o = append(o, 0xa1, 0x61)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Audit)))
+	for za0001 := range z.Audit {
+		o, err = z.Audit[za0001].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Audit", za0001)
+			return
+		}
+	}
 	return
 }
 
 // UnmarshalMsg implements msgp.Unmarshaler
-func (z *Lock) UnmarshalMsg(bts []byte) (o []byte, err error) {
+func (z *Checkout) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	var field []byte
 	_ = field
 	var zb0001 uint32
@@ -233,9 +298,15 @@ func (z *Lock) UnmarshalMsg(bts []byte) (o []byte, err error) {
 		}
 		switch msgp.UnsafeString(field) {
 		case "o":
-			z.Handle, bts, err = msgp.ReadInt64Bytes(bts)
+			z.Owner, bts, err = msgp.ReadStringBytes(bts)
 			if err != nil {
-				err = msgp.WrapError(err, "Handle")
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "s":
+			z.Since, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Since")
 				return
 			}
 		case "t":
@@ -244,6 +315,25 @@ func (z *Lock) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "Till")
 				return
 			}
+		case "a":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Audit")
+				return
+			}
+			if cap(z.Audit) >= int(zb0002) {
+				z.Audit = (z.Audit)[:zb0002]
+			} else {
+				z.Audit = make([]CheckoutAudit, zb0002)
+			}
+			for za0001 := range z.Audit {
+				bts, err = z.Audit[za0001].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Audit", za0001)
+					return
+				}
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -257,13 +347,16 @@ func (z *Lock) UnmarshalMsg(bts []byte) (o []byte, err error) {
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z Lock) Msgsize() (s int) {
-	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+func (z *Checkout) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.Owner) + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.ArrayHeaderSize
+	for za0001 := range z.Audit {
+		s += z.Audit[za0001].Msgsize()
+	}
 	return
 }
 
 // DecodeMsg implements msgp.Decodable
-func (z *QueueMeta) DecodeMsg(dc *msgp.Reader) (err error) {
+func (z *CheckoutAudit) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
 	_ = field
 	var zb0001 uint32
@@ -280,16 +373,28 @@ func (z *QueueMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 			return
 		}
 		switch msgp.UnsafeString(field) {
-		case "Total":
-			z.Total, err = dc.ReadInt64()
+		case "t":
+			z.At, err = dc.ReadInt64()
 			if err != nil {
-				err = msgp.WrapError(err, "Total")
+				err = msgp.WrapError(err, "At")
 				return
 			}
-		case "Counter":
-			z.Counter, err = dc.ReadInt64()
+		case "o":
+			z.Owner, err = dc.ReadString()
 			if err != nil {
-				err = msgp.WrapError(err, "Counter")
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "p":
+			z.Previous, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Previous")
+				return
+			}
+		case "r":
+			z.Reason, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Reason")
 				return
 			}
 		default:
@@ -304,46 +409,72 @@ func (z *QueueMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 }
 
 // EncodeMsg implements msgp.Encodable
-func (z QueueMeta) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 2
-	// write "Total"
-	err = en.Append(0x82, 0xa5, 0x54, 0x6f, 0x74, 0x61, 0x6c)
+func (z *CheckoutAudit) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 4
+	// write "t"
+	err = en.Append(0x84, 0xa1, 0x74)
 	if err != nil {
 		return
 	}
-	err = en.WriteInt64(z.Total)
+	err = en.WriteInt64(z.At)
 	if err != nil {
-		err = msgp.WrapError(err, "Total")
+		err = msgp.WrapError(err, "At")
 		return
 	}
-	// write "Counter"
-	err = en.Append(0xa7, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72)
+	// write "o"
+	err = en.Append(0xa1, 0x6f)
 	if err != nil {
 		return
 	}
-	err = en.WriteInt64(z.Counter)
+	err = en.WriteString(z.Owner)
 	if err != nil {
-		err = msgp.WrapError(err, "Counter")
+		err = msgp.WrapError(err, "Owner")
+		return
+	}
+	// write "p"
+	err = en.Append(0xa1, 0x70)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Previous)
+	if err != nil {
+		err = msgp.WrapError(err, "Previous")
+		return
+	}
+	// write "r"
+	err = en.Append(0xa1, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Reason)
+	if err != nil {
+		err = msgp.WrapError(err, "Reason")
 		return
 	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
-func (z QueueMeta) MarshalMsg(b []byte) (o []byte, err error) {
+func (z *CheckoutAudit) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 2
-	// string "Total"
-	o = append(o, 0x82, 0xa5, 0x54, 0x6f, 0x74, 0x61, 0x6c)
-	o = msgp.AppendInt64(o, z.Total)
-	// string "Counter"
-	o = append(o, 0xa7, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72)
-	o = msgp.AppendInt64(o, z.Counter)
+	// map header, size 4
+	// string "t"
+	o = append(o, 0x84, 0xa1, 0x74)
+	o = msgp.AppendInt64(o, z.At)
+	// string "o"
+	o = append(o, 0xa1, 0x6f)
+	o = msgp.AppendString(o, z.Owner)
+	// string "p"
+	o = append(o, 0xa1, 0x70)
+	o = msgp.AppendString(o, z.Previous)
+	// string "r"
+	o = append(o, 0xa1, 0x72)
+	o = msgp.AppendString(o, z.Reason)
 	return
 }
 
 // UnmarshalMsg implements msgp.Unmarshaler
-func (z *QueueMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
+func (z *CheckoutAudit) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	var field []byte
 	_ = field
 	var zb0001 uint32
@@ -360,16 +491,28 @@ func (z *QueueMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			return
 		}
 		switch msgp.UnsafeString(field) {
-		case "Total":
-			z.Total, bts, err = msgp.ReadInt64Bytes(bts)
+		case "t":
+			z.At, bts, err = msgp.ReadInt64Bytes(bts)
 			if err != nil {
-				err = msgp.WrapError(err, "Total")
+				err = msgp.WrapError(err, "At")
 				return
 			}
-		case "Counter":
-			z.Counter, bts, err = msgp.ReadInt64Bytes(bts)
+		case "o":
+			z.Owner, bts, err = msgp.ReadStringBytes(bts)
 			if err != nil {
-				err = msgp.WrapError(err, "Counter")
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "p":
+			z.Previous, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Previous")
+				return
+			}
+		case "r":
+			z.Reason, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Reason")
 				return
 			}
 		default:
@@ -385,7 +528,5723 @@ func (z *QueueMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z QueueMeta) Msgsize() (s int) {
-	s = 1 + 6 + msgp.Int64Size + 8 + msgp.Int64Size
+func (z *CheckoutAudit) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.Owner) + 2 + msgp.StringPrefixSize + len(z.Previous) + 2 + msgp.StringPrefixSize + len(z.Reason)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Claim) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "h":
+			z.Handle, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Handle")
+				return
+			}
+		case "o":
+			z.Owner, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "t":
+			z.Till, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z Claim) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "h"
+	err = en.Append(0x83, 0xa1, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Handle)
+	if err != nil {
+		err = msgp.WrapError(err, "Handle")
+		return
+	}
+	// write "o"
+	err = en.Append(0xa1, 0x6f)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Owner)
+	if err != nil {
+		err = msgp.WrapError(err, "Owner")
+		return
+	}
+	// write "t"
+	err = en.Append(0xa1, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Till)
+	if err != nil {
+		err = msgp.WrapError(err, "Till")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z Claim) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "h"
+	o = append(o, 0x83, 0xa1, 0x68)
+	o = msgp.AppendInt64(o, z.Handle)
+	// string "o"
+	o = append(o, 0xa1, 0x6f)
+	o = msgp.AppendString(o, z.Owner)
+	// string "t"
+	o = append(o, 0xa1, 0x74)
+	o = msgp.AppendInt64(o, z.Till)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Claim) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "h":
+			z.Handle, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Handle")
+				return
+			}
+		case "o":
+			z.Owner, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "t":
+			z.Till, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z Claim) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.Owner) + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *CounterReset) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "i":
+			z.Interval, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Interval")
+				return
+			}
+		case "c":
+			z.Cron, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Cron")
+				return
+			}
+		case "s":
+			z.Start, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Start")
+				return
+			}
+		case "n":
+			z.Next, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Next")
+				return
+			}
+		case "lr":
+			z.LastRun, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "LastRun")
+				return
+			}
+		case "lv":
+			z.LastValue, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "LastValue")
+				return
+			}
+		case "lk":
+			z.LastKey, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "LastKey")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *CounterReset) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 7
+	// write "i"
+	err = en.Append(0x87, 0xa1, 0x69)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Interval)
+	if err != nil {
+		err = msgp.WrapError(err, "Interval")
+		return
+	}
+	// write "c"
+	err = en.Append(0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Cron)
+	if err != nil {
+		err = msgp.WrapError(err, "Cron")
+		return
+	}
+	// write "s"
+	err = en.Append(0xa1, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Start)
+	if err != nil {
+		err = msgp.WrapError(err, "Start")
+		return
+	}
+	// write "n"
+	err = en.Append(0xa1, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Next)
+	if err != nil {
+		err = msgp.WrapError(err, "Next")
+		return
+	}
+	// write "lr"
+	err = en.Append(0xa2, 0x6c, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.LastRun)
+	if err != nil {
+		err = msgp.WrapError(err, "LastRun")
+		return
+	}
+	// write "lv"
+	err = en.Append(0xa2, 0x6c, 0x76)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.LastValue)
+	if err != nil {
+		err = msgp.WrapError(err, "LastValue")
+		return
+	}
+	// write "lk"
+	err = en.Append(0xa2, 0x6c, 0x6b)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.LastKey)
+	if err != nil {
+		err = msgp.WrapError(err, "LastKey")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *CounterReset) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 7
+	// string "i"
+	o = append(o, 0x87, 0xa1, 0x69)
+	o = msgp.AppendInt64(o, z.Interval)
+	// string "c"
+	o = append(o, 0xa1, 0x63)
+	o = msgp.AppendString(o, z.Cron)
+	// string "s"
+	o = append(o, 0xa1, 0x73)
+	o = msgp.AppendInt64(o, z.Start)
+	// string "n"
+	o = append(o, 0xa1, 0x6e)
+	o = msgp.AppendInt64(o, z.Next)
+	// string "lr"
+	o = append(o, 0xa2, 0x6c, 0x72)
+	o = msgp.AppendInt64(o, z.LastRun)
+	// string "lv"
+	o = append(o, 0xa2, 0x6c, 0x76)
+	o = msgp.AppendInt64(o, z.LastValue)
+	// string "lk"
+	o = append(o, 0xa2, 0x6c, 0x6b)
+	o = msgp.AppendString(o, z.LastKey)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *CounterReset) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "i":
+			z.Interval, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Interval")
+				return
+			}
+		case "c":
+			z.Cron, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Cron")
+				return
+			}
+		case "s":
+			z.Start, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Start")
+				return
+			}
+		case "n":
+			z.Next, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Next")
+				return
+			}
+		case "lr":
+			z.LastRun, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LastRun")
+				return
+			}
+		case "lv":
+			z.LastValue, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LastValue")
+				return
+			}
+		case "lk":
+			z.LastKey, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LastKey")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *CounterReset) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.Cron) + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 3 + msgp.Int64Size + 3 + msgp.Int64Size + 3 + msgp.StringPrefixSize + len(z.LastKey)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Experiment) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "b":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Buckets")
+				return
+			}
+			if cap(z.Buckets) >= int(zb0002) {
+				z.Buckets = (z.Buckets)[:zb0002]
+			} else {
+				z.Buckets = make([]ExperimentBucket, zb0002)
+			}
+			for za0001 := range z.Buckets {
+				err = z.Buckets[za0001].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Buckets", za0001)
+					return
+				}
+			}
+		case "c":
+			z.Created, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "u":
+			z.Updated, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Experiment) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "b"
+	err = en.Append(0x83, 0xa1, 0x62)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Buckets)))
+	if err != nil {
+		err = msgp.WrapError(err, "Buckets")
+		return
+	}
+	for za0001 := range z.Buckets {
+		err = z.Buckets[za0001].EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "Buckets", za0001)
+			return
+		}
+	}
+	// write "c"
+	err = en.Append(0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Created)
+	if err != nil {
+		err = msgp.WrapError(err, "Created")
+		return
+	}
+	// write "u"
+	err = en.Append(0xa1, 0x75)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Updated)
+	if err != nil {
+		err = msgp.WrapError(err, "Updated")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Experiment) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "b"
+	o = append(o, 0x83, 0xa1, 0x62)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Buckets)))
+	for za0001 := range z.Buckets {
+		o, err = z.Buckets[za0001].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Buckets", za0001)
+			return
+		}
+	}
+	// string "c"
+	o = append(o, 0xa1, 0x63)
+	o = msgp.AppendInt64(o, z.Created)
+	// string "u"
+	o = append(o, 0xa1, 0x75)
+	o = msgp.AppendInt64(o, z.Updated)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Experiment) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "b":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Buckets")
+				return
+			}
+			if cap(z.Buckets) >= int(zb0002) {
+				z.Buckets = (z.Buckets)[:zb0002]
+			} else {
+				z.Buckets = make([]ExperimentBucket, zb0002)
+			}
+			for za0001 := range z.Buckets {
+				bts, err = z.Buckets[za0001].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Buckets", za0001)
+					return
+				}
+			}
+		case "c":
+			z.Created, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "u":
+			z.Updated, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Experiment) Msgsize() (s int) {
+	s = 1 + 2 + msgp.ArrayHeaderSize
+	for za0001 := range z.Buckets {
+		s += z.Buckets[za0001].Msgsize()
+	}
+	s += 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *ExperimentBucket) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "n":
+			z.Name, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Name")
+				return
+			}
+		case "w":
+			z.Weight, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Weight")
+				return
+			}
+		case "a":
+			z.Assigned, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Assigned")
+				return
+			}
+		case "e":
+			z.Exposures, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Exposures")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *ExperimentBucket) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 4
+	// write "n"
+	err = en.Append(0x84, 0xa1, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Name)
+	if err != nil {
+		err = msgp.WrapError(err, "Name")
+		return
+	}
+	// write "w"
+	err = en.Append(0xa1, 0x77)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Weight)
+	if err != nil {
+		err = msgp.WrapError(err, "Weight")
+		return
+	}
+	// write "a"
+	err = en.Append(0xa1, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Assigned)
+	if err != nil {
+		err = msgp.WrapError(err, "Assigned")
+		return
+	}
+	// write "e"
+	err = en.Append(0xa1, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Exposures)
+	if err != nil {
+		err = msgp.WrapError(err, "Exposures")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *ExperimentBucket) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 4
+	// string "n"
+	o = append(o, 0x84, 0xa1, 0x6e)
+	o = msgp.AppendString(o, z.Name)
+	// string "w"
+	o = append(o, 0xa1, 0x77)
+	o = msgp.AppendInt64(o, z.Weight)
+	// string "a"
+	o = append(o, 0xa1, 0x61)
+	o = msgp.AppendInt64(o, z.Assigned)
+	// string "e"
+	o = append(o, 0xa1, 0x65)
+	o = msgp.AppendInt64(o, z.Exposures)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *ExperimentBucket) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "n":
+			z.Name, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Name")
+				return
+			}
+		case "w":
+			z.Weight, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Weight")
+				return
+			}
+		case "a":
+			z.Assigned, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Assigned")
+				return
+			}
+		case "e":
+			z.Exposures, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Exposures")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *ExperimentBucket) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.Name) + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Export) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "u":
+			z.URL, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "URL")
+				return
+			}
+		case "m":
+			z.Method, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Method")
+				return
+			}
+		case "p":
+			z.Prefix, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Prefix")
+				return
+			}
+		case "i":
+			z.Interval, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Interval")
+				return
+			}
+		case "n":
+			z.Next, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Next")
+				return
+			}
+		case "lr":
+			z.LastRun, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "LastRun")
+				return
+			}
+		case "lk":
+			z.LastKeys, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "LastKeys")
+				return
+			}
+		case "le":
+			z.LastError, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "LastError")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Export) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 8
+	// write "u"
+	err = en.Append(0x88, 0xa1, 0x75)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.URL)
+	if err != nil {
+		err = msgp.WrapError(err, "URL")
+		return
+	}
+	// write "m"
+	err = en.Append(0xa1, 0x6d)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Method)
+	if err != nil {
+		err = msgp.WrapError(err, "Method")
+		return
+	}
+	// write "p"
+	err = en.Append(0xa1, 0x70)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Prefix)
+	if err != nil {
+		err = msgp.WrapError(err, "Prefix")
+		return
+	}
+	// write "i"
+	err = en.Append(0xa1, 0x69)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Interval)
+	if err != nil {
+		err = msgp.WrapError(err, "Interval")
+		return
+	}
+	// write "n"
+	err = en.Append(0xa1, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Next)
+	if err != nil {
+		err = msgp.WrapError(err, "Next")
+		return
+	}
+	// write "lr"
+	err = en.Append(0xa2, 0x6c, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.LastRun)
+	if err != nil {
+		err = msgp.WrapError(err, "LastRun")
+		return
+	}
+	// write "lk"
+	err = en.Append(0xa2, 0x6c, 0x6b)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.LastKeys)
+	if err != nil {
+		err = msgp.WrapError(err, "LastKeys")
+		return
+	}
+	// write "le"
+	err = en.Append(0xa2, 0x6c, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.LastError)
+	if err != nil {
+		err = msgp.WrapError(err, "LastError")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Export) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 8
+	// string "u"
+	o = append(o, 0x88, 0xa1, 0x75)
+	o = msgp.AppendString(o, z.URL)
+	// string "m"
+	o = append(o, 0xa1, 0x6d)
+	o = msgp.AppendString(o, z.Method)
+	// string "p"
+	o = append(o, 0xa1, 0x70)
+	o = msgp.AppendString(o, z.Prefix)
+	// string "i"
+	o = append(o, 0xa1, 0x69)
+	o = msgp.AppendInt64(o, z.Interval)
+	// string "n"
+	o = append(o, 0xa1, 0x6e)
+	o = msgp.AppendInt64(o, z.Next)
+	// string "lr"
+	o = append(o, 0xa2, 0x6c, 0x72)
+	o = msgp.AppendInt64(o, z.LastRun)
+	// string "lk"
+	o = append(o, 0xa2, 0x6c, 0x6b)
+	o = msgp.AppendInt64(o, z.LastKeys)
+	// string "le"
+	o = append(o, 0xa2, 0x6c, 0x65)
+	o = msgp.AppendString(o, z.LastError)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Export) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "u":
+			z.URL, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "URL")
+				return
+			}
+		case "m":
+			z.Method, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Method")
+				return
+			}
+		case "p":
+			z.Prefix, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Prefix")
+				return
+			}
+		case "i":
+			z.Interval, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Interval")
+				return
+			}
+		case "n":
+			z.Next, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Next")
+				return
+			}
+		case "lr":
+			z.LastRun, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LastRun")
+				return
+			}
+		case "lk":
+			z.LastKeys, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LastKeys")
+				return
+			}
+		case "le":
+			z.LastError, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LastError")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Export) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.URL) + 2 + msgp.StringPrefixSize + len(z.Method) + 2 + msgp.StringPrefixSize + len(z.Prefix) + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 3 + msgp.Int64Size + 3 + msgp.Int64Size + 3 + msgp.StringPrefixSize + len(z.LastError)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Flag) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "e":
+			z.Enabled, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "Enabled")
+				return
+			}
+		case "p":
+			z.Percent, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Percent")
+				return
+			}
+		case "r":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Rules")
+				return
+			}
+			if cap(z.Rules) >= int(zb0002) {
+				z.Rules = (z.Rules)[:zb0002]
+			} else {
+				z.Rules = make([]FlagRule, zb0002)
+			}
+			for za0001 := range z.Rules {
+				err = z.Rules[za0001].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Rules", za0001)
+					return
+				}
+			}
+		case "d":
+			z.Description, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Description")
+				return
+			}
+		case "v":
+			z.Version, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Version")
+				return
+			}
+		case "u":
+			z.Updated, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		case "b":
+			z.By, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "By")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Flag) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 7
+	// write "e"
+	err = en.Append(0x87, 0xa1, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.Enabled)
+	if err != nil {
+		err = msgp.WrapError(err, "Enabled")
+		return
+	}
+	// write "p"
+	err = en.Append(0xa1, 0x70)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Percent)
+	if err != nil {
+		err = msgp.WrapError(err, "Percent")
+		return
+	}
+	// write "r"
+	err = en.Append(0xa1, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Rules)))
+	if err != nil {
+		err = msgp.WrapError(err, "Rules")
+		return
+	}
+	for za0001 := range z.Rules {
+		err = z.Rules[za0001].EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "Rules", za0001)
+			return
+		}
+	}
+	// write "d"
+	err = en.Append(0xa1, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Description)
+	if err != nil {
+		err = msgp.WrapError(err, "Description")
+		return
+	}
+	// write "v"
+	err = en.Append(0xa1, 0x76)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Version)
+	if err != nil {
+		err = msgp.WrapError(err, "Version")
+		return
+	}
+	// write "u"
+	err = en.Append(0xa1, 0x75)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Updated)
+	if err != nil {
+		err = msgp.WrapError(err, "Updated")
+		return
+	}
+	// write "b"
+	err = en.Append(0xa1, 0x62)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.By)
+	if err != nil {
+		err = msgp.WrapError(err, "By")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Flag) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 7
+	// string "e"
+	o = append(o, 0x87, 0xa1, 0x65)
+	o = msgp.AppendBool(o, z.Enabled)
+	// string "p"
+	o = append(o, 0xa1, 0x70)
+	o = msgp.AppendFloat64(o, z.Percent)
+	// string "r"
+	o = append(o, 0xa1, 0x72)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Rules)))
+	for za0001 := range z.Rules {
+		o, err = z.Rules[za0001].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Rules", za0001)
+			return
+		}
+	}
+	// string "d"
+	o = append(o, 0xa1, 0x64)
+	o = msgp.AppendString(o, z.Description)
+	// string "v"
+	o = append(o, 0xa1, 0x76)
+	o = msgp.AppendInt64(o, z.Version)
+	// string "u"
+	o = append(o, 0xa1, 0x75)
+	o = msgp.AppendInt64(o, z.Updated)
+	// string "b"
+	o = append(o, 0xa1, 0x62)
+	o = msgp.AppendString(o, z.By)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Flag) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "e":
+			z.Enabled, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Enabled")
+				return
+			}
+		case "p":
+			z.Percent, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Percent")
+				return
+			}
+		case "r":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Rules")
+				return
+			}
+			if cap(z.Rules) >= int(zb0002) {
+				z.Rules = (z.Rules)[:zb0002]
+			} else {
+				z.Rules = make([]FlagRule, zb0002)
+			}
+			for za0001 := range z.Rules {
+				bts, err = z.Rules[za0001].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Rules", za0001)
+					return
+				}
+			}
+		case "d":
+			z.Description, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Description")
+				return
+			}
+		case "v":
+			z.Version, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Version")
+				return
+			}
+		case "u":
+			z.Updated, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		case "b":
+			z.By, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "By")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Flag) Msgsize() (s int) {
+	s = 1 + 2 + msgp.BoolSize + 2 + msgp.Float64Size + 2 + msgp.ArrayHeaderSize
+	for za0001 := range z.Rules {
+		s += z.Rules[za0001].Msgsize()
+	}
+	s += 2 + msgp.StringPrefixSize + len(z.Description) + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.By)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *FlagRule) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "a":
+			z.Attr, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Attr")
+				return
+			}
+		case "o":
+			z.Op, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Op")
+				return
+			}
+		case "v":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Values")
+				return
+			}
+			if cap(z.Values) >= int(zb0002) {
+				z.Values = (z.Values)[:zb0002]
+			} else {
+				z.Values = make([]string, zb0002)
+			}
+			for za0001 := range z.Values {
+				z.Values[za0001], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Values", za0001)
+					return
+				}
+			}
+		case "p":
+			z.Percent, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Percent")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *FlagRule) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 4
+	// write "a"
+	err = en.Append(0x84, 0xa1, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Attr)
+	if err != nil {
+		err = msgp.WrapError(err, "Attr")
+		return
+	}
+	// write "o"
+	err = en.Append(0xa1, 0x6f)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Op)
+	if err != nil {
+		err = msgp.WrapError(err, "Op")
+		return
+	}
+	// write "v"
+	err = en.Append(0xa1, 0x76)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Values)))
+	if err != nil {
+		err = msgp.WrapError(err, "Values")
+		return
+	}
+	for za0001 := range z.Values {
+		err = en.WriteString(z.Values[za0001])
+		if err != nil {
+			err = msgp.WrapError(err, "Values", za0001)
+			return
+		}
+	}
+	// write "p"
+	err = en.Append(0xa1, 0x70)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Percent)
+	if err != nil {
+		err = msgp.WrapError(err, "Percent")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *FlagRule) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 4
+	// string "a"
+	o = append(o, 0x84, 0xa1, 0x61)
+	o = msgp.AppendString(o, z.Attr)
+	// string "o"
+	o = append(o, 0xa1, 0x6f)
+	o = msgp.AppendString(o, z.Op)
+	// string "v"
+	o = append(o, 0xa1, 0x76)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Values)))
+	for za0001 := range z.Values {
+		o = msgp.AppendString(o, z.Values[za0001])
+	}
+	// string "p"
+	o = append(o, 0xa1, 0x70)
+	o = msgp.AppendFloat64(o, z.Percent)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *FlagRule) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "a":
+			z.Attr, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Attr")
+				return
+			}
+		case "o":
+			z.Op, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Op")
+				return
+			}
+		case "v":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Values")
+				return
+			}
+			if cap(z.Values) >= int(zb0002) {
+				z.Values = (z.Values)[:zb0002]
+			} else {
+				z.Values = make([]string, zb0002)
+			}
+			for za0001 := range z.Values {
+				z.Values[za0001], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Values", za0001)
+					return
+				}
+			}
+		case "p":
+			z.Percent, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Percent")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *FlagRule) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.Attr) + 2 + msgp.StringPrefixSize + len(z.Op) + 2 + msgp.ArrayHeaderSize
+	for za0001 := range z.Values {
+		s += msgp.StringPrefixSize + len(z.Values[za0001])
+	}
+	s += 2 + msgp.Float64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Gauge) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "l":
+			z.Last, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Last")
+				return
+			}
+		case "mi":
+			z.Min, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Min")
+				return
+			}
+		case "ma":
+			z.Max, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Max")
+				return
+			}
+		case "n":
+			z.Count, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Count")
+				return
+			}
+		case "s":
+			z.Sum, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Sum")
+				return
+			}
+		case "u":
+			z.Updated, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Gauge) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 6
+	// write "l"
+	err = en.Append(0x86, 0xa1, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Last)
+	if err != nil {
+		err = msgp.WrapError(err, "Last")
+		return
+	}
+	// write "mi"
+	err = en.Append(0xa2, 0x6d, 0x69)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Min)
+	if err != nil {
+		err = msgp.WrapError(err, "Min")
+		return
+	}
+	// write "ma"
+	err = en.Append(0xa2, 0x6d, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Max)
+	if err != nil {
+		err = msgp.WrapError(err, "Max")
+		return
+	}
+	// write "n"
+	err = en.Append(0xa1, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Count)
+	if err != nil {
+		err = msgp.WrapError(err, "Count")
+		return
+	}
+	// write "s"
+	err = en.Append(0xa1, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Sum)
+	if err != nil {
+		err = msgp.WrapError(err, "Sum")
+		return
+	}
+	// write "u"
+	err = en.Append(0xa1, 0x75)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Updated)
+	if err != nil {
+		err = msgp.WrapError(err, "Updated")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Gauge) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 6
+	// string "l"
+	o = append(o, 0x86, 0xa1, 0x6c)
+	o = msgp.AppendFloat64(o, z.Last)
+	// string "mi"
+	o = append(o, 0xa2, 0x6d, 0x69)
+	o = msgp.AppendFloat64(o, z.Min)
+	// string "ma"
+	o = append(o, 0xa2, 0x6d, 0x61)
+	o = msgp.AppendFloat64(o, z.Max)
+	// string "n"
+	o = append(o, 0xa1, 0x6e)
+	o = msgp.AppendInt64(o, z.Count)
+	// string "s"
+	o = append(o, 0xa1, 0x73)
+	o = msgp.AppendFloat64(o, z.Sum)
+	// string "u"
+	o = append(o, 0xa1, 0x75)
+	o = msgp.AppendInt64(o, z.Updated)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Gauge) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "l":
+			z.Last, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Last")
+				return
+			}
+		case "mi":
+			z.Min, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Min")
+				return
+			}
+		case "ma":
+			z.Max, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Max")
+				return
+			}
+		case "n":
+			z.Count, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Count")
+				return
+			}
+		case "s":
+			z.Sum, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Sum")
+				return
+			}
+		case "u":
+			z.Updated, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Gauge) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Float64Size + 3 + msgp.Float64Size + 3 + msgp.Float64Size + 2 + msgp.Int64Size + 2 + msgp.Float64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Histogram) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "b":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Bounds")
+				return
+			}
+			if cap(z.Bounds) >= int(zb0002) {
+				z.Bounds = (z.Bounds)[:zb0002]
+			} else {
+				z.Bounds = make([]float64, zb0002)
+			}
+			for za0001 := range z.Bounds {
+				z.Bounds[za0001], err = dc.ReadFloat64()
+				if err != nil {
+					err = msgp.WrapError(err, "Bounds", za0001)
+					return
+				}
+			}
+		case "c":
+			var zb0003 uint32
+			zb0003, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Counts")
+				return
+			}
+			if cap(z.Counts) >= int(zb0003) {
+				z.Counts = (z.Counts)[:zb0003]
+			} else {
+				z.Counts = make([]int64, zb0003)
+			}
+			for za0002 := range z.Counts {
+				z.Counts[za0002], err = dc.ReadInt64()
+				if err != nil {
+					err = msgp.WrapError(err, "Counts", za0002)
+					return
+				}
+			}
+		case "n":
+			z.Count, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Count")
+				return
+			}
+		case "s":
+			z.Sum, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Sum")
+				return
+			}
+		case "mi":
+			z.Min, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Min")
+				return
+			}
+		case "ma":
+			z.Max, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Max")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Histogram) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 6
+	// write "b"
+	err = en.Append(0x86, 0xa1, 0x62)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Bounds)))
+	if err != nil {
+		err = msgp.WrapError(err, "Bounds")
+		return
+	}
+	for za0001 := range z.Bounds {
+		err = en.WriteFloat64(z.Bounds[za0001])
+		if err != nil {
+			err = msgp.WrapError(err, "Bounds", za0001)
+			return
+		}
+	}
+	// write "c"
+	err = en.Append(0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Counts)))
+	if err != nil {
+		err = msgp.WrapError(err, "Counts")
+		return
+	}
+	for za0002 := range z.Counts {
+		err = en.WriteInt64(z.Counts[za0002])
+		if err != nil {
+			err = msgp.WrapError(err, "Counts", za0002)
+			return
+		}
+	}
+	// write "n"
+	err = en.Append(0xa1, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Count)
+	if err != nil {
+		err = msgp.WrapError(err, "Count")
+		return
+	}
+	// write "s"
+	err = en.Append(0xa1, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Sum)
+	if err != nil {
+		err = msgp.WrapError(err, "Sum")
+		return
+	}
+	// write "mi"
+	err = en.Append(0xa2, 0x6d, 0x69)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Min)
+	if err != nil {
+		err = msgp.WrapError(err, "Min")
+		return
+	}
+	// write "ma"
+	err = en.Append(0xa2, 0x6d, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Max)
+	if err != nil {
+		err = msgp.WrapError(err, "Max")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Histogram) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 6
+	// string "b"
+	o = append(o, 0x86, 0xa1, 0x62)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Bounds)))
+	for za0001 := range z.Bounds {
+		o = msgp.AppendFloat64(o, z.Bounds[za0001])
+	}
+	// string "c"
+	o = append(o, 0xa1, 0x63)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Counts)))
+	for za0002 := range z.Counts {
+		o = msgp.AppendInt64(o, z.Counts[za0002])
+	}
+	// string "n"
+	o = append(o, 0xa1, 0x6e)
+	o = msgp.AppendInt64(o, z.Count)
+	// string "s"
+	o = append(o, 0xa1, 0x73)
+	o = msgp.AppendFloat64(o, z.Sum)
+	// string "mi"
+	o = append(o, 0xa2, 0x6d, 0x69)
+	o = msgp.AppendFloat64(o, z.Min)
+	// string "ma"
+	o = append(o, 0xa2, 0x6d, 0x61)
+	o = msgp.AppendFloat64(o, z.Max)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Histogram) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "b":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Bounds")
+				return
+			}
+			if cap(z.Bounds) >= int(zb0002) {
+				z.Bounds = (z.Bounds)[:zb0002]
+			} else {
+				z.Bounds = make([]float64, zb0002)
+			}
+			for za0001 := range z.Bounds {
+				z.Bounds[za0001], bts, err = msgp.ReadFloat64Bytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Bounds", za0001)
+					return
+				}
+			}
+		case "c":
+			var zb0003 uint32
+			zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Counts")
+				return
+			}
+			if cap(z.Counts) >= int(zb0003) {
+				z.Counts = (z.Counts)[:zb0003]
+			} else {
+				z.Counts = make([]int64, zb0003)
+			}
+			for za0002 := range z.Counts {
+				z.Counts[za0002], bts, err = msgp.ReadInt64Bytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Counts", za0002)
+					return
+				}
+			}
+		case "n":
+			z.Count, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Count")
+				return
+			}
+		case "s":
+			z.Sum, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Sum")
+				return
+			}
+		case "mi":
+			z.Min, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Min")
+				return
+			}
+		case "ma":
+			z.Max, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Max")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Histogram) Msgsize() (s int) {
+	s = 1 + 2 + msgp.ArrayHeaderSize + (len(z.Bounds) * (msgp.Float64Size)) + 2 + msgp.ArrayHeaderSize + (len(z.Counts) * (msgp.Int64Size)) + 2 + msgp.Int64Size + 2 + msgp.Float64Size + 3 + msgp.Float64Size + 3 + msgp.Float64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Hold) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "a":
+			z.Amount, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Amount")
+				return
+			}
+		case "t":
+			z.Till, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z Hold) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 2
+	// write "a"
+	err = en.Append(0x82, 0xa1, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Amount)
+	if err != nil {
+		err = msgp.WrapError(err, "Amount")
+		return
+	}
+	// write "t"
+	err = en.Append(0xa1, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Till)
+	if err != nil {
+		err = msgp.WrapError(err, "Till")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z Hold) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 2
+	// string "a"
+	o = append(o, 0x82, 0xa1, 0x61)
+	o = msgp.AppendInt64(o, z.Amount)
+	// string "t"
+	o = append(o, 0xa1, 0x74)
+	o = msgp.AppendInt64(o, z.Till)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Hold) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "a":
+			z.Amount, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Amount")
+				return
+			}
+		case "t":
+			z.Till, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z Hold) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *KV) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Data":
+			z.Data, err = dc.ReadBytes(z.Data)
+			if err != nil {
+				err = msgp.WrapError(err, "Data")
+				return
+			}
+		case "Version":
+			z.Version, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Version")
+				return
+			}
+		case "c":
+			z.Sum, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "Sum")
+				return
+			}
+		case "e":
+			z.Expires, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Expires")
+				return
+			}
+		case "t":
+			z.Type, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		case "d":
+			z.Cold, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "Cold")
+				return
+			}
+		case "l":
+			z.Lease, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Lease")
+				return
+			}
+		case "g":
+			z.Flags, err = dc.ReadUint64()
+			if err != nil {
+				err = msgp.WrapError(err, "Flags")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *KV) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 8
+	// write "Data"
+	err = en.Append(0x88, 0xa4, 0x44, 0x61, 0x74, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.Data)
+	if err != nil {
+		err = msgp.WrapError(err, "Data")
+		return
+	}
+	// write "Version"
+	err = en.Append(0xa7, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Version)
+	if err != nil {
+		err = msgp.WrapError(err, "Version")
+		return
+	}
+	// write "c"
+	err = en.Append(0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.Sum)
+	if err != nil {
+		err = msgp.WrapError(err, "Sum")
+		return
+	}
+	// write "e"
+	err = en.Append(0xa1, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Expires)
+	if err != nil {
+		err = msgp.WrapError(err, "Expires")
+		return
+	}
+	// write "t"
+	err = en.Append(0xa1, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Type)
+	if err != nil {
+		err = msgp.WrapError(err, "Type")
+		return
+	}
+	// write "d"
+	err = en.Append(0xa1, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.Cold)
+	if err != nil {
+		err = msgp.WrapError(err, "Cold")
+		return
+	}
+	// write "l"
+	err = en.Append(0xa1, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Lease)
+	if err != nil {
+		err = msgp.WrapError(err, "Lease")
+		return
+	}
+	// write "g"
+	err = en.Append(0xa1, 0x67)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint64(z.Flags)
+	if err != nil {
+		err = msgp.WrapError(err, "Flags")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *KV) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 8
+	// string "Data"
+	o = append(o, 0x88, 0xa4, 0x44, 0x61, 0x74, 0x61)
+	o = msgp.AppendBytes(o, z.Data)
+	// string "Version"
+	o = append(o, 0xa7, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	o = msgp.AppendInt64(o, z.Version)
+	// string "c"
+	o = append(o, 0xa1, 0x63)
+	o = msgp.AppendUint32(o, z.Sum)
+	// string "e"
+	o = append(o, 0xa1, 0x65)
+	o = msgp.AppendInt64(o, z.Expires)
+	// string "t"
+	o = append(o, 0xa1, 0x74)
+	o = msgp.AppendString(o, z.Type)
+	// string "d"
+	o = append(o, 0xa1, 0x64)
+	o = msgp.AppendBool(o, z.Cold)
+	// string "l"
+	o = append(o, 0xa1, 0x6c)
+	o = msgp.AppendString(o, z.Lease)
+	// string "g"
+	o = append(o, 0xa1, 0x67)
+	o = msgp.AppendUint64(o, z.Flags)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *KV) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Data":
+			z.Data, bts, err = msgp.ReadBytesBytes(bts, z.Data)
+			if err != nil {
+				err = msgp.WrapError(err, "Data")
+				return
+			}
+		case "Version":
+			z.Version, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Version")
+				return
+			}
+		case "c":
+			z.Sum, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Sum")
+				return
+			}
+		case "e":
+			z.Expires, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Expires")
+				return
+			}
+		case "t":
+			z.Type, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		case "d":
+			z.Cold, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Cold")
+				return
+			}
+		case "l":
+			z.Lease, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Lease")
+				return
+			}
+		case "g":
+			z.Flags, bts, err = msgp.ReadUint64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Flags")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *KV) Msgsize() (s int) {
+	s = 1 + 5 + msgp.BytesPrefixSize + len(z.Data) + 8 + msgp.Int64Size + 2 + msgp.Uint32Size + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.Type) + 2 + msgp.BoolSize + 2 + msgp.StringPrefixSize + len(z.Lease) + 2 + msgp.Uint64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *KeyStats) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "c":
+			z.Created, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "m":
+			z.Modified, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Modified")
+				return
+			}
+		case "w":
+			z.Writes, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Writes")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z KeyStats) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "c"
+	err = en.Append(0x83, 0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Created)
+	if err != nil {
+		err = msgp.WrapError(err, "Created")
+		return
+	}
+	// write "m"
+	err = en.Append(0xa1, 0x6d)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Modified)
+	if err != nil {
+		err = msgp.WrapError(err, "Modified")
+		return
+	}
+	// write "w"
+	err = en.Append(0xa1, 0x77)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Writes)
+	if err != nil {
+		err = msgp.WrapError(err, "Writes")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z KeyStats) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "c"
+	o = append(o, 0x83, 0xa1, 0x63)
+	o = msgp.AppendInt64(o, z.Created)
+	// string "m"
+	o = append(o, 0xa1, 0x6d)
+	o = msgp.AppendInt64(o, z.Modified)
+	// string "w"
+	o = append(o, 0xa1, 0x77)
+	o = msgp.AppendInt64(o, z.Writes)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *KeyStats) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "c":
+			z.Created, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "m":
+			z.Modified, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Modified")
+				return
+			}
+		case "w":
+			z.Writes, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Writes")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z KeyStats) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Lease) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "t":
+			z.TTL, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "TTL")
+				return
+			}
+		case "e":
+			z.Till, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		case "k":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Keys")
+				return
+			}
+			if cap(z.Keys) >= int(zb0002) {
+				z.Keys = (z.Keys)[:zb0002]
+			} else {
+				z.Keys = make([]string, zb0002)
+			}
+			for za0001 := range z.Keys {
+				z.Keys[za0001], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Keys", za0001)
+					return
+				}
+			}
+		case "l":
+			var zb0003 uint32
+			zb0003, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Locks")
+				return
+			}
+			if cap(z.Locks) >= int(zb0003) {
+				z.Locks = (z.Locks)[:zb0003]
+			} else {
+				z.Locks = make([]string, zb0003)
+			}
+			for za0002 := range z.Locks {
+				z.Locks[za0002], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Locks", za0002)
+					return
+				}
+			}
+		case "n":
+			z.Name, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Name")
+				return
+			}
+		case "b":
+			z.Behavior, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Behavior")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Lease) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 6
+	// write "t"
+	err = en.Append(0x86, 0xa1, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.TTL)
+	if err != nil {
+		err = msgp.WrapError(err, "TTL")
+		return
+	}
+	// write "e"
+	err = en.Append(0xa1, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Till)
+	if err != nil {
+		err = msgp.WrapError(err, "Till")
+		return
+	}
+	// write "k"
+	err = en.Append(0xa1, 0x6b)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Keys)))
+	if err != nil {
+		err = msgp.WrapError(err, "Keys")
+		return
+	}
+	for za0001 := range z.Keys {
+		err = en.WriteString(z.Keys[za0001])
+		if err != nil {
+			err = msgp.WrapError(err, "Keys", za0001)
+			return
+		}
+	}
+	// write "l"
+	err = en.Append(0xa1, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Locks)))
+	if err != nil {
+		err = msgp.WrapError(err, "Locks")
+		return
+	}
+	for za0002 := range z.Locks {
+		err = en.WriteString(z.Locks[za0002])
+		if err != nil {
+			err = msgp.WrapError(err, "Locks", za0002)
+			return
+		}
+	}
+	// write "n"
+	err = en.Append(0xa1, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Name)
+	if err != nil {
+		err = msgp.WrapError(err, "Name")
+		return
+	}
+	// write "b"
+	err = en.Append(0xa1, 0x62)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Behavior)
+	if err != nil {
+		err = msgp.WrapError(err, "Behavior")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Lease) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 6
+	// string "t"
+	o = append(o, 0x86, 0xa1, 0x74)
+	o = msgp.AppendInt64(o, z.TTL)
+	// string "e"
+	o = append(o, 0xa1, 0x65)
+	o = msgp.AppendInt64(o, z.Till)
+	// string "k"
+	o = append(o, 0xa1, 0x6b)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Keys)))
+	for za0001 := range z.Keys {
+		o = msgp.AppendString(o, z.Keys[za0001])
+	}
+	// string "l"
+	o = append(o, 0xa1, 0x6c)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Locks)))
+	for za0002 := range z.Locks {
+		o = msgp.AppendString(o, z.Locks[za0002])
+	}
+	// string "n"
+	o = append(o, 0xa1, 0x6e)
+	o = msgp.AppendString(o, z.Name)
+	// string "b"
+	o = append(o, 0xa1, 0x62)
+	o = msgp.AppendString(o, z.Behavior)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Lease) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "t":
+			z.TTL, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "TTL")
+				return
+			}
+		case "e":
+			z.Till, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		case "k":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Keys")
+				return
+			}
+			if cap(z.Keys) >= int(zb0002) {
+				z.Keys = (z.Keys)[:zb0002]
+			} else {
+				z.Keys = make([]string, zb0002)
+			}
+			for za0001 := range z.Keys {
+				z.Keys[za0001], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Keys", za0001)
+					return
+				}
+			}
+		case "l":
+			var zb0003 uint32
+			zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Locks")
+				return
+			}
+			if cap(z.Locks) >= int(zb0003) {
+				z.Locks = (z.Locks)[:zb0003]
+			} else {
+				z.Locks = make([]string, zb0003)
+			}
+			for za0002 := range z.Locks {
+				z.Locks[za0002], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Locks", za0002)
+					return
+				}
+			}
+		case "n":
+			z.Name, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Name")
+				return
+			}
+		case "b":
+			z.Behavior, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Behavior")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Lease) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.ArrayHeaderSize
+	for za0001 := range z.Keys {
+		s += msgp.StringPrefixSize + len(z.Keys[za0001])
+	}
+	s += 2 + msgp.ArrayHeaderSize
+	for za0002 := range z.Locks {
+		s += msgp.StringPrefixSize + len(z.Locks[za0002])
+	}
+	s += 2 + msgp.StringPrefixSize + len(z.Name) + 2 + msgp.StringPrefixSize + len(z.Behavior)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *ListMeta) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "h":
+			z.Head, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Head")
+				return
+			}
+		case "t":
+			z.Tail, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Tail")
+				return
+			}
+		case "v":
+			z.Version, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Version")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z ListMeta) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "h"
+	err = en.Append(0x83, 0xa1, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Head)
+	if err != nil {
+		err = msgp.WrapError(err, "Head")
+		return
+	}
+	// write "t"
+	err = en.Append(0xa1, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Tail)
+	if err != nil {
+		err = msgp.WrapError(err, "Tail")
+		return
+	}
+	// write "v"
+	err = en.Append(0xa1, 0x76)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Version)
+	if err != nil {
+		err = msgp.WrapError(err, "Version")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z ListMeta) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "h"
+	o = append(o, 0x83, 0xa1, 0x68)
+	o = msgp.AppendInt64(o, z.Head)
+	// string "t"
+	o = append(o, 0xa1, 0x74)
+	o = msgp.AppendInt64(o, z.Tail)
+	// string "v"
+	o = append(o, 0xa1, 0x76)
+	o = msgp.AppendInt64(o, z.Version)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *ListMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "h":
+			z.Head, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Head")
+				return
+			}
+		case "t":
+			z.Tail, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Tail")
+				return
+			}
+		case "v":
+			z.Version, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Version")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z ListMeta) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Lock) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "o":
+			z.Handle, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Handle")
+				return
+			}
+		case "t":
+			z.Till, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		case "f":
+			z.Token, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Token")
+				return
+			}
+		case "w":
+			z.Owner, err = dc.ReadBytes(z.Owner)
+			if err != nil {
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "l":
+			z.Lease, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Lease")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Lock) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 5
+	// write "o"
+	err = en.Append(0x85, 0xa1, 0x6f)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Handle)
+	if err != nil {
+		err = msgp.WrapError(err, "Handle")
+		return
+	}
+	// write "t"
+	err = en.Append(0xa1, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Till)
+	if err != nil {
+		err = msgp.WrapError(err, "Till")
+		return
+	}
+	// write "f"
+	err = en.Append(0xa1, 0x66)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Token)
+	if err != nil {
+		err = msgp.WrapError(err, "Token")
+		return
+	}
+	// write "w"
+	err = en.Append(0xa1, 0x77)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.Owner)
+	if err != nil {
+		err = msgp.WrapError(err, "Owner")
+		return
+	}
+	// write "l"
+	err = en.Append(0xa1, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Lease)
+	if err != nil {
+		err = msgp.WrapError(err, "Lease")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Lock) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 5
+	// string "o"
+	o = append(o, 0x85, 0xa1, 0x6f)
+	o = msgp.AppendInt64(o, z.Handle)
+	// string "t"
+	o = append(o, 0xa1, 0x74)
+	o = msgp.AppendInt64(o, z.Till)
+	// string "f"
+	o = append(o, 0xa1, 0x66)
+	o = msgp.AppendInt64(o, z.Token)
+	// string "w"
+	o = append(o, 0xa1, 0x77)
+	o = msgp.AppendBytes(o, z.Owner)
+	// string "l"
+	o = append(o, 0xa1, 0x6c)
+	o = msgp.AppendString(o, z.Lease)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Lock) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "o":
+			z.Handle, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Handle")
+				return
+			}
+		case "t":
+			z.Till, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		case "f":
+			z.Token, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Token")
+				return
+			}
+		case "w":
+			z.Owner, bts, err = msgp.ReadBytesBytes(bts, z.Owner)
+			if err != nil {
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "l":
+			z.Lease, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Lease")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Lock) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.BytesPrefixSize + len(z.Owner) + 2 + msgp.StringPrefixSize + len(z.Lease)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *LockGroup) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "i":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "IDs")
+				return
+			}
+			if cap(z.IDs) >= int(zb0002) {
+				z.IDs = (z.IDs)[:zb0002]
+			} else {
+				z.IDs = make([]string, zb0002)
+			}
+			for za0001 := range z.IDs {
+				z.IDs[za0001], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "IDs", za0001)
+					return
+				}
+			}
+		case "h":
+			z.Handle, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Handle")
+				return
+			}
+		case "t":
+			z.Till, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		case "l":
+			var zb0003 uint32
+			zb0003, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Locks")
+				return
+			}
+			if cap(z.Locks) >= int(zb0003) {
+				z.Locks = (z.Locks)[:zb0003]
+			} else {
+				z.Locks = make([]LockGroupLock, zb0003)
+			}
+			for za0002 := range z.Locks {
+				var zb0004 uint32
+				zb0004, err = dc.ReadMapHeader()
+				if err != nil {
+					err = msgp.WrapError(err, "Locks", za0002)
+					return
+				}
+				for zb0004 > 0 {
+					zb0004--
+					field, err = dc.ReadMapKeyPtr()
+					if err != nil {
+						err = msgp.WrapError(err, "Locks", za0002)
+						return
+					}
+					switch msgp.UnsafeString(field) {
+					case "i":
+						z.Locks[za0002].ID, err = dc.ReadString()
+						if err != nil {
+							err = msgp.WrapError(err, "Locks", za0002, "ID")
+							return
+						}
+					case "h":
+						z.Locks[za0002].Handle, err = dc.ReadInt64()
+						if err != nil {
+							err = msgp.WrapError(err, "Locks", za0002, "Handle")
+							return
+						}
+					case "f":
+						z.Locks[za0002].Token, err = dc.ReadInt64()
+						if err != nil {
+							err = msgp.WrapError(err, "Locks", za0002, "Token")
+							return
+						}
+					default:
+						err = dc.Skip()
+						if err != nil {
+							err = msgp.WrapError(err, "Locks", za0002)
+							return
+						}
+					}
+				}
+			}
+		case "c":
+			z.Created, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "u":
+			z.Updated, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *LockGroup) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 6
+	// write "i"
+	err = en.Append(0x86, 0xa1, 0x69)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.IDs)))
+	if err != nil {
+		err = msgp.WrapError(err, "IDs")
+		return
+	}
+	for za0001 := range z.IDs {
+		err = en.WriteString(z.IDs[za0001])
+		if err != nil {
+			err = msgp.WrapError(err, "IDs", za0001)
+			return
+		}
+	}
+	// write "h"
+	err = en.Append(0xa1, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Handle)
+	if err != nil {
+		err = msgp.WrapError(err, "Handle")
+		return
+	}
+	// write "t"
+	err = en.Append(0xa1, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Till)
+	if err != nil {
+		err = msgp.WrapError(err, "Till")
+		return
+	}
+	// write "l"
+	err = en.Append(0xa1, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Locks)))
+	if err != nil {
+		err = msgp.WrapError(err, "Locks")
+		return
+	}
+	for za0002 := range z.Locks {
+		// map header, size 3
+		// write "i"
+		err = en.Append(0x83, 0xa1, 0x69)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.Locks[za0002].ID)
+		if err != nil {
+			err = msgp.WrapError(err, "Locks", za0002, "ID")
+			return
+		}
+		// write "h"
+		err = en.Append(0xa1, 0x68)
+		if err != nil {
+			return
+		}
+		err = en.WriteInt64(z.Locks[za0002].Handle)
+		if err != nil {
+			err = msgp.WrapError(err, "Locks", za0002, "Handle")
+			return
+		}
+		// write "f"
+		err = en.Append(0xa1, 0x66)
+		if err != nil {
+			return
+		}
+		err = en.WriteInt64(z.Locks[za0002].Token)
+		if err != nil {
+			err = msgp.WrapError(err, "Locks", za0002, "Token")
+			return
+		}
+	}
+	// write "c"
+	err = en.Append(0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Created)
+	if err != nil {
+		err = msgp.WrapError(err, "Created")
+		return
+	}
+	// write "u"
+	err = en.Append(0xa1, 0x75)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Updated)
+	if err != nil {
+		err = msgp.WrapError(err, "Updated")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *LockGroup) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 6
+	// string "i"
+	o = append(o, 0x86, 0xa1, 0x69)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.IDs)))
+	for za0001 := range z.IDs {
+		o = msgp.AppendString(o, z.IDs[za0001])
+	}
+	// string "h"
+	o = append(o, 0xa1, 0x68)
+	o = msgp.AppendInt64(o, z.Handle)
+	// string "t"
+	o = append(o, 0xa1, 0x74)
+	o = msgp.AppendInt64(o, z.Till)
+	// string "l"
+	o = append(o, 0xa1, 0x6c)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Locks)))
+	for za0002 := range z.Locks {
+		// map header, size 3
+		// string "i"
+		o = append(o, 0x83, 0xa1, 0x69)
+		o = msgp.AppendString(o, z.Locks[za0002].ID)
+		// string "h"
+		o = append(o, 0xa1, 0x68)
+		o = msgp.AppendInt64(o, z.Locks[za0002].Handle)
+		// string "f"
+		o = append(o, 0xa1, 0x66)
+		o = msgp.AppendInt64(o, z.Locks[za0002].Token)
+	}
+	// string "c"
+	o = append(o, 0xa1, 0x63)
+	o = msgp.AppendInt64(o, z.Created)
+	// string "u"
+	o = append(o, 0xa1, 0x75)
+	o = msgp.AppendInt64(o, z.Updated)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *LockGroup) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "i":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "IDs")
+				return
+			}
+			if cap(z.IDs) >= int(zb0002) {
+				z.IDs = (z.IDs)[:zb0002]
+			} else {
+				z.IDs = make([]string, zb0002)
+			}
+			for za0001 := range z.IDs {
+				z.IDs[za0001], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "IDs", za0001)
+					return
+				}
+			}
+		case "h":
+			z.Handle, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Handle")
+				return
+			}
+		case "t":
+			z.Till, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Till")
+				return
+			}
+		case "l":
+			var zb0003 uint32
+			zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Locks")
+				return
+			}
+			if cap(z.Locks) >= int(zb0003) {
+				z.Locks = (z.Locks)[:zb0003]
+			} else {
+				z.Locks = make([]LockGroupLock, zb0003)
+			}
+			for za0002 := range z.Locks {
+				var zb0004 uint32
+				zb0004, bts, err = msgp.ReadMapHeaderBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Locks", za0002)
+					return
+				}
+				for zb0004 > 0 {
+					zb0004--
+					field, bts, err = msgp.ReadMapKeyZC(bts)
+					if err != nil {
+						err = msgp.WrapError(err, "Locks", za0002)
+						return
+					}
+					switch msgp.UnsafeString(field) {
+					case "i":
+						z.Locks[za0002].ID, bts, err = msgp.ReadStringBytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Locks", za0002, "ID")
+							return
+						}
+					case "h":
+						z.Locks[za0002].Handle, bts, err = msgp.ReadInt64Bytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Locks", za0002, "Handle")
+							return
+						}
+					case "f":
+						z.Locks[za0002].Token, bts, err = msgp.ReadInt64Bytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Locks", za0002, "Token")
+							return
+						}
+					default:
+						bts, err = msgp.Skip(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Locks", za0002)
+							return
+						}
+					}
+				}
+			}
+		case "c":
+			z.Created, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "u":
+			z.Updated, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *LockGroup) Msgsize() (s int) {
+	s = 1 + 2 + msgp.ArrayHeaderSize
+	for za0001 := range z.IDs {
+		s += msgp.StringPrefixSize + len(z.IDs[za0001])
+	}
+	s += 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.ArrayHeaderSize
+	for za0002 := range z.Locks {
+		s += 1 + 2 + msgp.StringPrefixSize + len(z.Locks[za0002].ID) + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	}
+	s += 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *LockGroupLock) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "i":
+			z.ID, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "ID")
+				return
+			}
+		case "h":
+			z.Handle, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Handle")
+				return
+			}
+		case "f":
+			z.Token, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Token")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z LockGroupLock) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "i"
+	err = en.Append(0x83, 0xa1, 0x69)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.ID)
+	if err != nil {
+		err = msgp.WrapError(err, "ID")
+		return
+	}
+	// write "h"
+	err = en.Append(0xa1, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Handle)
+	if err != nil {
+		err = msgp.WrapError(err, "Handle")
+		return
+	}
+	// write "f"
+	err = en.Append(0xa1, 0x66)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Token)
+	if err != nil {
+		err = msgp.WrapError(err, "Token")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z LockGroupLock) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "i"
+	o = append(o, 0x83, 0xa1, 0x69)
+	o = msgp.AppendString(o, z.ID)
+	// string "h"
+	o = append(o, 0xa1, 0x68)
+	o = msgp.AppendInt64(o, z.Handle)
+	// string "f"
+	o = append(o, 0xa1, 0x66)
+	o = msgp.AppendInt64(o, z.Token)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *LockGroupLock) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "i":
+			z.ID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ID")
+				return
+			}
+		case "h":
+			z.Handle, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Handle")
+				return
+			}
+		case "f":
+			z.Token, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Token")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z LockGroupLock) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.ID) + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *LockSteal) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "a":
+			z.Acc, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Acc")
+				return
+			}
+		case "i":
+			z.ID, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "ID")
+				return
+			}
+		case "f":
+			z.Fast, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "Fast")
+				return
+			}
+		case "po":
+			z.PrevOwner, err = dc.ReadBytes(z.PrevOwner)
+			if err != nil {
+				err = msgp.WrapError(err, "PrevOwner")
+				return
+			}
+		case "pt":
+			z.PrevToken, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "PrevToken")
+				return
+			}
+		case "pl":
+			z.PrevLease, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "PrevLease")
+				return
+			}
+		case "o":
+			z.Owner, err = dc.ReadBytes(z.Owner)
+			if err != nil {
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "t":
+			z.Token, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Token")
+				return
+			}
+		case "b":
+			z.By, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "By")
+				return
+			}
+		case "r":
+			z.Reason, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Reason")
+				return
+			}
+		case "at":
+			z.At, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "At")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *LockSteal) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 11
+	// write "a"
+	err = en.Append(0x8b, 0xa1, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Acc)
+	if err != nil {
+		err = msgp.WrapError(err, "Acc")
+		return
+	}
+	// write "i"
+	err = en.Append(0xa1, 0x69)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.ID)
+	if err != nil {
+		err = msgp.WrapError(err, "ID")
+		return
+	}
+	// write "f"
+	err = en.Append(0xa1, 0x66)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.Fast)
+	if err != nil {
+		err = msgp.WrapError(err, "Fast")
+		return
+	}
+	// write "po"
+	err = en.Append(0xa2, 0x70, 0x6f)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.PrevOwner)
+	if err != nil {
+		err = msgp.WrapError(err, "PrevOwner")
+		return
+	}
+	// write "pt"
+	err = en.Append(0xa2, 0x70, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.PrevToken)
+	if err != nil {
+		err = msgp.WrapError(err, "PrevToken")
+		return
+	}
+	// write "pl"
+	err = en.Append(0xa2, 0x70, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.PrevLease)
+	if err != nil {
+		err = msgp.WrapError(err, "PrevLease")
+		return
+	}
+	// write "o"
+	err = en.Append(0xa1, 0x6f)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.Owner)
+	if err != nil {
+		err = msgp.WrapError(err, "Owner")
+		return
+	}
+	// write "t"
+	err = en.Append(0xa1, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Token)
+	if err != nil {
+		err = msgp.WrapError(err, "Token")
+		return
+	}
+	// write "b"
+	err = en.Append(0xa1, 0x62)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.By)
+	if err != nil {
+		err = msgp.WrapError(err, "By")
+		return
+	}
+	// write "r"
+	err = en.Append(0xa1, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Reason)
+	if err != nil {
+		err = msgp.WrapError(err, "Reason")
+		return
+	}
+	// write "at"
+	err = en.Append(0xa2, 0x61, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.At)
+	if err != nil {
+		err = msgp.WrapError(err, "At")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *LockSteal) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 11
+	// string "a"
+	o = append(o, 0x8b, 0xa1, 0x61)
+	o = msgp.AppendString(o, z.Acc)
+	// string "i"
+	o = append(o, 0xa1, 0x69)
+	o = msgp.AppendString(o, z.ID)
+	// string "f"
+	o = append(o, 0xa1, 0x66)
+	o = msgp.AppendBool(o, z.Fast)
+	// string "po"
+	o = append(o, 0xa2, 0x70, 0x6f)
+	o = msgp.AppendBytes(o, z.PrevOwner)
+	// string "pt"
+	o = append(o, 0xa2, 0x70, 0x74)
+	o = msgp.AppendInt64(o, z.PrevToken)
+	// string "pl"
+	o = append(o, 0xa2, 0x70, 0x6c)
+	o = msgp.AppendString(o, z.PrevLease)
+	// string "o"
+	o = append(o, 0xa1, 0x6f)
+	o = msgp.AppendBytes(o, z.Owner)
+	// string "t"
+	o = append(o, 0xa1, 0x74)
+	o = msgp.AppendInt64(o, z.Token)
+	// string "b"
+	o = append(o, 0xa1, 0x62)
+	o = msgp.AppendString(o, z.By)
+	// string "r"
+	o = append(o, 0xa1, 0x72)
+	o = msgp.AppendString(o, z.Reason)
+	// string "at"
+	o = append(o, 0xa2, 0x61, 0x74)
+	o = msgp.AppendInt64(o, z.At)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *LockSteal) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "a":
+			z.Acc, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Acc")
+				return
+			}
+		case "i":
+			z.ID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ID")
+				return
+			}
+		case "f":
+			z.Fast, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Fast")
+				return
+			}
+		case "po":
+			z.PrevOwner, bts, err = msgp.ReadBytesBytes(bts, z.PrevOwner)
+			if err != nil {
+				err = msgp.WrapError(err, "PrevOwner")
+				return
+			}
+		case "pt":
+			z.PrevToken, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "PrevToken")
+				return
+			}
+		case "pl":
+			z.PrevLease, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "PrevLease")
+				return
+			}
+		case "o":
+			z.Owner, bts, err = msgp.ReadBytesBytes(bts, z.Owner)
+			if err != nil {
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "t":
+			z.Token, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Token")
+				return
+			}
+		case "b":
+			z.By, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "By")
+				return
+			}
+		case "r":
+			z.Reason, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Reason")
+				return
+			}
+		case "at":
+			z.At, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "At")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *LockSteal) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.Acc) + 2 + msgp.StringPrefixSize + len(z.ID) + 2 + msgp.BoolSize + 3 + msgp.BytesPrefixSize + len(z.PrevOwner) + 3 + msgp.Int64Size + 3 + msgp.StringPrefixSize + len(z.PrevLease) + 2 + msgp.BytesPrefixSize + len(z.Owner) + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.By) + 2 + msgp.StringPrefixSize + len(z.Reason) + 3 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *PartitionGroup) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "n":
+			z.Partitions, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "Partitions")
+				return
+			}
+		case "m":
+			z.Members, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Members")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z PartitionGroup) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 2
+	// write "n"
+	err = en.Append(0x82, 0xa1, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.Partitions)
+	if err != nil {
+		err = msgp.WrapError(err, "Partitions")
+		return
+	}
+	// write "m"
+	err = en.Append(0xa1, 0x6d)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Members)
+	if err != nil {
+		err = msgp.WrapError(err, "Members")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z PartitionGroup) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 2
+	// string "n"
+	o = append(o, 0x82, 0xa1, 0x6e)
+	o = msgp.AppendInt(o, z.Partitions)
+	// string "m"
+	o = append(o, 0xa1, 0x6d)
+	o = msgp.AppendString(o, z.Members)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *PartitionGroup) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "n":
+			z.Partitions, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Partitions")
+				return
+			}
+		case "m":
+			z.Members, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Members")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z PartitionGroup) Msgsize() (s int) {
+	s = 1 + 2 + msgp.IntSize + 2 + msgp.StringPrefixSize + len(z.Members)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *QueueMeta) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Total":
+			z.Total, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Total")
+				return
+			}
+		case "Counter":
+			z.Counter, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Counter")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z QueueMeta) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 2
+	// write "Total"
+	err = en.Append(0x82, 0xa5, 0x54, 0x6f, 0x74, 0x61, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Total)
+	if err != nil {
+		err = msgp.WrapError(err, "Total")
+		return
+	}
+	// write "Counter"
+	err = en.Append(0xa7, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Counter)
+	if err != nil {
+		err = msgp.WrapError(err, "Counter")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z QueueMeta) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 2
+	// string "Total"
+	o = append(o, 0x82, 0xa5, 0x54, 0x6f, 0x74, 0x61, 0x6c)
+	o = msgp.AppendInt64(o, z.Total)
+	// string "Counter"
+	o = append(o, 0xa7, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72)
+	o = msgp.AppendInt64(o, z.Counter)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *QueueMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Total":
+			z.Total, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Total")
+				return
+			}
+		case "Counter":
+			z.Counter, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Counter")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z QueueMeta) Msgsize() (s int) {
+	s = 1 + 6 + msgp.Int64Size + 8 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Quota) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "l":
+			z.Limit, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Limit")
+				return
+			}
+		case "u":
+			z.Used, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Used")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z Quota) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 2
+	// write "l"
+	err = en.Append(0x82, 0xa1, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Limit)
+	if err != nil {
+		err = msgp.WrapError(err, "Limit")
+		return
+	}
+	// write "u"
+	err = en.Append(0xa1, 0x75)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Used)
+	if err != nil {
+		err = msgp.WrapError(err, "Used")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z Quota) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 2
+	// string "l"
+	o = append(o, 0x82, 0xa1, 0x6c)
+	o = msgp.AppendInt64(o, z.Limit)
+	// string "u"
+	o = append(o, 0xa1, 0x75)
+	o = msgp.AppendInt64(o, z.Used)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Quota) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "l":
+			z.Limit, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Limit")
+				return
+			}
+		case "u":
+			z.Used, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Used")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z Quota) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *RateSample) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "m":
+			z.Minute, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Minute")
+				return
+			}
+		case "v":
+			z.Value, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Value")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z RateSample) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 2
+	// write "m"
+	err = en.Append(0x82, 0xa1, 0x6d)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Minute)
+	if err != nil {
+		err = msgp.WrapError(err, "Minute")
+		return
+	}
+	// write "v"
+	err = en.Append(0xa1, 0x76)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Value)
+	if err != nil {
+		err = msgp.WrapError(err, "Value")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z RateSample) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 2
+	// string "m"
+	o = append(o, 0x82, 0xa1, 0x6d)
+	o = msgp.AppendInt64(o, z.Minute)
+	// string "v"
+	o = append(o, 0xa1, 0x76)
+	o = msgp.AppendInt64(o, z.Value)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *RateSample) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "m":
+			z.Minute, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Minute")
+				return
+			}
+		case "v":
+			z.Value, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Value")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z RateSample) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Seq) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "v":
+			z.Value, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Value")
+				return
+			}
+		case "s":
+			z.Start, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Start")
+				return
+			}
+		case "st":
+			z.Step, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Step")
+				return
+			}
+		case "f":
+			z.Format, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Format")
+				return
+			}
+		case "cy":
+			z.Cycle, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "Cycle")
+				return
+			}
+		case "m":
+			z.Max, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Max")
+				return
+			}
+		case "r":
+			z.Rollovers, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Rollovers")
+				return
+			}
+		case "c":
+			z.Created, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "u":
+			z.Updated, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Seq) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 9
+	// write "v"
+	err = en.Append(0x89, 0xa1, 0x76)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Value)
+	if err != nil {
+		err = msgp.WrapError(err, "Value")
+		return
+	}
+	// write "s"
+	err = en.Append(0xa1, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Start)
+	if err != nil {
+		err = msgp.WrapError(err, "Start")
+		return
+	}
+	// write "st"
+	err = en.Append(0xa2, 0x73, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Step)
+	if err != nil {
+		err = msgp.WrapError(err, "Step")
+		return
+	}
+	// write "f"
+	err = en.Append(0xa1, 0x66)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Format)
+	if err != nil {
+		err = msgp.WrapError(err, "Format")
+		return
+	}
+	// write "cy"
+	err = en.Append(0xa2, 0x63, 0x79)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.Cycle)
+	if err != nil {
+		err = msgp.WrapError(err, "Cycle")
+		return
+	}
+	// write "m"
+	err = en.Append(0xa1, 0x6d)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Max)
+	if err != nil {
+		err = msgp.WrapError(err, "Max")
+		return
+	}
+	// write "r"
+	err = en.Append(0xa1, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Rollovers)
+	if err != nil {
+		err = msgp.WrapError(err, "Rollovers")
+		return
+	}
+	// write "c"
+	err = en.Append(0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Created)
+	if err != nil {
+		err = msgp.WrapError(err, "Created")
+		return
+	}
+	// write "u"
+	err = en.Append(0xa1, 0x75)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Updated)
+	if err != nil {
+		err = msgp.WrapError(err, "Updated")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Seq) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 9
+	// string "v"
+	o = append(o, 0x89, 0xa1, 0x76)
+	o = msgp.AppendInt64(o, z.Value)
+	// string "s"
+	o = append(o, 0xa1, 0x73)
+	o = msgp.AppendInt64(o, z.Start)
+	// string "st"
+	o = append(o, 0xa2, 0x73, 0x74)
+	o = msgp.AppendInt64(o, z.Step)
+	// string "f"
+	o = append(o, 0xa1, 0x66)
+	o = msgp.AppendString(o, z.Format)
+	// string "cy"
+	o = append(o, 0xa2, 0x63, 0x79)
+	o = msgp.AppendBool(o, z.Cycle)
+	// string "m"
+	o = append(o, 0xa1, 0x6d)
+	o = msgp.AppendInt64(o, z.Max)
+	// string "r"
+	o = append(o, 0xa1, 0x72)
+	o = msgp.AppendInt64(o, z.Rollovers)
+	// string "c"
+	o = append(o, 0xa1, 0x63)
+	o = msgp.AppendInt64(o, z.Created)
+	// string "u"
+	o = append(o, 0xa1, 0x75)
+	o = msgp.AppendInt64(o, z.Updated)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Seq) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "v":
+			z.Value, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Value")
+				return
+			}
+		case "s":
+			z.Start, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Start")
+				return
+			}
+		case "st":
+			z.Step, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Step")
+				return
+			}
+		case "f":
+			z.Format, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Format")
+				return
+			}
+		case "cy":
+			z.Cycle, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Cycle")
+				return
+			}
+		case "m":
+			z.Max, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Max")
+				return
+			}
+		case "r":
+			z.Rollovers, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Rollovers")
+				return
+			}
+		case "c":
+			z.Created, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "u":
+			z.Updated, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Updated")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Seq) Msgsize() (s int) {
+	s = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 3 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.Format) + 3 + msgp.BoolSize + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Setting) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "v":
+			z.Value, err = dc.ReadBytes(z.Value)
+			if err != nil {
+				err = msgp.WrapError(err, "Value")
+				return
+			}
+		case "c":
+			z.Changed, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Changed")
+				return
+			}
+		case "b":
+			z.By, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "By")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Setting) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "v"
+	err = en.Append(0x83, 0xa1, 0x76)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.Value)
+	if err != nil {
+		err = msgp.WrapError(err, "Value")
+		return
+	}
+	// write "c"
+	err = en.Append(0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Changed)
+	if err != nil {
+		err = msgp.WrapError(err, "Changed")
+		return
+	}
+	// write "b"
+	err = en.Append(0xa1, 0x62)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.By)
+	if err != nil {
+		err = msgp.WrapError(err, "By")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Setting) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "v"
+	o = append(o, 0x83, 0xa1, 0x76)
+	o = msgp.AppendBytes(o, z.Value)
+	// string "c"
+	o = append(o, 0xa1, 0x63)
+	o = msgp.AppendInt64(o, z.Changed)
+	// string "b"
+	o = append(o, 0xa1, 0x62)
+	o = msgp.AppendString(o, z.By)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Setting) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "v":
+			z.Value, bts, err = msgp.ReadBytesBytes(bts, z.Value)
+			if err != nil {
+				err = msgp.WrapError(err, "Value")
+				return
+			}
+		case "c":
+			z.Changed, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Changed")
+				return
+			}
+		case "b":
+			z.By, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "By")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Setting) Msgsize() (s int) {
+	s = 1 + 2 + msgp.BytesPrefixSize + len(z.Value) + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.By)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *SettingChange) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "n":
+			z.Name, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Name")
+				return
+			}
+		case "o":
+			z.Old, err = dc.ReadBytes(z.Old)
+			if err != nil {
+				err = msgp.WrapError(err, "Old")
+				return
+			}
+		case "v":
+			z.New, err = dc.ReadBytes(z.New)
+			if err != nil {
+				err = msgp.WrapError(err, "New")
+				return
+			}
+		case "a":
+			z.At, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "At")
+				return
+			}
+		case "b":
+			z.By, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "By")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *SettingChange) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 5
+	// write "n"
+	err = en.Append(0x85, 0xa1, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Name)
+	if err != nil {
+		err = msgp.WrapError(err, "Name")
+		return
+	}
+	// write "o"
+	err = en.Append(0xa1, 0x6f)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.Old)
+	if err != nil {
+		err = msgp.WrapError(err, "Old")
+		return
+	}
+	// write "v"
+	err = en.Append(0xa1, 0x76)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.New)
+	if err != nil {
+		err = msgp.WrapError(err, "New")
+		return
+	}
+	// write "a"
+	err = en.Append(0xa1, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.At)
+	if err != nil {
+		err = msgp.WrapError(err, "At")
+		return
+	}
+	// write "b"
+	err = en.Append(0xa1, 0x62)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.By)
+	if err != nil {
+		err = msgp.WrapError(err, "By")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *SettingChange) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 5
+	// string "n"
+	o = append(o, 0x85, 0xa1, 0x6e)
+	o = msgp.AppendString(o, z.Name)
+	// string "o"
+	o = append(o, 0xa1, 0x6f)
+	o = msgp.AppendBytes(o, z.Old)
+	// string "v"
+	o = append(o, 0xa1, 0x76)
+	o = msgp.AppendBytes(o, z.New)
+	// string "a"
+	o = append(o, 0xa1, 0x61)
+	o = msgp.AppendInt64(o, z.At)
+	// string "b"
+	o = append(o, 0xa1, 0x62)
+	o = msgp.AppendString(o, z.By)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *SettingChange) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "n":
+			z.Name, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Name")
+				return
+			}
+		case "o":
+			z.Old, bts, err = msgp.ReadBytesBytes(bts, z.Old)
+			if err != nil {
+				err = msgp.WrapError(err, "Old")
+				return
+			}
+		case "v":
+			z.New, bts, err = msgp.ReadBytesBytes(bts, z.New)
+			if err != nil {
+				err = msgp.WrapError(err, "New")
+				return
+			}
+		case "a":
+			z.At, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "At")
+				return
+			}
+		case "b":
+			z.By, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "By")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SettingChange) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.Name) + 2 + msgp.BytesPrefixSize + len(z.Old) + 2 + msgp.BytesPrefixSize + len(z.New) + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len(z.By)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *VClock) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "c":
+			var zb0002 uint32
+			zb0002, err = dc.ReadMapHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Clock")
+				return
+			}
+			if z.Clock == nil {
+				z.Clock = make(map[string]int64, zb0002)
+			} else if len(z.Clock) > 0 {
+				for key := range z.Clock {
+					delete(z.Clock, key)
+				}
+			}
+			for zb0002 > 0 {
+				zb0002--
+				var za0001 string
+				var za0002 int64
+				za0001, err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Clock")
+					return
+				}
+				za0002, err = dc.ReadInt64()
+				if err != nil {
+					err = msgp.WrapError(err, "Clock", za0001)
+					return
+				}
+				z.Clock[za0001] = za0002
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *VClock) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 1
+	// write "c"
+	err = en.Append(0x81, 0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteMapHeader(uint32(len(z.Clock)))
+	if err != nil {
+		err = msgp.WrapError(err, "Clock")
+		return
+	}
+	for za0001, za0002 := range z.Clock {
+		err = en.WriteString(za0001)
+		if err != nil {
+			err = msgp.WrapError(err, "Clock")
+			return
+		}
+		err = en.WriteInt64(za0002)
+		if err != nil {
+			err = msgp.WrapError(err, "Clock", za0001)
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *VClock) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 1
+	// string "c"
+	o = append(o, 0x81, 0xa1, 0x63)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Clock)))
+	for za0001, za0002 := range z.Clock {
+		o = msgp.AppendString(o, za0001)
+		o = msgp.AppendInt64(o, za0002)
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *VClock) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "c":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Clock")
+				return
+			}
+			if z.Clock == nil {
+				z.Clock = make(map[string]int64, zb0002)
+			} else if len(z.Clock) > 0 {
+				for key := range z.Clock {
+					delete(z.Clock, key)
+				}
+			}
+			for zb0002 > 0 {
+				var za0001 string
+				var za0002 int64
+				zb0002--
+				za0001, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Clock")
+					return
+				}
+				za0002, bts, err = msgp.ReadInt64Bytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Clock", za0001)
+					return
+				}
+				z.Clock[za0001] = za0002
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *VClock) Msgsize() (s int) {
+	s = 1 + 2 + msgp.MapHeaderSize
+	if z.Clock != nil {
+		for za0001, za0002 := range z.Clock {
+			_ = za0002
+			s += msgp.StringPrefixSize + len(za0001) + msgp.Int64Size
+		}
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *WebhookKey) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "s":
+			z.Secret, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Secret")
+				return
+			}
+		case "c":
+			z.Created, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z WebhookKey) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 2
+	// write "s"
+	err = en.Append(0x82, 0xa1, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Secret)
+	if err != nil {
+		err = msgp.WrapError(err, "Secret")
+		return
+	}
+	// write "c"
+	err = en.Append(0xa1, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Created)
+	if err != nil {
+		err = msgp.WrapError(err, "Created")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z WebhookKey) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 2
+	// string "s"
+	o = append(o, 0x82, 0xa1, 0x73)
+	o = msgp.AppendString(o, z.Secret)
+	// string "c"
+	o = append(o, 0xa1, 0x63)
+	o = msgp.AppendInt64(o, z.Created)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *WebhookKey) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "s":
+			z.Secret, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Secret")
+				return
+			}
+		case "c":
+			z.Created, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z WebhookKey) Msgsize() (s int) {
+	s = 1 + 2 + msgp.StringPrefixSize + len(z.Secret) + 2 + msgp.Int64Size
 	return
 }
@@ -0,0 +1,224 @@
+// Checkouts are optimistic offline locks for human workflows - user
+// checks out a record, edits it for half an hour and checks it back in.
+//
+// Unlike fast locks nobody waits on a checkout - if record is checked out
+// by someone else request fails right away. Checkout can be taken over
+// with Force (for ex. by admin) and every takeover is kept in audit log.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const checkoutAuditLen = 20
+
+type CheckoutRequest struct {
+	Owner  string
+	Dur    int  // seconds
+	Force  bool // take over checkout of another owner
+	Reason string
+}
+
+type CheckoutAudit struct {
+	At       int64
+	Owner    string
+	Previous string
+	Reason   string
+}
+
+type CheckoutResponse struct {
+	Owner string          `json:",omitempty"`
+	Since int64           `json:",omitempty"`
+	Till  int64           `json:",omitempty"`
+	Audit []CheckoutAudit `json:",omitempty"`
+}
+
+func toCheckoutResponse(c cd.Checkout) CheckoutResponse {
+	res := CheckoutResponse{
+		Owner: c.Owner,
+		Since: c.Since,
+		Till:  c.Till,
+	}
+	for _, v := range c.Audit {
+		res.Audit = append(res.Audit, CheckoutAudit(v))
+	}
+	return res
+}
+
+func getCheckout(b pebble.Reader, acc, id string) (cd.Checkout, error) {
+	var c cd.Checkout
+	d, closer, err := b.Get(compID(cd.CheckoutPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	defer closer.Close()
+	_, err = c.UnmarshalMsg(d)
+	return c, err
+}
+
+func putCheckout(b *pebble.Batch, acc, id string, c cd.Checkout) error {
+	d, err := c.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.CheckoutPrefix, acc, id), d, pebble.NoSync)
+}
+
+func GetCheckoutHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	c, err := getCheckout(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if c.Till < time.Now().Unix() { // expired - keep only audit
+		c.Owner, c.Since, c.Till = "", 0, 0
+	}
+	d, err := json.Marshal(toCheckoutResponse(c))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// CheckoutHandler checks out the record or extends existing checkout of the owner.
+func CheckoutHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req CheckoutRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if req.Owner == "" || req.Dur <= 0 {
+		ctx.Error("owner and dur are required", 400)
+		return
+	}
+	var c cd.Checkout
+	conflict := false
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		c, err = getCheckout(b, acc, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		held := c.Till >= now && c.Owner != req.Owner
+		if held && !req.Force {
+			conflict = true
+			return nil
+		}
+		if held {
+			c.Audit = append(c.Audit, cd.CheckoutAudit{
+				At:       now,
+				Owner:    req.Owner,
+				Previous: c.Owner,
+				Reason:   req.Reason,
+			})
+			if len(c.Audit) > checkoutAuditLen {
+				c.Audit = c.Audit[len(c.Audit)-checkoutAuditLen:]
+			}
+		}
+		if c.Owner != req.Owner || c.Till < now {
+			c.Since = now
+		}
+		c.Owner = req.Owner
+		c.Till = now + int64(req.Dur)
+		err = putCheckout(b, acc, id, c)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if conflict {
+		ctx.Error(fmt.Sprintf("checked out by %v till %v", c.Owner, c.Till), 409)
+		return
+	}
+	d, err := json.Marshal(toCheckoutResponse(c))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// CheckinHandler releases checkout of ?owner=
+func CheckinHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	owner := string(ctx.QueryArgs().Peek("owner"))
+	var c cd.Checkout
+	conflict := false
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		c, err = getCheckout(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if c.Till < time.Now().Unix() {
+			return nil // expired already
+		}
+		if c.Owner != owner {
+			conflict = true
+			return nil
+		}
+		c.Owner, c.Since, c.Till = "", 0, 0
+		if len(c.Audit) == 0 {
+			err = b.Delete(compID(cd.CheckoutPrefix, acc, id), pebble.NoSync)
+		} else {
+			err = putCheckout(b, acc, id, c)
+		}
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if conflict {
+		ctx.Error(fmt.Sprintf("checked out by %v till %v", c.Owner, c.Till), 409)
+		return
+	}
+}
@@ -0,0 +1,241 @@
+// Job claims allow using KV items under a prefix as a simple job queue.
+//
+// Worker claims the oldest (lowest version) item that is not claimed by
+// anyone else, processes it while renewing the claim and then completes
+// it, which deletes the item. If worker dies - claim expires and item can
+// be claimed by another worker.
+//
+// Claims are stored separately from KV items, so producers can keep
+// updating items without affecting the claims.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const claimMaxScan = 10000 // max items scanned to find the oldest one
+
+type ClaimResponse struct {
+	Key     string
+	Value   json.RawMessage `json:",omitempty"`
+	Version int64           `json:",omitempty"`
+	Handle  int64
+	Till    int64
+}
+
+func getClaim(b pebble.Reader, acc, key string) (*cd.Claim, error) {
+	d, closer, err := b.Get(compID(cd.ClaimPrefix, acc, key))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var c cd.Claim
+	_, err = c.UnmarshalMsg(d)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func putClaim(b *pebble.Batch, acc, key string, c cd.Claim) error {
+	d, err := c.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.ClaimPrefix, acc, key), d, pebble.NoSync)
+}
+
+// claimOldest finds unexpired item with the lowest version under the prefix
+// without active claim and claims it.
+func claimOldest(b *pebble.Batch, acc, prefix, owner string, ttl int) (*ClaimResponse, error) {
+	kvPrefix := compID(cd.KVPrefix, acc, prefix)
+	iter, err := b.NewIter(&pebble.IterOptions{
+		LowerBound: kvPrefix,
+		UpperBound: prefixEnd(kvPrefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	now := time.Now().Unix()
+	var res *ClaimResponse
+	scanned := 0
+	for iter.First(); iter.Valid() && scanned < claimMaxScan; iter.Next() {
+		scanned++
+		var v cd.KV
+		_, err := v.UnmarshalMsg(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if res != nil && res.Version <= v.Version {
+			continue
+		}
+		if v.Expires != 0 && v.Expires <= now { // expired, but not swept yet
+			continue
+		}
+		key := string(bytes.TrimPrefix(iter.Key(), compID(cd.KVPrefix, acc, "")))
+		c, err := getClaim(b, acc, key)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil && c.Till >= now {
+			continue
+		}
+		v.Data = append([]byte{}, v.Data...)
+		err = loadCold(&v)
+		if err != nil {
+			return nil, err
+		}
+		res = &ClaimResponse{
+			Key:     key,
+			Value:   v.Data,
+			Version: v.Version,
+		}
+	}
+	if res == nil {
+		return nil, nil
+	}
+	res.Handle = time.Now().UnixNano()
+	res.Till = now + int64(ttl)
+	err = putClaim(b, acc, res.Key, cd.Claim{
+		Handle: res.Handle,
+		Owner:  owner,
+		Till:   res.Till,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func getClaimTTL(ctx *fasthttp.RequestCtx) (int, error) {
+	ttl := ctx.QueryArgs().GetUintOrZero("ttl")
+	if ttl <= 0 || ttl > 86400 {
+		return 0, fmt.Errorf("ttl is not in range 1~86400")
+	}
+	return ttl, nil
+}
+
+// ClaimHandler claims the oldest unclaimed item under ?prefix= for ?ttl= seconds
+func ClaimHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl, err := getClaimTTL(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	prefix := string(ctx.QueryArgs().Peek("prefix"))
+	owner := string(ctx.QueryArgs().Peek("owner"))
+	var res *ClaimResponse
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		res, err = claimOldest(b, acc, prefix, owner, ttl)
+		if err != nil || res == nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if res == nil {
+		ctx.Error("nothing to claim", 404)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// updateClaim validates ?handle= of the claim and calls f to modify it
+func updateClaim(ctx *fasthttp.RequestCtx, f func(b *pebble.Batch, acc, key string, c *cd.Claim) error) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	key, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	handle := int64(ctx.QueryArgs().GetUintOrZero("handle"))
+	var res *ClaimResponse
+	lost := false
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		c, err := getClaim(b, acc, key)
+		if err != nil {
+			return err
+		}
+		if c == nil || c.Handle != handle || c.Till < time.Now().Unix() {
+			lost = true
+			return nil
+		}
+		err = f(b, acc, key, c)
+		if err != nil {
+			return err
+		}
+		res = &ClaimResponse{Key: key, Handle: c.Handle, Till: c.Till}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if lost {
+		ctx.Error("claim expired or taken by another worker", 409)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// RenewClaimHandler extends claim for ?ttl= seconds from now
+func RenewClaimHandler(ctx *fasthttp.RequestCtx) {
+	ttl, err := getClaimTTL(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	updateClaim(ctx, func(b *pebble.Batch, acc, key string, c *cd.Claim) error {
+		c.Till = time.Now().Unix() + int64(ttl)
+		return putClaim(b, acc, key, *c)
+	})
+}
+
+// CompleteClaimHandler deletes claimed item. With ?release=1 claim
+// is removed, but item is kept to be claimed again.
+func CompleteClaimHandler(ctx *fasthttp.RequestCtx) {
+	release := ctx.QueryArgs().GetBool("release")
+	updateClaim(ctx, func(b *pebble.Batch, acc, key string, c *cd.Claim) error {
+		c.Till = 0
+		err := b.Delete(compID(cd.ClaimPrefix, acc, key), pebble.NoSync)
+		if err != nil || release {
+			return err
+		}
+		return handleKVSet(acc, b, &KV{Key: key, Delete: true})
+	})
+}
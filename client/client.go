@@ -0,0 +1,72 @@
+// Package client is Go client of cdtools. It covers the parts that are hard
+// to get right by hand, plain API calls can be made with Do.
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type Client struct {
+	URL  string // for ex. http://cd:8080
+	HTTP *fasthttp.Client
+}
+
+func New(url string) *Client {
+	return &Client{URL: url, HTTP: &fasthttp.Client{}}
+}
+
+// StatusError is returned when server responds with non-200 status
+type StatusError struct {
+	Code       int
+	Body       string
+	ErrorCode  string        // stable code of the error, for ex. LOCK_HELD
+	Retryable  bool          // same request may succeed later (after RetryAfter)
+	RetryAfter time.Duration // 0 if server didn't set it
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("cdtools: %v %v", e.Code, e.Body)
+}
+
+// Do sends JSON request to the path and decodes JSON response into res if it isn't nil
+func (c *Client) Do(method, path string, req, res any, timeout time.Duration) error {
+	r := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(r)
+	defer fasthttp.ReleaseResponse(resp)
+	r.Header.SetMethod(method)
+	r.SetRequestURI(c.URL + path)
+	if req != nil {
+		d, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		r.Header.SetContentType("application/json")
+		r.SetBody(d)
+	}
+	err := c.HTTP.DoTimeout(r, resp, timeout)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != 200 {
+		e := &StatusError{
+			Code:      resp.StatusCode(),
+			Body:      string(resp.Body()),
+			ErrorCode: string(resp.Header.Peek("X-Error-Code")),
+			Retryable: string(resp.Header.Peek("X-Retryable")) == "true",
+		}
+		if s, err := strconv.Atoi(string(resp.Header.Peek("Retry-After"))); err == nil {
+			e.RetryAfter = time.Duration(s) * time.Second
+		}
+		return e
+	}
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Body(), res)
+}
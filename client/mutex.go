@@ -0,0 +1,273 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+var ErrLockLost = errors.New("cdtools: lock lost")
+var ErrNotHeld = errors.New("cdtools: lock is not held")
+
+// Mutex is a fast lock of the server usable as sync.Locker. Held lock is
+// renewed every TTL/3, failed renewals are retried more often till TTL/10
+// is left, after that or when server rejects the renewal the lock is lost:
+// context returned by LockContext is cancelled with ErrLockLost and OnLost
+// is called. Goroutines of the process wait for the lock locally, so only
+// one of them waits on the server. Lock acquired when the response didn't
+// reach the client (network error) is released by the server after TTL.
+type Mutex struct {
+	TTL     time.Duration   // lock expires if the process dies, default 30s
+	Wait    time.Duration   // server waits for the lock per request, default 10s
+	Owner   json.RawMessage // holder metadata shown by lock inspection
+	OwnerID string          // ID of the client for deadlock detection
+	OnLost  func(err error) // called in a new goroutine when held lock is lost
+
+	c   *Client
+	acc string
+	id  string
+	sem chan struct{} // held by the goroutine that locked the mutex
+
+	mu   sync.Mutex // guards held
+	held *heldLock
+}
+
+type heldLock struct {
+	handle int64
+	token  int64
+	cancel context.CancelCauseFunc
+	stop   chan struct{} // closed by Unlock
+	done   chan struct{} // closed when renewals stop
+}
+
+type lockRequest struct {
+	LockID      string          `json:",omitempty"`
+	LockDur     int             `json:",omitempty"`
+	LockWait    int             `json:",omitempty"`
+	LockOwner   json.RawMessage `json:",omitempty"`
+	LockOwnerID string          `json:",omitempty"`
+	UnlockID    string          `json:",omitempty"`
+	Unlock      int64           `json:",omitempty"`
+}
+
+type lockResponse struct {
+	Lock  int64 `json:"l"`
+	Token int64 `json:"f"`
+}
+
+// Mutex returns lock id of the account, set its fields before the first Lock
+func (c *Client) Mutex(acc, id string) *Mutex {
+	return &Mutex{
+		TTL:  time.Second * 30,
+		Wait: time.Second * 10,
+		c:    c,
+		acc:  acc,
+		id:   id,
+		sem:  make(chan struct{}, 1),
+	}
+}
+
+// seconds rounds duration up to whole seconds the server works with
+func seconds(d time.Duration) int {
+	return max(int((d+time.Second-1)/time.Second), 1)
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryDelay returns Retry-After of the server or exponential backoff up to ~6s
+func retryDelay(err error, attempt int) time.Duration {
+	var se *StatusError
+	if errors.As(err, &se) && se.RetryAfter > 0 {
+		return se.RetryAfter
+	}
+	return time.Millisecond * 100 << min(attempt, 6)
+}
+
+func isDeadlock(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.ErrorCode == "DEADLOCK"
+}
+
+func (m *Mutex) path() string {
+	return "/req/" + url.PathEscape(m.acc)
+}
+
+// Lock acquires the lock, retrying till it succeeds. It panics on requests
+// server rejects as invalid, use LockContext to handle errors.
+func (m *Mutex) Lock() {
+	for attempt := 0; ; attempt++ {
+		_, err := m.LockContext(context.Background())
+		if err == nil {
+			return
+		}
+		if !isDeadlock(err) {
+			panic(err)
+		}
+		sleep(context.Background(), retryDelay(err, attempt)) // till the other side times out
+	}
+}
+
+// Unlock releases the lock, it does nothing if the lock was lost
+func (m *Mutex) Unlock() {
+	m.UnlockContext(context.Background())
+}
+
+// LockContext acquires the lock and holds it till Unlock or till ctx is done,
+// then the lock is released. Returned context is cancelled when the lock is
+// released or lost. Server errors and timeouts are retried till ctx is done,
+// deadlocks and invalid requests are returned.
+func (m *Mutex) LockContext(ctx context.Context) (context.Context, error) {
+	select {
+	case m.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	start, res, err := m.acquire(ctx)
+	if err != nil {
+		<-m.sem
+		return nil, err
+	}
+	lctx, cancel := context.WithCancelCause(context.Background())
+	h := &heldLock{handle: res.Lock, token: res.Token, cancel: cancel, stop: make(chan struct{}), done: make(chan struct{})}
+	m.mu.Lock()
+	m.held = h
+	m.mu.Unlock()
+	go m.renew(ctx, h, start)
+	return lctx, nil
+}
+
+func (m *Mutex) acquire(ctx context.Context) (time.Time, lockResponse, error) {
+	req := lockRequest{LockID: m.id, LockDur: seconds(m.TTL), LockWait: seconds(m.Wait), LockOwner: m.Owner, LockOwnerID: m.OwnerID}
+	for attempt := 0; ; attempt++ {
+		if ctx.Err() != nil {
+			return time.Time{}, lockResponse{}, ctx.Err()
+		}
+		start := time.Now()
+		var res lockResponse
+		err := m.c.Do("POST", m.path(), req, &res, m.Wait+time.Second*5)
+		var se *StatusError
+		switch {
+		case err == nil && ctx.Err() != nil: // cancelled while waiting for the server
+			m.unlock(res.Lock)
+			return time.Time{}, lockResponse{}, ctx.Err()
+		case err == nil:
+			return start, res, nil
+		case isDeadlock(err):
+			return time.Time{}, lockResponse{}, err
+		case errors.As(err, &se) && se.Code == 409: // server waited for the lock already
+			attempt = -1
+			continue
+		case errors.As(err, &se) && !se.Retryable:
+			return time.Time{}, lockResponse{}, err
+		}
+		if !sleep(ctx, retryDelay(err, attempt)) {
+			return time.Time{}, lockResponse{}, ctx.Err()
+		}
+	}
+}
+
+func (m *Mutex) renew(ctx context.Context, h *heldLock, start time.Time) {
+	defer close(h.done)
+	deadline := start.Add(m.TTL)
+	next := m.TTL / 3
+	for {
+		t := time.NewTimer(next)
+		select {
+		case <-h.stop:
+			t.Stop()
+			return
+		case <-ctx.Done():
+			t.Stop()
+			if m.end(h, context.Cause(ctx)) {
+				m.unlock(h.handle)
+			}
+			return
+		case <-t.C:
+		}
+		start := time.Now()
+		req := lockRequest{LockID: m.id, UnlockID: m.id, Unlock: h.handle, LockDur: seconds(m.TTL)}
+		err := m.c.Do("POST", m.path(), req, nil, m.TTL/3)
+		var se *StatusError
+		switch {
+		case err == nil:
+			deadline = start.Add(m.TTL)
+			next = m.TTL / 3
+		case errors.As(err, &se) && se.Code != 503: // expired or taken by someone else
+			m.lost(h, fmt.Errorf("%w: %v", ErrLockLost, err))
+			return
+		case time.Until(deadline) <= m.TTL/10:
+			m.lost(h, fmt.Errorf("%w: renewal failed: %v", ErrLockLost, err))
+			return
+		default:
+			next = min(m.TTL/10, time.Until(deadline)-m.TTL/10)
+		}
+	}
+}
+
+// end marks the lock as not held, returns false if it was done already
+func (m *Mutex) end(h *heldLock, cause error) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held != h {
+		return false
+	}
+	m.held = nil
+	h.cancel(cause)
+	<-m.sem
+	return true
+}
+
+func (m *Mutex) lost(h *heldLock, err error) {
+	if m.end(h, err) && m.OnLost != nil {
+		go m.OnLost(err)
+	}
+}
+
+func (m *Mutex) unlock(handle int64) error {
+	return m.c.Do("POST", m.path(), lockRequest{UnlockID: m.id, Unlock: handle}, nil, time.Second*5)
+}
+
+// UnlockContext releases the lock, returns ErrNotHeld if it isn't held or was lost
+func (m *Mutex) UnlockContext(ctx context.Context) error {
+	m.mu.Lock()
+	h := m.held
+	m.mu.Unlock()
+	if h == nil || !m.end(h, nil) {
+		return ErrNotHeld
+	}
+	close(h.stop)
+	select {
+	case <-h.done: // renewal in flight would extend the lock after unlock
+	case <-ctx.Done():
+		go func() {
+			<-h.done
+			m.unlock(h.handle)
+		}()
+		return ctx.Err()
+	}
+	return m.unlock(h.handle)
+}
+
+// Token returns fencing token of the held lock, 0 if it isn't held
+func (m *Mutex) Token() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held == nil {
+		return 0
+	}
+	return m.held.token
+}
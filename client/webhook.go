@@ -0,0 +1,75 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookHeader carries signatures of webhook deliveries:
+//
+//	t=<unix seconds>,v1=<key ID>:<hex HMAC-SHA256 of "<t>.<body>">[,v1=...]
+//
+// Delivery is signed with every key of the server, so consumers keep
+// working while keys are rotated.
+const WebhookHeader = "X-Cdtools-Signature"
+
+var ErrBadSignature = errors.New("cdtools: webhook signature doesn't match")
+var ErrStaleSignature = errors.New("cdtools: webhook signature is too old")
+
+// WebhookSignature returns HMAC of the body signed at unix seconds t
+func WebhookSignature(secret string, t int64, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(strconv.FormatInt(t, 10) + "."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// ParseWebhookHeader returns signing time and signatures by key ID
+func ParseWebhookHeader(header string) (int64, map[string]string, error) {
+	var t int64
+	sigs := map[string]string{}
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return 0, nil, errors.New("cdtools: invalid webhook signature time")
+			}
+			t = n
+		case "v1":
+			id, sig, ok := strings.Cut(v, ":")
+			if ok {
+				sigs[id] = sig
+			}
+		}
+	}
+	if t == 0 || len(sigs) == 0 {
+		return 0, nil, errors.New("cdtools: invalid webhook signature header")
+	}
+	return t, sigs, nil
+}
+
+// VerifyWebhook checks that delivery with the header value and body was
+// signed with the secret within tolerance (0 - any time ago)
+func VerifyWebhook(secret, header string, body []byte, tolerance time.Duration) error {
+	t, sigs, err := ParseWebhookHeader(header)
+	if err != nil {
+		return err
+	}
+	if tolerance > 0 && time.Since(time.Unix(t, 0)).Abs() > tolerance {
+		return ErrStaleSignature
+	}
+	want := WebhookSignature(secret, t, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
@@ -0,0 +1,658 @@
+// Consul API shim - the subset of session and KV endpoints `consul lock`
+// and Consul API clients use for locking, so tooling built around Consul
+// can point at cdtools (CONSUL_HTTP_ADDR=cd:8080). Everything works with
+// the single ConsulAccount.
+//
+// Sessions are leases created with Consul TTL ("15s", none - 30 days),
+// ?acquire=<session> takes the persistent lock of the key attached to the
+// session and ?release= releases it. When the session is destroyed or not
+// renewed, its locks are released or, with "delete" behavior, the keys are
+// deleted. ModifyIndex is KV version and LockIndex is fencing token of the
+// key. Blocking queries (?index=&wait=) are served by checking the key
+// every 200ms, index of missing keys and ?recurse listings is the index of
+// the whole account, so they may wake up without changes, like in Consul.
+// Lock delay, health checks, ACLs, datacenters and transactions are not
+// supported.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+var ErrInvalidSession = errors.New("invalid session")
+
+const consulPoll = time.Millisecond * 200
+
+// consulNoTTL is TTL of sessions created without one, the longest lease
+const consulNoTTL = 86400 * 30
+
+const (
+	consulMaxWait     = time.Minute * 10
+	consulDefaultWait = time.Minute * 5
+)
+
+type ConsulSessionRequest struct {
+	Name     string
+	TTL      string
+	Behavior string
+}
+
+type ConsulSession struct {
+	ID        string
+	Name      string
+	Node      string
+	Behavior  string
+	TTL       string
+	LockDelay int64
+	Checks    []string
+}
+
+type ConsulKVPair struct {
+	Key         string
+	CreateIndex int64 // the same as ModifyIndex, creation is not tracked
+	ModifyIndex int64
+	LockIndex   int64
+	Flags       uint64
+	Value       []byte // base64 in JSON
+	Session     string `json:",omitempty"`
+}
+
+func consulAcc() string {
+	if config.ConsulAccount != "" {
+		return config.ConsulAccount
+	}
+	return "consul"
+}
+
+// consulKey returns the key from /v1/kv/*key, empty for the root
+func consulKey(ctx *fasthttp.RequestCtx) (string, error) {
+	key, _ := ctx.UserValue("key").(string)
+	key = strings.TrimPrefix(key, "/")
+	if len(key) > 1024 {
+		return "", fmt.Errorf("key len is not in range 0~1024")
+	}
+	if strings.IndexByte(key, 0) >= 0 {
+		return "", fmt.Errorf("0 is not allowed as a character in key")
+	}
+	return key, nil
+}
+
+func writeConsulJSON(ctx *fasthttp.RequestCtx, v any) {
+	d, err := json.Marshal(v)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.Response.SetBody(d)
+}
+
+func consulSession(id string, l *cd.Lease) ConsulSession {
+	host, _ := os.Hostname()
+	s := ConsulSession{ID: id, Name: l.Name, Node: host, Behavior: l.Behavior, Checks: []string{}}
+	if l.TTL != consulNoTTL {
+		s.TTL = (time.Duration(l.TTL) * time.Second).String()
+	}
+	return s
+}
+
+// sessionLockTill returns Till of the locks held by the session, they expire with it
+func sessionLockTill(l *cd.Lease) int64 {
+	return l.Till/1000 + 1
+}
+
+// consulBump returns the next version of the account, index of every change
+// must grow for blocking queries, deletes and lock releases included
+func consulBump(b *pebble.Batch, acc string) (int64, error) {
+	seqID := compID1(cd.VerSequencePrefix, acc)
+	seq, err := GetInt64(seqID, b)
+	if err != nil {
+		return 0, err
+	}
+	var ver int64 = 1
+	if seq != nil {
+		ver = *seq
+	}
+	return ver, SetInt64(seqID, ver+1, b)
+}
+
+func consulSet(b *pebble.Batch, acc string, kv *KV) error {
+	var err error
+	kv.Version, err = consulBump(b, acc)
+	if err != nil {
+		return err
+	}
+	return handleKVSet(acc, b, kv)
+}
+
+// consulTouch moves ModifyIndex of the key after its lock was released by
+// session invalidation, so blocked lock waiters wake up
+func consulTouch(b *pebble.Batch, acc, key string) error {
+	v, err := getKV(b, acc, key)
+	if err != nil {
+		return err
+	}
+	if v == nil { // deleted with the session
+		_, err = consulBump(b, acc)
+		return err
+	}
+	return consulSet(b, acc, &KV{Key: key, Value: v.Data, ContentType: v.Type, Flags: v.Flags})
+}
+
+func consulEntry(b *pebble.Batch, acc, key string, v *cd.KV) (ConsulKVPair, error) {
+	e := ConsulKVPair{Key: key, CreateIndex: v.Version, ModifyIndex: v.Version, Flags: v.Flags}
+	if len(v.Data) > 0 {
+		e.Value = v.Data
+	}
+	l, err := getPLock(b, acc, key)
+	if err != nil {
+		return e, err
+	}
+	if l != nil {
+		e.Session = l.Lease
+	}
+	t, err := lastPLockToken(b, acc, key)
+	if err != nil {
+		return e, err
+	}
+	if t != nil {
+		e.LockIndex = *t
+	}
+	return e, nil
+}
+
+// consulRead returns entries of the key or of all keys with the prefix and their index
+func consulRead(acc, key string, recurse bool) ([]ConsulKVPair, int64, error) {
+	b := store.DB().NewIndexedBatch()
+	defer b.Close()
+	res := []ConsulKVPair{}
+	keys := []string{key}
+	if recurse {
+		keys = nil
+		prefix := compID(cd.KVPrefix, acc, key)
+		iter, err := store.DB().NewIter(&pebble.IterOptions{
+			LowerBound: prefix,
+			UpperBound: prefixEnd(prefix),
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		accPrefix := compID(cd.KVPrefix, acc, "")
+		for iter.First(); iter.Valid(); iter.Next() {
+			keys = append(keys, string(bytes.TrimPrefix(iter.Key(), accPrefix)))
+		}
+		err = iter.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	for _, k := range keys {
+		v, err := getKV(b, acc, k)
+		if err != nil {
+			return nil, 0, err
+		}
+		if v == nil {
+			continue
+		}
+		e, err := consulEntry(b, acc, k, v)
+		if err != nil {
+			return nil, 0, err
+		}
+		res = append(res, e)
+	}
+	if !recurse && len(res) == 1 {
+		return res, res[0].ModifyIndex, nil
+	}
+	seq, err := GetInt64(compID1(cd.VerSequencePrefix, acc), b)
+	if err != nil {
+		return nil, 0, err
+	}
+	var index int64 = 1
+	if seq != nil {
+		index = max(*seq-1, 1)
+	}
+	return res, index, nil
+}
+
+func getConsulWait(ctx *fasthttp.RequestCtx) (time.Duration, error) {
+	w := string(ctx.QueryArgs().Peek("wait"))
+	if w == "" {
+		return consulDefaultWait, nil
+	}
+	d, err := time.ParseDuration(w)
+	if err != nil {
+		return 0, fmt.Errorf("invalid wait: %w", err)
+	}
+	return min(d, consulMaxWait), nil
+}
+
+// ConsulGetKVHandler - GET /v1/kv/*key?recurse&keys&separator=&raw&index=&wait=
+func ConsulGetKVHandler(ctx *fasthttp.RequestCtx) {
+	acc := consulAcc()
+	key, err := consulKey(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	args := ctx.QueryArgs()
+	keysOnly := args.Has("keys")
+	recurse := args.Has("recurse") || keysOnly
+	wait, err := getConsulWait(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	waitIndex := int64(args.GetUintOrZero("index"))
+	deadline := time.Now().Add(wait)
+	var res []ConsulKVPair
+	var index int64
+	for {
+		res, index, err = consulRead(acc, key, recurse)
+		if err != nil {
+			retryError(ctx, acc, "", err)
+			return
+		}
+		if waitIndex == 0 || index > waitIndex || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(consulPoll)
+	}
+	ctx.Response.Header.Set("X-Consul-Index", strconv.FormatInt(index, 10))
+	ctx.Response.Header.Set("X-Consul-KnownLeader", "true")
+	if len(res) == 0 {
+		ctx.SetStatusCode(404)
+		return
+	}
+	switch {
+	case keysOnly:
+		sep := string(args.Peek("separator"))
+		keys := []string{}
+		for _, e := range res {
+			k := e.Key
+			if sep != "" { // collapse keys below the separator into their "directory"
+				if i := strings.Index(k[len(key):], sep); i >= 0 {
+					k = k[:len(key)+i+len(sep)]
+				}
+			}
+			if len(keys) == 0 || keys[len(keys)-1] != k {
+				keys = append(keys, k)
+			}
+		}
+		writeConsulJSON(ctx, keys)
+	case args.Has("raw"):
+		ctx.Response.SetBody(res[0].Value)
+	default:
+		writeConsulJSON(ctx, res)
+	}
+}
+
+func getConsulUint(ctx *fasthttp.RequestCtx, name string) (*uint64, error) {
+	if !ctx.QueryArgs().Has(name) {
+		return nil, nil
+	}
+	v, err := strconv.ParseUint(string(ctx.QueryArgs().Peek(name)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v: %w", name, err)
+	}
+	return &v, nil
+}
+
+// ConsulPutKVHandler - PUT /v1/kv/*key?flags=&cas=&acquire=&release= responds
+// with true if the value was written
+func ConsulPutKVHandler(ctx *fasthttp.RequestCtx) {
+	acc := consulAcc()
+	key, err := consulKey(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if key == "" {
+		ctx.Error("key is required", 400)
+		return
+	}
+	flags, err := getConsulUint(ctx, "flags")
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	cas, err := getConsulUint(ctx, "cas")
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	acquire := string(ctx.QueryArgs().Peek("acquire"))
+	release := string(ctx.QueryArgs().Peek("release"))
+	kv := &KV{Key: key, Value: append(json.RawMessage{}, ctx.Request.Body()...)}
+	if flags != nil {
+		kv.Flags = *flags
+	}
+	err = checkLimits(acc, Request{KVSet: []*KV{kv}})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	var written bool
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		cur, err := getKV(b, acc, key)
+		if err != nil {
+			return err
+		}
+		if cas != nil {
+			var ver uint64
+			if cur != nil {
+				ver = uint64(cur.Version)
+			}
+			if ver != *cas {
+				return b.Close()
+			}
+		}
+		l, err := getPLock(b, acc, key)
+		if err != nil {
+			return err
+		}
+		switch {
+		case acquire != "":
+			s, err := getLiveLease(b, acc, acquire)
+			if err == ErrLeaseNotFound {
+				return fmt.Errorf("%w %q", ErrInvalidSession, acquire)
+			}
+			if err != nil {
+				return err
+			}
+			if l != nil && l.Lease != acquire {
+				return b.Close()
+			}
+			if l == nil {
+				token, err := nextPLockToken(b, acc, key)
+				if err != nil {
+					return err
+				}
+				l = &cd.Lock{Handle: time.Now().UnixNano(), Token: token, Lease: acquire}
+				err = attachLease(b, acc, acquire, leaseLocks, key)
+				if err != nil {
+					return err
+				}
+			}
+			l.Till = sessionLockTill(s)
+			d, err := l.MarshalMsg(nil)
+			if err != nil {
+				return err
+			}
+			err = b.Set(compID(cd.PLockPrefix, acc, key), d, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+			if s.Behavior == "delete" {
+				kv.Lease = acquire
+			}
+		case release != "":
+			if l == nil || l.Lease != release {
+				return b.Close()
+			}
+			err = b.Delete(compID(cd.PLockPrefix, acc, key), pebble.NoSync)
+			if err != nil {
+				return err
+			}
+		case cur != nil:
+			kv.Lease = cur.Lease // still deleted with the session holding it
+		}
+		err = consulSet(b, acc, kv)
+		if err != nil {
+			return err
+		}
+		written = true
+		return commitBatch(ctx, b)
+	})
+	if errors.Is(err, ErrInvalidSession) {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if written {
+		store.notifier(acc).NotifyVersion(key, kv.Version)
+	}
+	writeConsulJSON(ctx, written)
+}
+
+// ConsulDeleteKVHandler - DELETE /v1/kv/*key?recurse&cas= deletes the key and its lock
+func ConsulDeleteKVHandler(ctx *fasthttp.RequestCtx) {
+	acc := consulAcc()
+	key, err := consulKey(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	recurse := ctx.QueryArgs().Has("recurse")
+	if key == "" && !recurse {
+		ctx.Error("key is required", 400)
+		return
+	}
+	cas, err := getConsulUint(ctx, "cas")
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var deleted bool
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		keys := []string{key}
+		if recurse {
+			keys = nil
+			prefix := compID(cd.KVPrefix, acc, key)
+			iter, err := b.NewIter(&pebble.IterOptions{
+				LowerBound: prefix,
+				UpperBound: prefixEnd(prefix),
+			})
+			if err != nil {
+				return err
+			}
+			accPrefix := compID(cd.KVPrefix, acc, "")
+			for iter.First(); iter.Valid(); iter.Next() {
+				keys = append(keys, string(bytes.TrimPrefix(iter.Key(), accPrefix)))
+			}
+			err = iter.Close()
+			if err != nil {
+				return err
+			}
+		} else if cas != nil {
+			cur, err := getKV(b, acc, key)
+			if err != nil {
+				return err
+			}
+			if cur == nil || uint64(cur.Version) != *cas {
+				return b.Close()
+			}
+		}
+		for _, k := range keys {
+			err := handleKVSet(acc, b, &KV{Key: k, Delete: true})
+			if err != nil {
+				return err
+			}
+			err = b.Delete(compID(cd.PLockPrefix, acc, k), pebble.NoSync)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := consulBump(b, acc)
+		if err != nil {
+			return err
+		}
+		deleted = true
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeConsulJSON(ctx, deleted)
+}
+
+// ConsulCreateSessionHandler - PUT /v1/session/create with optional {"Name", "TTL", "Behavior"}
+func ConsulCreateSessionHandler(ctx *fasthttp.RequestCtx) {
+	acc := consulAcc()
+	var req ConsulSessionRequest
+	if len(bytes.TrimSpace(ctx.Request.Body())) > 0 {
+		err := json.Unmarshal(ctx.Request.Body(), &req)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	ttl := int64(consulNoTTL)
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			ctx.Error("invalid TTL: "+err.Error(), 400)
+			return
+		}
+		if d < time.Second*10 || d > time.Hour*24 {
+			ctx.Error("TTL must be between 10s and 86400s", 400)
+			return
+		}
+		ttl = int64(d / time.Second)
+	}
+	if req.Behavior == "" {
+		req.Behavior = "release"
+	}
+	if req.Behavior != "release" && req.Behavior != "delete" {
+		ctx.Error("behavior should be release or delete", 400)
+		return
+	}
+	var id string
+	l := &cd.Lease{TTL: ttl, Name: req.Name, Behavior: req.Behavior}
+	b := store.DB().NewIndexedBatch()
+	err := store.Singleton([]byte(acc), func() error {
+		var err error
+		id, err = newLeaseID(b, acc)
+		if err != nil {
+			return err
+		}
+		l.Till = ttlNow().UnixMilli() + l.TTL*1000
+		err = putLease(b, acc, id, l)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeConsulJSON(ctx, map[string]string{"ID": id})
+}
+
+// ConsulRenewSessionHandler - PUT /v1/session/renew/:id extends the session and its locks by TTL
+func ConsulRenewSessionHandler(ctx *fasthttp.RequestCtx) {
+	acc := consulAcc()
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var l *cd.Lease
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = getLiveLease(b, acc, id)
+		if err != nil {
+			return err
+		}
+		l.Till = ttlNow().UnixMilli() + l.TTL*1000
+		err = putLease(b, acc, id, l)
+		if err != nil {
+			return err
+		}
+		for _, key := range l.Locks {
+			lock, err := getPLock(b, acc, key)
+			if err != nil {
+				return err
+			}
+			if lock == nil || lock.Lease != id {
+				continue
+			}
+			lock.Till = sessionLockTill(l)
+			d, err := lock.MarshalMsg(nil)
+			if err != nil {
+				return err
+			}
+			err = b.Set(compID(cd.PLockPrefix, acc, key), d, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+		}
+		return commitBatch(ctx, b)
+	})
+	if err == ErrLeaseNotFound {
+		ctx.Error(fmt.Sprintf("Session id '%v' not found", id), 404)
+		return
+	}
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeConsulJSON(ctx, []ConsulSession{consulSession(id, l)})
+}
+
+// ConsulDestroySessionHandler - PUT /v1/session/destroy/:id invalidates the session right away
+func ConsulDestroySessionHandler(ctx *fasthttp.RequestCtx) {
+	acc := consulAcc()
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err := getLease(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			return b.Close()
+		}
+		err = revokeLease(b, acc, id, l)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeConsulJSON(ctx, true)
+}
+
+// ConsulSessionInfoHandler - GET /v1/session/info/:id, empty list if session doesn't exist
+func ConsulSessionInfoHandler(ctx *fasthttp.RequestCtx) {
+	acc := consulAcc()
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	res := []ConsulSession{}
+	l, err := getLiveLease(store.DB(), acc, id)
+	if err != nil && err != ErrLeaseNotFound {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if l != nil {
+		res = append(res, consulSession(id, l))
+	}
+	writeConsulJSON(ctx, res)
+}
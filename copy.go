@@ -0,0 +1,185 @@
+// Copy or move KV values between accounts. Both accounts are locked, so
+// the operation is atomic. Expiration of values is preserved, copied values
+// get new versions of destination account, so versions of a key never go
+// back or repeat (CAS writes and ETags rely on it).
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const maxCopyKeys = 10000
+
+type CopyRequest struct {
+	From      string
+	To        string
+	Key       string // single key
+	Prefix    string // or all keys with prefix
+	Move      bool   // delete keys from source account
+	Overwrite bool   // overwrite existing keys of destination account
+}
+
+type CopyResponse struct {
+	Keys []string
+}
+
+// copyKeys returns values to copy in a source account
+func copyKeys(b *pebble.Batch, req CopyRequest) ([]string, []cd.KV, error) {
+	var keys []string
+	var values []cd.KV
+	if req.Key != "" {
+		v, err := getKV(b, req.From, req.Key)
+		if err != nil || v == nil {
+			return nil, nil, err
+		}
+		return []string{req.Key}, []cd.KV{*v}, nil
+	}
+	prefix := compID(cd.KVPrefix, req.From, req.Prefix)
+	iter, err := b.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iter.Close()
+	now := time.Now().Unix()
+	for iter.First(); iter.Valid(); iter.Next() {
+		if len(keys) == maxCopyKeys {
+			return nil, nil, fmt.Errorf("more than %v keys to copy", maxCopyKeys)
+		}
+		var v cd.KV
+		_, err := v.UnmarshalMsg(iter.Value())
+		if err != nil {
+			return nil, nil, err
+		}
+		if v.Expires != 0 && v.Expires <= now {
+			continue
+		}
+		v.Data = append([]byte{}, v.Data...)
+		err = loadCold(&v)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, string(bytes.TrimPrefix(iter.Key(), compID(cd.KVPrefix, req.From, ""))))
+		values = append(values, v)
+	}
+	return keys, values, nil
+}
+
+func copyValues(req CopyRequest, res *CopyResponse) error {
+	b := store.DB().NewIndexedBatch()
+	keys, values, err := copyKeys(b, req)
+	if err != nil {
+		return err
+	}
+	seqID := compID1(cd.VerSequencePrefix, req.To)
+	seq, err := GetInt64(seqID, b)
+	if err != nil {
+		return err
+	}
+	next := int64(1)
+	if seq != nil {
+		next = *seq
+	}
+	now := time.Now().Unix()
+	for i, key := range keys {
+		if !req.Overwrite {
+			cur, err := getKV(b, req.To, key)
+			if err != nil {
+				return err
+			}
+			if cur != nil {
+				return fmt.Errorf("key %q already exists in %q", key, req.To)
+			}
+		}
+		v := values[i]
+		kv := &KV{Key: key, Value: v.Data, Version: next, ContentType: v.Type}
+		if v.Expires != 0 {
+			kv.TTL = v.Expires - now
+		}
+		err = handleKVSet(req.To, b, kv)
+		if err != nil {
+			return err
+		}
+		next++
+		if req.Move {
+			err = handleKVSet(req.From, b, &KV{Key: key, Delete: true})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = SetInt64(seqID, next, b)
+	if err != nil {
+		return err
+	}
+	res.Keys = keys
+	return b.Commit(pebble.NoSync)
+}
+
+// CopyHandler - POST /admin/copy
+func CopyHandler(ctx *fasthttp.RequestCtx) {
+	var req CopyRequest
+	err := json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	for _, acc := range []string{req.From, req.To} {
+		if err := checkAcc(acc); err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	if req.From == req.To {
+		ctx.Error("From and To accounts should be different", 400)
+		return
+	}
+	if (req.Key == "") == (req.Prefix == "") {
+		ctx.Error("either Key or Prefix should be set", 400)
+		return
+	}
+	if strings.IndexByte(req.Key+req.Prefix, 0) >= 0 {
+		ctx.Error("0 is not allowed as a character in key", 400)
+		return
+	}
+	// lock accounts in the same order to avoid deadlocks between opposite moves
+	first, second := req.From, req.To
+	if first > second {
+		first, second = second, first
+	}
+	var res CopyResponse
+	err = store.Singleton([]byte(first), func() error {
+		return store.singletonUpdate([]byte(second), func() error {
+			return copyValues(req, &res)
+		})
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	for _, key := range res.Keys {
+		v, err := getKV(store.DB(), req.To, key)
+		if err == nil && v != nil {
+			store.notifier(req.To).NotifyVersion(key, v.Version)
+		}
+	}
+	if res.Keys == nil {
+		res.Keys = []string{}
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,71 @@
+// Deadlock detection for fast locks. Clients pass their ID with the lock
+// request (LockOwnerID), server remembers which owner holds each lock and
+// which lock each owner is waiting for. Before owner starts waiting the
+// chain of holders is followed: waiting for a lock held by an owner that
+// waits for a lock held by ... the owner itself is a deadlock, and the
+// new waiter fails right away with ErrDeadlock instead of waiting till
+// timeout. Only locks taken with owner ID take part in detection, owner
+// is expected to wait for one lock at a time.
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrDeadlock = errors.New("deadlock detected")
+
+// maxWaitChain limits the walk over the graph, chains are short in practice
+const maxWaitChain = 1000
+
+type waitGraph struct {
+	mu      sync.Mutex
+	holders map[string]string // lock cid -> Account|0|owner ID
+	waits   map[string]string // Account|0|owner ID -> lock cid it waits for
+
+	detected atomic.Int64
+}
+
+var deadlocks = &waitGraph{holders: map[string]string{}, waits: map[string]string{}}
+
+func (g *waitGraph) acquired(cid, owner string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.holders[cid] = owner
+}
+
+func (g *waitGraph) released(cid string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.holders, cid)
+}
+
+// wait registers that owner waits for the lock, unless it would deadlock
+func (g *waitGraph) wait(cid, owner string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := cid
+	for i := 0; i < maxWaitChain; i++ {
+		h, ok := g.holders[c]
+		if !ok {
+			break
+		}
+		if h == owner {
+			g.detected.Add(1)
+			return ErrDeadlock
+		}
+		c, ok = g.waits[h]
+		if !ok {
+			break
+		}
+	}
+	g.waits[owner] = cid
+	return nil
+}
+
+func (g *waitGraph) done(owner string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.waits, owner)
+}
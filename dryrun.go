@@ -0,0 +1,21 @@
+// Dry run (?dryrun=1) evaluates mutating request - preconditions,
+// CAS checks, bounds and quotas - and returns the would-be result
+// without persisting anything.
+package main
+
+import (
+	"github.com/cockroachdb/pebble"
+	"github.com/valyala/fasthttp"
+)
+
+func isDryRun(ctx *fasthttp.RequestCtx) bool {
+	return ctx.QueryArgs().GetBool("dryrun")
+}
+
+// commitBatch commits the batch, or discards it if request is a dry run
+func commitBatch(ctx *fasthttp.RequestCtx, b *pebble.Batch) error {
+	if isDryRun(ctx) {
+		return b.Close()
+	}
+	return b.Commit(pebble.NoSync)
+}
@@ -0,0 +1,158 @@
+// Instance epoch is a generation number persisted in the DB and bumped on
+// every promotion. Instance refuses writes once it sees a newer epoch:
+// in the fence file on shared storage (FencePath) or in X-Epoch header of
+// a client that already talked to the new primary. So an old primary that
+// comes back after failover doesn't diverge silently.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+var ErrFenced = errors.New("instance is fenced by newer epoch")
+
+const fenceInterval = time.Second * 5
+
+var epoch atomic.Int64
+
+type EpochResponse struct {
+	Epoch  int64
+	Fence  int64 `json:",omitempty"` // epoch in the fence file
+	Fenced bool
+}
+
+func InitEpoch() {
+	d, closer, err := store.DB().Get(compID1(cd.EpochPrefix, ""))
+	if err != nil && err != pebble.ErrNotFound {
+		panic(err)
+	}
+	if err == nil {
+		epoch.Store(ByteToInt64(d))
+		closer.Close()
+	}
+	if epoch.Load() == 0 { // first start
+		err := store.DB().Set(compID1(cd.EpochPrefix, ""), Int64ToByte(1), pebble.Sync)
+		if err != nil {
+			panic(err)
+		}
+		epoch.Store(1)
+	}
+	checkFence()
+}
+
+// readFence returns epoch written to the fence file, 0 if there is none
+func readFence() (int64, error) {
+	if config.FencePath == "" {
+		return 0, nil
+	}
+	d, err := os.ReadFile(config.FencePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(bytes.TrimSpace(d)), 10, 64)
+}
+
+func checkFence() int64 {
+	fence, err := readFence()
+	if err != nil {
+		log.Printf("failed to read fence file: %v", err)
+		return 0
+	}
+	if fence > epoch.Load() {
+		if !store.Fenced() {
+			log.Printf("fenced: epoch %v, newer epoch %v in %v", epoch.Load(), fence, config.FencePath)
+		}
+		store.Fence()
+	}
+	return fence
+}
+
+func FenceLoop() {
+	if config.FencePath == "" {
+		return
+	}
+	for range time.Tick(fenceInterval) {
+		checkFence()
+	}
+}
+
+// epochHandler sets X-Epoch of every response and refuses requests of
+// clients that already seen newer epoch.
+func epochHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		e := epoch.Load()
+		if v := ctx.Request.Header.Peek("X-Epoch"); len(v) > 0 {
+			ce, err := strconv.ParseInt(string(v), 10, 64)
+			if err == nil && ce > e {
+				ctx.Error(ErrFenced.Error(), 503)
+				ctx.Response.Header.Set("X-Epoch", strconv.FormatInt(e, 10))
+				return
+			}
+		}
+		h(ctx)
+		ctx.Response.Header.Set("X-Epoch", strconv.FormatInt(e, 10))
+	}
+}
+
+func writeEpochResponse(ctx *fasthttp.RequestCtx, fence int64) {
+	d, err := json.Marshal(EpochResponse{Epoch: epoch.Load(), Fence: fence, Fenced: store.Fenced()})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetEpochHandler - GET /admin/epoch
+func GetEpochHandler(ctx *fasthttp.RequestCtx) {
+	writeEpochResponse(ctx, checkFence())
+}
+
+// promote bumps epoch of this instance past the fence, writes it to the
+// fence file and resumes writes.
+func promote() (int64, error) {
+	fence, err := readFence()
+	if err != nil {
+		return 0, err
+	}
+	e := max(epoch.Load(), fence) + 1
+	// written directly, since Singleton refuses writes of fenced instance
+	err = store.DB().Set(compID1(cd.EpochPrefix, ""), Int64ToByte(e), pebble.Sync)
+	if err != nil {
+		return 0, err
+	}
+	if config.FencePath != "" {
+		err = os.WriteFile(config.FencePath, []byte(strconv.FormatInt(e, 10)), 0644)
+		if err != nil {
+			return 0, err
+		}
+	}
+	epoch.Store(e)
+	store.Unfence()
+	log.Printf("promoted to epoch %v", e)
+	return e, nil
+}
+
+// PromoteHandler - POST /admin/epoch
+func PromoteHandler(ctx *fasthttp.RequestCtx) {
+	e, err := promote()
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	writeEpochResponse(ctx, e)
+}
@@ -0,0 +1,87 @@
+// Error responses carry a stable machine-readable code in X-Error-Code and
+// X-Retryable: true if the same request may succeed later (after
+// Retry-After if it's set), so clients don't have to parse messages.
+// Known errors are recognized by the message the handler responded with,
+// the rest get the code of their status.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+
+	"github.com/valyala/fasthttp"
+)
+
+type errorCode struct {
+	Code      string
+	Retryable bool
+}
+
+type knownError struct {
+	err error
+	errorCode
+}
+
+var knownErrors = []knownError{
+	{ErrStopped, errorCode{"STORE_STOPPED", true}},
+	{ErrFenced, errorCode{"FENCED", false}},
+	{cd.ErrNotLocked, errorCode{"LOCK_HELD", true}},
+	{ErrDeadlock, errorCode{"DEADLOCK", true}},
+	{ErrLockConflict, errorCode{"CONFLICT", false}},
+	{cd.ErrVersionMismatch, errorCode{"PRECONDITION_FAILED", false}},
+	{cd.ErrValueMismatch, errorCode{"PRECONDITION_FAILED", false}},
+	{cd.ErrChecksum, errorCode{"CHECKSUM_MISMATCH", false}},
+	{ErrValueTooLarge, errorCode{"VALUE_TOO_LARGE", false}},
+	{ErrLeaseNotFound, errorCode{"LEASE_NOT_FOUND", false}},
+	{ErrInvalidSession, errorCode{"LEASE_NOT_FOUND", false}},
+	{ErrSeqParams, errorCode{"PRECONDITION_FAILED", false}},
+	{ErrSeqExhausted, errorCode{"SEQUENCE_EXHAUSTED", false}},
+	{ErrSeqRange, errorCode{"PRECONDITION_FAILED", false}},
+}
+
+var statusErrors = map[int]errorCode{
+	400: {"BAD_REQUEST", false},
+	404: {"NOT_FOUND", false},
+	408: {"TIMEOUT", true},
+	409: {"CONFLICT", false},
+	413: {"VALUE_TOO_LARGE", false},
+	423: {"LOCKED", true},
+	429: {"RATE_LIMITED", true},
+	500: {"INTERNAL", true},
+	503: {"UNAVAILABLE", true},
+}
+
+// setErrorCode sets code of the error response, call after ctx.Error
+func setErrorCode(ctx *fasthttp.RequestCtx, code string, retryable bool) {
+	ctx.Response.Header.Set("X-Error-Code", code)
+	if retryable {
+		ctx.Response.Header.Set("X-Retryable", "true")
+	} else {
+		ctx.Response.Header.Set("X-Retryable", "false")
+	}
+}
+
+func responseErrorCode(status int, body []byte) errorCode {
+	for _, e := range knownErrors {
+		if bytes.HasPrefix(body, []byte(e.err.Error())) {
+			return e.errorCode
+		}
+	}
+	if c, ok := statusErrors[status]; ok {
+		return c
+	}
+	return errorCode{"ERROR", false}
+}
+
+// errorCodeHandler wraps h, adding codes to error responses that don't have one
+func errorCodeHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		h(ctx)
+		status := ctx.Response.StatusCode()
+		if status < 400 || len(ctx.Response.Header.Peek("X-Error-Code")) > 0 {
+			return
+		}
+		c := responseErrorCode(status, ctx.Response.Body())
+		setErrorCode(ctx, c.Code, c.Retryable)
+	}
+}
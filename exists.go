@@ -0,0 +1,112 @@
+// Existence checks answer HEAD /db/:acc/:primitive/:id with 200 or 404
+// and no body, so frequent checks (for ex. if idempotency key was already
+// used) are cheaper than full reads. Misses go through negative cache,
+// see cache.go.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/valyala/fasthttp"
+)
+
+var existsPrefixes = map[string]int{
+	"counter":  cd.AtomicPrefix,
+	"vclock":   cd.VClockPrefix,
+	"checkout": cd.CheckoutPrefix,
+	"hist":     cd.HistogramPrefix,
+	"gauge":    cd.GaugePrefix,
+	"seq":      cd.SeqPrefix,
+	"set":      cd.SetPrefix,
+	"zset":     cd.ZSetPrefix,
+	"list":     cd.ListPrefix,
+	"hash":     cd.HashPrefix,
+	"ts":       cd.SeriesPrefix,
+}
+
+// recordExists checks for the record itself or any of its elements (Account|0|ID|0|...)
+func recordExists(acc string, prefix int, id string) (bool, error) {
+	key := compID(prefix, acc, id)
+	if rcache.isMissing(acc, key) {
+		return false, nil
+	}
+	token := rcache.token(acc, key)
+	ok, err := exists(store.DB(), key)
+	if err != nil || ok {
+		return ok, err
+	}
+	elems := compID2(prefix, acc, id, "")
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: elems,
+		UpperBound: prefixEnd(elems),
+	})
+	if err != nil {
+		return false, err
+	}
+	ok = iter.First()
+	err = iter.Close()
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		rcache.putMissing(acc, token, key)
+	}
+	return ok, nil
+}
+
+func keyExists(acc, primitive, id string) (bool, error) {
+	switch primitive {
+	case "kv":
+		v, err := cachedKV(acc, id)
+		return v != nil, err
+	case "lock": // persistent or fast lock is held
+		l, err := getPLock(store.DB(), acc, id)
+		if err != nil || l != nil {
+			return l != nil, err
+		}
+		till, _, _, _ := memLockInfo(acc, id)
+		return till != 0, nil
+	case "idempotency":
+		exp, err := getIdempotency(store.DB(), acc, id)
+		return exp > time.Now().Unix(), err
+	case "lease":
+		_, err := getLiveLease(store.DB(), acc, id)
+		if err == ErrLeaseNotFound {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	prefix, ok := existsPrefixes[primitive]
+	if !ok {
+		return false, fmt.Errorf("unknown primitive %q", primitive)
+	}
+	if primitive == aliasCounter {
+		id = resolveAlias(acc, aliasCounter, id)
+	}
+	return recordExists(acc, prefix, id)
+}
+
+// HeadHandler - HEAD /db/:acc/:primitive/:id
+func HeadHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ok, err := keyExists(acc, ctx.UserValue("primitive").(string), id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if !ok {
+		ctx.SetStatusCode(404)
+	}
+}
@@ -0,0 +1,354 @@
+// A/B experiments assign keys (users, sessions...) to weighted buckets.
+// Bucket is picked by hash of the key, so assignment is deterministic, and
+// stored, so the key stays in its bucket when weights change. Bucket with
+// weight 0 gets no new keys. Assignment and its counters are updated in the
+// same batch: Assigned counts keys put into the bucket, Exposures counts
+// every assignment request unless it's sent with ?expose=0.
+// Keys are reassigned only if their bucket was removed from the experiment.
+//
+// ExperimentPrefix|Account|0|ID - experiment with counters
+// AssignmentPrefix|Account|0|ID|0|Key - bucket of the key
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const maxExperimentBuckets = 100
+
+type ExperimentBucketConfig struct {
+	Name   string
+	Weight int64
+}
+
+type ExperimentConfig struct {
+	Buckets []ExperimentBucketConfig
+}
+
+type ExperimentBucket struct {
+	Name      string
+	Weight    int64
+	Assigned  int64
+	Exposures int64
+}
+
+type ExperimentResponse struct {
+	ID      string
+	Buckets []ExperimentBucket
+	Created int64
+	Updated int64
+}
+
+type AssignRequest struct {
+	Key string
+}
+
+type AssignResponse struct {
+	Experiment string
+	Key        string
+	Bucket     string
+	New        bool // key was assigned by this request
+	At         int64
+}
+
+func getExperiment(b pebble.Reader, acc, id string) (*cd.Experiment, error) {
+	d, closer, err := b.Get(compID(cd.ExperimentPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var e cd.Experiment
+	_, err = e.UnmarshalMsg(d)
+	return &e, err
+}
+
+func putExperiment(b *pebble.Batch, acc, id string, e *cd.Experiment) error {
+	d, err := e.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.ExperimentPrefix, acc, id), d, pebble.NoSync)
+}
+
+func getAssignment(b pebble.Reader, acc, id, key string) (*cd.Assignment, error) {
+	d, closer, err := b.Get(compID2(cd.AssignmentPrefix, acc, id, key))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var a cd.Assignment
+	_, err = a.UnmarshalMsg(d)
+	return &a, err
+}
+
+// pickBucket returns index of the bucket for the key by its hash and bucket weights
+func pickBucket(id, key string, buckets []cd.ExperimentBucket) int {
+	var total int64
+	for _, b := range buckets {
+		total += b.Weight
+	}
+	n := int64(crc32.ChecksumIEEE([]byte(id+"\x00"+key))) % total
+	for i, b := range buckets {
+		if n < b.Weight {
+			return i
+		}
+		n -= b.Weight
+	}
+	return len(buckets) - 1
+}
+
+func toExperimentResponse(id string, e *cd.Experiment) ExperimentResponse {
+	res := ExperimentResponse{ID: id, Buckets: []ExperimentBucket{}, Created: e.Created, Updated: e.Updated}
+	for _, b := range e.Buckets {
+		res.Buckets = append(res.Buckets, ExperimentBucket{Name: b.Name, Weight: b.Weight, Assigned: b.Assigned, Exposures: b.Exposures})
+	}
+	return res
+}
+
+func writeExperimentResponse(ctx *fasthttp.RequestCtx, id string, e *cd.Experiment) {
+	d, err := json.Marshal(toExperimentResponse(id, e))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func checkExperimentConfig(c ExperimentConfig) error {
+	if len(c.Buckets) == 0 || len(c.Buckets) > maxExperimentBuckets {
+		return fmt.Errorf("number of buckets should be from 1 to %v", maxExperimentBuckets)
+	}
+	var total int64
+	names := map[string]bool{}
+	for _, b := range c.Buckets {
+		if b.Name == "" || names[b.Name] {
+			return fmt.Errorf("bucket names should be unique and not empty")
+		}
+		names[b.Name] = true
+		if b.Weight < 0 {
+			return fmt.Errorf("bucket %q: weight can't be negative", b.Name)
+		}
+		total += b.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("at least one bucket should have weight")
+	}
+	return nil
+}
+
+// GetExperimentHandler - GET /db/:acc/experiment/:id returns buckets with counters
+func GetExperimentHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	e, err := getExperiment(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if e == nil {
+		ctx.Error("experiment not found", 404)
+		return
+	}
+	writeExperimentResponse(ctx, id, e)
+}
+
+// SetExperimentHandler - PUT /db/:acc/experiment/:id with ExperimentConfig in the body.
+// Counters of buckets with the same name are kept.
+func SetExperimentHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var c ExperimentConfig
+	err = json.Unmarshal(ctx.Request.Body(), &c)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	err = checkExperimentConfig(c)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var e *cd.Experiment
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		cur, err := getExperiment(b, acc, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		e = &cd.Experiment{Created: now, Updated: now}
+		old := map[string]cd.ExperimentBucket{}
+		if cur != nil {
+			e.Created = cur.Created
+			for _, b := range cur.Buckets {
+				old[b.Name] = b
+			}
+		}
+		for _, bc := range c.Buckets {
+			o := old[bc.Name]
+			e.Buckets = append(e.Buckets, cd.ExperimentBucket{Name: bc.Name, Weight: bc.Weight, Assigned: o.Assigned, Exposures: o.Exposures})
+		}
+		err = putExperiment(b, acc, id, e)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeExperimentResponse(ctx, id, e)
+}
+
+// DeleteExperimentHandler - DELETE /db/:acc/experiment/:id deletes the experiment with assignments
+func DeleteExperimentHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := b.Delete(compID(cd.ExperimentPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		prefix := compID2(cd.AssignmentPrefix, acc, id, "")
+		err = b.DeleteRange(prefix, prefixEnd(prefix), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+}
+
+// AssignHandler - POST /db/:acc/experiment/:id/assign?expose= with {"Key"} in
+// the body returns bucket of the key, assigning it on the first request
+func AssignHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req AssignRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if req.Key == "" || len(req.Key) > 1024 || bytes.IndexByte([]byte(req.Key), 0) >= 0 {
+		ctx.Error("key should be 1~1024 bytes without 0 characters", 400)
+		return
+	}
+	expose := !ctx.QueryArgs().Has("expose") || ctx.QueryArgs().GetBool("expose")
+	var found bool
+	res := AssignResponse{Experiment: id, Key: req.Key}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		e, err := getExperiment(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return b.Close()
+		}
+		found = true
+		a, err := getAssignment(b, acc, id, req.Key)
+		if err != nil {
+			return err
+		}
+		i := -1
+		if a != nil {
+			for j, bucket := range e.Buckets {
+				if bucket.Name == a.Bucket {
+					i = j
+				}
+			}
+		}
+		if i < 0 { // new key or its bucket was removed
+			i = pickBucket(id, req.Key, e.Buckets)
+			a = &cd.Assignment{Bucket: e.Buckets[i].Name, At: time.Now().Unix()}
+			d, err := a.MarshalMsg(nil)
+			if err != nil {
+				return err
+			}
+			err = b.Set(compID2(cd.AssignmentPrefix, acc, id, req.Key), d, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+			e.Buckets[i].Assigned++
+			res.New = true
+		}
+		res.Bucket, res.At = a.Bucket, a.At
+		if !res.New && !expose {
+			return b.Close() // nothing changed
+		}
+		if expose {
+			e.Buckets[i].Exposures++
+		}
+		err = putExperiment(b, acc, id, e)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if !found {
+		ctx.Error("experiment not found", 404)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
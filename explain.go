@@ -0,0 +1,186 @@
+// Explain collects everything known about a single key of a primitive
+// in one response, for debugging by operators.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+var explainPrefixes = map[string]int{
+	"kv":        cd.KVPrefix,
+	"counter":   cd.AtomicPrefix,
+	"lock":      cd.LocksPrefix,
+	"plock":     cd.PLockPrefix,
+	"vclock":    cd.VClockPrefix,
+	"checkout":  cd.CheckoutPrefix,
+	"claim":     cd.ClaimPrefix,
+	"partition": cd.PartitionPrefix,
+	"quota":     cd.QuotaPrefix,
+	"hist":      cd.HistogramPrefix,
+	"gauge":     cd.GaugePrefix,
+	"seq":       cd.SeqPrefix,
+	"set":       cd.SetPrefix,
+	"zset":      cd.ZSetPrefix,
+	"list":      cd.ListPrefix,
+	"hash":      cd.HashPrefix,
+	"ts":        cd.SeriesPrefix,
+}
+
+type ExplainLock struct {
+	Till  int64 // unix seconds
+	Since int64 `json:",omitempty"` // when lock was acquired
+}
+
+type ExplainResponse struct {
+	Primitive string
+	Key       string
+	Exists    bool
+	Records   int               // number of db records: value + elements
+	Size      int64             // bytes of keys & values of all records
+	Version   int64             `json:",omitempty"` // kv version
+	TTL       int64             `json:",omitempty"` // seconds till kv value expires
+	History   bool              // versions history is kept
+	Stats     *KeyStats         `json:",omitempty"`
+	Lock      *ExplainLock      `json:",omitempty"` // lock with the same id is held
+	Claim     *cd.Claim         `json:",omitempty"` // kv is claimed as a job
+	Checkout  *CheckoutResponse `json:",omitempty"`
+	Mutex     int               // store mutex & notifier shard of the account
+	LockShard int               // fast lock shard of the key
+}
+
+func explainShard(s string) int {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return int(h.Sum64() % mCount)
+}
+
+// ExplainHandler - GET /admin/explain/:acc/:primitive/:id
+func ExplainHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	primitive := ctx.UserValue("primitive").(string)
+	prefix, ok := explainPrefixes[primitive]
+	if !ok {
+		ctx.Error(fmt.Sprintf("unknown primitive %q", primitive), 400)
+		return
+	}
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	res := ExplainResponse{
+		Primitive: primitive,
+		Key:       id,
+		Mutex:     explainShard(acc),
+		LockShard: explainShard(acc + string([]byte{0}) + id),
+	}
+
+	// value itself and all elements stored under Account|0|ID|0|...
+	head := compID(prefix, acc, id)
+	d, closer, err := snap.Get(head)
+	if err != nil && err != pebble.ErrNotFound {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if err == nil {
+		res.Records++
+		res.Size += int64(len(head) + len(d))
+		closer.Close()
+	}
+	elems := compID2(prefix, acc, id, "")
+	iter, err := snap.NewIter(&pebble.IterOptions{
+		LowerBound: elems,
+		UpperBound: prefixEnd(elems),
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		res.Records++
+		res.Size += int64(len(iter.Key()) + len(iter.Value()))
+	}
+	err = iter.Close()
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	res.Exists = res.Records > 0
+
+	if primitive == "kv" {
+		v, err := getKV(snap, acc, id)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if v != nil {
+			res.Version = v.Version
+			if v.Expires != 0 {
+				res.TTL = v.Expires - time.Now().Unix()
+			}
+		}
+		res.Claim, err = getClaim(snap, acc, id)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	var kind string
+	switch primitive {
+	case "kv":
+		kind = statsKV
+	case "counter":
+		kind = statsCounter
+	case "lock":
+		kind = statsLock
+	}
+	if kind != "" {
+		st, err := getStats(snap, acc, kind, id)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if st != nil {
+			res.Stats = &KeyStats{Created: st.Created, Modified: st.Modified, Writes: st.Writes}
+		}
+	}
+	if till := memLockTill(acc, id); till > 0 {
+		res.Lock = &ExplainLock{Till: till}
+		st, err := getStats(snap, acc, statsLock, id)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if st != nil {
+			res.Lock.Since = st.Modified
+		}
+	}
+	c, err := getCheckout(snap, acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if c.Till >= time.Now().Unix() {
+		co := toCheckoutResponse(c)
+		res.Checkout = &co
+	}
+	d, err = json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,373 @@
+// Scheduled exports deliver KV values of the account (optionally only
+// keys with prefix) to a URL every Interval seconds. The URL can be a
+// webhook or a pre-signed object store URL (Method: PUT).
+// Body is newline delimited JSON, one value per line.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const minExportInterval = 60
+
+type ExportConfig struct {
+	URL      string
+	Method   string // POST (default) or PUT
+	Prefix   string
+	Interval int64 // seconds between exports
+}
+
+type ExportStatus struct {
+	ExportConfig
+	Next      int64
+	LastRun   int64  `json:",omitempty"`
+	LastKeys  int64  `json:",omitempty"`
+	LastError string `json:",omitempty"`
+}
+
+var exportClient = &fasthttp.Client{}
+
+func getExport(b pebble.Reader, acc, id string) (*cd.Export, error) {
+	d, closer, err := b.Get(compID(cd.ExportPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var e cd.Export
+	_, err = e.UnmarshalMsg(d)
+	return &e, err
+}
+
+func putExport(b *pebble.Batch, acc, id string, e *cd.Export) error {
+	d, err := e.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.ExportPrefix, acc, id), d, pebble.NoSync)
+}
+
+func toExportStatus(e *cd.Export) ExportStatus {
+	return ExportStatus{
+		ExportConfig: ExportConfig{URL: e.URL, Method: e.Method, Prefix: e.Prefix, Interval: e.Interval},
+		Next:         e.Next,
+		LastRun:      e.LastRun,
+		LastKeys:     e.LastKeys,
+		LastError:    e.LastError,
+	}
+}
+
+func writeExportStatus(ctx *fasthttp.RequestCtx, e *cd.Export) {
+	d, err := json.Marshal(toExportStatus(e))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// writeExport writes values of the account with prefix as NDJSON
+func writeExport(w io.Writer, snap *pebble.Snapshot, acc, prefix string) (int64, error) {
+	p := compID(cd.KVPrefix, acc, prefix)
+	iter, err := snap.NewIter(&pebble.IterOptions{
+		LowerBound: p,
+		UpperBound: prefixEnd(p),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+	bw := bufio.NewWriter(w)
+	now := time.Now().Unix()
+	var n int64
+	for iter.First(); iter.Valid(); iter.Next() {
+		var v cd.KV
+		_, err := v.UnmarshalMsg(iter.Value())
+		if err != nil {
+			return n, err
+		}
+		if v.Expires != 0 && v.Expires <= now {
+			continue
+		}
+		err = loadCold(&v)
+		if err != nil {
+			return n, err
+		}
+		line := MultiGetValue{
+			Key:     string(bytes.TrimPrefix(iter.Key(), compID(cd.KVPrefix, acc, ""))),
+			Version: v.Version,
+		}
+		if json.Valid(v.Data) {
+			line.Value = v.Data
+		} else {
+			line.Raw = v.Data
+		}
+		if v.Expires != 0 {
+			line.TTL = v.Expires - now
+		}
+		d, err := json.Marshal(line)
+		if err != nil {
+			return n, err
+		}
+		bw.Write(d)
+		bw.WriteByte('\n')
+		n++
+	}
+	return n, bw.Flush()
+}
+
+// runExport delivers the export and returns number of exported values
+func runExport(acc string, e *cd.Export) (int64, error) {
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	var body bytes.Buffer
+	n, err := writeExport(&body, snap, acc, e.Prefix)
+	if err != nil {
+		return n, err
+	}
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(e.URL)
+	req.Header.SetMethod(e.Method)
+	req.Header.SetContentType("application/x-ndjson")
+	req.Header.Set("X-Account", acc)
+	req.SetBody(body.Bytes())
+	signWebhook(req)
+	err = exportClient.DoTimeout(req, resp, time.Minute*5)
+	if err != nil {
+		return n, err
+	}
+	if resp.StatusCode() >= 300 {
+		return n, fmt.Errorf("export URL returned %v", resp.StatusCode())
+	}
+	return n, nil
+}
+
+// finishExport runs the export and saves its result
+func finishExport(acc, id string) (*cd.Export, error) {
+	e, err := getExport(store.DB(), acc, id)
+	if err != nil || e == nil {
+		return e, err
+	}
+	start := time.Now().Unix()
+	n, runErr := runExport(acc, e)
+	if runErr != nil {
+		log.Printf("export %v/%v: %v", acc, id, runErr)
+	}
+	var res *cd.Export
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		res, err = getExport(b, acc, id)
+		if err != nil || res == nil { // deleted while running
+			return err
+		}
+		res.LastRun, res.LastKeys, res.LastError = start, n, ""
+		if runErr != nil {
+			res.LastError = runErr.Error()
+		}
+		res.Next = start + res.Interval
+		err = putExport(b, acc, id, res)
+		if err != nil {
+			return err
+		}
+		return b.Commit(pebble.NoSync)
+	})
+	return res, err
+}
+
+// ExportLoop runs due exports of all accounts every few seconds
+func ExportLoop() {
+	t := time.NewTicker(time.Second * 10)
+	for range t.C {
+		release, err := store.beginWrite()
+		if err != nil {
+			continue // writes are paused or stopped
+		}
+		runExports()
+		release()
+	}
+}
+
+// runExports runs exports that are due
+func runExports() {
+	type due struct{ acc, id string }
+	var list []due
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.ExportPrefix},
+		UpperBound: []byte{cd.ExportPrefix + 1},
+	})
+	if err != nil {
+		log.Print("export: ", err)
+		return
+	}
+	now := time.Now().Unix()
+	for iter.First(); iter.Valid(); iter.Next() {
+		var e cd.Export
+		_, err := e.UnmarshalMsg(iter.Value())
+		if err != nil || e.Next > now {
+			continue
+		}
+		parts := strings.SplitN(string(iter.Key()[1:]), string([]byte{0}), 2)
+		if len(parts) == 2 {
+			list = append(list, due{parts[0], parts[1]})
+		}
+	}
+	iter.Close()
+	for _, d := range list {
+		_, err := finishExport(d.acc, d.id)
+		if err != nil {
+			log.Printf("export %v/%v: %v", d.acc, d.id, err)
+		}
+	}
+}
+
+func GetExportHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	e, err := getExport(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if e == nil {
+		ctx.Error("not found", 404)
+		return
+	}
+	writeExportStatus(ctx, e)
+}
+
+// SetExportHandler creates or updates export config, first run is scheduled right away
+func SetExportHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req ExportConfig
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
+		ctx.Error("URL should be http(s) URL", 400)
+		return
+	}
+	switch req.Method {
+	case "":
+		req.Method = "POST"
+	case "POST", "PUT":
+	default:
+		ctx.Error("Method should be POST or PUT", 400)
+		return
+	}
+	if req.Interval < minExportInterval {
+		ctx.Error(fmt.Sprintf("Interval should be at least %v seconds", minExportInterval), 400)
+		return
+	}
+	e := &cd.Export{
+		URL:      req.URL,
+		Method:   req.Method,
+		Prefix:   req.Prefix,
+		Interval: req.Interval,
+		Next:     time.Now().Unix(),
+	}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		old, err := getExport(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			e.LastRun, e.LastKeys, e.LastError = old.LastRun, old.LastKeys, old.LastError
+			e.Next = old.LastRun + e.Interval
+		}
+		err = putExport(b, acc, id, e)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	writeExportStatus(ctx, e)
+}
+
+// RunExportHandler runs export right away and returns its result
+func RunExportHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	e, err := finishExport(acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if e == nil {
+		ctx.Error("not found", 404)
+		return
+	}
+	writeExportStatus(ctx, e)
+}
+
+func DeleteExportHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := b.Delete(compID(cd.ExportPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
@@ -0,0 +1,193 @@
+// Failover for setups without external orchestration. Follower checks
+// health endpoint of the primary every Interval seconds and after Failures
+// consecutive failed checks sends "promotion_needed" event, so operator can
+// verify the follower has the data and promote it (POST /admin/epoch).
+// With AutoPromote follower promotes itself instead. Followers with lower
+// priority (bigger Priority) need Priority more rounds of failures, and
+// don't promote if other follower already bumped the epoch in the fence
+// file. Shadow mirroring is best-effort: writes acknowledged by the primary
+// but not mirrored before it went down (up to the mirror queue, plus
+// everything dropped when the follower couldn't keep up) are lost on
+// automatic promotion.
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type FailoverConfig struct {
+	Primary  string `yaml:"Primary"`  // health URL of the primary, for ex. http://primary:8080/admin/epoch
+	Interval int    `yaml:"Interval"` // seconds between checks, default 1
+	Failures int    `yaml:"Failures"` // failed checks in a row to promote after, default 3
+	Priority int    `yaml:"Priority"` // 0 - highest
+	Timeout  int    `yaml:"Timeout"`  // health check timeout in seconds, default 1
+	Webhook  string `yaml:"Webhook"`  // URL to POST failover events to
+	// promote without operator, accepting loss of writes that weren't mirrored
+	AutoPromote bool `yaml:"AutoPromote"`
+}
+
+type FailoverEvent struct {
+	Event    string // primary_down, primary_up, promotion_needed, promoted, skipped
+	Failures int
+	Epoch    int64
+	At       int64
+	Error    string `json:",omitempty"`
+}
+
+type FailoverState struct {
+	Primary  string
+	Failures int // failed checks in a row
+	Checked  int64
+	Promoted bool
+	Events   []FailoverEvent
+}
+
+// number of recent events kept in state
+const failoverEvents = 100
+
+var failoverMu sync.Mutex
+var failoverState FailoverState
+
+var failoverClient = &fasthttp.Client{}
+
+func checkPrimary(cfg FailoverConfig) error {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(cfg.Primary)
+	err := failoverClient.DoTimeout(req, resp, time.Second*time.Duration(cfg.Timeout))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("primary returned %v", resp.StatusCode())
+	}
+	return nil
+}
+
+func sendFailoverEvent(cfg FailoverConfig, e FailoverEvent) {
+	log.Printf("failover: %v after %v failed checks, epoch %v %v", e.Event, e.Failures, e.Epoch, e.Error)
+	failoverMu.Lock()
+	failoverState.Events = append(failoverState.Events, e)
+	if len(failoverState.Events) > failoverEvents {
+		failoverState.Events = failoverState.Events[1:]
+	}
+	failoverMu.Unlock()
+	if cfg.Webhook == "" {
+		return
+	}
+	d, err := json.Marshal(e)
+	if err != nil {
+		log.Print("failover event: ", err)
+		return
+	}
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(cfg.Webhook)
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json")
+	req.SetBody(d)
+	signWebhook(req)
+	err = failoverClient.DoTimeout(req, resp, time.Second*5)
+	if err == nil && resp.StatusCode() >= 300 {
+		err = fmt.Errorf("webhook returned %v", resp.StatusCode())
+	}
+	if err != nil {
+		log.Print("failover event: ", err)
+	}
+}
+
+func FailoverLoop(cfg FailoverConfig) {
+	if cfg.Primary == "" {
+		return
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 1
+	}
+	if cfg.Failures <= 0 {
+		cfg.Failures = 3
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 1
+	}
+	failoverMu.Lock()
+	failoverState.Primary = cfg.Primary
+	failoverMu.Unlock()
+	fence, err := readFence()
+	if err != nil {
+		log.Printf("failed to read fence file: %v", err)
+	}
+	need := cfg.Failures * (cfg.Priority + 1)
+	failures := 0
+	notified := false // promotion_needed was sent for current outage
+	for range time.Tick(time.Second * time.Duration(cfg.Interval)) {
+		err := checkPrimary(cfg)
+		switch {
+		case err == nil && failures > 0:
+			sendFailoverEvent(cfg, FailoverEvent{Event: "primary_up", Failures: failures, Epoch: epoch.Load(), At: time.Now().Unix()})
+			failures = 0
+			notified = false
+		case err != nil:
+			failures++
+			if failures == cfg.Failures {
+				sendFailoverEvent(cfg, FailoverEvent{Event: "primary_down", Failures: failures, Epoch: epoch.Load(), At: time.Now().Unix(), Error: err.Error()})
+			}
+		}
+		failoverMu.Lock()
+		failoverState.Failures = failures
+		failoverState.Checked = time.Now().Unix()
+		failoverMu.Unlock()
+		if failures < need {
+			continue
+		}
+		if !cfg.AutoPromote {
+			if !notified {
+				notified = true
+				sendFailoverEvent(cfg, FailoverEvent{Event: "promotion_needed", Failures: failures, Epoch: epoch.Load(), At: time.Now().Unix()})
+			}
+			continue
+		}
+		e := FailoverEvent{Failures: failures, At: time.Now().Unix()}
+		cur, err := readFence()
+		if err == nil && cur != fence { // other follower was promoted first
+			e.Event, e.Epoch = "skipped", cur
+		} else {
+			var release func()
+			release, err = store.beginWrite()
+			if err == nil {
+				e.Event = "promoted"
+				e.Epoch, err = promote()
+				release()
+			}
+		}
+		if err != nil {
+			e.Event, e.Error = "skipped", err.Error()
+		}
+		failoverMu.Lock()
+		failoverState.Promoted = e.Event == "promoted"
+		failoverMu.Unlock()
+		sendFailoverEvent(cfg, e)
+		return
+	}
+}
+
+// GetFailoverHandler - GET /admin/failover
+func GetFailoverHandler(ctx *fasthttp.RequestCtx) {
+	failoverMu.Lock()
+	d, err := json.Marshal(failoverState)
+	failoverMu.Unlock()
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,550 @@
+// Feature flags with consistent evaluation on the server. Flag that's not
+// Enabled is off for everyone, otherwise the first rule matching attributes
+// of the evaluation decides, and keys not matched by any rule get the flag
+// with Percent probability. Percentages are sticky: key is hashed with the
+// flag ID into one of 10000 buckets, so raising the percentage only adds
+// keys. Evaluation key is also available to rules as "key" attribute.
+// Changes are streamed as server-sent events, so clients can cache flags.
+//
+//	{"Enabled": true}                   - on for everyone
+//	{"Enabled": true, "Percent": 25}    - on for 25% of keys
+//	{"Enabled": true, "Percent": 0, "Rules": [{"Attr": "country", "Op": "in", "Values": ["DE", "FR"]}]}
+//
+// Account|0|ID - flag
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	maxFlagRules  = 100
+	maxFlagValues = 1000
+	flagBuckets   = 10000
+)
+
+const (
+	flagMissing = "missing" // flag doesn't exist
+	flagOff     = "off"     // flag is not enabled
+	flagRule    = "rule"
+	flagRollout = "rollout"
+)
+
+var flagOps = map[string]bool{
+	"in": true, "not_in": true, "prefix": true, "suffix": true, "contains": true,
+	"gt": true, "gte": true, "lt": true, "lte": true, "exists": true,
+}
+
+type FlagRule struct {
+	Attr    string
+	Op      string   // in, not_in, prefix, suffix, contains, gt, gte, lt, lte, exists
+	Values  []string `json:",omitempty"` // any of them matches, numeric ops use the first one
+	Percent *float64 `json:",omitempty"` // of matching keys the flag is on for, default 100
+}
+
+type FlagConfig struct {
+	Enabled     bool
+	Percent     *float64 `json:",omitempty"` // of keys not matched by rules the flag is on for, default 100
+	Rules       []FlagRule
+	Description string
+}
+
+type FlagResponse struct {
+	ID          string
+	Enabled     bool
+	Percent     float64
+	Rules       []FlagRule
+	Description string `json:",omitempty"`
+	Version     int64
+	Updated     int64  `json:",omitempty"`
+	By          string `json:",omitempty"`
+}
+
+type FlagEvalRequest struct {
+	Key   string         // user, tenant, device... to bucket percentages by
+	Attrs map[string]any `json:",omitempty"`
+}
+
+type FlagDecision struct {
+	ID      string
+	Value   bool
+	Reason  string // missing, off, rule or rollout
+	Rule    *int   `json:",omitempty"` // index of the matched rule
+	Version int64
+}
+
+func getFlag(b pebble.Reader, acc, id string) (*cd.Flag, error) {
+	d, closer, err := b.Get(compID(cd.FlagPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var f cd.Flag
+	_, err = f.UnmarshalMsg(d)
+	return &f, err
+}
+
+func checkPercent(p *float64) (float64, error) {
+	if p == nil {
+		return 100, nil
+	}
+	if *p < 0 || *p > 100 {
+		return 0, fmt.Errorf("percent should be from 0 to 100")
+	}
+	return *p, nil
+}
+
+// toFlag validates flag config sent by client
+func toFlag(c FlagConfig) (*cd.Flag, error) {
+	if len(c.Rules) > maxFlagRules {
+		return nil, fmt.Errorf("too many rules, limit is %v", maxFlagRules)
+	}
+	p, err := checkPercent(c.Percent)
+	if err != nil {
+		return nil, err
+	}
+	f := &cd.Flag{Enabled: c.Enabled, Percent: p, Description: c.Description}
+	for i, r := range c.Rules {
+		if r.Attr == "" {
+			return nil, fmt.Errorf("rule %v: attr is required", i)
+		}
+		if !flagOps[r.Op] {
+			return nil, fmt.Errorf("rule %v: unknown op %q", i, r.Op)
+		}
+		if len(r.Values) == 0 && r.Op != "exists" {
+			return nil, fmt.Errorf("rule %v: values are required", i)
+		}
+		if len(r.Values) > maxFlagValues {
+			return nil, fmt.Errorf("rule %v: too many values, limit is %v", i, maxFlagValues)
+		}
+		if strings.HasPrefix(r.Op, "gt") || strings.HasPrefix(r.Op, "lt") {
+			_, err := strconv.ParseFloat(r.Values[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("rule %v: %v needs a number", i, r.Op)
+			}
+		}
+		p, err := checkPercent(r.Percent)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: %w", i, err)
+		}
+		f.Rules = append(f.Rules, cd.FlagRule{Attr: r.Attr, Op: r.Op, Values: r.Values, Percent: p})
+	}
+	return f, nil
+}
+
+func toFlagResponse(id string, f *cd.Flag) FlagResponse {
+	res := FlagResponse{ID: id, Enabled: f.Enabled, Percent: f.Percent, Rules: []FlagRule{}, Description: f.Description, Version: f.Version, Updated: f.Updated, By: f.By}
+	for _, r := range f.Rules {
+		p := r.Percent
+		res.Rules = append(res.Rules, FlagRule{Attr: r.Attr, Op: r.Op, Values: r.Values, Percent: &p})
+	}
+	return res
+}
+
+// attrString formats attribute value the way rules compare it
+func attrString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func ruleMatches(r cd.FlagRule, attrs map[string]any) bool {
+	a, ok := attrs[r.Attr]
+	if r.Op == "exists" || !ok { // missing attribute matches only not_in
+		return ok == (r.Op != "not_in")
+	}
+	v := attrString(a)
+	switch r.Op {
+	case "gt", "gte", "lt", "lte":
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		limit, _ := strconv.ParseFloat(r.Values[0], 64)
+		switch r.Op {
+		case "gt":
+			return n > limit
+		case "gte":
+			return n >= limit
+		case "lt":
+			return n < limit
+		}
+		return n <= limit
+	}
+	for _, val := range r.Values {
+		var m bool
+		switch r.Op {
+		case "in", "not_in":
+			m = v == val
+		case "prefix":
+			m = strings.HasPrefix(v, val)
+		case "suffix":
+			m = strings.HasSuffix(v, val)
+		case "contains":
+			m = strings.Contains(v, val)
+		}
+		if m {
+			return r.Op != "not_in"
+		}
+	}
+	return r.Op == "not_in"
+}
+
+// inRollout returns true if key falls into percent of keys for the flag
+func inRollout(id, key string, percent float64) bool {
+	bucket := crc32.ChecksumIEEE([]byte(id+"\x00"+key)) % flagBuckets
+	return float64(bucket) < percent*flagBuckets/100
+}
+
+func evalFlag(id string, f *cd.Flag, req FlagEvalRequest) FlagDecision {
+	if f == nil {
+		return FlagDecision{ID: id, Reason: flagMissing}
+	}
+	res := FlagDecision{ID: id, Reason: flagOff, Version: f.Version}
+	if !f.Enabled {
+		return res
+	}
+	attrs := req.Attrs
+	if _, ok := attrs["key"]; !ok {
+		attrs = map[string]any{"key": req.Key}
+		for k, v := range req.Attrs {
+			attrs[k] = v
+		}
+	}
+	for i, r := range f.Rules {
+		if ruleMatches(r, attrs) {
+			i := i
+			res.Reason, res.Rule = flagRule, &i
+			res.Value = inRollout(id, req.Key, r.Percent)
+			return res
+		}
+	}
+	res.Reason = flagRollout
+	res.Value = inRollout(id, req.Key, f.Percent)
+	return res
+}
+
+type FlagEvent struct {
+	Type string `json:"-"` // change or delete
+	FlagResponse
+}
+
+type flagSub struct {
+	ch     chan FlagEvent
+	closed bool // channel closed because subscriber was too slow
+}
+
+type flagEventHub struct {
+	mu   sync.Mutex
+	subs map[string]map[*flagSub]struct{} // acc|0|flag ID -> subscribers
+}
+
+var flagEvents = &flagEventHub{subs: map[string]map[*flagSub]struct{}{}}
+
+func (h *flagEventHub) publish(acc, id string, e FlagEvent) {
+	cid := acc + string([]byte{0}) + id
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subs[cid]
+	for s := range subs {
+		select {
+		case s.ch <- e:
+		default:
+			close(s.ch)
+			s.closed = true
+			delete(subs, s)
+		}
+	}
+	if len(subs) == 0 {
+		delete(h.subs, cid)
+	}
+}
+
+func (h *flagEventHub) subscribe(acc, id string) *flagSub {
+	cid := acc + string([]byte{0}) + id
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &flagSub{ch: make(chan FlagEvent, lockEventBuffer)}
+	if h.subs[cid] == nil {
+		h.subs[cid] = map[*flagSub]struct{}{}
+	}
+	h.subs[cid][s] = struct{}{}
+	return s
+}
+
+func (h *flagEventHub) unsubscribe(acc, id string, s *flagSub) {
+	cid := acc + string([]byte{0}) + id
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.closed {
+		return
+	}
+	delete(h.subs[cid], s)
+	if len(h.subs[cid]) == 0 {
+		delete(h.subs, cid)
+	}
+}
+
+// writeFlag stores the flag, nil flag deletes it
+func writeFlag(ctx *fasthttp.RequestCtx, acc, id string, f *cd.Flag) (FlagEvent, error) {
+	e := FlagEvent{Type: "delete", FlagResponse: FlagResponse{ID: id, Rules: []FlagRule{}}}
+	b := store.DB().NewIndexedBatch()
+	err := store.Singleton([]byte(acc), func() error {
+		seqID := compID1(cd.VerSequencePrefix, acc)
+		seq, err := GetInt64(seqID, b)
+		if err != nil {
+			return err
+		}
+		var ver int64 = 1
+		if seq != nil {
+			ver = *seq
+		}
+		err = SetInt64(seqID, ver+1, b)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			cur, err := getFlag(b, acc, id)
+			if err != nil {
+				return err
+			}
+			if cur == nil {
+				return b.Close()
+			}
+			e.Version = ver
+			err = b.Delete(compID(cd.FlagPrefix, acc, id), pebble.NoSync)
+			if err != nil {
+				return err
+			}
+		} else {
+			f.Version = ver
+			d, err := f.MarshalMsg(nil)
+			if err != nil {
+				return err
+			}
+			err = b.Set(compID(cd.FlagPrefix, acc, id), d, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+			e = FlagEvent{Type: "change", FlagResponse: toFlagResponse(id, f)}
+		}
+		err = commitBatch(ctx, b)
+		if err != nil || isDryRun(ctx) {
+			return err
+		}
+		if e.Version != 0 {
+			flagEvents.publish(acc, id, e) // under Singleton, so events are in order of versions
+		}
+		return nil
+	})
+	return e, err
+}
+
+func getFlagArgs(ctx *fasthttp.RequestCtx) (string, string, error) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	id, err := getID(ctx)
+	return acc, id, err
+}
+
+// ListFlagsHandler - GET /db/:acc/flag lists flags of the account
+func ListFlagsHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	prefix := compID(cd.FlagPrefix, acc, "")
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	res := []FlagResponse{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		var f cd.Flag
+		_, err := f.UnmarshalMsg(iter.Value())
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		res = append(res, toFlagResponse(string(bytes.TrimPrefix(iter.Key(), prefix)), &f))
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetFlagHandler - GET /db/:acc/flag/:id
+func GetFlagHandler(ctx *fasthttp.RequestCtx) {
+	acc, id, err := getFlagArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	f, err := getFlag(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if f == nil {
+		ctx.Error("flag not found", 404)
+		return
+	}
+	d, err := json.Marshal(toFlagResponse(id, f))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// SetFlagHandler - PUT /db/:acc/flag/:id?by= with FlagConfig in the body
+func SetFlagHandler(ctx *fasthttp.RequestCtx) {
+	acc, id, err := getFlagArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var c FlagConfig
+	err = json.Unmarshal(ctx.Request.Body(), &c)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	f, err := toFlag(c)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	f.Updated = time.Now().Unix()
+	f.By = string(ctx.QueryArgs().Peek("by"))
+	e, err := writeFlag(ctx, acc, id, f)
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	d, err := json.Marshal(e.FlagResponse)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// DeleteFlagHandler - DELETE /db/:acc/flag/:id, evaluations return "missing" after it
+func DeleteFlagHandler(ctx *fasthttp.RequestCtx) {
+	acc, id, err := getFlagArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	_, err = writeFlag(ctx, acc, id, nil)
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+}
+
+// EvalFlagHandler - POST /db/:acc/flag/:id/eval with FlagEvalRequest in the body
+func EvalFlagHandler(ctx *fasthttp.RequestCtx) {
+	acc, id, err := getFlagArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req FlagEvalRequest
+	if len(bytes.TrimSpace(ctx.Request.Body())) > 0 {
+		err = json.Unmarshal(ctx.Request.Body(), &req)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	f, err := getFlag(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(evalFlag(id, f, req))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// FlagEventsHandler - GET /db/:acc/flag/:id/events streams "state" of the flag
+// followed by "change" and "delete" events, events older than the state by
+// Version may come right after it and should be skipped
+func FlagEventsHandler(ctx *fasthttp.RequestCtx) {
+	acc, id, err := getFlagArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.SetContentType("text/event-stream")
+	ctx.Response.Header.Set("Cache-Control", "no-cache")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		s := flagEvents.subscribe(acc, id)
+		defer flagEvents.unsubscribe(acc, id, s)
+		state := FlagResponse{ID: id, Rules: []FlagRule{}}
+		f, err := getFlag(store.DB(), acc, id)
+		if err != nil {
+			return
+		}
+		if f != nil {
+			state = toFlagResponse(id, f)
+		}
+		if writeSSE(w, "state", state) != nil {
+			return
+		}
+		t := time.NewTicker(lockEventHeartbeat)
+		defer t.Stop()
+		for {
+			select {
+			case e, ok := <-s.ch:
+				if !ok {
+					return // too slow, client should reconnect
+				}
+				if writeSSE(w, e.Type, e) != nil {
+					return
+				}
+			case <-t.C:
+				w.WriteString(": ping\n\n") // fails once client is gone
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,117 @@
+// Flush statistics show how group commit behaves on the hardware:
+// distribution of WAL fsync durations, number of requests committed by
+// a single flush, and bytes written to WAL. WAL bytes are taken from
+// pebble metrics, so per flush value is an average since DB was opened.
+package main
+
+import (
+	"fmt"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+var syncBuckets = []time.Duration{
+	time.Microsecond * 100, time.Microsecond * 250, time.Microsecond * 500,
+	time.Millisecond, time.Microsecond * 2500, time.Millisecond * 5, time.Millisecond * 10,
+	time.Millisecond * 25, time.Millisecond * 50, time.Millisecond * 100, time.Second,
+}
+
+var batchBuckets = []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+
+type flushStats struct {
+	flushes  int64
+	requests int64
+	maxSync  time.Duration
+	sync     []int64 // by syncBuckets, last one is for slower syncs
+	batch    []int64 // by batchBuckets, last one is for bigger batches
+}
+
+func newFlushStats() flushStats {
+	return flushStats{
+		sync:  make([]int64, len(syncBuckets)+1),
+		batch: make([]int64, len(batchBuckets)+1),
+	}
+}
+
+// record should be called with p.mu locked
+func (s *flushStats) record(d time.Duration, count int) {
+	s.flushes++
+	s.requests += int64(count)
+	s.maxSync = max(s.maxSync, d)
+	i := 0
+	for i < len(syncBuckets) && d > syncBuckets[i] {
+		i++
+	}
+	s.sync[i]++
+	i = 0
+	for i < len(batchBuckets) && count > batchBuckets[i] {
+		i++
+	}
+	s.batch[i]++
+}
+
+type FlushBucket struct {
+	Le    string // upper bound of the bucket, empty for the last one
+	Count int64
+}
+
+type FlushStatsResponse struct {
+	Flushes     int64
+	Requests    int64   // requests committed by flushes
+	AvgRequests float64 // requests per flush
+	Pending     int     // requests in flight
+	LastSyncUs  int64
+	MaxSyncUs   int64
+	Sync        []FlushBucket // fsync durations
+	Batch       []FlushBucket // requests per flush
+
+	WALBytesIn       uint64  // logical bytes written to WAL
+	WALBytesWritten  uint64  // physical bytes written to WAL
+	WALBytesPerFlush float64 // average
+	WriteAmp         float64 // (flushed + compacted bytes) / bytes in, for all levels
+}
+
+// GetFlushStatsHandler - GET /admin/flush
+func GetFlushStatsHandler(ctx *fasthttp.RequestCtx) {
+	var res FlushStatsResponse
+	store.mu.Lock()
+	s := store.flushes
+	res.Flushes, res.Requests = s.flushes, s.requests
+	res.Pending = store.pending
+	res.LastSyncUs = store.lastFlush.Microseconds()
+	res.MaxSyncUs = s.maxSync.Microseconds()
+	for i, c := range s.sync {
+		b := FlushBucket{Count: c}
+		if i < len(syncBuckets) {
+			b.Le = syncBuckets[i].String()
+		}
+		res.Sync = append(res.Sync, b)
+	}
+	for i, c := range s.batch {
+		b := FlushBucket{Count: c}
+		if i < len(batchBuckets) {
+			b.Le = fmt.Sprint(batchBuckets[i])
+		}
+		res.Batch = append(res.Batch, b)
+	}
+	db := store.DB()
+	store.mu.Unlock()
+	if res.Flushes > 0 {
+		res.AvgRequests = float64(res.Requests) / float64(res.Flushes)
+	}
+	m := db.Metrics()
+	res.WALBytesIn, res.WALBytesWritten = m.WAL.BytesIn, m.WAL.BytesWritten
+	if res.Flushes > 0 {
+		res.WALBytesPerFlush = float64(m.WAL.BytesWritten) / float64(res.Flushes)
+	}
+	total := m.Total()
+	res.WriteAmp = total.WriteAmp()
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
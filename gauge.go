@@ -0,0 +1,168 @@
+// Gauges track last reported value of a metric along with min, max,
+// count and sum of all reported values, for monitoring-style data where
+// a counter is not enough (queue lengths, temperatures, memory usage).
+package main
+
+import (
+	"clouddragon/cd"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type GaugeResponse struct {
+	Last    float64
+	Min     float64
+	Max     float64
+	Avg     float64
+	Count   int64
+	Sum     float64
+	Updated int64
+}
+
+func toGaugeResponse(g cd.Gauge) GaugeResponse {
+	res := GaugeResponse{
+		Last:    g.Last,
+		Min:     g.Min,
+		Max:     g.Max,
+		Count:   g.Count,
+		Sum:     g.Sum,
+		Updated: g.Updated,
+	}
+	if g.Count > 0 {
+		res.Avg = g.Sum / float64(g.Count)
+	}
+	return res
+}
+
+func getGauge(b pebble.Reader, acc, id string) (*cd.Gauge, error) {
+	d, closer, err := b.Get(compID(cd.GaugePrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var g cd.Gauge
+	_, err = g.UnmarshalMsg(d)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func GetGaugeHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	g, err := getGauge(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if g == nil {
+		ctx.Error("gauge not found", 404)
+		return
+	}
+	d, err := json.Marshal(toGaugeResponse(*g))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// SetGaugeHandler reports ?v= as the current value of the gauge
+func SetGaugeHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	v, err := strconv.ParseFloat(string(ctx.QueryArgs().Peek("v")), 64)
+	if err != nil {
+		ctx.Error("v should be a number", 400)
+		return
+	}
+	var g *cd.Gauge
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		g, err = getGauge(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if g == nil {
+			g = &cd.Gauge{Min: v, Max: v}
+		}
+		g.Last = v
+		if v < g.Min {
+			g.Min = v
+		}
+		if v > g.Max {
+			g.Max = v
+		}
+		g.Count++
+		g.Sum += v
+		g.Updated = time.Now().Unix()
+		d, err := g.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		err = b.Set(compID(cd.GaugePrefix, acc, id), d, pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(toGaugeResponse(*g))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func DeleteGaugeHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := b.Delete(compID(cd.GaugePrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
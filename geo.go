@@ -0,0 +1,245 @@
+// Geo index allows to find KV records within a radius from a point.
+//
+// Values of KV records with key prefix listed in GeoIndex config are
+// indexed if they are JSON objects with "lat" and "lon" fields.
+// Index is kept in geohash order, so radius query scans only the cell
+// containing the point and 8 neighbour cells.
+//
+// Account|0|h|0|Geohash|0|Key - lat & lon of the record
+// Account|0|k|0|Key           - geohash of the record to remove old index
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	geoBase32    = "0123456789bcdefghjkmnpqrstuvwxyz"
+	geoPrecision = 12
+	earthRadius  = 6371000.0 // meters
+)
+
+type GeoPoint struct {
+	Lat *float64 `json:"lat"`
+	Lon *float64 `json:"lon"`
+}
+
+type GeoResult struct {
+	Key      string
+	Lat      float64
+	Lon      float64
+	Distance float64 // meters
+}
+
+type GeoResponse struct {
+	Results []GeoResult
+}
+
+func geohash(lat, lon float64, precision int) string {
+	latR, lonR := [2]float64{-90, 90}, [2]float64{-180, 180}
+	var sb strings.Builder
+	bit, ch, even := 0, 0, true
+	for sb.Len() < precision {
+		r, v := &latR, lat
+		if even {
+			r, v = &lonR, lon
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if v >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+		bit++
+		if bit == 5 {
+			sb.WriteByte(geoBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+// geoCellSize returns height & width of geohash cell in degrees
+func geoCellSize(precision int) (float64, float64) {
+	bits := precision * 5
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lonBits))
+}
+
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+func geoIndexed(key string) bool {
+	for _, p := range config.GeoIndex {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// unindexGeo removes the key from geo index
+func unindexGeo(acc string, b *pebble.Batch, key string) error {
+	revKey := compID2(cd.GeoPrefix, acc, "k", key)
+	d, closer, err := b.Get(revKey)
+	if err == pebble.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	old := string(d)
+	closer.Close()
+	err = b.Delete(compID2(cd.GeoPrefix, acc, "h", old+string([]byte{0})+key), pebble.NoSync)
+	if err != nil {
+		return err
+	}
+	return b.Delete(revKey, pebble.NoSync)
+}
+
+// indexGeo updates geo index of the KV record. Should be called on every KV write.
+func indexGeo(acc string, b *pebble.Batch, key string, value []byte, del bool) error {
+	if !geoIndexed(key) {
+		return nil
+	}
+	err := unindexGeo(acc, b, key)
+	if err != nil {
+		return err
+	}
+	var p GeoPoint
+	if del || json.Unmarshal(value, &p) != nil || p.Lat == nil || p.Lon == nil {
+		return nil // not a point - nothing to index
+	}
+	if math.Abs(*p.Lat) > 90 || math.Abs(*p.Lon) > 180 {
+		return nil
+	}
+	h := geohash(*p.Lat, *p.Lon, geoPrecision)
+	pos := make([]byte, 16)
+	binary.LittleEndian.PutUint64(pos, math.Float64bits(*p.Lat))
+	binary.LittleEndian.PutUint64(pos[8:], math.Float64bits(*p.Lon))
+	err = b.Set(compID2(cd.GeoPrefix, acc, "h", h+string([]byte{0})+key), pos, pebble.NoSync)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID2(cd.GeoPrefix, acc, "k", key), []byte(h), pebble.NoSync)
+}
+
+// GeoSearchHandler returns keys within ?radius= meters of ?lat=&lon= point,
+// closest first.
+func GeoSearchHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	args := ctx.QueryArgs()
+	lat, err1 := strconv.ParseFloat(string(args.Peek("lat")), 64)
+	lon, err2 := strconv.ParseFloat(string(args.Peek("lon")), 64)
+	radius, err3 := strconv.ParseFloat(string(args.Peek("radius")), 64)
+	if err1 != nil || err2 != nil || err3 != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 ||
+		radius <= 0 || radius > 1000000 {
+		ctx.Error("lat, lon and radius (up to 1000km) are required", 400)
+		return
+	}
+	limit, _, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	prefix := string(args.Peek("prefix"))
+
+	// choose smallest cells that are still bigger than the radius,
+	// so 3x3 cells around the point cover the whole circle
+	precision := geoPrecision
+	cos := math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	for ; precision > 1; precision-- {
+		h, w := geoCellSize(precision)
+		if h*111320 >= radius && w*111320*cos >= radius {
+			break
+		}
+	}
+	h, w := geoCellSize(precision)
+	cells := map[string]bool{}
+	for _, dy := range []float64{-h, 0, h} {
+		for _, dx := range []float64{-w, 0, w} {
+			clat := math.Max(-90, math.Min(90, lat+dy))
+			clon := lon + dx
+			if clon > 180 {
+				clon -= 360
+			}
+			if clon < -180 {
+				clon += 360
+			}
+			cells[geohash(clat, clon, precision)] = true
+		}
+	}
+
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	res := GeoResponse{Results: []GeoResult{}}
+	for cell := range cells {
+		cp := compID2(cd.GeoPrefix, acc, "h", cell)
+		iter, err := snap.NewIter(&pebble.IterOptions{
+			LowerBound: cp,
+			UpperBound: prefixEnd(cp),
+		})
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		for iter.First(); iter.Valid(); iter.Next() {
+			k := iter.Key()[len(cp)-len(cell):]
+			key := string(k[bytes.IndexByte(k, 0)+1:])
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			v := iter.Value()
+			r := GeoResult{
+				Key: key,
+				Lat: math.Float64frombits(binary.LittleEndian.Uint64(v)),
+				Lon: math.Float64frombits(binary.LittleEndian.Uint64(v[8:])),
+			}
+			r.Distance = distance(lat, lon, r.Lat, r.Lon)
+			if r.Distance <= radius {
+				res.Results = append(res.Results, r)
+			}
+		}
+		err = iter.Close()
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	sort.Slice(res.Results, func(i, j int) bool {
+		return res.Results[i].Distance < res.Results[j].Distance
+	})
+	if len(res.Results) > limit {
+		res.Results = res.Results[:limit]
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,214 @@
+// Hashes store every field under a separate key, so updating single field
+// of a big object doesn't rewrite the whole object under the singleton lock.
+//
+// Account|0|ID           - number of fields
+// Account|0|ID|0|Field   - field value (JSON)
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"strconv"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type HashRequest struct {
+	Set    map[string]json.RawMessage
+	Delete []string
+	Incr   map[string]int64 // increment integer fields
+}
+
+type HashResponse struct {
+	Len    int64
+	Fields map[string]json.RawMessage `json:",omitempty"`
+}
+
+// GetHashHandler returns fields listed in ?field= or all fields
+func GetHashHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	res := HashResponse{Fields: map[string]json.RawMessage{}}
+	res.Len, err = getCard(snap, compID(cd.HashPrefix, acc, id))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	fields := ctx.QueryArgs().PeekMulti("field")
+	for _, f := range fields {
+		d, closer, err := snap.Get(compID2(cd.HashPrefix, acc, id, string(f)))
+		if err == pebble.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		res.Fields[string(f)] = append(json.RawMessage{}, d...)
+		closer.Close()
+	}
+	if len(fields) == 0 {
+		prefix := compID2(cd.HashPrefix, acc, id, "")
+		iter, err := snap.NewIter(&pebble.IterOptions{
+			LowerBound: prefix,
+			UpperBound: prefixEnd(prefix),
+		})
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		defer iter.Close()
+		for iter.First(); iter.Valid() && len(res.Fields) < maxPageSize; iter.Next() {
+			res.Fields[string(iter.Key()[len(prefix):])] = append(json.RawMessage{}, iter.Value()...)
+		}
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// UpdateHashHandler sets, deletes and increments fields. Response contains
+// new values of the incremented fields.
+func UpdateHashHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req HashRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	res := HashResponse{Fields: map[string]json.RawMessage{}}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		lenKey := compID(cd.HashPrefix, acc, id)
+		res.Len, err = getCard(b, lenKey)
+		if err != nil {
+			return err
+		}
+		set := func(f string, v []byte) error {
+			key := compID2(cd.HashPrefix, acc, id, f)
+			ok, err := exists(b, key)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				res.Len++
+			}
+			return b.Set(key, v, pebble.NoSync)
+		}
+		for f, v := range req.Set {
+			err := set(f, v)
+			if err != nil {
+				return err
+			}
+		}
+		for f, n := range req.Incr {
+			cur := int64(0)
+			d, closer, err := b.Get(compID2(cd.HashPrefix, acc, id, f))
+			if err != nil && err != pebble.ErrNotFound {
+				return err
+			}
+			if err == nil {
+				cur, err = strconv.ParseInt(string(d), 10, 64)
+				closer.Close()
+				if err != nil {
+					return fmt.Errorf("field %v is not an integer", f)
+				}
+			}
+			v := []byte(strconv.FormatInt(cur+n, 10))
+			err = set(f, v)
+			if err != nil {
+				return err
+			}
+			res.Fields[f] = v
+		}
+		for _, f := range req.Delete {
+			key := compID2(cd.HashPrefix, acc, id, f)
+			ok, err := exists(b, key)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			res.Len--
+			err = b.Delete(key, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+		}
+		if res.Len == 0 {
+			err = b.Delete(lenKey, pebble.NoSync)
+		} else {
+			err = b.Set(lenKey, Int64ToByte(res.Len), pebble.NoSync)
+		}
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func DeleteHashHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		prefix := compID2(cd.HashPrefix, acc, id, "")
+		err := b.DeleteRange(prefix, prefixEnd(prefix), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		err = b.Delete(compID(cd.HashPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
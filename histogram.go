@@ -0,0 +1,262 @@
+// Histograms accumulate observations (for ex. latencies) into buckets
+// server-side, so many clients can report into single distribution and
+// read percentile estimates back.
+//
+// Percentiles are estimated with linear interpolation inside the bucket,
+// so precision depends on the bucket layout.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+// used if histogram was not configured before first observation
+var defaultHistBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
+
+type HistogramRequest struct {
+	Buckets []float64 // upper bounds, used only for configuration
+	Values  []float64
+}
+
+type HistogramResponse struct {
+	Buckets     []float64
+	Counts      []int64
+	Count       int64
+	Sum         float64
+	Min         float64
+	Max         float64
+	Percentiles map[string]float64 `json:",omitempty"`
+}
+
+func getHistogram(b pebble.Reader, acc, id string) (*cd.Histogram, error) {
+	d, closer, err := b.Get(compID(cd.HistogramPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var h cd.Histogram
+	_, err = h.UnmarshalMsg(d)
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func newHistogram(bounds []float64) *cd.Histogram {
+	return &cd.Histogram{
+		Bounds: bounds,
+		Counts: make([]int64, len(bounds)+1),
+	}
+}
+
+func observe(h *cd.Histogram, v float64) {
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	if h.Count == 0 || v < h.Min {
+		h.Min = v
+	}
+	if h.Count == 0 || v > h.Max {
+		h.Max = v
+	}
+	h.Count++
+	h.Sum += v
+}
+
+// percentile estimates value below which q (0~1) of observations fall
+func percentile(h *cd.Histogram, q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := q * float64(h.Count)
+	seen := int64(0)
+	for i, c := range h.Counts {
+		if c == 0 || float64(seen+c) < rank {
+			seen += c
+			continue
+		}
+		lo, hi := h.Min, h.Max
+		if i > 0 && h.Bounds[i-1] > lo {
+			lo = h.Bounds[i-1]
+		}
+		if i < len(h.Bounds) && h.Bounds[i] < hi {
+			hi = h.Bounds[i]
+		}
+		return lo + (hi-lo)*(rank-float64(seen))/float64(c)
+	}
+	return h.Max
+}
+
+func toHistogramResponse(h *cd.Histogram, qs []float64) HistogramResponse {
+	res := HistogramResponse{
+		Buckets:     h.Bounds,
+		Counts:      h.Counts,
+		Count:       h.Count,
+		Sum:         h.Sum,
+		Min:         h.Min,
+		Max:         h.Max,
+		Percentiles: map[string]float64{},
+	}
+	for _, q := range qs {
+		res.Percentiles["p"+strconv.FormatFloat(q*100, 'f', -1, 64)] = percentile(h, q)
+	}
+	return res
+}
+
+// getQuantiles parses ?q=0.5,0.99 (p50, p90, p99 by default)
+func getQuantiles(ctx *fasthttp.RequestCtx) ([]float64, error) {
+	args := ctx.QueryArgs().PeekMulti("q")
+	if len(args) == 0 {
+		return []float64{0.5, 0.9, 0.99}, nil
+	}
+	var res []float64
+	for _, v := range args {
+		q, err := strconv.ParseFloat(string(v), 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, fmt.Errorf("q should be in range 0~1")
+		}
+		res = append(res, q)
+	}
+	return res, nil
+}
+
+func GetHistogramHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	qs, err := getQuantiles(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	h, err := getHistogram(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if h == nil {
+		ctx.Error("histogram not found", 404)
+		return
+	}
+	d, err := json.Marshal(toHistogramResponse(h, qs))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// updateHistogram applies observations from request body. If reset is true -
+// histogram is re-created with buckets from the request.
+func updateHistogram(ctx *fasthttp.RequestCtx, reset bool) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req HistogramRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if reset && (len(req.Buckets) == 0 || len(req.Buckets) > 1000 ||
+		!sort.Float64sAreSorted(req.Buckets)) {
+		ctx.Error("buckets should be sorted and contain 1~1000 bounds", 400)
+		return
+	}
+	var h *cd.Histogram
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		if !reset {
+			h, err = getHistogram(b, acc, id)
+			if err != nil {
+				return err
+			}
+		}
+		if h == nil && reset {
+			h = newHistogram(req.Buckets)
+		}
+		if h == nil {
+			h = newHistogram(defaultHistBounds)
+		}
+		for _, v := range req.Values {
+			observe(h, v)
+		}
+		d, err := h.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		err = b.Set(compID(cd.HistogramPrefix, acc, id), d, pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(toHistogramResponse(h, nil))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// ObserveHandler records Values into histogram
+func ObserveHandler(ctx *fasthttp.RequestCtx) {
+	updateHistogram(ctx, false)
+}
+
+// ConfigureHistogramHandler re-creates histogram with given Buckets
+func ConfigureHistogramHandler(ctx *fasthttp.RequestCtx) {
+	updateHistogram(ctx, true)
+}
+
+func DeleteHistogramHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := b.Delete(compID(cd.HistogramPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
@@ -0,0 +1,146 @@
+// Hybrid logical clock shared by all accounts.
+//
+// Timestamp consists of wall time in milliseconds and a logical counter
+// that grows when wall time doesn't move forward (many requests within
+// same millisecond, clock jumped backwards or remote timestamp is ahead).
+//
+// To stay monotonic across restarts we persist a high-water mark a few
+// seconds ahead of the issued timestamps. After reboot clock starts from
+// that mark, so it never issues a timestamp lower than one issued before.
+// Mark is updated only once per hlcReserve, so most calls never touch disk.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	hlcReserve  = int64(10000) // ms ahead of wall clock persisted as high-water mark
+	hlcMaxDrift = int64(60000) // ms remote clock is allowed to be ahead of ours
+	hlcMaxLogic = int64(0xffff)
+)
+
+type HLCTimestamp struct {
+	Wall    int64 // unix time in milliseconds
+	Logical int64 // counter of events within the same Wall
+	TS      int64 // Wall and Logical packed into single sortable number
+}
+
+type hybridClock struct {
+	mu      sync.Mutex
+	wall    int64
+	logical int64
+	mark    int64 // persisted high-water mark
+}
+
+var clock *hybridClock
+
+func InitClock() {
+	d, closer, err := store.DB().Get(compID1(cd.HLCPrefix, ""))
+	if err != nil && err != pebble.ErrNotFound {
+		panic(err)
+	}
+	clock = &hybridClock{}
+	if err == nil {
+		clock.mark = ByteToInt64(d)
+		closer.Close()
+		// everything up to the mark could have been issued before reboot
+		clock.wall = clock.mark
+	}
+}
+
+func (h *hybridClock) Now() (HLCTimestamp, error) {
+	return h.Update(HLCTimestamp{})
+}
+
+// Update merges timestamp received from another service and returns
+// a timestamp higher than both local and remote ones.
+func (h *hybridClock) Update(remote HLCTimestamp) (HLCTimestamp, error) {
+	pt := time.Now().UnixMilli()
+	if remote.TS != 0 && remote.Wall == 0 {
+		remote.Wall = remote.TS >> 16
+		remote.Logical = remote.TS & hlcMaxLogic
+	}
+	if remote.Wall > pt+hlcMaxDrift {
+		return HLCTimestamp{}, fmt.Errorf("remote timestamp is too far in the future")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case pt > h.wall && pt > remote.Wall:
+		h.wall = pt
+		h.logical = 0
+	case remote.Wall > h.wall:
+		h.wall = remote.Wall
+		h.logical = remote.Logical + 1
+	case remote.Wall == h.wall && remote.Logical > h.logical:
+		h.logical = remote.Logical + 1
+	default:
+		h.logical++
+	}
+	if h.logical > hlcMaxLogic { // counter overflow - borrow next millisecond
+		h.wall++
+		h.logical = 0
+	}
+	if h.wall >= h.mark {
+		err := h.persistMark(h.wall + hlcReserve)
+		if err != nil {
+			return HLCTimestamp{}, err
+		}
+	}
+	return HLCTimestamp{
+		Wall:    h.wall,
+		Logical: h.logical,
+		TS:      h.wall<<16 | h.logical,
+	}, nil
+}
+
+// persistMark waits until new mark is flushed to disk, since we can't issue
+// timestamps above the mark until we are sure they won't repeat after reboot.
+func (h *hybridClock) persistMark(mark int64) error {
+	err := store.Singleton(nil, func() error {
+		b := store.DB().NewBatch() // inside, so DB can't be switched meanwhile
+		err := SetInt64(compID1(cd.HLCPrefix, ""), mark, b)
+		if err != nil {
+			return err
+		}
+		return b.Commit(pebble.NoSync)
+	})
+	if err != nil {
+		return err
+	}
+	h.mark = mark
+	return nil
+}
+
+// TimeHandler returns current timestamp. If body contains timestamp
+// observed from another service - clock is advanced past it.
+func TimeHandler(ctx *fasthttp.RequestCtx) {
+	var remote HLCTimestamp
+	if len(ctx.Request.Body()) > 0 {
+		err := json.Unmarshal(ctx.Request.Body(), &remote)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	ts, err := clock.Update(remote)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(ts)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,218 @@
+// Holds are two-phase consumption of atomic counters (for ex. items in
+// stock). Client reserves an amount for some time and then either commits
+// the hold, which subtracts amount from the counter, or cancels it.
+// Holds that are not committed in time are returned automatically.
+//
+// Available amount is counter value minus all active holds.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type HoldInfo struct {
+	Hold   string
+	Amount int64
+	Till   int64
+}
+
+type HoldResponse struct {
+	Value     int64 // counter value
+	Held      int64 // sum of active holds
+	Available int64
+	Holds     []HoldInfo `json:",omitempty"`
+}
+
+func holdKey(acc, key, hold string) []byte {
+	return compID(cd.HoldPrefix, acc, key+string([]byte{0})+hold)
+}
+
+// getHolds returns active holds of the counter and deletes expired ones
+func getHolds(b *pebble.Batch, acc, key string) ([]HoldInfo, int64, error) {
+	prefix := holdKey(acc, key, "")
+	iter, err := b.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer iter.Close()
+	now := time.Now().Unix()
+	var res []HoldInfo
+	var held int64
+	for iter.First(); iter.Valid(); iter.Next() {
+		var h cd.Hold
+		_, err := h.UnmarshalMsg(iter.Value())
+		if err != nil {
+			return nil, 0, err
+		}
+		if h.Till < now {
+			err := b.Delete(append([]byte{}, iter.Key()...), pebble.NoSync)
+			if err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		held += h.Amount
+		res = append(res, HoldInfo{
+			Hold:   string(bytes.TrimPrefix(iter.Key(), prefix)),
+			Amount: h.Amount,
+			Till:   h.Till,
+		})
+	}
+	return res, held, nil
+}
+
+func holdState(b *pebble.Batch, acc, key string) (HoldResponse, error) {
+	var res HoldResponse
+	val, err := GetInt64(compID(cd.AtomicPrefix, acc, key), b)
+	if err != nil {
+		return res, err
+	}
+	if val != nil {
+		res.Value = *val
+	}
+	res.Holds, res.Held, err = getHolds(b, acc, key)
+	if err != nil {
+		return res, err
+	}
+	res.Available = res.Value - res.Held
+	return res, nil
+}
+
+// updateHolds runs f under the singleton lock and responds with the state of the counter
+func updateHolds(ctx *fasthttp.RequestCtx, f func(b *pebble.Batch, acc, key string, res *HoldResponse) (int, error)) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	key, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var res HoldResponse
+	status := 200
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		res, err = holdState(b, acc, key)
+		if err != nil {
+			return err
+		}
+		status, err = f(b, acc, key, &res)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.SetStatusCode(status)
+	ctx.Response.SetBody(d)
+}
+
+func GetHoldsHandler(ctx *fasthttp.RequestCtx) {
+	updateHolds(ctx, func(b *pebble.Batch, acc, key string, res *HoldResponse) (int, error) {
+		return 200, nil
+	})
+}
+
+// HoldHandler reserves ?n= from the counter for ?ttl= seconds
+func HoldHandler(ctx *fasthttp.RequestCtx) {
+	n, err := strconv.ParseInt(string(ctx.QueryArgs().Peek("n")), 10, 64)
+	if err != nil || n <= 0 {
+		ctx.Error("n should be a positive number", 400)
+		return
+	}
+	ttl := ctx.QueryArgs().GetUintOrZero("ttl")
+	if ttl <= 0 || ttl > 86400 {
+		ctx.Error("ttl is not in range 1~86400", 400)
+		return
+	}
+	updateHolds(ctx, func(b *pebble.Batch, acc, key string, res *HoldResponse) (int, error) {
+		if res.Available < n {
+			return 409, nil
+		}
+		h := cd.Hold{
+			Amount: n,
+			Till:   time.Now().Unix() + int64(ttl),
+		}
+		id := strconv.FormatInt(time.Now().UnixNano(), 10)
+		d, err := h.MarshalMsg(nil)
+		if err != nil {
+			return 0, err
+		}
+		err = b.Set(holdKey(acc, key, id), d, pebble.NoSync)
+		if err != nil {
+			return 0, err
+		}
+		res.Holds = []HoldInfo{{Hold: id, Amount: h.Amount, Till: h.Till}}
+		res.Held += n
+		res.Available -= n
+		return 200, nil
+	})
+}
+
+// finishHold removes ?hold= and subtracts its amount from the counter if commit is true
+func finishHold(ctx *fasthttp.RequestCtx, commit bool) {
+	id := string(ctx.QueryArgs().Peek("hold"))
+	updateHolds(ctx, func(b *pebble.Batch, acc, key string, res *HoldResponse) (int, error) {
+		var hold *HoldInfo
+		for i, h := range res.Holds {
+			if h.Hold == id {
+				hold = &res.Holds[i]
+			}
+		}
+		if hold == nil {
+			return 404, nil
+		}
+		err := b.Delete(holdKey(acc, key, id), pebble.NoSync)
+		if err != nil {
+			return 0, err
+		}
+		res.Held -= hold.Amount
+		if commit {
+			res.Value -= hold.Amount
+			err = SetInt64(compID(cd.AtomicPrefix, acc, key), res.Value, b)
+			if err != nil {
+				return 0, fmt.Errorf("commit hold: %v", err)
+			}
+			err = touchStats(b, acc, statsCounter, key)
+			if err != nil {
+				return 0, err
+			}
+			err = sampleCounter(b, acc, key, res.Value)
+			if err != nil {
+				return 0, err
+			}
+		}
+		res.Available = res.Value - res.Held
+		res.Holds = []HoldInfo{*hold}
+		return 200, nil
+	})
+}
+
+func CommitHoldHandler(ctx *fasthttp.RequestCtx) {
+	finishHold(ctx, true)
+}
+
+func CancelHoldHandler(ctx *fasthttp.RequestCtx) {
+	finishHold(ctx, false)
+}
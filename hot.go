@@ -0,0 +1,80 @@
+// Hot account detection. Writes are counted per account every minute, so
+// accounts dominating write volume of the store can be found. Splitting an
+// account into its own store is not supported yet: there is a single store.
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const hotPeriod = time.Minute
+
+type HotAccount struct {
+	Account string
+	Writes  int64
+	Share   float64 // of all writes in the period
+}
+
+type HotResponse struct {
+	From     time.Time
+	To       time.Time
+	Writes   int64
+	Accounts []HotAccount
+}
+
+var hotMu sync.Mutex
+var hotReport HotResponse
+
+// countWrite should be called with p.mu locked
+func (p *Store) countWrite(key []byte) {
+	if len(key) == 0 {
+		return // internal writes, not bound to an account
+	}
+	p.writes[string(key)]++
+}
+
+func HotLoop() {
+	from := time.Now()
+	for to := range time.Tick(hotPeriod) {
+		store.mu.Lock()
+		writes := store.writes
+		store.writes = map[string]int64{}
+		store.mu.Unlock()
+		r := HotResponse{From: from, To: to, Accounts: []HotAccount{}}
+		for acc, n := range writes {
+			r.Writes += n
+			r.Accounts = append(r.Accounts, HotAccount{Account: acc, Writes: n})
+		}
+		for i := range r.Accounts {
+			r.Accounts[i].Share = float64(r.Accounts[i].Writes) / float64(r.Writes)
+		}
+		sort.Slice(r.Accounts, func(i, j int) bool { return r.Accounts[i].Writes > r.Accounts[j].Writes })
+		hotMu.Lock()
+		hotReport = r
+		hotMu.Unlock()
+		from = to
+	}
+}
+
+// GetHotHandler - GET /admin/hot?limit= returns accounts with most writes in the last minute
+func GetHotHandler(ctx *fasthttp.RequestCtx) {
+	limit := ctx.QueryArgs().GetUintOrZero("limit")
+	if limit <= 0 {
+		limit = 10
+	}
+	hotMu.Lock()
+	r := hotReport
+	hotMu.Unlock()
+	r.Accounts = r.Accounts[:min(len(r.Accounts), limit)]
+	d, err := json.Marshal(r)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,125 @@
+// Idempotency IDs of requests are remembered for IdempotencyTTL seconds
+// (default 1 day), retries within that time are rejected as duplicates.
+// Expired IDs are deleted by the sweeper in small batches per account,
+// like expired KV values (see ttl.go).
+//
+// IdempotencyPrefix|Account|0|ID - expiration (8 bytes BE, unix seconds)
+// IdemExpiryPrefix|Expires(8 bytes BE)|Account|0|ID - expiration index
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"encoding/binary"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const defaultIdempotencyTTL = 24 * 60 * 60
+
+func idempotencyTTLKey(expires int64, acc, id string) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(expires))
+	return compID1(cd.IdemExpiryPrefix, string(b)+acc+string([]byte{0})+id)
+}
+
+// getIdempotency returns expiration of the ID, 0 if it's not stored
+func getIdempotency(r pebble.Reader, acc, id string) (int64, error) {
+	d, closer, err := r.Get(compID(cd.IdempotencyPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	if len(d) < 8 {
+		return 0, nil
+	}
+	return int64(binary.BigEndian.Uint64(d)), nil
+}
+
+// putIdempotency remembers the ID for IdempotencyTTL, old is its previous (expired) expiration
+func putIdempotency(b *pebble.Batch, acc, id string, old int64) error {
+	if old != 0 {
+		err := b.Delete(idempotencyTTLKey(old, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+	}
+	ttl := int64(config.IdempotencyTTL)
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	expires := time.Now().Unix() + ttl
+	d := make([]byte, 8)
+	binary.BigEndian.PutUint64(d, uint64(expires))
+	err := b.Set(compID(cd.IdempotencyPrefix, acc, id), d, pebble.NoSync)
+	if err != nil {
+		return err
+	}
+	return b.Set(idempotencyTTLKey(expires, acc, id), nil, pebble.NoSync)
+}
+
+// sweepIdempotency deletes up to ttlSweepBatch expired IDs, returns number deleted
+func (p *Store) sweepIdempotency() (int, error) {
+	iter, err := p.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.IdemExpiryPrefix},
+		UpperBound: idempotencyTTLKey(time.Now().Unix()+1, "", ""),
+	})
+	if err != nil {
+		return 0, err
+	}
+	byAcc := map[string][]ttlEntry{}
+	n := 0
+	for iter.First(); iter.Valid() && n < ttlSweepBatch; iter.Next() {
+		k := iter.Key()[1:]
+		if len(k) < 8 {
+			continue
+		}
+		i := bytes.IndexByte(k[8:], 0)
+		if i < 0 {
+			continue
+		}
+		acc := string(k[8 : 8+i])
+		byAcc[acc] = append(byAcc[acc], ttlEntry{
+			expires: int64(binary.BigEndian.Uint64(k[:8])),
+			key:     string(k[8+i+1:]),
+		})
+		n++
+	}
+	err = iter.Close()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for acc, entries := range byAcc {
+		b := p.DB().NewIndexedBatch()
+		err := p.Singleton([]byte(acc), func() error {
+			for _, e := range entries {
+				err := b.Delete(idempotencyTTLKey(e.expires, acc, e.key), pebble.NoSync)
+				if err != nil {
+					return err
+				}
+				exp, err := getIdempotency(b, acc, e.key)
+				if err != nil {
+					return err
+				}
+				if exp != e.expires { // ID was used again after it expired
+					continue
+				}
+				err = b.Delete(compID(cd.IdempotencyPrefix, acc, e.key), pebble.NoSync)
+				if err != nil {
+					return err
+				}
+				deleted++
+			}
+			return b.Commit(pebble.NoSync)
+		})
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
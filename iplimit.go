@@ -0,0 +1,293 @@
+// Per-IP limits protect the listener from a single client in a tight
+// retry loop. Every IP gets a token bucket of Rate requests per second,
+// requests over the limit are rejected with 429. IP that keeps getting
+// rejected (BanAfter rejections within a minute) is banned for BanTime
+// seconds, requests of banned IPs are rejected before anything else is
+// done. IPs can be banned and unbanned manually via admin API.
+// Limits and bans are kept in memory and reset on restart.
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	ipShards       = 64
+	ipBanWindow    = time.Minute
+	defaultBanTime = 60
+)
+
+type IPLimitsConfig struct {
+	Rate     int      `yaml:"Rate"`     // requests per second per IP, 0 - no limit
+	Burst    int      `yaml:"Burst"`    // requests allowed at once, default Rate
+	Conns    int      `yaml:"Conns"`    // open connections per IP, 0 - no limit
+	BanAfter int      `yaml:"BanAfter"` // rejected requests within a minute to ban IP after, 0 - never ban
+	BanTime  int      `yaml:"BanTime"`  // seconds to ban IP for, default 60
+	Allow    []string `yaml:"Allow"`    // IPs that are never limited or banned
+}
+
+type ipState struct {
+	tokens   float64
+	last     time.Time // last time tokens were added
+	rejected int       // rejected requests since windowAt
+	windowAt time.Time
+	banned   time.Time // banned till
+	manual   bool      // banned via admin API
+}
+
+type ipShard struct {
+	mu sync.Mutex
+	m  map[string]*ipState
+}
+
+type ipLimiter struct {
+	shards [ipShards]ipShard
+	allow  map[string]bool
+
+	limited  atomic.Int64 // requests rejected by rate limit
+	refused  atomic.Int64 // requests of banned IPs
+	bans     atomic.Int64 // times IPs were banned automatically
+	tracking atomic.Int64 // IPs with state in memory
+}
+
+var ipLimits = newIPLimiter()
+
+var errBadIP = errors.New("bad IP address")
+
+func newIPLimiter() *ipLimiter {
+	l := &ipLimiter{allow: map[string]bool{}}
+	for i := range l.shards {
+		l.shards[i].m = map[string]*ipState{}
+	}
+	return l
+}
+
+func (l *ipLimiter) shard(ip string) *ipShard {
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return &l.shards[h.Sum32()%ipShards]
+}
+
+// check returns how long the client should wait if request is rejected
+func (l *ipLimiter) check(cfg IPLimitsConfig, ip string, now time.Time) (time.Duration, bool) {
+	if l.allow[ip] {
+		return 0, true
+	}
+	s := l.shard(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.m[ip]
+	if st == nil {
+		if cfg.Rate <= 0 {
+			return 0, true // nothing to track, banned IPs always have state
+		}
+		st = &ipState{tokens: float64(cfg.burst()), last: now, windowAt: now}
+		s.m[ip] = st
+		l.tracking.Add(1)
+	}
+	if now.Before(st.banned) {
+		l.refused.Add(1)
+		return st.banned.Sub(now), false
+	}
+	if cfg.Rate <= 0 {
+		return 0, true
+	}
+	st.tokens = min(st.tokens+now.Sub(st.last).Seconds()*float64(cfg.Rate), float64(cfg.burst()))
+	st.last = now
+	if st.tokens >= 1 {
+		st.tokens--
+		return 0, true
+	}
+	l.limited.Add(1)
+	if now.Sub(st.windowAt) > ipBanWindow {
+		st.rejected, st.windowAt = 0, now
+	}
+	st.rejected++
+	if cfg.BanAfter > 0 && st.rejected >= cfg.BanAfter {
+		st.banned, st.manual = now.Add(cfg.banTime()), false
+		st.rejected, st.windowAt = 0, now
+		l.bans.Add(1)
+		return cfg.banTime(), false
+	}
+	return time.Duration((1 - st.tokens) / float64(cfg.Rate) * float64(time.Second)), false
+}
+
+func (cfg IPLimitsConfig) burst() int {
+	if cfg.Burst > 0 {
+		return cfg.Burst
+	}
+	return max(cfg.Rate, 1)
+}
+
+func maxConnsPerIP(cfg IPLimitsConfig) int {
+	if cfg.Conns > 0 {
+		return cfg.Conns
+	}
+	return 100000
+}
+
+func (cfg IPLimitsConfig) banTime() time.Duration {
+	if cfg.BanTime > 0 {
+		return time.Duration(cfg.BanTime) * time.Second
+	}
+	return defaultBanTime * time.Second
+}
+
+func (l *ipLimiter) ban(ip string, till time.Time) {
+	s := l.shard(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.m[ip]
+	if st == nil {
+		st = &ipState{last: time.Now(), windowAt: time.Now()}
+		s.m[ip] = st
+		l.tracking.Add(1)
+	}
+	st.banned, st.manual = till, true
+}
+
+// unban returns false if IP wasn't banned
+func (l *ipLimiter) unban(ip string) bool {
+	s := l.shard(ip)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.m[ip]
+	if st == nil || !time.Now().Before(st.banned) {
+		return false
+	}
+	st.banned, st.rejected = time.Time{}, 0
+	return true
+}
+
+// expire forgets IPs that are not banned and have full bucket by now
+func (l *ipLimiter) expire(cfg IPLimitsConfig, now time.Time) {
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		for ip, st := range s.m {
+			full := cfg.Rate <= 0 || st.tokens+now.Sub(st.last).Seconds()*float64(cfg.Rate) >= float64(cfg.burst())
+			if full && !now.Before(st.banned) && now.Sub(st.windowAt) > ipBanWindow {
+				delete(s.m, ip)
+				l.tracking.Add(-1)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// IPLimitsLoop forgets idle IPs every minute
+func IPLimitsLoop(cfg IPLimitsConfig) {
+	for range time.Tick(ipBanWindow) {
+		ipLimits.expire(cfg, time.Now())
+	}
+}
+
+func ipLimitHandler(cfg IPLimitsConfig, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	for _, v := range cfg.Allow {
+		if ip := net.ParseIP(v); ip != nil {
+			ipLimits.allow[ip.String()] = true
+		}
+	}
+	return func(ctx *fasthttp.RequestCtx) {
+		wait, ok := ipLimits.check(cfg, clientIP(ctx), time.Now())
+		if !ok {
+			ctx.Error("too many requests from "+clientIP(ctx), 429)
+			setRetryAfter(ctx, wait)
+			return
+		}
+		h(ctx)
+	}
+}
+
+type BannedIP struct {
+	IP     string
+	Till   time.Time
+	Manual bool `json:",omitempty"` // banned via admin API
+}
+
+type IPLimitsStats struct {
+	Limited  int64 // requests rejected by rate limit
+	Refused  int64 // requests of banned IPs
+	Bans     int64 // automatic bans since start
+	Tracking int64 // IPs currently tracked
+	Banned   []BannedIP
+}
+
+// GetIPLimitsHandler - GET /admin/ips shows limit metrics and currently banned IPs
+func GetIPLimitsHandler(ctx *fasthttp.RequestCtx) {
+	res := IPLimitsStats{
+		Limited:  ipLimits.limited.Load(),
+		Refused:  ipLimits.refused.Load(),
+		Bans:     ipLimits.bans.Load(),
+		Tracking: ipLimits.tracking.Load(),
+		Banned:   []BannedIP{},
+	}
+	now := time.Now()
+	for i := range ipLimits.shards {
+		s := &ipLimits.shards[i]
+		s.mu.Lock()
+		for ip, st := range s.m {
+			if now.Before(st.banned) {
+				res.Banned = append(res.Banned, BannedIP{IP: ip, Till: st.banned, Manual: st.manual})
+			}
+		}
+		s.mu.Unlock()
+	}
+	sort.Slice(res.Banned, func(i, j int) bool { return res.Banned[i].Till.After(res.Banned[j].Till) })
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func getIP(ctx *fasthttp.RequestCtx) (string, error) {
+	ip := net.ParseIP(ctx.UserValue("ip").(string))
+	if ip == nil {
+		return "", errBadIP
+	}
+	return ip.String(), nil
+}
+
+// BanIPHandler - PUT /admin/ips/:ip?ttl= bans IP for ttl seconds (default BanTime)
+func BanIPHandler(ctx *fasthttp.RequestCtx) {
+	ip, err := getIP(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl := config.IPLimits.banTime()
+	if v := ctx.QueryArgs().Peek("ttl"); len(v) > 0 {
+		n, err := strconv.Atoi(string(v))
+		if err != nil || n <= 0 {
+			ctx.Error("ttl should be positive number of seconds", 400)
+			return
+		}
+		ttl = time.Duration(n) * time.Second
+	}
+	ipLimits.ban(ip, time.Now().Add(ttl))
+}
+
+// UnbanIPHandler - DELETE /admin/ips/:ip
+func UnbanIPHandler(ctx *fasthttp.RequestCtx) {
+	ip, err := getIP(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if !ipLimits.unban(ip) {
+		ctx.Error("not banned", 404)
+		return
+	}
+}
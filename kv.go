@@ -0,0 +1,414 @@
+// KV endpoints store arbitrary blobs per account. Writes go through the
+// same request pipeline as /req (Store.Singleton + group commit), so
+// values are versioned, indexed and can be watched.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type KVResponse struct {
+	Key     string
+	Version int64
+}
+
+func writeKVResponse(ctx *fasthttp.RequestCtx, res KVResponse) {
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.Header.Set("X-Version", strconv.FormatInt(res.Version, 10))
+	ctx.Response.SetBody(d)
+}
+
+// GetKVHandler returns stored blob as is with Content-Type it was stored with,
+// version is returned in X-Version header and as ETag (304 if If-None-Match matches)
+func GetKVHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	v, err := cachedKV(acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if v == nil {
+		ctx.Error("not found", 404)
+		return
+	}
+	ctx.Response.Header.Set("X-Version", strconv.FormatInt(v.Version, 10))
+	if v.Expires != 0 {
+		ctx.Response.Header.Set("X-TTL", strconv.FormatInt(v.Expires-time.Now().Unix(), 10))
+	}
+	if config.KeyStats {
+		st, err := getStats(store.DB(), acc, statsKV, resolveAlias(acc, aliasKV, id))
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if st != nil {
+			ctx.Response.Header.Set("X-Created", strconv.FormatInt(st.Created, 10))
+			ctx.Response.Header.Set("X-Modified", strconv.FormatInt(st.Modified, 10))
+			ctx.Response.Header.Set("X-Writes", strconv.FormatInt(st.Writes, 10))
+		}
+	}
+	etag := kvETag(v.Version)
+	ctx.Response.Header.Set("ETag", etag)
+	if etagMatch(string(ctx.Request.Header.Peek("If-None-Match")), etag) {
+		ctx.SetStatusCode(fasthttp.StatusNotModified)
+		return
+	}
+	if v.Type != "" {
+		ctx.Response.Header.SetContentType(v.Type)
+	} else {
+		ctx.Response.Header.SetContentType("application/octet-stream")
+	}
+	ctx.Response.SetBody(v.Data)
+}
+
+// kvETag - versions are unique per account, so version alone identifies the value
+func kvETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// etagMatch checks If-None-Match header value against the ETag
+func etagMatch(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// getTTL parses ?ttl= or X-TTL header in seconds
+func getTTL(ctx *fasthttp.RequestCtx) (int64, error) {
+	v := ctx.QueryArgs().Peek("ttl")
+	if len(v) == 0 {
+		v = ctx.Request.Header.Peek("X-TTL")
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	ttl, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("ttl should be a positive number of seconds")
+	}
+	return ttl, nil
+}
+
+// getIfVersion parses ?if-version= or If-Match header with ETag of conditional writes
+func getIfVersion(ctx *fasthttp.RequestCtx) (*int64, error) {
+	if !ctx.QueryArgs().Has("if-version") {
+		return getIfMatch(ctx)
+	}
+	v, err := strconv.ParseInt(string(ctx.QueryArgs().Peek("if-version")), 10, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("if-version should be a version number")
+	}
+	return &v, nil
+}
+
+// getIfMatch parses If-Match header, only a single ETag returned by GET is supported
+func getIfMatch(ctx *fasthttp.RequestCtx) (*int64, error) {
+	h := strings.TrimSpace(string(ctx.Request.Header.Peek("If-Match")))
+	if h == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(h, "W/"), `"`), 10, 64)
+	if err != nil || v <= 0 {
+		return nil, fmt.Errorf("If-Match should be a single ETag of the value")
+	}
+	return &v, nil
+}
+
+// SetKVHandler stores request body as the value of the key, optionally expiring after ?ttl= seconds.
+// With ?if-version= value is written only if current version matches (409 otherwise).
+// With ?append=1 body is appended to the current value.
+func SetKVHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl, err := getTTL(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ifVersion, err := getIfVersion(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	kv := &KV{Key: id, Value: append(json.RawMessage{}, ctx.Request.Body()...), TTL: ttl, IfVersion: ifVersion}
+	kv.ContentType = string(ctx.Request.Header.ContentType())
+	kv.Lease = string(ctx.QueryArgs().Peek("lease"))
+	kv.Append = ctx.QueryArgs().GetBool("append")
+	_, err = handle(acc, Request{KVSet: []*KV{kv}, DryRun: isDryRun(ctx)})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeKVResponse(ctx, KVResponse{Key: id, Version: kv.Version})
+}
+
+// PatchKVHandler applies request body as RFC 7396 JSON merge patch to the stored value
+func PatchKVHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl, err := getTTL(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ifVersion, err := getIfVersion(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if !json.Valid(ctx.Request.Body()) {
+		ctx.Error("patch should be a valid JSON", 400)
+		return
+	}
+	kv := &KV{Key: id, Value: append(json.RawMessage{}, ctx.Request.Body()...), TTL: ttl, IfVersion: ifVersion, Patch: true}
+	kv.ContentType = "application/json"
+	kv.Lease = string(ctx.QueryArgs().Peek("lease"))
+	_, err = handle(acc, Request{KVSet: []*KV{kv}, DryRun: isDryRun(ctx)})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeKVResponse(ctx, KVResponse{Key: id, Version: kv.Version})
+}
+
+// DeleteKVHandler deletes the key, with ?if-version= or If-Match only if current version matches.
+// Non-empty body is expected value - key is deleted only if it's exactly the same (409 otherwise).
+func DeleteKVHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ifVersion, err := getIfVersion(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	kv := &KV{Key: id, Delete: true, IfVersion: ifVersion}
+	if len(ctx.Request.Body()) > 0 {
+		kv.IfValue = append(json.RawMessage{}, ctx.Request.Body()...)
+	}
+	_, err = handle(acc, Request{KVSet: []*KV{kv}, DryRun: isDryRun(ctx)})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeKVResponse(ctx, KVResponse{Key: id, Version: kv.Version})
+}
+
+type MultiGetValue struct {
+	Key     string
+	Value   json.RawMessage `json:",omitempty"`
+	Raw     []byte          `json:",omitempty"` // base64 of the value if it's not a valid JSON
+	Version int64           // 0 - not found
+	TTL     int64           `json:",omitempty"`
+
+	ContentType string `json:",omitempty"`
+
+	Created  int64 `json:",omitempty"` // key stats, with KeyStats in config
+	Modified int64 `json:",omitempty"`
+	Writes   int64 `json:",omitempty"`
+}
+
+type MultiGetResponse struct {
+	Values []MultiGetValue // in the same order as requested keys
+}
+
+// MultiGetKVHandler - POST /db/:acc/kv:multiget with JSON array of keys
+// returns all values read from a single snapshot.
+func MultiGetKVHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var keys []string
+	err = json.Unmarshal(ctx.Request.Body(), &keys)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if len(keys) > maxPageSize {
+		ctx.Error(fmt.Sprintf("more than %v keys requested", maxPageSize), 400)
+		return
+	}
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	res := MultiGetResponse{Values: make([]MultiGetValue, 0, len(keys))}
+	for _, key := range keys {
+		kv := MultiGetValue{Key: key}
+		v, err := getKV(snap, acc, resolveAlias(acc, aliasKV, key))
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if v != nil {
+			kv.Version = v.Version
+			kv.ContentType = v.Type
+			if json.Valid(v.Data) {
+				kv.Value = v.Data
+			} else {
+				kv.Raw = v.Data
+			}
+			if v.Expires != 0 {
+				kv.TTL = v.Expires - time.Now().Unix()
+			}
+		}
+		res.Values = append(res.Values, kv)
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// routeMultiGet serves /db/:acc/kv:multiget, which router can't register
+// because of ':' in the middle of path segment.
+func routeMultiGet(ctx *fasthttp.RequestCtx) bool {
+	path := string(ctx.Path())
+	if !ctx.IsPost() || !strings.HasPrefix(path, "/db/") || !strings.HasSuffix(path, "/kv:multiget") {
+		return false
+	}
+	acc := strings.TrimSuffix(strings.TrimPrefix(path, "/db/"), "/kv:multiget")
+	if strings.Contains(acc, "/") {
+		return false
+	}
+	ctx.SetUserValue("acc", acc)
+	MultiGetKVHandler(ctx)
+	return true
+}
+
+type ListKVResponse struct {
+	Keys   []MultiGetValue
+	Cursor string `json:",omitempty"` // pass as ?cursor= to get next page
+}
+
+// ListKVHandler lists keys with ?prefix= page by page, with values if ?values=1
+func ListKVHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	limit, cursor, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	withValues := ctx.QueryArgs().GetBool("values")
+	prefix := compID(cd.KVPrefix, acc, string(ctx.QueryArgs().Peek("prefix")))
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	res := ListKVResponse{Keys: []MultiGetValue{}}
+	now := time.Now().Unix()
+	accPrefix := compID(cd.KVPrefix, acc, "")
+	for iter.SeekGE(append(accPrefix, cursor...)); iter.Valid(); iter.Next() {
+		key := string(bytes.TrimPrefix(iter.Key(), accPrefix))
+		if key == cursor && cursor != "" {
+			continue
+		}
+		if len(res.Keys) == limit {
+			res.Cursor = res.Keys[len(res.Keys)-1].Key
+			break
+		}
+		var v cd.KV
+		_, err := v.UnmarshalMsg(iter.Value())
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if v.Expires != 0 && v.Expires <= now {
+			continue
+		}
+		kv := MultiGetValue{Key: key, Version: v.Version, ContentType: v.Type}
+		if v.Expires != 0 {
+			kv.TTL = v.Expires - now
+		}
+		if config.KeyStats {
+			st, err := getStats(store.DB(), acc, statsKV, key)
+			if err != nil {
+				ctx.Error(err.Error(), 400)
+				return
+			}
+			if st != nil {
+				kv.Created, kv.Modified, kv.Writes = st.Created, st.Modified, st.Writes
+			}
+		}
+		if withValues {
+			err = loadCold(&v)
+			if err != nil {
+				ctx.Error(err.Error(), 400)
+				return
+			}
+			data := append([]byte{}, v.Data...)
+			if json.Valid(data) {
+				kv.Value = data
+			} else {
+				kv.Raw = data
+			}
+		}
+		res.Keys = append(res.Keys, kv)
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
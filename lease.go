@@ -0,0 +1,355 @@
+// Leases are etcd-style sessions - client grants a lease with TTL, attaches
+// KV values and persistent locks to it and keeps it alive with keepalive
+// requests. When client stops sending keepalives lease expires, attached
+// values are deleted and locks are released.
+// Writing the value again without lease detaches it from the lease.
+// Sweeper scans all leases every second, so they are meant to be few
+// (one per client process), not one per key.
+//
+// Account|0|ID - lease
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+var ErrLeaseNotFound = errors.New("lease not found")
+
+const (
+	leaseKeys  = "kv"
+	leaseLocks = "lock"
+)
+
+type LeaseResponse struct {
+	ID    string
+	TTL   int64
+	Till  int64    // unix milliseconds
+	Keys  []string `json:",omitempty"`
+	Locks []string `json:",omitempty"`
+}
+
+// getLease returns the lease, expired leases are returned too
+func getLease(b pebble.Reader, acc, id string) (*cd.Lease, error) {
+	d, closer, err := b.Get(compID(cd.LeasePrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var l cd.Lease
+	_, err = l.UnmarshalMsg(d)
+	return &l, err
+}
+
+// getLiveLease returns ErrLeaseNotFound if lease doesn't exist or expired
+func getLiveLease(b pebble.Reader, acc, id string) (*cd.Lease, error) {
+	l, err := getLease(b, acc, id)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || l.Till <= ttlNow().UnixMilli() {
+		return nil, ErrLeaseNotFound
+	}
+	return l, nil
+}
+
+// newLeaseID returns unused lease ID, call within Singleton
+func newLeaseID(b *pebble.Batch, acc string) (string, error) {
+	for n := time.Now().UnixNano(); ; n++ {
+		id := strconv.FormatInt(n, 10)
+		cur, err := getLease(b, acc, id)
+		if err != nil {
+			return "", err
+		}
+		if cur == nil {
+			return id, nil
+		}
+	}
+}
+
+func putLease(b *pebble.Batch, acc, id string, l *cd.Lease) error {
+	d, err := l.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.LeasePrefix, acc, id), d, pebble.NoSync)
+}
+
+// attachLease adds KV key or persistent lock to the lease
+func attachLease(b *pebble.Batch, acc, id, kind, key string) error {
+	l, err := getLiveLease(b, acc, id)
+	if err != nil {
+		return err
+	}
+	list := &l.Keys
+	if kind == leaseLocks {
+		list = &l.Locks
+	}
+	for _, v := range *list {
+		if v == key {
+			return nil
+		}
+	}
+	*list = append(*list, key)
+	return putLease(b, acc, id, l)
+}
+
+// revokeLease deletes the lease and entries which are still attached to it
+func revokeLease(b *pebble.Batch, acc, id string, l *cd.Lease) error {
+	for _, key := range l.Keys {
+		d, closer, err := b.Get(compID(cd.KVPrefix, acc, key))
+		if err == pebble.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var v cd.KV
+		_, err = v.UnmarshalMsg(d)
+		closer.Close()
+		if err != nil {
+			return err
+		}
+		if v.Lease != id {
+			continue // overwritten without lease
+		}
+		err = handleKVSet(acc, b, &KV{Key: key, Delete: true})
+		if err != nil {
+			return err
+		}
+	}
+	for _, lock := range l.Locks {
+		d, closer, err := b.Get(compID(cd.PLockPrefix, acc, lock))
+		if err == pebble.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var v cd.Lock
+		_, err = v.UnmarshalMsg(d)
+		closer.Close()
+		if err != nil {
+			return err
+		}
+		if v.Lease != id {
+			continue // taken again without lease
+		}
+		err = b.Delete(compID(cd.PLockPrefix, acc, lock), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		if l.Behavior != "" { // Consul session, lock holders see release via ModifyIndex
+			err = consulTouch(b, acc, lock)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return b.Delete(compID(cd.LeasePrefix, acc, id), pebble.NoSync)
+}
+
+// sweepLeases revokes expired leases, returns number revoked
+func (p *Store) sweepLeases() (int, error) {
+	iter, err := p.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.LeasePrefix},
+		UpperBound: []byte{cd.LeasePrefix + 1},
+	})
+	if err != nil {
+		return 0, err
+	}
+	now := ttlNow().UnixMilli()
+	byAcc := map[string][]string{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		k := iter.Key()[1:]
+		i := bytes.IndexByte(k, 0)
+		if i < 0 {
+			continue
+		}
+		var l cd.Lease
+		_, err := l.UnmarshalMsg(iter.Value())
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+		if l.Till > now {
+			continue
+		}
+		acc := string(k[:i])
+		byAcc[acc] = append(byAcc[acc], string(k[i+1:]))
+	}
+	err = iter.Close()
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for acc, ids := range byAcc {
+		b := p.DB().NewIndexedBatch()
+		err := p.Singleton([]byte(acc), func() error {
+			for _, id := range ids {
+				l, err := getLease(b, acc, id)
+				if err != nil {
+					return err
+				}
+				if l == nil || l.Till > ttlNow().UnixMilli() { // kept alive in the meantime
+					continue
+				}
+				err = revokeLease(b, acc, id, l)
+				if err != nil {
+					return err
+				}
+				revoked++
+			}
+			return b.Commit(pebble.NoSync)
+		})
+		if err != nil {
+			return revoked, err
+		}
+	}
+	return revoked, nil
+}
+
+func writeLeaseResponse(ctx *fasthttp.RequestCtx, id string, l *cd.Lease) {
+	d, err := json.Marshal(LeaseResponse{ID: id, TTL: l.TTL, Till: l.Till, Keys: l.Keys, Locks: l.Locks})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func leaseError(ctx *fasthttp.RequestCtx, acc string, err error) {
+	if errors.Is(err, ErrLeaseNotFound) {
+		ctx.Error(err.Error(), 404)
+		return
+	}
+	retryError(ctx, acc, "", err)
+}
+
+// GrantLeaseHandler - POST /db/:acc/lease?ttl= creates a new lease
+func GrantLeaseHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl, err := getPLockTTL(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var id string
+	l := &cd.Lease{TTL: int64(ttl)}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		id, err = newLeaseID(b, acc)
+		if err != nil {
+			return err
+		}
+		l.Till = ttlNow().UnixMilli() + l.TTL*1000
+		err := putLease(b, acc, id, l)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeLeaseResponse(ctx, id, l)
+}
+
+func GetLeaseHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	l, err := getLiveLease(store.DB(), acc, id)
+	if err != nil {
+		leaseError(ctx, acc, err)
+		return
+	}
+	writeLeaseResponse(ctx, id, l)
+}
+
+// KeepaliveLeaseHandler - PUT /db/:acc/lease/:id extends the lease by its TTL
+func KeepaliveLeaseHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var l *cd.Lease
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = getLiveLease(b, acc, id)
+		if err != nil {
+			return err
+		}
+		l.Till = ttlNow().UnixMilli() + l.TTL*1000
+		err = putLease(b, acc, id, l)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		leaseError(ctx, acc, err)
+		return
+	}
+	writeLeaseResponse(ctx, id, l)
+}
+
+// RevokeLeaseHandler - DELETE /db/:acc/lease/:id revokes the lease right away
+func RevokeLeaseHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var l *cd.Lease
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = getLiveLease(b, acc, id)
+		if err != nil {
+			return err
+		}
+		err = revokeLease(b, acc, id, l)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		leaseError(ctx, acc, err)
+		return
+	}
+	writeLeaseResponse(ctx, id, l)
+}
@@ -0,0 +1,70 @@
+// Size limits protect batches and flush latency from huge requests.
+// Global limits are set in config and can be overridden per account,
+// 0 means no limit.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrValueTooLarge = errors.New("value too large")
+
+type LimitsConfig struct {
+	MaxValueSize  int `yaml:"MaxValueSize"`  // bytes of KV value
+	MaxKeyLen     int `yaml:"MaxKeyLen"`     // KV key length
+	MaxCounterLen int `yaml:"MaxCounterLen"` // atomic counter ID length
+
+	Accounts map[string]LimitsConfig `yaml:"Accounts"` // per-account overrides
+}
+
+// accountLimits returns limits of the account, account limits take precedence over global ones
+func accountLimits(acc string) LimitsConfig {
+	l := config.Limits
+	a, ok := l.Accounts[acc]
+	if !ok {
+		return l
+	}
+	if a.MaxValueSize != 0 {
+		l.MaxValueSize = a.MaxValueSize
+	}
+	if a.MaxKeyLen != 0 {
+		l.MaxKeyLen = a.MaxKeyLen
+	}
+	if a.MaxCounterLen != 0 {
+		l.MaxCounterLen = a.MaxCounterLen
+	}
+	return l
+}
+
+func checkValueSize(l LimitsConfig, v []byte) error {
+	if l.MaxValueSize > 0 && len(v) > l.MaxValueSize {
+		return fmt.Errorf("%w: %v bytes, limit is %v", ErrValueTooLarge, len(v), l.MaxValueSize)
+	}
+	return nil
+}
+
+// checkLimits validates request before any locks are taken
+func checkLimits(acc string, req Request) error {
+	l := accountLimits(acc)
+	for _, v := range req.KVSet {
+		if l.MaxKeyLen > 0 && len(v.Key) > l.MaxKeyLen {
+			return fmt.Errorf("key %q is longer than %v", v.Key, l.MaxKeyLen)
+		}
+		err := checkValueSize(l, v.Value)
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range req.KVGet {
+		if l.MaxKeyLen > 0 && len(v) > l.MaxKeyLen {
+			return fmt.Errorf("key %q is longer than %v", v, l.MaxKeyLen)
+		}
+	}
+	for _, v := range req.Atomic {
+		if l.MaxCounterLen > 0 && len(v.Key) > l.MaxCounterLen {
+			return fmt.Errorf("counter %q is longer than %v", v.Key, l.MaxCounterLen)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+// Lists store every element under a separate key indexed by position, so
+// push and pop at both ends don't rewrite the whole list.
+//
+// Account|0|ID           - list metadata (head & tail index)
+// Account|0|ID|0|Index   - element
+//
+// Pop can block until something is pushed to the list, using the same
+// notifier as KV watch requests.
+package main
+
+import (
+	"clouddragon/cd"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type ListResponse struct {
+	Len    int64
+	Values []json.RawMessage `json:",omitempty"`
+}
+
+func listElemKey(acc, id string, i int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(i)^(1<<63)) // keep negative indexes first
+	return compID2(cd.ListPrefix, acc, id, string(b))
+}
+
+// notifier key used to wake up blocked pops
+func listWatchKey(id string) string {
+	return string([]byte{cd.ListPrefix, 0}) + id
+}
+
+func getListMeta(b pebble.Reader, acc, id string) (cd.ListMeta, error) {
+	var m cd.ListMeta
+	d, closer, err := b.Get(compID(cd.ListPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	defer closer.Close()
+	_, err = m.UnmarshalMsg(d)
+	return m, err
+}
+
+func putListMeta(b *pebble.Batch, acc, id string, m cd.ListMeta) error {
+	d, err := m.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.ListPrefix, acc, id), d, pebble.NoSync)
+}
+
+func getSide(ctx *fasthttp.RequestCtx) (bool, error) {
+	switch string(ctx.QueryArgs().Peek("side")) {
+	case "left":
+		return true, nil
+	case "right", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("side should be left or right")
+}
+
+// listPop removes n elements from one side of the list
+func listPop(b *pebble.Batch, acc, id string, m *cd.ListMeta, left bool, n int) ([]json.RawMessage, error) {
+	var res []json.RawMessage
+	for ; n > 0 && m.Head < m.Tail; n-- {
+		i := m.Tail - 1
+		if left {
+			i = m.Head
+		}
+		key := listElemKey(acc, id, i)
+		d, closer, err := b.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, append(json.RawMessage{}, d...))
+		closer.Close()
+		err = b.Delete(key, pebble.NoSync)
+		if err != nil {
+			return nil, err
+		}
+		if left {
+			m.Head++
+		} else {
+			m.Tail--
+		}
+	}
+	return res, nil
+}
+
+// listPush pushes values to one side of the list trimming it to capLen (if > 0)
+func listPush(b *pebble.Batch, acc, id string, values []json.RawMessage, left bool, capLen int64) (cd.ListMeta, error) {
+	m, err := getListMeta(b, acc, id)
+	if err != nil {
+		return m, err
+	}
+	for _, v := range values {
+		i := m.Tail
+		if left {
+			m.Head--
+			i = m.Head
+		} else {
+			m.Tail++
+		}
+		err = b.Set(listElemKey(acc, id, i), v, pebble.NoSync)
+		if err != nil {
+			return m, err
+		}
+	}
+	if capLen > 0 && m.Tail-m.Head > capLen {
+		_, err = listPop(b, acc, id, &m, !left, int(m.Tail-m.Head-capLen))
+		if err != nil {
+			return m, err
+		}
+	}
+	m.Version++
+	return m, putListMeta(b, acc, id, m)
+}
+
+// PushHandler pushes JSON array of values to the ?side= of the list.
+// If list becomes longer than ?cap= - elements from the other side are dropped.
+func PushHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	left, err := getSide(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	capLen := int64(ctx.QueryArgs().GetUintOrZero("cap"))
+	var values []json.RawMessage
+	err = json.Unmarshal(ctx.Request.Body(), &values)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var m cd.ListMeta
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		m, err = listPush(b, acc, id, values, left, capLen)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if !isDryRun(ctx) {
+		store.notifier(acc).NotifyVersion(listWatchKey(id), m.Version)
+	}
+	d, err := json.Marshal(ListResponse{Len: m.Tail - m.Head})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// PopHandler pops ?n= values from the ?side= of the list. If list is empty
+// request blocks up to ?wait= seconds until something is pushed.
+func PopHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	left, err := getSide(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	n := 1
+	if ctx.QueryArgs().Has("n") {
+		n = ctx.QueryArgs().GetUintOrZero("n")
+		if n <= 0 || n > maxPageSize {
+			ctx.Error("n is not in range 1~1000", 400)
+			return
+		}
+	}
+	wait := ctx.QueryArgs().GetUintOrZero("wait")
+	if wait > 60 {
+		wait = 60
+	}
+	deadline := time.Now().Add(time.Second * time.Duration(wait))
+	nf := store.notifier(acc)
+	var res ListResponse
+	for {
+		attached := false
+		var ver int64
+		b := store.DB().NewIndexedBatch()
+		err = store.Singleton([]byte(acc), func() error {
+			m, err := getListMeta(b, acc, id)
+			if err != nil {
+				return err
+			}
+			res.Values, err = listPop(b, acc, id, &m, left, n)
+			if err != nil {
+				return err
+			}
+			res.Len = m.Tail - m.Head
+			if len(res.Values) == 0 {
+				if time.Now().Before(deadline) {
+					// attach under singleton lock, so push can't happen
+					// between the check and listening
+					nf.Attach(listWatchKey(id), m.Version)
+					attached = true
+					ver = m.Version
+				}
+				return nil
+			}
+			// metadata is kept even for empty list, so version
+			// never goes back for blocked pops
+			err = putListMeta(b, acc, id, m)
+			if err != nil {
+				return err
+			}
+			return commitBatch(ctx, b)
+		})
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if !attached {
+			break
+		}
+		remaining := int(time.Until(deadline).Seconds())
+		if nf.Listen(listWatchKey(id), ver, remaining) == -1 {
+			break // timeout
+		}
+	}
+	if len(res.Values) == 0 && wait > 0 {
+		ctx.Error("list is empty", 404)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetListHandler returns elements in range ?start=&stop= (inclusive, negative
+// values are counted from the end of the list).
+func GetListHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	m, err := getListMeta(snap, acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	res := ListResponse{Len: m.Tail - m.Head}
+	start, stop := int64(0), int64(-1)
+	if v, err := ctx.QueryArgs().GetUint("start"); err == nil {
+		start = int64(v)
+	}
+	if ctx.QueryArgs().Has("stop") {
+		_, err = fmt.Sscan(string(ctx.QueryArgs().Peek("stop")), &stop)
+		if err != nil {
+			ctx.Error("stop should be a number", 400)
+			return
+		}
+	}
+	if stop < 0 {
+		stop += res.Len
+	}
+	if stop >= res.Len {
+		stop = res.Len - 1
+	}
+	if stop-start >= maxPageSize {
+		stop = start + maxPageSize - 1
+	}
+	for i := start; i <= stop; i++ {
+		d, closer, err := snap.Get(listElemKey(acc, id, m.Head+i))
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		res.Values = append(res.Values, append(json.RawMessage{}, d...))
+		closer.Close()
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func DeleteListHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		m, err := getListMeta(b, acc, id)
+		if err != nil {
+			return err
+		}
+		prefix := compID2(cd.ListPrefix, acc, id, "")
+		err = b.DeleteRange(prefix, prefixEnd(prefix), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		err = putListMeta(b, acc, id, cd.ListMeta{Version: m.Version})
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
@@ -0,0 +1,146 @@
+// Locked get & put collapse the common "lock, read, write, unlock"
+// critical section into two requests:
+//
+// GET  - acquires the lock with the same ID as the KV key and returns value
+// PUT  - validates lock handle, writes the value and releases the lock
+//
+// PUT without handle acquires the lock, writes the value and releases it
+// in a single request.
+package main
+
+import (
+	"fmt"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type LockedResponse struct {
+	Key     string
+	Value   json.RawMessage `json:",omitempty"`
+	Version int64
+	Lock    int64 `json:",omitempty"` // handle to pass to PUT
+	Token   int64 `json:",omitempty"` // fencing token of acquired lock
+}
+
+func getLockArgs(ctx *fasthttp.RequestCtx) (int, int, error) {
+	dur := ctx.QueryArgs().GetUintOrZero("dur")
+	if dur <= 0 {
+		dur = 30
+	}
+	wait := ctx.QueryArgs().GetUintOrZero("wait")
+	if dur > 86400 || wait > 60 {
+		return 0, 0, fmt.Errorf("dur should be up to 86400 and wait up to 60 seconds")
+	}
+	return dur, wait, nil
+}
+
+func writeLockedResponse(ctx *fasthttp.RequestCtx, res LockedResponse) {
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// LockedGetHandler locks the key for ?dur= seconds waiting up to ?wait= seconds
+// and returns current value. ?owner= is kept as metadata of the holder.
+func LockedGetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	dur, wait, err := getLockArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	res, err := handle(acc, Request{
+		LockID:    id,
+		LockDur:   dur,
+		LockWait:  wait,
+		LockOwner: ownerJSON(append([]byte{}, ctx.QueryArgs().Peek("owner")...)),
+		KVGet:     []string{id},
+	})
+	if err != nil {
+		retryError(ctx, acc, id, err)
+		return
+	}
+	writeLockedResponse(ctx, LockedResponse{
+		Key:     id,
+		Value:   res.KVGet[0].Value,
+		Version: res.KVGet[0].Version,
+		Lock:    res.Lock,
+		Token:   res.Token,
+	})
+}
+
+// LockedPutHandler writes body as the value of the key and releases the lock
+// held with ?handle=. Without handle lock is acquired first (waiting up to ?wait=).
+func LockedPutHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	dur, wait, err := getLockArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if isDryRun(ctx) { // locked write always takes or releases the lock
+		ctx.Error("dry run is not supported for locked writes", 400)
+		return
+	}
+	value := ctx.Request.Body()
+	if !json.Valid(value) {
+		ctx.Error("value should be a valid json", 400)
+		return
+	}
+	kv := &KV{Key: id, Value: append(json.RawMessage{}, value...)}
+	handle64 := int64(ctx.QueryArgs().GetUintOrZero("handle"))
+	if handle64 == 0 {
+		res, err := handle(acc, Request{
+			LockID:   id,
+			LockDur:  dur,
+			LockWait: wait,
+			KVSet:    []*KV{kv},
+		})
+		if err != nil {
+			retryError(ctx, acc, id, err)
+			return
+		}
+		handle64 = res.Lock
+		_, err = handle(acc, Request{UnlockID: id, Unlock: handle64})
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	} else {
+		_, err = handle(acc, Request{
+			UnlockID: id,
+			Unlock:   handle64,
+			KVSet:    []*KV{kv},
+		})
+		if err != nil {
+			ctx.Error(err.Error(), 409)
+			return
+		}
+	}
+	writeLockedResponse(ctx, LockedResponse{
+		Key:     id,
+		Version: kv.Version,
+	})
+}
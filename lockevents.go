@@ -0,0 +1,175 @@
+// Lock events stream changes of a fast lock as server-sent events, so
+// clients waiting for a release don't have to poll the lock endpoint.
+// Stream starts with "state" event (same as GET of the lock), followed
+// by acquire, extend, release, expire, steal, yield and preempt events.
+// Events are published under the lock shard mutex, so the state is never
+// older than the events after it. Subscriber that doesn't keep up with events is disconnected
+// and should reconnect to get the current state again.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	lockEventBuffer    = 64
+	lockEventHeartbeat = time.Second * 15
+)
+
+const (
+	lockAcquired  = "acquire"
+	lockExtended  = "extend"
+	lockReleased  = "release"
+	lockExpired   = "expire"
+	lockStolen    = "steal"
+	lockYield     = "yield"   // waiter of higher priority asks holder to release the lock
+	lockPreempted = "preempt" // lock wasn't released by the yield deadline
+)
+
+type LockEvent struct {
+	Type  string          `json:"-"`
+	At    int64           // unix ms
+	Till  int64           `json:",omitempty"` // expiration of acquired or extended lock
+	Owner json.RawMessage `json:",omitempty"`
+	// steal events - owner the lock was taken from and why
+	Previous json.RawMessage `json:",omitempty"`
+	Reason   string          `json:",omitempty"`
+	// yield events - unix ms lock is force-released at, Owner is the requester
+	YieldBy int64 `json:",omitempty"`
+}
+
+type lockSub struct {
+	ch     chan LockEvent
+	closed bool // channel closed because subscriber was too slow
+}
+
+type lockEventHub struct {
+	mu   sync.Mutex
+	subs map[string]map[*lockSub]struct{} // lock cid -> subscribers
+	n    atomic.Int64
+}
+
+var lockEvents = &lockEventHub{subs: map[string]map[*lockSub]struct{}{}}
+
+// publish sends event to subscribers of the lock, call with shard mutex locked
+func (h *lockEventHub) publish(cid, typ string, till int64, owner []byte) {
+	h.publishEvent(cid, LockEvent{Type: typ, Till: till, Owner: ownerJSON(owner)})
+}
+
+func (h *lockEventHub) publishEvent(cid string, e LockEvent) {
+	if h.n.Load() == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subs[cid]
+	if len(subs) == 0 {
+		return
+	}
+	e.At = time.Now().UnixMilli()
+	for s := range subs {
+		select {
+		case s.ch <- e:
+		default:
+			close(s.ch)
+			s.closed = true
+			delete(subs, s)
+			h.n.Add(-1)
+		}
+	}
+	if len(subs) == 0 {
+		delete(h.subs, cid)
+	}
+}
+
+// subscribe returns subscription and current state of the lock
+func (h *lockEventHub) subscribe(acc, id string) (*lockSub, PLockResponse) {
+	cid := acc + string([]byte{0}) + id
+	km := chooseLock(cid)
+	km.l.Lock()
+	defer km.l.Unlock()
+	s := &lockSub{ch: make(chan LockEvent, lockEventBuffer)}
+	h.mu.Lock()
+	if h.subs[cid] == nil {
+		h.subs[cid] = map[*lockSub]struct{}{}
+	}
+	h.subs[cid][s] = struct{}{}
+	h.n.Add(1)
+	h.mu.Unlock()
+	res := PLockResponse{ID: id, Waiting: len(km.queue[cid])}
+	if fl, ok := km.m[cid]; ok {
+		res.Locked, res.Fast, res.Till, res.Owner, res.YieldBy = true, true, fl.till, ownerJSON(fl.owner), fl.yieldBy()
+	}
+	return s, res
+}
+
+func (h *lockEventHub) unsubscribe(acc, id string, s *lockSub) {
+	cid := acc + string([]byte{0}) + id
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.closed {
+		return
+	}
+	delete(h.subs[cid], s)
+	if len(h.subs[cid]) == 0 {
+		delete(h.subs, cid)
+	}
+	h.n.Add(-1)
+}
+
+func writeSSE(w *bufio.Writer, event string, v any) error {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, d)
+	return w.Flush()
+}
+
+// LockEventsHandler - GET /db/:acc/lock/:id/events streams events of the fast lock
+func LockEventsHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.SetContentType("text/event-stream")
+	ctx.Response.Header.Set("Cache-Control", "no-cache")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		s, state := lockEvents.subscribe(acc, id)
+		defer lockEvents.unsubscribe(acc, id, s)
+		if writeSSE(w, "state", state) != nil {
+			return
+		}
+		t := time.NewTicker(lockEventHeartbeat)
+		defer t.Stop()
+		for {
+			select {
+			case e, ok := <-s.ch:
+				if !ok {
+					return // too slow, client should reconnect
+				}
+				if writeSSE(w, e.Type, e) != nil {
+					return
+				}
+			case <-t.C:
+				w.WriteString(": ping\n\n") // fails once client is gone
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+}
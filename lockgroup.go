@@ -0,0 +1,392 @@
+// Lock groups are named sets of fast locks taken together. Group is defined
+// once with its lock IDs, then acquired all-or-nothing like multi-lock and
+// held with a single handle: all locks of the group share one TTL, extending
+// or releasing the group extends or releases every lock. Holder of the
+// group with its locks and their fencing tokens is stored in the group
+// record, so the handle keeps working after restart while locks are held.
+//
+// LockGroupPrefix|Account|0|ID - group
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type LockGroupRequest struct {
+	IDs []string
+}
+
+type LockGroupResponse struct {
+	ID      string
+	IDs     []string
+	Locked  bool
+	Till    int64       `json:",omitempty"` // unix seconds
+	Locks   []MultiLock `json:",omitempty"` // returned only to the holder
+	Handle  int64       `json:",omitempty"` // returned only to the holder
+	Created int64
+	Updated int64
+}
+
+func getLockGroup(b pebble.Reader, acc, id string) (*cd.LockGroup, error) {
+	d, closer, err := b.Get(compID(cd.LockGroupPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var g cd.LockGroup
+	_, err = g.UnmarshalMsg(d)
+	if err != nil {
+		return nil, err
+	}
+	if g.Handle != 0 && g.Till <= ttlNow().Unix() {
+		g.Handle, g.Till, g.Locks = 0, 0, nil // expired
+	}
+	return &g, nil
+}
+
+func putLockGroup(b *pebble.Batch, acc, id string, g *cd.LockGroup) error {
+	d, err := g.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.LockGroupPrefix, acc, id), d, pebble.NoSync)
+}
+
+func groupLocks(g *cd.LockGroup) []MultiLock {
+	locks := make([]MultiLock, len(g.Locks))
+	for i, l := range g.Locks {
+		locks[i] = MultiLock{ID: l.ID, Handle: l.Handle, Token: l.Token}
+	}
+	return locks
+}
+
+// extendGroup moves expiration of every lock to the same time
+func extendGroup(acc string, locks []MultiLock, dur int) (int64, error) {
+	till := ttlNow().Unix() + int64(dur)
+	for _, l := range locks {
+		cid := acc + string([]byte{0}) + l.ID
+		err := chooseLock(cid).extendLock(cid, l.Handle, till)
+		if err != nil {
+			return 0, fmt.Errorf("%w: lock %v of the group: %v", cd.ErrNotLocked, l.ID, err)
+		}
+		if config.PersistLocks {
+			err = persistExtension(acc, l.ID, l.Handle, dur)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return till, nil
+}
+
+func writeLockGroupResponse(ctx *fasthttp.RequestCtx, id string, g *cd.LockGroup, holder bool) {
+	res := LockGroupResponse{ID: id, IDs: g.IDs, Locked: g.Handle != 0, Till: g.Till, Created: g.Created, Updated: g.Updated}
+	if holder {
+		res.Locks, res.Handle = groupLocks(g), g.Handle
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetLockGroupHandler - GET /db/:acc/lockgroup/:id returns locks of the group and if it's held
+func GetLockGroupHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	g, err := getLockGroup(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if g == nil {
+		ctx.Error("lock group not found", 404)
+		return
+	}
+	writeLockGroupResponse(ctx, id, g, false)
+}
+
+// SetLockGroupHandler - PUT /db/:acc/lockgroup/:id with {"IDs": [...]} defines
+// the group, current holder keeps the locks it acquired
+func SetLockGroupHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req LockGroupRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	err = checkLockIDs(req.IDs)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var g *cd.LockGroup
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		g, err = getLockGroup(b, acc, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		if g == nil {
+			g = &cd.LockGroup{Created: now}
+		}
+		g.IDs = lockOrder(acc, req.IDs)
+		g.Updated = now
+		err = putLockGroup(b, acc, id, g)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeLockGroupResponse(ctx, id, g, false)
+}
+
+// DeleteLockGroupHandler - DELETE /db/:acc/lockgroup/:id removes the group if it's not held
+func DeleteLockGroupHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var g *cd.LockGroup
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		g, err = getLockGroup(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if g != nil && g.Handle != 0 {
+			return b.Close()
+		}
+		err = b.Delete(compID(cd.LockGroupPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if g != nil && g.Handle != 0 {
+		plockConflict(ctx, g.Till)
+		return
+	}
+}
+
+// LockGroupHandler - POST /db/:acc/lockgroup/:id/lock?dur=&wait=&owner-id= with
+// owner metadata in the body acquires all locks of the group
+func LockGroupHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	dur, wait, err := getLockArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	owner := ownerJSON(append([]byte{}, ctx.Request.Body()...))
+	ownerID := string(ctx.QueryArgs().Peek("owner-id"))
+	g, err := getLockGroup(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if g == nil {
+		ctx.Error("lock group not found", 404)
+		return
+	}
+	locks, lockID, err := multiLock(acc, g.IDs, dur, wait, owner, ownerID)
+	if err != nil {
+		retryError(ctx, acc, lockID, err)
+		return
+	}
+	till, err := extendGroup(acc, locks, dur)
+	if err == nil {
+		b := store.DB().NewIndexedBatch()
+		err = store.Singleton([]byte(acc), func() error {
+			g, err = getLockGroup(b, acc, id)
+			if err != nil {
+				return err
+			}
+			if g == nil {
+				return fmt.Errorf("lock group was deleted")
+			}
+			g.Handle, g.Till, g.Locks = time.Now().UnixNano(), till, make([]cd.LockGroupLock, len(locks))
+			for i, l := range locks {
+				g.Locks[i] = cd.LockGroupLock{ID: l.ID, Handle: l.Handle, Token: l.Token}
+			}
+			err = putLockGroup(b, acc, id, g)
+			if err != nil {
+				return err
+			}
+			return commitBatch(ctx, b)
+		})
+	}
+	if err != nil {
+		uerr := multiUnlock(acc, locks)
+		if uerr != nil {
+			log.Print("lock group: ", uerr)
+		}
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeLockGroupResponse(ctx, id, g, true)
+}
+
+// ExtendLockGroupHandler - PUT /db/:acc/lockgroup/:id/lock?handle=&dur= extends all locks of the group
+func ExtendLockGroupHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	dur, _, err := getLockArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	handle := int64(ctx.QueryArgs().GetUintOrZero("handle"))
+	if handle == 0 {
+		ctx.Error("handle is required", 400)
+		return
+	}
+	var g *cd.LockGroup
+	var conflict bool
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		g, err = getLockGroup(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if g == nil || g.Handle != handle {
+			conflict = true
+			return b.Close()
+		}
+		g.Till, err = extendGroup(acc, groupLocks(g), dur)
+		if err != nil {
+			return err
+		}
+		err = putLockGroup(b, acc, id, g)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if conflict {
+		var till int64
+		if g != nil {
+			till = g.Till
+		}
+		plockConflict(ctx, till)
+		return
+	}
+	writeLockGroupResponse(ctx, id, g, true)
+}
+
+// UnlockGroupHandler - DELETE /db/:acc/lockgroup/:id/lock?handle= releases all locks of the group
+func UnlockGroupHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	handle := int64(ctx.QueryArgs().GetUintOrZero("handle"))
+	if handle == 0 {
+		ctx.Error("handle is required", 400)
+		return
+	}
+	var g *cd.LockGroup
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		g, err = getLockGroup(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if g == nil || g.Handle == 0 {
+			return b.Close() // expired
+		}
+		if g.Handle != handle {
+			return b.Close()
+		}
+		err = multiUnlock(acc, groupLocks(g))
+		if err != nil {
+			return err
+		}
+		g.Handle, g.Till, g.Locks = 0, 0, nil
+		err = putLockGroup(b, acc, id, g)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if g != nil && g.Handle != 0 && g.Handle != handle {
+		plockConflict(ctx, g.Till)
+		return
+	}
+}
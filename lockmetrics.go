@@ -0,0 +1,236 @@
+// Lock metrics are cumulative per-account counters of fast lock
+// acquisitions, timeouts, expirations, hold times and a histogram of wait
+// times, along with current holders and the most contended locks right now.
+// Unlike lock reports they are never reset, so they can be scraped and
+// turned into rates by monitoring. Tenants see their own numbers in
+// GET /db/:acc/locks/stats.
+package main
+
+import (
+	"clouddragon/cd"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+var lockWaitBuckets = []time.Duration{
+	time.Millisecond, time.Millisecond * 10, time.Millisecond * 100, time.Millisecond * 500,
+	time.Second, time.Second * 5, time.Second * 10, time.Second * 30,
+}
+
+// number of contended locks shown per account
+const lockMetricsTop = 10
+
+type lockMetrics struct {
+	acquired atomic.Int64
+	timeouts atomic.Int64 // lock wasn't acquired within wait time
+	expired  atomic.Int64
+	released atomic.Int64   // by the holder or expiration
+	held     atomic.Int64   // nanoseconds locks were held till release
+	wait     atomic.Int64   // nanoseconds
+	buckets  []atomic.Int64 // by lockWaitBuckets, last one is for longer waits
+}
+
+var lockMetricsByAcc sync.Map // account -> *lockMetrics
+
+func accountLockMetrics(key string) *lockMetrics {
+	acc, _, _ := strings.Cut(key, string([]byte{0}))
+	if m, ok := lockMetricsByAcc.Load(acc); ok {
+		return m.(*lockMetrics)
+	}
+	m, _ := lockMetricsByAcc.LoadOrStore(acc, &lockMetrics{buckets: make([]atomic.Int64, len(lockWaitBuckets)+1)})
+	return m.(*lockMetrics)
+}
+
+func (m *lockMetrics) recordWait(wait time.Duration, acquired bool) {
+	if !acquired {
+		m.timeouts.Add(1)
+		return
+	}
+	m.acquired.Add(1)
+	m.wait.Add(int64(wait))
+	i := sort.Search(len(lockWaitBuckets), func(i int) bool { return wait <= lockWaitBuckets[i] })
+	m.buckets[i].Add(1)
+}
+
+func (m *lockMetrics) recordHeld(held time.Duration) {
+	m.released.Add(1)
+	m.held.Add(int64(held))
+}
+
+type LockWaitBucket struct {
+	LeMs  int64 `json:",omitempty"` // wait up to LeMs, last bucket has no limit
+	Count int64
+}
+
+type ContendedLock struct {
+	ID      string
+	Waiting int
+}
+
+type LockMetrics struct {
+	Account   string
+	Acquired  int64
+	Timeouts  int64
+	Expired   int64 // released by the sweeper
+	WaitMs    int64 // total wait time of acquired locks
+	Released  int64
+	HeldMs    int64 // total hold time of released locks
+	Wait      []LockWaitBucket
+	Holders   int             // locks held right now
+	Waiting   int             // clients waiting right now
+	Contended []ContendedLock `json:",omitempty"` // locks with most waiters right now
+}
+
+// collectLockMetrics returns metrics of the account or of all accounts if acc is empty
+func collectLockMetrics(filter string, top int) []LockMetrics {
+	byAcc := map[string]*LockMetrics{}
+	get := func(acc string) *LockMetrics {
+		r := byAcc[acc]
+		if r == nil {
+			r = &LockMetrics{Account: acc}
+			byAcc[acc] = r
+		}
+		return r
+	}
+	lockMetricsByAcc.Range(func(k, v any) bool {
+		acc, m := k.(string), v.(*lockMetrics)
+		if filter != "" && acc != filter {
+			return true
+		}
+		r := get(acc)
+		r.Acquired, r.Timeouts, r.Expired = m.acquired.Load(), m.timeouts.Load(), m.expired.Load()
+		r.WaitMs = time.Duration(m.wait.Load()).Milliseconds()
+		r.Released, r.HeldMs = m.released.Load(), time.Duration(m.held.Load()).Milliseconds()
+		for i := range m.buckets {
+			b := LockWaitBucket{Count: m.buckets[i].Load()}
+			if i < len(lockWaitBuckets) {
+				b.LeMs = lockWaitBuckets[i].Milliseconds()
+			}
+			r.Wait = append(r.Wait, b)
+		}
+		return true
+	})
+	for _, km := range fmu {
+		km.l.Lock()
+		for cid := range km.m {
+			acc, _, _ := strings.Cut(cid, string([]byte{0}))
+			if filter == "" || acc == filter {
+				get(acc).Holders++
+			}
+		}
+		for cid, q := range km.queue {
+			acc, id, _ := strings.Cut(cid, string([]byte{0}))
+			if filter == "" || acc == filter {
+				r := get(acc)
+				r.Waiting += len(q)
+				r.Contended = append(r.Contended, ContendedLock{ID: id, Waiting: len(q)})
+			}
+		}
+		km.l.Unlock()
+	}
+	res := []LockMetrics{}
+	for _, r := range byAcc {
+		sort.Slice(r.Contended, func(i, j int) bool { return r.Contended[i].Waiting > r.Contended[j].Waiting })
+		r.Contended = r.Contended[:min(len(r.Contended), top)]
+		res = append(res, *r)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Account < res[j].Account })
+	return res
+}
+
+// GetLockMetricsHandler - GET /admin/locks/metrics?acc=
+func GetLockMetricsHandler(ctx *fasthttp.RequestCtx) {
+	res := collectLockMetrics(string(ctx.QueryArgs().Peek("acc")), lockMetricsTop)
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+type LockStats struct {
+	Held       int // fast locks held right now
+	Persistent int // persistent locks held right now
+	Waiting    int // clients waiting for fast locks right now
+	Acquired   int64
+	Timeouts   int64
+	Expired    int64
+	AvgHoldMs  float64 // of released fast locks
+	AvgWaitMs  float64 // of acquired fast locks
+	Contended  []ContendedLock
+}
+
+// countPLocks returns number of persistent locks of the account that are held
+func countPLocks(acc string) (int, error) {
+	prefix := compID(cd.PLockPrefix, acc, "")
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+	n := 0
+	now := time.Now().Unix()
+	for iter.First(); iter.Valid(); iter.Next() {
+		var l cd.Lock
+		_, err := l.UnmarshalMsg(iter.Value())
+		if err != nil {
+			return n, err
+		}
+		if l.Till > now {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetLockStatsHandler - GET /db/:acc/locks/stats?top= lock statistics of the account since start
+func GetLockStatsHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	top := lockMetricsTop
+	if ctx.QueryArgs().Has("top") {
+		top = ctx.QueryArgs().GetUintOrZero("top")
+		if top <= 0 || top > lockReportTop {
+			ctx.Error("top should be a number from 1 to "+strconv.Itoa(lockReportTop), 400)
+			return
+		}
+	}
+	res := LockStats{Contended: []ContendedLock{}}
+	for _, m := range collectLockMetrics(acc, top) {
+		res.Held, res.Waiting = m.Holders, m.Waiting
+		res.Acquired, res.Timeouts, res.Expired = m.Acquired, m.Timeouts, m.Expired
+		if m.Released > 0 {
+			res.AvgHoldMs = float64(m.HeldMs) / float64(m.Released)
+		}
+		if m.Acquired > 0 {
+			res.AvgWaitMs = float64(m.WaitMs) / float64(m.Acquired)
+		}
+		res.Contended = append(res.Contended, m.Contended...)
+	}
+	res.Persistent, err = countPLocks(acc)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
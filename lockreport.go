@@ -0,0 +1,173 @@
+// Lock analytics are collected by lock shards and aggregated every minute
+// into per-account reports of the longest-held, most acquired and longest
+// waited locks. Reports cover the last complete period only.
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const lockReportPeriod = time.Minute
+
+// number of locks kept in each report section
+const lockReportTop = 100
+
+type lockUsage struct {
+	Acquired int64
+	Failed   int64 // lock wasn't acquired within wait time
+	Expired  int64 // released by the sweeper, not by the holder
+	Held     time.Duration
+	MaxHeld  time.Duration
+	Wait     time.Duration
+	MaxWait  time.Duration
+}
+
+type LockUsage struct {
+	ID        string
+	Acquired  int64
+	Failed    int64
+	Expired   int64
+	HeldMs    int64 // total time lock was held
+	MaxHeldMs int64
+	WaitMs    int64 // total time clients waited for the lock
+	MaxWaitMs int64
+}
+
+type LockReport struct {
+	Account      string
+	From         time.Time
+	To           time.Time
+	LongestHeld  []LockUsage
+	MostAcquired []LockUsage
+	LongestWait  []LockUsage
+}
+
+var lockReportMu sync.Mutex
+var lockReports = map[string]*LockReport{}
+
+// recordWait should be called with km.l locked
+func (km *fastLockMutex) recordWait(key string, wait time.Duration, acquired bool) {
+	accountLockMetrics(key).recordWait(wait, acquired)
+	u := km.usage[key]
+	if u == nil {
+		u = &lockUsage{}
+		km.usage[key] = u
+	}
+	if acquired {
+		u.Acquired++
+	} else {
+		u.Failed++
+	}
+	u.Wait += wait
+	u.MaxWait = max(u.MaxWait, wait)
+}
+
+// recordHeld should be called with km.l locked
+func (km *fastLockMutex) recordHeld(key string, held time.Duration) {
+	accountLockMetrics(key).recordHeld(held)
+	u := km.usage[key]
+	if u == nil { // acquired in previous period
+		u = &lockUsage{}
+		km.usage[key] = u
+	}
+	u.Held += held
+	u.MaxHeld = max(u.MaxHeld, held)
+}
+
+func topLocks(all []LockUsage, less func(a, b LockUsage) bool) []LockUsage {
+	sort.Slice(all, func(i, j int) bool { return less(all[i], all[j]) })
+	return append([]LockUsage{}, all[:min(len(all), lockReportTop)]...)
+}
+
+func aggregateLocks(from, to time.Time) {
+	accs := map[string][]LockUsage{}
+	for _, km := range fmu {
+		km.l.Lock()
+		usage := km.usage
+		km.usage = map[string]*lockUsage{}
+		km.l.Unlock()
+		for cid, u := range usage {
+			acc, id, _ := strings.Cut(cid, string([]byte{0}))
+			accs[acc] = append(accs[acc], LockUsage{
+				ID:        id,
+				Acquired:  u.Acquired,
+				Failed:    u.Failed,
+				Expired:   u.Expired,
+				HeldMs:    u.Held.Milliseconds(),
+				MaxHeldMs: u.MaxHeld.Milliseconds(),
+				WaitMs:    u.Wait.Milliseconds(),
+				MaxWaitMs: u.MaxWait.Milliseconds(),
+			})
+		}
+	}
+	reports := map[string]*LockReport{}
+	for acc, all := range accs {
+		reports[acc] = &LockReport{
+			Account: acc,
+			From:    from,
+			To:      to,
+			LongestHeld: topLocks(all, func(a, b LockUsage) bool {
+				return a.MaxHeldMs > b.MaxHeldMs
+			}),
+			MostAcquired: topLocks(all, func(a, b LockUsage) bool {
+				return a.Acquired > b.Acquired
+			}),
+			LongestWait: topLocks(all, func(a, b LockUsage) bool {
+				return a.WaitMs > b.WaitMs
+			}),
+		}
+	}
+	lockReportMu.Lock()
+	lockReports = reports
+	lockReportMu.Unlock()
+}
+
+func LockReportLoop() {
+	from := time.Now()
+	t := time.NewTicker(lockReportPeriod)
+	for to := range t.C {
+		aggregateLocks(from, to)
+		from = to
+	}
+}
+
+// GetLockReportHandler - GET /admin/locks/report?acc=&limit=
+func GetLockReportHandler(ctx *fasthttp.RequestCtx) {
+	limit := 10
+	if v := ctx.QueryArgs().Peek("limit"); len(v) > 0 {
+		l, err := strconv.Atoi(string(v))
+		if err != nil || l <= 0 || l > lockReportTop {
+			ctx.Error("limit should be a number from 1 to "+strconv.Itoa(lockReportTop), 400)
+			return
+		}
+		limit = l
+	}
+	acc := string(ctx.QueryArgs().Peek("acc"))
+	res := []LockReport{}
+	lockReportMu.Lock()
+	for _, r := range lockReports {
+		if acc != "" && r.Account != acc {
+			continue
+		}
+		rr := *r
+		rr.LongestHeld = rr.LongestHeld[:min(len(rr.LongestHeld), limit)]
+		rr.MostAcquired = rr.MostAcquired[:min(len(rr.MostAcquired), limit)]
+		rr.LongestWait = rr.LongestWait[:min(len(rr.LongestWait), limit)]
+		res = append(res, rr)
+	}
+	lockReportMu.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Account < res[j].Account })
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
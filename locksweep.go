@@ -0,0 +1,153 @@
+// Fast lock sweeper releases locks that weren't unlocked or extended
+// within their duration (for ex. client crashed while holding the lock).
+// Each lock shard keeps a heap of lock deadlines, so sweeping only touches
+// expired locks. Persisted lock records are removed with the lock, so they
+// don't pile up until the next restart.
+package main
+
+import (
+	"clouddragon/cd"
+	"container/heap"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const lockSweepInterval = time.Millisecond * 100
+
+var locksReclaimed atomic.Int64
+
+type lockExpiry struct {
+	key    string
+	handle int64
+	at     time.Time
+	index  int
+}
+
+// lockExpiryHeap implements heap.Interface ordered by deadline
+type lockExpiryHeap []*lockExpiry
+
+func (h lockExpiryHeap) Len() int           { return len(h) }
+func (h lockExpiryHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h lockExpiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *lockExpiryHeap) Push(x any) {
+	e := x.(*lockExpiry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lockExpiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// sweep releases expired locks, wakes up waiters every second to handle their timeouts
+func (km *fastLockMutex) sweep() {
+	now := time.Now()
+	var expired []lockExpiry
+	released := false
+	km.l.Lock()
+	for len(km.expiry) > 0 && !km.expiry[0].at.After(now) {
+		e := heap.Pop(&km.expiry).(*lockExpiry)
+		fl := km.m[e.key]
+		if fl.released { // damping ended
+			delete(km.m, e.key)
+			lockEvents.publish(e.key, lockReleased, 0, nil)
+			released = true
+			continue
+		}
+		km.recordHeld(e.key, now.Sub(fl.acquired))
+		km.releaseOwner(e.key, fl)
+		expired = append(expired, *e)
+		if fl.preempted(now) { // waiter of higher priority doesn't wait for damping
+			locksPreempted.Add(1)
+			lockEvents.publish(e.key, lockPreempted, 0, nil)
+			delete(km.m, e.key)
+			continue
+		}
+		km.usage[e.key].Expired++
+		accountLockMetrics(e.key).expired.Add(1)
+		lockEvents.publish(e.key, lockExpired, 0, nil)
+		if km.delay(e.key, fl, now) {
+			heap.Push(&km.expiry, e)
+			continue
+		}
+		delete(km.m, e.key)
+	}
+	if len(expired) > 0 || released || now.Sub(km.woken) >= time.Second {
+		km.woken = now
+		km.c.Broadcast()
+	}
+	km.l.Unlock()
+	locksReclaimed.Add(int64(len(expired)))
+	if len(expired) == 0 {
+		return
+	}
+	release, err := store.beginWrite()
+	if err != nil {
+		log.Print("lock sweep: ", err)
+		return
+	}
+	defer release()
+	for _, e := range expired {
+		err := deletePersistedLock(e.key, e.handle)
+		if err != nil {
+			log.Print("lock sweep: ", err)
+		}
+	}
+}
+
+// deletePersistedLock removes lock record unless the lock was taken again in the meantime
+func deletePersistedLock(cid string, handle int64) error {
+	key := compID1(cd.LocksPrefix, cid)
+	d, closer, err := store.DB().Get(key)
+	if err == pebble.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var l cd.Lock
+	_, err = l.UnmarshalMsg(d)
+	closer.Close()
+	if err != nil || l.Handle != handle {
+		return err
+	}
+	return store.DB().Delete(key, pebble.NoSync)
+}
+
+type LockSweepStats struct {
+	Held      int   // fast locks currently held
+	Waiting   int   // clients waiting for fast locks
+	Reclaimed int64 // locks released by the sweeper since start
+	Deadlocks int64 // waiters failed by deadlock detection since start
+	Preempted int64 // locks force-released for waiters of higher priority since start
+}
+
+// GetLockSweepHandler - GET /admin/locks
+func GetLockSweepHandler(ctx *fasthttp.RequestCtx) {
+	res := LockSweepStats{Reclaimed: locksReclaimed.Load(), Deadlocks: deadlocks.detected.Load(), Preempted: locksPreempted.Load()}
+	for _, km := range fmu {
+		km.l.Lock()
+		res.Held += len(km.m)
+		for _, q := range km.queue {
+			res.Waiting += len(q)
+		}
+		km.l.Unlock()
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"time"
 
 	_ "net/http/pprof"
 
@@ -22,6 +24,38 @@ type Config struct {
 	ListenAddr string         `yaml:"ListenAddr"`
 	DBPath     string         `yaml:"DBPath"`
 	DBOptions  pebble.Options `yaml:"DBOptions"`
+	WAL        WALConfig      `yaml:"WAL"`      // WAL sync tuning, see wal.go
+	GeoIndex   []string       `yaml:"GeoIndex"` // KV key prefixes with lat/lon values to index
+	Search     []SearchConfig `yaml:"Search"`   // KV key prefixes to maintain search index for
+	Shadow     ShadowConfig   `yaml:"Shadow"`   // instance to mirror traffic to
+	Verify     VerifyConfig   `yaml:"Verify"`   // periodic integrity verification
+	Alerts     []AlertRule    `yaml:"Alerts"`   // rules to notify about
+	Limits     LimitsConfig   `yaml:"Limits"`   // max sizes of keys and values
+	Failover   FailoverConfig `yaml:"Failover"` // primary to monitor and take over from
+	Tiering    TieringConfig  `yaml:"Tiering"`  // object storage for cold KV values
+	IPLimits   IPLimitsConfig `yaml:"IPLimits"` // per-IP request rate and connection limits
+	Proxy      ProxyConfig    `yaml:"Proxy"`    // load balancers in front of the server
+	Registry   RegistryConfig `yaml:"Registry"` // detection of duplicate active instances
+	Outbound   OutboundConfig `yaml:"Outbound"` // proxy, TLS and timeouts of outgoing connections
+
+	VerifyChecksums bool  `yaml:"VerifyChecksums"` // verify checksums of KV values on read
+	RequestLog      int   `yaml:"RequestLog"`      // number of recent requests to keep for debugging
+	CacheSize       int64 `yaml:"CacheSize"`       // bytes of memory for read cache, 0 - disabled
+	NegativeCache   int   `yaml:"NegativeCache"`   // milliseconds to cache missing keys for, needs CacheSize
+	PersistLocks    bool  `yaml:"PersistLocks"`    // write extensions of fast locks to disk, slower but they survive restart
+	IdempotencyTTL  int   `yaml:"IdempotencyTTL"`  // seconds idempotency IDs are remembered for, default 1 day
+	KeyStats        bool  `yaml:"KeyStats"`        // track creation, modification time and writes of keys, extra read and write per write
+
+	AdminToken string `yaml:"AdminToken"` // bearer token of admin operations that need auth (lock stealing)
+	StealToken string `yaml:"StealToken"` // bearer token scoped to lock stealing only
+
+	PurgeKey      string `yaml:"PurgeKey"`      // secret to sign account purge reports with
+	QuotaWarn     int    `yaml:"QuotaWarn"`     // % of quota limit to warn about, 0 - disabled
+	QuotaWarnList string `yaml:"QuotaWarnList"` // list of the account to push quota warnings to
+	FencePath     string `yaml:"FencePath"`     // file on shared storage with the latest instance epoch
+	ConsulAccount string `yaml:"ConsulAccount"` // account Consul API (/v1/) works with, default "consul"
+	ClockJump     int    `yaml:"ClockJump"`     // seconds of wall clock jump TTL clock compensates, default 1
+	NodeID        int    `yaml:"NodeID"`        // 0~1023, node part of snowflake IDs, unique per instance issuing them
 	// TODO: backups & restore from S3
 	//
 	// S3 speed:  ~1GB/s per avg instance   6GB/sec network-optimized
@@ -49,37 +83,244 @@ func main() {
 }
 
 var store *Store
+var config Config
 
 func Start(ctx context.Context) error {
-	var cfg Config
 	yd, err := os.ReadFile("config.yml")
 	if err != nil {
 		return err
 	}
-	err = yaml.Unmarshal(yd, &cfg)
+	err = yaml.Unmarshal(yd, &config)
+	if err != nil {
+		return err
+	}
+	applyWAL(&config.DBOptions, config.WAL)
+	config.KeyStats = config.KeyStats || statsNeeded(config)
+	trustedProxies, err = parseTrusted(config.Proxy.Trusted)
+	if err != nil {
+		return err
+	}
+	err = InitOutbound(config.Outbound)
+	if err != nil {
+		return err
+	}
+	err = InitSnowflake(config.NodeID)
 	if err != nil {
 		return err
 	}
-	db, err := pebble.Open(cfg.DBPath, &cfg.DBOptions)
+	db, err := pebble.Open(config.DBPath, &config.DBOptions)
 	if err != nil {
 		return err
 	}
 	store = NewStore(db)
+	InitTTLClock(config.ClockJump)
 	InitFastLocks()
+	InitClock()
+	InitEpoch()
+	InitAliases()
+	InitSettings()
+	InitWebhookKeys()
+	InitTTLIndex()
+	go FenceLoop()
+	go FailoverLoop(config.Failover)
+	go RegistryLoop(config.Registry)
+	go VerifyLoop(config.Verify)
+	go AlertLoop(config.Alerts)
+	go store.SweepLoop()
+	go ExportLoop()
+	go ResetLoop()
+	go LockReportLoop()
+	go TTLClockLoop()
+	go HotLoop()
+	go TierLoop(config.Tiering)
+	go IPLimitsLoop(config.IPLimits)
+	ResumeRebuild()
+	reqLog.resize(config.RequestLog)
+	rcache.resize(config.CacheSize, time.Duration(config.NegativeCache)*time.Millisecond)
 	go func() {
-		log.Print("START ", cfg.ListenAddr)
+		log.Print("START ", config.ListenAddr)
 		router := fasthttprouter.New()
 		router.POST("/req/:acc", RequestHandler)
 		router.POST("/watch/:acc", WatchHandler)
+		router.GET("/db/:acc/kv", ListKVHandler)
+		router.GET("/db/:acc/kv/:id", GetKVHandler)
+		router.POST("/db/:acc/kv/:id", SetKVHandler)
+		router.PATCH("/db/:acc/kv/:id", PatchKVHandler)
+		router.DELETE("/db/:acc/kv/:id", DeleteKVHandler)
+		router.GET("/db/:acc/ttl", ListExpiringHandler)
+		router.GET("/db/:acc/ttl/:id", GetTTLHandler)
+		router.POST("/db/:acc/rename", RenameHandler)
+		router.GET("/db/:acc/alias", ListAliasesHandler)
+		router.POST("/db/:acc/alias/:id", SetAliasHandler)
+		router.DELETE("/db/:acc/alias/:id", DeleteAliasHandler)
+		router.GET("/db/:acc/counter/:id", GetCounterHandler)
+		router.GET("/db/:acc/counter/:id/reset", GetCounterResetHandler)
+		router.PUT("/db/:acc/counter/:id/reset", SetCounterResetHandler)
+		router.POST("/db/:acc/counter/:id/reset", RunCounterResetHandler)
+		router.DELETE("/db/:acc/counter/:id/reset", DeleteCounterResetHandler)
+		router.HEAD("/db/:acc/:primitive/:id", HeadHandler)
+		router.POST("/db/:acc/lease", GrantLeaseHandler)
+		router.GET("/db/:acc/lease/:id", GetLeaseHandler)
+		router.PUT("/db/:acc/lease/:id", KeepaliveLeaseHandler)
+		router.DELETE("/db/:acc/lease/:id", RevokeLeaseHandler)
+		router.GET("/time", TimeHandler)
+		router.POST("/time", TimeHandler)
+		router.POST("/webhook/verify", VerifyWebhookHandler)
+		router.POST("/db/:acc/tso", TSOHandler)
+		router.GET("/db/:acc/vclock/:id", GetVClockHandler)
+		router.POST("/db/:acc/vclock/:id", UpdateVClockHandler)
+		router.GET("/db/:acc/checkout/:id", GetCheckoutHandler)
+		router.POST("/db/:acc/checkout/:id", CheckoutHandler)
+		router.DELETE("/db/:acc/checkout/:id", CheckinHandler)
+		router.GET("/db/:acc/presence", ListPresenceHandler)
+		router.GET("/db/:acc/presence/:id", GetPresenceHandler)
+		router.POST("/db/:acc/presence/:id", HeartbeatHandler)
+		router.DELETE("/db/:acc/presence/:id", LeaveHandler)
+		router.POST("/db/:acc/claim", ClaimHandler)
+		router.PUT("/db/:acc/claim/:id", RenewClaimHandler)
+		router.DELETE("/db/:acc/claim/:id", CompleteClaimHandler)
+		router.GET("/db/:acc/partitions/:id", GetPartitionsHandler)
+		router.POST("/db/:acc/partitions/:id", SetPartitionGroupHandler)
+		router.GET("/db/:acc/quota/*path", GetQuotaHandler)
+		router.PUT("/db/:acc/quota/*path", SetQuotaLimitHandler)
+		router.POST("/db/:acc/quota/*path", ConsumeQuotaHandler)
+		router.GET("/db/:acc/hold/:id", GetHoldsHandler)
+		router.POST("/db/:acc/hold/:id", HoldHandler)
+		router.PUT("/db/:acc/hold/:id", CommitHoldHandler)
+		router.DELETE("/db/:acc/hold/:id", CancelHoldHandler)
+		router.GET("/db/:acc/hist/:id", GetHistogramHandler)
+		router.POST("/db/:acc/hist/:id", ObserveHandler)
+		router.PUT("/db/:acc/hist/:id", ConfigureHistogramHandler)
+		router.DELETE("/db/:acc/hist/:id", DeleteHistogramHandler)
+		router.GET("/db/:acc/gauge/:id", GetGaugeHandler)
+		router.POST("/db/:acc/gauge/:id", SetGaugeHandler)
+		router.DELETE("/db/:acc/gauge/:id", DeleteGaugeHandler)
+		router.GET("/db/:acc/seq", ListSeqHandler)
+		router.GET("/db/:acc/seq/:id", GetSeqHandler)
+		router.POST("/db/:acc/seq/:id", NextSeqHandler)
+		router.PUT("/db/:acc/seq/:id", SetSeqHandler)
+		router.DELETE("/db/:acc/seq/:id", DeleteSeqHandler)
+		router.POST("/db/:acc/id/:id", SnowflakeHandler)
+		router.POST("/db/:acc/ulid", ULIDHandler)
+		router.POST("/db/:acc/uuid", UUIDHandler)
+		router.GET("/db/:acc/set/:id", GetSetHandler)
+		router.POST("/db/:acc/set/:id", UpdateSetHandler)
+		router.DELETE("/db/:acc/set/:id", DeleteSetHandler)
+		router.GET("/db/:acc/zset/:id", GetZSetHandler)
+		router.POST("/db/:acc/zset/:id", UpdateZSetHandler)
+		router.POST("/db/:acc/zset/:id/pop", PopMinHandler)
+		router.DELETE("/db/:acc/zset/:id", DeleteZSetHandler)
+		router.GET("/db/:acc/list/:id", GetListHandler)
+		router.POST("/db/:acc/list/:id", PushHandler)
+		router.POST("/db/:acc/list/:id/pop", PopHandler)
+		router.DELETE("/db/:acc/list/:id", DeleteListHandler)
+		router.GET("/db/:acc/hash/:id", GetHashHandler)
+		router.POST("/db/:acc/hash/:id", UpdateHashHandler)
+		router.DELETE("/db/:acc/hash/:id", DeleteHashHandler)
+		router.GET("/db/:acc/geo", GeoSearchHandler)
+		router.GET("/db/:acc/search", SearchHandler)
+		router.GET("/db/:acc/ts/:id", GetSeriesHandler)
+		router.POST("/db/:acc/ts/:id", AppendSeriesHandler)
+		router.DELETE("/db/:acc/ts/:id", DeleteSeriesHandler)
+		router.POST("/db/:acc/read", ReadHandler)
+		router.GET("/db/:acc/lock/:id", GetLockHandler)
+		router.GET("/db/:acc/lock/:id/events", LockEventsHandler)
+		router.GET("/tf/:acc/:id", GetTFStateHandler)
+		router.POST("/tf/:acc/:id", SetTFStateHandler)
+		router.DELETE("/tf/:acc/:id", DeleteTFStateHandler)
+		router.Handle("LOCK", "/tf/:acc/:id", TFLockHandler)
+		router.Handle("UNLOCK", "/tf/:acc/:id", TFUnlockHandler)
+		router.GET("/db/:acc/flag", ListFlagsHandler)
+		router.GET("/db/:acc/flag/:id", GetFlagHandler)
+		router.PUT("/db/:acc/flag/:id", SetFlagHandler)
+		router.DELETE("/db/:acc/flag/:id", DeleteFlagHandler)
+		router.POST("/db/:acc/flag/:id/eval", EvalFlagHandler)
+		router.GET("/db/:acc/flag/:id/events", FlagEventsHandler)
+		router.GET("/db/:acc/experiment/:id", GetExperimentHandler)
+		router.PUT("/db/:acc/experiment/:id", SetExperimentHandler)
+		router.DELETE("/db/:acc/experiment/:id", DeleteExperimentHandler)
+		router.POST("/db/:acc/experiment/:id/assign", AssignHandler)
+		router.PUT("/v1/session/create", ConsulCreateSessionHandler)
+		router.PUT("/v1/session/renew/:id", ConsulRenewSessionHandler)
+		router.PUT("/v1/session/destroy/:id", ConsulDestroySessionHandler)
+		router.GET("/v1/session/info/:id", ConsulSessionInfoHandler)
+		router.GET("/v1/kv/*key", ConsulGetKVHandler)
+		router.PUT("/v1/kv/*key", ConsulPutKVHandler)
+		router.DELETE("/v1/kv/*key", ConsulDeleteKVHandler)
+		router.POST("/db/:acc/locks", MultiLockHandler)
+		router.GET("/db/:acc/locks/stats", GetLockStatsHandler)
+		router.DELETE("/db/:acc/locks", MultiUnlockHandler)
+		router.GET("/db/:acc/lockgroup/:id", GetLockGroupHandler)
+		router.PUT("/db/:acc/lockgroup/:id", SetLockGroupHandler)
+		router.DELETE("/db/:acc/lockgroup/:id", DeleteLockGroupHandler)
+		router.POST("/db/:acc/lockgroup/:id/lock", LockGroupHandler)
+		router.PUT("/db/:acc/lockgroup/:id/lock", ExtendLockGroupHandler)
+		router.DELETE("/db/:acc/lockgroup/:id/lock", UnlockGroupHandler)
+		router.POST("/db/:acc/lock/:id", SetLockHandler)
+		router.DELETE("/db/:acc/lock/:id", DeleteLockHandler)
+		router.GET("/db/:acc/rwlock/:id", GetRWLockHandler)
+		router.GET("/db/:acc/barrier/:id", GetBarrierHandler)
+		router.POST("/db/:acc/barrier/:id", ArriveBarrierHandler)
+		router.DELETE("/db/:acc/barrier/:id", ResetBarrierHandler)
+		router.POST("/db/:acc/rwlock/:id", RWLockHandler)
+		router.DELETE("/db/:acc/rwlock/:id", RWUnlockHandler)
+		router.GET("/db/:acc/locked/:id", LockedGetHandler)
+		router.PUT("/db/:acc/locked/:id", LockedPutHandler)
+		router.GET("/db/:acc/stats/:kind", ListStatsHandler)
+		router.GET("/db/:acc/stats/:kind/:id", GetStatsHandler)
+		router.GET("/db/:acc/rate/:id", GetRateHandler)
+		router.GET("/db/:acc/export/:id", GetExportHandler)
+		router.PUT("/db/:acc/export/:id", SetExportHandler)
+		router.POST("/db/:acc/export/:id", RunExportHandler)
+		router.DELETE("/db/:acc/export/:id", DeleteExportHandler)
+		router.POST("/admin/switch", SwitchHandler)
+		router.POST("/admin/copy", CopyHandler)
+		router.DELETE("/admin/purge/:acc", PurgeHandler)
+		router.GET("/admin/verify", GetVerifyHandler)
+		router.GET("/admin/alerts", GetAlertsHandler)
+		router.GET("/admin/explain/:acc/:primitive/:id", ExplainHandler)
+		router.GET("/admin/requests", GetRequestLogHandler)
+		router.GET("/admin/locks/report", GetLockReportHandler)
+		router.GET("/admin/locks", GetLockSweepHandler)
+		router.GET("/admin/locks/metrics", GetLockMetricsHandler)
+		router.GET("/admin/steals", GetStealLogHandler)
+		router.GET("/admin/epoch", GetEpochHandler)
+		router.GET("/admin/clock", GetClockHandler)
+		router.POST("/admin/epoch", PromoteHandler)
+		router.GET("/admin/failover", GetFailoverHandler)
+		router.GET("/admin/rebuild", GetRebuildHandler)
+		router.GET("/admin/flush", GetFlushStatsHandler)
+		router.GET("/admin/hot", GetHotHandler)
+		router.GET("/admin/cache", GetCacheStatsHandler)
+		router.GET("/admin/instance", GetInstanceHandler)
+		router.GET("/admin/settings", GetSettingsHandler)
+		router.GET("/admin/settings/history", GetSettingHistoryHandler)
+		router.PUT("/admin/settings/:name", SetSettingHandler)
+		router.DELETE("/admin/settings/:name", RevertSettingHandler)
+		router.GET("/admin/webhook/keys", ListWebhookKeysHandler)
+		router.POST("/admin/webhook/keys", CreateWebhookKeyHandler)
+		router.DELETE("/admin/webhook/keys/:id", DeleteWebhookKeyHandler)
+		router.GET("/admin/ips", GetIPLimitsHandler)
+		router.PUT("/admin/ips/:ip", BanIPHandler)
+		router.DELETE("/admin/ips/:ip", UnbanIPHandler)
+		router.POST("/admin/tier", TierHandler)
+		router.POST("/admin/rebuild", StartRebuildHandler)
+		router.DELETE("/admin/rebuild", StopRebuildHandler)
+		router.PUT("/admin/requests", SetRequestLogHandler)
+		router.POST("/admin/verify", StartVerifyHandler)
+		router.POST("/admin/steal/:acc/:id", StealLockHandler)
 
 		router.NotFound = func(ctx *fasthttp.RequestCtx) {
+			if routeMultiGet(ctx) {
+				return
+			}
 			ctx.SetStatusCode(404)
 		}
 
 		s := fasthttp.Server{
-			Handler:                       router.Handler,
+			Handler:                       errorCodeHandler(ipLimitHandler(config.IPLimits, reqLogHandler(shadowHandler(config.Shadow, epochHandler(dbHandler(router.Handler)))))),
 			Concurrency:                   100000,
-			MaxConnsPerIP:                 100000,
+			MaxConnsPerIP:                 maxConnsPerIP(config.IPLimits),
 			ReadBufferSize:                10000,
 			WriteBufferSize:               10000,
 			DisableHeaderNamesNormalizing: true,
@@ -87,7 +328,14 @@ func Start(ctx context.Context) error {
 			NoDefaultDate:                 true,
 			NoDefaultServerHeader:         true,
 		}
-		err := s.ListenAndServe(cfg.ListenAddr)
+		ln, err := net.Listen("tcp4", config.ListenAddr)
+		if err != nil {
+			panic(err)
+		}
+		if config.Proxy.Protocol {
+			ln = newProxyListener(ln)
+		}
+		err = s.Serve(ln)
 		if err != nil {
 			panic(err)
 		}
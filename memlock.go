@@ -2,8 +2,11 @@ package main
 
 import (
 	"clouddragon/cd"
+	"container/heap"
+	"errors"
 	"fmt"
 	"hash/fnv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,17 +16,21 @@ import (
 
 var fmu = []*fastLockMutex{}
 
+// ErrLockConflict - lock record on disk belongs to another holder
+var ErrLockConflict = errors.New("lock record has another handle")
+
 func InitFastLocks() {
 	for i := 0; i < mCount; i++ {
 		fmu = append(fmu, newFastLockMutex())
 	}
-	iter, err := store.db.NewIter(&pebble.IterOptions{
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
 		LowerBound: []byte{cd.LocksPrefix},
 		UpperBound: []byte{cd.LocksPrefix + 1},
 	})
 	if err != nil {
 		panic(err)
 	}
+	defer iter.Close()
 	for iter.First(); iter.Valid(); iter.Next() {
 		key := iter.Key()
 		value := iter.Value()
@@ -34,9 +41,9 @@ func InitFastLocks() {
 		if err != nil {
 			panic(err)
 		}
-		dur := f.Till - time.Now().Unix()
+		dur := f.Till - ttlNow().Unix()
 		if dur < 0 {
-			err := store.db.Delete(key, pebble.NoSync)
+			err := store.DB().Delete(key, pebble.NoSync)
 			if err != nil {
 				panic(err)
 			}
@@ -47,8 +54,8 @@ func InitFastLocks() {
 		if handleCounter < f.Handle {
 			handleCounter = f.Handle + 1
 		}
-		_, ok := km.Lock(cid, int(dur), 0, f.Handle)
-		if !ok {
+		_, err = km.Lock(cid, int(dur), 0, f.Handle, f.Owner, "", lockDamping{}, lockPreemption{})
+		if err != nil {
 			panic("lock should always work during startup")
 		}
 	}
@@ -61,36 +68,151 @@ func chooseLock(id string) *fastLockMutex {
 	return fmu[kid%mCount]
 }
 
-func memLock(acc, id string, dur, wait int) (int64, error) {
+func memLock(acc, id string, dur, wait int, owner []byte, ownerID string, damping lockDamping, preempt lockPreemption) (int64, error) {
 	cid := acc + string([]byte{0}) + id
-	handle, ok := chooseLock(cid).Lock(cid, dur, wait, 0)
-	if !ok {
-		return 0, cd.ErrNotLocked
+	if ownerID != "" {
+		ownerID = acc + string([]byte{0}) + ownerID // owners of different accounts don't share wait graph nodes
 	}
-	return handle, nil
+	return chooseLock(cid).Lock(cid, dur, wait, 0, owner, ownerID, damping, preempt)
 }
 
 func memUnlock(acc, id string, handle int64) error {
 	cid := acc + string([]byte{0}) + id
-	ch, err := chooseLock(cid).Unlock(cid, handle)
+	return chooseLock(cid).Unlock(cid, handle)
+}
+
+func memExtendLock(acc, id string, handle int64, dur int) error {
+	cid := acc + string([]byte{0}) + id
+	return chooseLock(cid).extendLock(cid, handle, ttlNow().Unix()+int64(dur))
+}
+
+// persistExtension writes new expiration of the lock to its record, so
+// the lock isn't released on restart at the expiration it was taken with
+func persistExtension(acc, id string, handle int64, dur int) error {
+	cid := acc + string([]byte{0}) + id
+	key := compID1(cd.LocksPrefix, cid)
+	d, closer, err := store.DB().Get(key)
+	if err == pebble.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var l cd.Lock
+	_, err = l.UnmarshalMsg(d)
+	closer.Close()
+	if err != nil {
+		return err
+	}
+	if handle != 0 && l.Handle != handle {
+		return fmt.Errorf("%w: %v", ErrLockConflict, l.Handle)
+	}
+	l.Till = ttlNow().Unix() + int64(dur)
+	d, err = l.MarshalMsg(nil)
 	if err != nil {
 		return err
 	}
-	if ch != nil {
-		close(ch)
+	err = store.DB().Set(key, d, pebble.Sync)
+	if err != nil {
+		return err
+	}
+	// lock was released while we were writing - don't bring its record back
+	km := chooseLock(cid)
+	km.l.Lock()
+	fl, ok := km.m[cid]
+	km.l.Unlock()
+	if !ok || fl.handle != l.Handle {
+		return deletePersistedLock(cid, l.Handle)
 	}
 	return nil
 }
 
-func memExtendLock(acc, id string, handle int64, dur int) error {
+// memLockTill returns unix time when the lock expires or 0 if it's not locked
+func memLockTill(acc, id string) int64 {
+	cid := acc + string([]byte{0}) + id
+	km := chooseLock(cid)
+	km.l.Lock()
+	defer km.l.Unlock()
+	return km.m[cid].till
+}
+
+// memLockInfo returns expiration and owner of the lock, number of clients
+// waiting for it and deadline of requested yield (unix ms, 0 - none)
+func memLockInfo(acc, id string) (int64, []byte, int, int64) {
 	cid := acc + string([]byte{0}) + id
-	return chooseLock(cid).extendLock(cid, handle, time.Now().Unix()+int64(dur))
+	km := chooseLock(cid)
+	km.l.Lock()
+	defer km.l.Unlock()
+	fl := km.m[cid]
+	return fl.till, fl.owner, len(km.queue[cid]), fl.yieldBy()
+}
+
+// memPurge releases all locks of the account, returns number of locks released
+func memPurge(acc string) int {
+	prefix := acc + string([]byte{0})
+	n := 0
+	for _, km := range fmu {
+		km.l.Lock()
+		for k, fl := range km.m {
+			if strings.HasPrefix(k, prefix) {
+				delete(km.m, k)
+				heap.Remove(&km.expiry, fl.expiry.index)
+				km.releaseOwner(k, fl)
+				lockEvents.publish(k, lockReleased, 0, nil)
+				n++
+			}
+		}
+		km.c.Broadcast()
+		km.l.Unlock()
+	}
+	return n
 }
 
 type FLock struct {
-	ch     chan bool
-	handle int64
-	till   int64
+	handle   int64
+	till     int64
+	acquired time.Time
+	owner    []byte
+	ownerID  string      // client ID for deadlock detection
+	expiry   *lockExpiry // entry of the sweeper heap
+	damping  lockDamping
+	released bool // unlocked or expired, held till damping ends
+	preempt  lockPreemption
+	yield    time.Time // holder is force-released at, see preempt.go
+}
+
+func (fl FLock) yieldBy() int64 {
+	if fl.yield.IsZero() {
+		return 0
+	}
+	return fl.yield.UnixMilli()
+}
+
+// lockDamping delays release of the lock to damp re-acquisition storms
+// of many clients competing for it
+type lockDamping struct {
+	minHold  time.Duration // lock is held at least this long after it's acquired
+	cooldown time.Duration // lock can't be acquired this long after it's released
+}
+
+// delay keeps released lock held till its minimum hold time and cooldown
+// end, returns false if there's nothing to wait for. Caller puts updated
+// expiry entry back to the heap.
+func (km *fastLockMutex) delay(key string, fl FLock, now time.Time) bool {
+	at := fl.acquired.Add(fl.damping.minHold)
+	if at.Before(now) {
+		at = now
+	}
+	at = at.Add(fl.damping.cooldown)
+	if !at.After(now) {
+		return false
+	}
+	fl.released = true
+	fl.owner, fl.ownerID = nil, ""
+	fl.till = ttlNow().Add(at.Sub(now) + time.Second - 1).Unix()
+	fl.expiry.at = at
+	km.m[key] = fl
+	return true
 }
 
 // similar to keyed mutex, but allows for unlock timeouts
@@ -98,23 +220,29 @@ type fastLockMutex struct {
 	c *sync.Cond
 	l sync.Locker
 	m map[string]FLock
+
+	queue  map[string][]lockWaiter // clients waiting for the lock, in arrival order
+	ticket int64
+
+	expiry lockExpiryHeap // deadlines of held locks, see locksweep.go
+	woken  time.Time      // last time waiters were woken up by the sweeper
+
+	usage map[string]*lockUsage // lock analytics of current report period
 }
 
 func newFastLockMutex() *fastLockMutex {
 	l := sync.Mutex{}
-	km := &fastLockMutex{c: sync.NewCond(&l), l: &l, m: map[string]FLock{}}
+	km := &fastLockMutex{c: sync.NewCond(&l), l: &l, m: map[string]FLock{}, queue: map[string][]lockWaiter{}, usage: map[string]*lockUsage{}}
 	go func() {
-		// wake up all locks to make sure that
+		// expire locks and wake up all waiters to make sure that
 		// some locks don't stuck forever waiting and can handle
 		// timeout event
 
 		// MEMORY LEAK. TODO: make a shutdown procedure for this.
 		// For now it should be ok, since this is a singleton struct
-		t := time.NewTicker(time.Second)
+		t := time.NewTicker(lockSweepInterval)
 		for range t.C {
-			km.l.Lock()
-			km.c.Broadcast()
-			km.l.Unlock()
+			km.sweep()
 		}
 	}()
 	return km
@@ -129,7 +257,7 @@ func (km *fastLockMutex) extendLock(key string, handle int64, till int64) error
 	km.l.Lock()
 	defer km.l.Unlock()
 	fl, ok := km.m[key]
-	if !ok {
+	if !ok || fl.released {
 		return fmt.Errorf("lock not found")
 	}
 	if handle != 0 && fl.handle != handle {
@@ -137,92 +265,140 @@ func (km *fastLockMutex) extendLock(key string, handle int64, till int64) error
 	}
 	fl.till = till
 	km.m[key] = fl
+	fl.expiry.at = time.Now().Add(untilTTL(till))
+	if !fl.yield.IsZero() && fl.yield.Before(fl.expiry.at) {
+		fl.expiry.at = fl.yield // can't be extended past requested yield
+	}
+	heap.Fix(&km.expiry, fl.expiry.index)
+	lockEvents.publish(key, lockExtended, till, fl.owner)
 	return nil
 }
 
-func (km *fastLockMutex) Unlock(key string, handle int64) (chan bool, error) {
-	km.l.Lock()
-	defer km.l.Unlock()
-	return km.unlock(key, handle)
+// steal gives lock held by prev to a new owner with a new handle, call with shard mutex locked
+func (km *fastLockMutex) steal(key string, prev FLock, handle int64, dur int, owner []byte, reason string) FLock {
+	km.recordHeld(key, time.Since(prev.acquired))
+	km.releaseOwner(key, prev)
+	fl := FLock{
+		handle:   handle,
+		till:     ttlNow().Unix() + int64(dur),
+		acquired: time.Now(),
+		owner:    owner,
+		expiry:   prev.expiry,
+	}
+	fl.expiry.handle = fl.handle
+	fl.expiry.at = time.Now().Add(time.Second * time.Duration(dur))
+	heap.Fix(&km.expiry, fl.expiry.index)
+	km.m[key] = fl
+	lockEvents.publishEvent(key, LockEvent{Type: lockStolen, Till: fl.till, Owner: ownerJSON(owner), Previous: ownerJSON(prev.owner), Reason: reason})
+	return fl
 }
 
-func (km *fastLockMutex) unlock(key string, handle int64) (chan bool, error) {
+func (km *fastLockMutex) Unlock(key string, handle int64) error {
+	km.l.Lock()
+	defer km.l.Unlock()
 	fl, found := km.m[key]
 	if !found {
-		return nil, nil
+		return nil
 	}
 	if handle != 0 && fl.handle != handle {
-		return nil, fmt.Errorf("handle mismatch")
+		return fmt.Errorf("handle mismatch")
+	}
+	if fl.released {
+		return nil
+	}
+	km.recordHeld(key, time.Since(fl.acquired))
+	km.releaseOwner(key, fl)
+	if km.delay(key, fl, time.Now()) {
+		heap.Fix(&km.expiry, fl.expiry.index)
+		return nil
 	}
 	delete(km.m, key)
-	km.c.Signal()
-	return fl.ch, nil
+	heap.Remove(&km.expiry, fl.expiry.index)
+	lockEvents.publish(key, lockReleased, 0, nil)
+	km.c.Broadcast() // cond is shared by keys of the shard, signal might wake up waiter of another key
+	return nil
 }
 
-func (km *fastLockMutex) UnlockTimeout(key string, till int64, ch chan bool) (chan bool, int64) {
-	km.l.Lock()
-	defer km.l.Unlock()
-	fl := km.m[key]
-	if fl.ch != ch {
-		return nil, 0
+// leaveQueue removes the ticket from the line of waiters
+func (km *fastLockMutex) leaveQueue(key string, ticket int64) {
+	q := km.queue[key]
+	for i, w := range q {
+		if w.ticket == ticket {
+			q = append(q[:i], q[i+1:]...)
+			break
+		}
 	}
-	if fl.till != till { // reschedule timer
-		return nil, fl.till
+	if len(q) == 0 {
+		delete(km.queue, key)
+		return
+	}
+	km.queue[key] = q
+	km.c.Broadcast() // next waiter might be able to take the lock now
+}
+
+// releaseOwner removes holder of the lock from deadlock detection
+func (km *fastLockMutex) releaseOwner(key string, fl FLock) {
+	if fl.ownerID != "" {
+		deadlocks.released(key)
 	}
-	// unlock only if value is the same
-	delete(km.m, key)
-	km.c.Signal()
-	return fl.ch, 0
 }
 
 var handleCounter = int64(1)
 
-func (km *fastLockMutex) Lock(key string, dur, wait int, oldHandle int64) (int64, bool) {
-	start := time.Now().Unix()
+func (km *fastLockMutex) Lock(key string, dur, wait int, oldHandle int64, owner []byte, ownerID string, damping lockDamping, preempt lockPreemption) (int64, error) {
+	now := time.Now()
 	handle := atomic.AddInt64(&handleCounter, 1)
 	if oldHandle != 0 {
 		handle = oldHandle
 	}
 	km.l.Lock()
 	defer km.l.Unlock()
-	for km.locked(key) {
-		// woke up by broadcast - i.e. lock operation timed out
-		if wait == 0 || int(time.Now().Unix()-start) > wait {
-			return 0, false
+	if km.locked(key) || len(km.queue[key]) > 0 {
+		// wait in line, lock is granted to waiters in order of priority and arrival
+		km.ticket++
+		ticket := km.ticket
+		km.queue[key] = append(km.queue[key], lockWaiter{ticket: ticket, priority: preempt.priority})
+		if ownerID != "" && wait > 0 {
+			err := deadlocks.wait(key, ownerID)
+			if err != nil {
+				km.leaveQueue(key, ticket)
+				km.recordWait(key, time.Since(now), false)
+				return 0, err
+			}
+			defer deadlocks.done(ownerID)
 		}
-		km.c.Wait()
+		for km.locked(key) || km.head(key) != ticket {
+			// woke up by broadcast - i.e. lock operation timed out
+			if wait == 0 || time.Since(now) > time.Second*time.Duration(wait) {
+				km.leaveQueue(key, ticket)
+				km.recordWait(key, time.Since(now), false)
+				return 0, cd.ErrNotLocked
+			}
+			if km.head(key) == ticket {
+				km.requestYield(key, preempt, owner)
+			}
+			km.c.Wait()
+		}
+		km.leaveQueue(key, ticket)
 	}
 
-	// lock, but unlock this key automatically if expires
-	ch := make(chan bool)
+	// lock, sweeper unlocks this key automatically if it expires
 	fl := FLock{
-		ch:     ch,
-		handle: handle,
-		till:   time.Now().Unix() + int64(dur),
+		handle:   handle,
+		till:     ttlNow().Unix() + int64(dur),
+		acquired: time.Now(),
+		owner:    owner,
+		ownerID:  ownerID,
+		expiry:   &lockExpiry{key: key, handle: handle, at: time.Now().Add(time.Second * time.Duration(dur))},
+		damping:  damping,
+		preempt:  preempt,
 	}
-	go func() {
-		t := time.NewTimer(time.Second * time.Duration(dur))
-		till := fl.till
-		for {
-			select {
-			case <-t.C:
-				retCh, newTill := km.UnlockTimeout(key, till, ch) // try unlock by timeout
-				if newTill != till {
-					t.Reset(time.Second * time.Duration(newTill-till))
-					till = newTill
-					continue
-				}
-				if retCh != nil {
-					close(retCh)
-				}
-				return
-			case <-ch:
-				// closed due to success
-				t.Stop()
-				return
-			}
-		}
-	}()
+	heap.Push(&km.expiry, fl.expiry)
+	km.recordWait(key, time.Since(now), true)
 	km.m[key] = fl
-	return handle, true
+	if ownerID != "" {
+		deadlocks.acquired(key, ownerID)
+	}
+	lockEvents.publish(key, lockAcquired, fl.till, owner)
+	return handle, nil
 }
@@ -0,0 +1,182 @@
+// Multi-lock acquires a set of fast locks all-or-nothing. Locks are always
+// acquired in the same order (by hash of the ID, not by the order of the
+// request), so two clients locking overlapping sets never deadlock each
+// other waiting for locks the other one holds. If any lock can't be acquired
+// within ?wait= seconds all locks acquired so far are released.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const maxMultiLock = 100
+
+type MultiLockRequest struct {
+	IDs     []string
+	Owner   json.RawMessage `json:",omitempty"` // holder metadata shown by lock inspection
+	OwnerID string          `json:",omitempty"` // client ID for deadlock detection
+}
+
+type MultiLock struct {
+	ID     string
+	Handle int64
+	Token  int64 `json:",omitempty"` // fencing token
+}
+
+type MultiLockResponse struct {
+	Locks []MultiLock
+}
+
+type MultiUnlockRequest struct {
+	Locks []MultiLock
+}
+
+// lockOrder sorts lock IDs in the order all clients acquire them in
+func lockOrder(acc string, ids []string) []string {
+	type entry struct {
+		id   string
+		hash uint64
+	}
+	seen := map[string]bool{}
+	var entries []entry
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		h := fnv.New64a()
+		h.Write([]byte(acc + string([]byte{0}) + id))
+		entries = append(entries, entry{id: id, hash: h.Sum64()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].hash != entries[j].hash {
+			return entries[i].hash < entries[j].hash
+		}
+		return entries[i].id < entries[j].id
+	})
+	res := make([]string, len(entries))
+	for i, e := range entries {
+		res[i] = e.id
+	}
+	return res
+}
+
+func checkLockIDs(ids []string) error {
+	if len(ids) == 0 || len(ids) > maxMultiLock {
+		return fmt.Errorf("from 1 to %v locks are allowed", maxMultiLock)
+	}
+	for _, id := range ids {
+		if id == "" || bytes.IndexByte([]byte(id), 0) >= 0 {
+			return fmt.Errorf("empty id or 0 in id is not allowed")
+		}
+	}
+	return nil
+}
+
+// multiLock acquires locks in the given order within wait seconds, on error
+// releases locks acquired so far and returns ID of the lock that failed
+func multiLock(acc string, ids []string, dur, wait int, owner json.RawMessage, ownerID string) ([]MultiLock, string, error) {
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	var locks []MultiLock
+	for _, id := range ids {
+		left := max(int(time.Until(deadline)/time.Second), 0)
+		r, err := handle(acc, Request{LockID: id, LockDur: dur, LockWait: left, LockOwner: owner, LockOwnerID: ownerID})
+		if err != nil {
+			uerr := multiUnlock(acc, locks)
+			if uerr != nil {
+				log.Print("multi-lock: ", uerr)
+			}
+			return nil, id, err
+		}
+		locks = append(locks, MultiLock{ID: id, Handle: r.Lock, Token: r.Token})
+	}
+	return locks, "", nil
+}
+
+// multiUnlock releases locks held with the handles
+func multiUnlock(acc string, locks []MultiLock) error {
+	var failed []string
+	for _, l := range locks {
+		err := memUnlock(acc, l.ID, l.Handle)
+		if err == nil {
+			err = store.DB().Delete(compID(cd.LocksPrefix, acc, l.ID), pebble.Sync)
+		}
+		if err != nil {
+			failed = append(failed, l.ID)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to unlock %v", failed)
+	}
+	return nil
+}
+
+// MultiLockHandler - POST /db/:acc/locks?dur=&wait= acquires all locks of the request
+func MultiLockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	dur, wait, err := getLockArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req MultiLockRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	err = checkLockIDs(req.IDs)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	locks, id, err := multiLock(acc, lockOrder(acc, req.IDs), dur, wait, req.Owner, req.OwnerID)
+	if err != nil {
+		retryError(ctx, acc, id, err)
+		return
+	}
+	d, err := json.Marshal(MultiLockResponse{Locks: locks})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// MultiUnlockHandler - DELETE /db/:acc/locks releases locks with their handles
+func MultiUnlockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req MultiUnlockRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if len(req.Locks) > maxMultiLock {
+		ctx.Error(fmt.Sprintf("up to %v locks are allowed", maxMultiLock), 400)
+		return
+	}
+	err = multiUnlock(acc, req.Locks)
+	if err != nil {
+		ctx.Error(err.Error(), 409)
+		return
+	}
+}
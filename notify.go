@@ -7,7 +7,18 @@ import (
 
 func newNotifier() *notifier {
 	l := sync.Mutex{}
-	return &notifier{c: sync.NewCond(&l), l: &l, s: make(map[string]*NotifierRecord)}
+	km := &notifier{c: sync.NewCond(&l), l: &l, s: make(map[string]*NotifierRecord)}
+	go func() {
+		// wake up listeners periodically, so they can handle timeouts
+		// even if nothing is changed
+		t := time.NewTicker(time.Second)
+		for range t.C {
+			km.l.Lock()
+			km.c.Broadcast()
+			km.l.Unlock()
+		}
+	}()
+	return km
 }
 
 type NotifierRecord struct {
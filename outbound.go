@@ -0,0 +1,123 @@
+// Outbound connections - webhooks (alerts, failover events, exports),
+// failover health checks, shadow mirroring, instance registry and object
+// storage of cold values - go through the same settings: HTTP proxy (with
+// basic auth, via CONNECT), extra CA certificates, client certificate for
+// mTLS and timeouts. Hosts from NoProxy are dialed directly.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpproxy"
+)
+
+type OutboundConfig struct {
+	Proxy        string   `yaml:"Proxy"`        // [user:password@]host:port of HTTP proxy
+	NoProxy      []string `yaml:"NoProxy"`      // hosts (or .domain suffixes) to connect to directly
+	CABundle     string   `yaml:"CABundle"`     // PEM file with CA certificates trusted in addition to system ones
+	CertFile     string   `yaml:"CertFile"`     // PEM client certificate for mTLS
+	KeyFile      string   `yaml:"KeyFile"`      // PEM key of the client certificate
+	Insecure     bool     `yaml:"Insecure"`     // don't verify server certificates, for testing only
+	DialTimeout  int      `yaml:"DialTimeout"`  // seconds to connect (via proxy included), default 5
+	ReadTimeout  int      `yaml:"ReadTimeout"`  // max seconds to read response, 0 - per request timeout only
+	WriteTimeout int      `yaml:"WriteTimeout"` // max seconds to write request, 0 - per request timeout only
+}
+
+// outboundClients returns clients of the subsystems, shadow client is configured when created
+func outboundClients() []*fasthttp.Client {
+	return []*fasthttp.Client{alertClient, exportClient, failoverClient, registryClient, tierClient}
+}
+
+var outboundConfig OutboundConfig
+var outboundTLSConfig *tls.Config
+
+// InitOutbound applies outbound settings to the clients, call before they're used
+func InitOutbound(cfg OutboundConfig) error {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5
+	}
+	tlsCfg, err := outboundTLS(cfg)
+	if err != nil {
+		return err
+	}
+	outboundConfig, outboundTLSConfig = cfg, tlsCfg
+	for _, c := range outboundClients() {
+		configureOutbound(c)
+	}
+	return nil
+}
+
+func outboundTLS(cfg OutboundConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if cfg.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("outbound: no certificates in %v", cfg.CABundle)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("outbound: client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+func configureOutbound(c *fasthttp.Client) {
+	cfg := outboundConfig
+	c.TLSConfig = outboundTLSConfig
+	c.ReadTimeout = time.Second * time.Duration(cfg.ReadTimeout)
+	c.WriteTimeout = time.Second * time.Duration(cfg.WriteTimeout)
+	dialTimeout := time.Second * time.Duration(cfg.DialTimeout)
+	direct := func(addr string) (net.Conn, error) {
+		return fasthttp.DialTimeout(addr, dialTimeout)
+	}
+	if cfg.Proxy == "" {
+		c.Dial = direct
+		return
+	}
+	proxied := fasthttpproxy.FasthttpHTTPDialerTimeout(cfg.Proxy, dialTimeout)
+	c.Dial = func(addr string) (net.Conn, error) {
+		if noProxy(cfg.NoProxy, addr) {
+			return direct(addr)
+		}
+		return proxied(addr)
+	}
+}
+
+// newOutboundClient returns client with outbound settings applied
+func newOutboundClient() *fasthttp.Client {
+	c := &fasthttp.Client{}
+	configureOutbound(c)
+	return c
+}
+
+func noProxy(list []string, addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	for _, h := range list {
+		if h == host || strings.HasPrefix(h, ".") && strings.HasSuffix(host, h) {
+			return true
+		}
+	}
+	return false
+}
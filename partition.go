@@ -0,0 +1,145 @@
+// Partition groups assign N partitions across alive members registered
+// in presence registry under the group's prefix.
+//
+// Assignment is not stored anywhere - it's computed from sorted list of
+// alive members, so every member gets the same view for the same
+// membership generation. Members long-poll the group to get notified
+// when membership changes and partitions have to be rebalanced.
+package main
+
+import (
+	"clouddragon/cd"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type PartitionGroup struct {
+	Partitions int
+	Members    string // presence prefix of members
+}
+
+type PartitionAssignment struct {
+	Gen        int64 // membership generation
+	Partitions int
+	Members    []string
+	Assignment map[string][]int
+	Mine       []int `json:",omitempty"` // partitions of ?member=
+}
+
+func getPartitionGroup(acc, id string) (*cd.PartitionGroup, error) {
+	d, closer, err := store.DB().Get(compID(cd.PartitionPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var g cd.PartitionGroup
+	_, err = g.UnmarshalMsg(d)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// assignPartitions spreads partitions round-robin across sorted members
+func assignPartitions(n int, members []string) map[string][]int {
+	res := make(map[string][]int, len(members))
+	if len(members) == 0 {
+		return res
+	}
+	for p := 0; p < n; p++ {
+		m := members[p%len(members)]
+		res[m] = append(res[m], p)
+	}
+	return res
+}
+
+func SetPartitionGroupHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req PartitionGroup
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if req.Partitions <= 0 || req.Partitions > 100000 {
+		ctx.Error("partitions is not in range 1~100000", 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		g := cd.PartitionGroup(req)
+		d, err := g.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		err = b.Set(compID(cd.PartitionPrefix, acc, id), d, pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
+
+// GetPartitionsHandler returns current assignment. If ?gen= is set -
+// blocks up to ?wait= seconds until membership changes.
+func GetPartitionsHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	g, err := getPartitionGroup(acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if g == nil {
+		ctx.Error("partition group not found", 404)
+		return
+	}
+	args := ctx.QueryArgs()
+	wait := args.GetUintOrZero("wait")
+	if wait > 60 {
+		wait = 60
+	}
+	list := presence.List(acc, g.Members, int64(args.GetUintOrZero("gen")), wait)
+	res := PartitionAssignment{
+		Gen:        list.Gen,
+		Partitions: g.Partitions,
+		Members:    []string{},
+	}
+	for _, m := range list.Members {
+		res.Members = append(res.Members, m.ID)
+	}
+	res.Assignment = assignPartitions(g.Partitions, res.Members)
+	res.Mine = res.Assignment[string(args.Peek("member"))]
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
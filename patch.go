@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	json "github.com/goccy/go-json"
+)
+
+func isJSONObject(v []byte) bool {
+	v = bytes.TrimSpace(v)
+	return len(v) > 0 && v[0] == '{'
+}
+
+// mergePatch applies RFC 7396 JSON merge patch to the target document.
+// Fields are kept as raw JSON, so untouched values are preserved as is.
+func mergePatch(target, patch []byte) ([]byte, error) {
+	if !isJSONObject(patch) {
+		return patch, nil
+	}
+	var p map[string]json.RawMessage
+	err := json.Unmarshal(patch, &p)
+	if err != nil {
+		return nil, fmt.Errorf("bad patch: %w", err)
+	}
+	t := map[string]json.RawMessage{}
+	if isJSONObject(target) {
+		err = json.Unmarshal(target, &t)
+		if err != nil {
+			return nil, fmt.Errorf("stored value is not a valid JSON: %w", err)
+		}
+	}
+	for k, v := range p {
+		if bytes.Equal(bytes.TrimSpace(v), []byte("null")) {
+			delete(t, k)
+			continue
+		}
+		t[k], err = mergePatch(t[k], v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(t)
+}
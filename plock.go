@@ -0,0 +1,283 @@
+// Persistent locks are stored in the DB and written through Store.Singleton,
+// so unlike fast locks they don't depend on in-memory state at all and
+// survive process restarts as is. Lock expires after TTL seconds; expired
+// records are treated as unlocked and overwritten by the next lock.
+// Every acquisition of fast or persistent lock issues a fencing token.
+// Lock taken with ?lease= is released when the lease expires.
+// GET inspects fast lock of the same ID if there is no persistent one.
+//
+// Account|0|ID - lock
+// Account|0|ID - last fencing token of the lock
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type PLockResponse struct {
+	ID      string
+	Locked  bool
+	Fast    bool            `json:",omitempty"` // lock is a fast (in-memory) lock
+	Till    int64           `json:",omitempty"` // unix seconds
+	Token   int64           `json:",omitempty"` // fencing token of the current owner
+	Owner   json.RawMessage `json:",omitempty"` // metadata passed by the holder
+	Waiting int             `json:",omitempty"` // clients waiting for fast lock
+	Handle  int64           `json:",omitempty"` // returned only to the owner
+	YieldBy int64           `json:",omitempty"` // unix ms fast lock is preempted at, see preempt.go
+}
+
+// ownerJSON returns owner metadata as is if it's a JSON, as a string otherwise
+func ownerJSON(owner []byte) json.RawMessage {
+	if len(owner) == 0 || json.Valid(owner) {
+		return owner
+	}
+	d, _ := json.Marshal(string(owner))
+	return d
+}
+
+// nextFenceToken issues strictly increasing token for the fast lock, tokens
+// are kept after lock is released, so they keep increasing across restarts.
+// Should be called inside Store.Singleton of the account.
+func nextFenceToken(b *pebble.Batch, acc, id string) (int64, error) {
+	key := compID(cd.FenceTokenPrefix, acc, id)
+	t, err := GetInt64(key, b)
+	if err != nil {
+		return 0, err
+	}
+	var next int64 = 1
+	if t != nil {
+		next = *t + 1
+	}
+	return next, SetInt64(key, next, b)
+}
+
+// lastPLockToken returns last token issued for the persistent lock. Persistent
+// and fast locks used to share tokens, so shared token is continued.
+func lastPLockToken(b *pebble.Batch, acc, id string) (*int64, error) {
+	t, err := GetInt64(compID(cd.PLockTokenPrefix, acc, id), b)
+	if err != nil || t != nil {
+		return t, err
+	}
+	return GetInt64(compID(cd.FenceTokenPrefix, acc, id), b)
+}
+
+// nextPLockToken issues token for the persistent lock, like nextFenceToken
+func nextPLockToken(b *pebble.Batch, acc, id string) (int64, error) {
+	t, err := lastPLockToken(b, acc, id)
+	if err != nil {
+		return 0, err
+	}
+	var next int64 = 1
+	if t != nil {
+		next = *t + 1
+	}
+	return next, SetInt64(compID(cd.PLockTokenPrefix, acc, id), next, b)
+}
+
+func getPLock(b pebble.Reader, acc, id string) (*cd.Lock, error) {
+	d, closer, err := b.Get(compID(cd.PLockPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var l cd.Lock
+	_, err = l.UnmarshalMsg(d)
+	if err != nil {
+		return nil, err
+	}
+	if l.Till <= ttlNow().Unix() {
+		return nil, nil // expired
+	}
+	return &l, nil
+}
+
+func getPLockTTL(ctx *fasthttp.RequestCtx) (int, error) {
+	ttl := 30
+	if ctx.QueryArgs().Has("ttl") {
+		ttl = ctx.QueryArgs().GetUintOrZero("ttl")
+	}
+	if ttl <= 0 || ttl > 86400*30 {
+		return 0, fmt.Errorf("ttl should be from 1 to %v seconds", 86400*30)
+	}
+	return ttl, nil
+}
+
+func writePLockResponse(ctx *fasthttp.RequestCtx, res PLockResponse) {
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// plockConflict responds with 409 and time till lock expires
+func plockConflict(ctx *fasthttp.RequestCtx, till int64) {
+	ctx.Error(cd.ErrNotLocked.Error(), 409)
+	if till > 0 {
+		setRetryAfter(ctx, untilTTL(till))
+	}
+}
+
+func GetLockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	l, err := getPLock(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	res := PLockResponse{ID: id}
+	if l != nil {
+		res.Locked, res.Till, res.Token, res.Owner = true, l.Till, l.Token, ownerJSON(l.Owner)
+		writePLockResponse(ctx, res)
+		return
+	}
+	till, owner, waiting, yield := memLockInfo(acc, id)
+	if till != 0 {
+		res.Locked, res.Fast, res.Till, res.Owner, res.YieldBy = true, true, till, ownerJSON(owner), yield
+	}
+	res.Waiting = waiting
+	writePLockResponse(ctx, res)
+}
+
+// SetLockHandler acquires the lock for ?ttl= seconds, request body is stored as owner metadata.
+// With ?handle= of the current owner lock is extended instead, ?lease= attaches lock to the lease.
+func SetLockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl, err := getPLockTTL(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	handle := int64(ctx.QueryArgs().GetUintOrZero("handle"))
+	owner := append([]byte{}, ctx.Request.Body()...)
+	lease := string(ctx.QueryArgs().Peek("lease"))
+	var l *cd.Lock
+	var conflict bool
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = getPLock(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if l != nil && l.Handle != handle {
+			conflict = true
+			return b.Close()
+		}
+		if l == nil {
+			if handle != 0 { // lock expired or was never taken with this handle
+				conflict = true
+				return b.Close()
+			}
+			token, err := nextPLockToken(b, acc, id)
+			if err != nil {
+				return err
+			}
+			l = &cd.Lock{Handle: time.Now().UnixNano(), Token: token}
+		}
+		if len(owner) > 0 {
+			l.Owner = owner
+		}
+		if lease != "" {
+			err = attachLease(b, acc, lease, leaseLocks, id)
+			if err != nil {
+				return err
+			}
+			l.Lease = lease
+		}
+		l.Till = ttlNow().Unix() + int64(ttl)
+		d, err := l.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		err = b.Set(compID(cd.PLockPrefix, acc, id), d, pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if conflict {
+		var till int64
+		if l != nil {
+			till = l.Till
+		}
+		plockConflict(ctx, till)
+		return
+	}
+	writePLockResponse(ctx, PLockResponse{ID: id, Locked: true, Till: l.Till, Token: l.Token, Owner: ownerJSON(l.Owner), Handle: l.Handle})
+}
+
+// DeleteLockHandler releases the lock held with ?handle=
+func DeleteLockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	handle := int64(ctx.QueryArgs().GetUintOrZero("handle"))
+	if handle == 0 {
+		ctx.Error("handle is required", 400)
+		return
+	}
+	var l *cd.Lock
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = getPLock(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if l != nil && l.Handle != handle {
+			return b.Close()
+		}
+		err = b.Delete(compID(cd.PLockPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if l != nil && l.Handle != handle {
+		plockConflict(ctx, l.Till)
+		return
+	}
+	writePLockResponse(ctx, PLockResponse{ID: id})
+}
@@ -0,0 +1,71 @@
+// Priority preemption for fast locks (wound-wait). Lock requests carry
+// LockPriority, waiters of higher priority get the lock before waiters of
+// lower priority, waiters of the same priority in arrival order. Waiter
+// that also sets LockPreempt (grace period, ms) asks holder of lower
+// priority to yield: subscribers of lock events get "yield" event with
+// the deadline and the requester, and if the lock isn't released by the
+// deadline the sweeper force-releases it ("preempt" event), regardless of
+// the holder's extensions and minimum hold time. Holder can't extend the
+// lock past the deadline.
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var locksPreempted atomic.Int64
+
+// lockPreemption is priority of the lock request and grace period it gives
+// to holders of lower priority, 0 - don't preempt
+type lockPreemption struct {
+	priority int
+	grace    time.Duration
+}
+
+type lockWaiter struct {
+	ticket   int64
+	priority int
+}
+
+// head returns ticket of the waiter that gets the lock next, call with shard mutex locked
+func (km *fastLockMutex) head(key string) int64 {
+	q := km.queue[key]
+	if len(q) == 0 {
+		return 0
+	}
+	next := q[0]
+	for _, w := range q[1:] {
+		if w.priority > next.priority {
+			next = w
+		}
+	}
+	return next.ticket
+}
+
+// requestYield asks holder of lower priority to release the lock within
+// the grace period of the waiter, call with shard mutex locked
+func (km *fastLockMutex) requestYield(key string, p lockPreemption, owner []byte) {
+	fl, ok := km.m[key]
+	if !ok || fl.released || p.grace <= 0 || fl.preempt.priority >= p.priority {
+		return
+	}
+	at := time.Now().Add(p.grace)
+	if !fl.yield.IsZero() && !fl.yield.After(at) {
+		return // earlier deadline was already requested
+	}
+	fl.yield = at
+	km.m[key] = fl
+	if at.Before(fl.expiry.at) {
+		fl.expiry.at = at
+		heap.Fix(&km.expiry, fl.expiry.index)
+	}
+	lockEvents.publishEvent(key, LockEvent{Type: lockYield, YieldBy: at.UnixMilli(), Owner: ownerJSON(owner), Reason: fmt.Sprintf("waiter of priority %d", p.priority)})
+}
+
+// preempted reports whether expired lock was force-released for a waiter of higher priority
+func (fl FLock) preempted(now time.Time) bool {
+	return !fl.yield.IsZero() && !fl.yield.After(now)
+}
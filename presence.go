@@ -0,0 +1,296 @@
+// Presence registry keeps track of alive clients (workers, schedulers,
+// consumers). Client heartbeats with a TTL and is considered alive until
+// TTL passes without another heartbeat.
+//
+// Registry is kept in RAM only - after reboot clients simply re-register
+// with their next heartbeat.
+//
+// Every membership change (join, leave, expire) bumps per-account
+// generation and is recorded as an event. Listing can long-poll on the
+// generation to get notified about membership changes.
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	presenceMaxTTL    = 3600
+	presenceEventsLen = 1000
+)
+
+type PresenceMember struct {
+	ID    string
+	Since int64
+	Till  int64
+	Meta  json.RawMessage `json:",omitempty"`
+}
+
+type PresenceEvent struct {
+	Gen  int64
+	ID   string
+	Type string // join|leave|expire
+	At   int64
+}
+
+type PresenceList struct {
+	Gen     int64
+	Members []PresenceMember `json:",omitempty"`
+	Events  []PresenceEvent  `json:",omitempty"` // events after requested gen
+}
+
+type presenceAcc struct {
+	gen     int64
+	members map[string]*PresenceMember
+	events  []PresenceEvent
+}
+
+type presenceRegistry struct {
+	c    *sync.Cond
+	l    sync.Locker
+	accs map[string]*presenceAcc
+}
+
+var presence = newPresenceRegistry()
+
+func newPresenceRegistry() *presenceRegistry {
+	l := sync.Mutex{}
+	p := &presenceRegistry{c: sync.NewCond(&l), l: &l, accs: map[string]*presenceAcc{}}
+	go func() {
+		// expire members and wake up listeners to handle timeouts
+		t := time.NewTicker(time.Second)
+		for range t.C {
+			p.l.Lock()
+			p.expire(time.Now().Unix())
+			p.c.Broadcast()
+			p.l.Unlock()
+		}
+	}()
+	return p
+}
+
+func (p *presenceRegistry) expire(now int64) {
+	for acc, a := range p.accs {
+		for id, m := range a.members {
+			if m.Till < now {
+				delete(a.members, id)
+				p.event(a, id, "expire", now)
+			}
+		}
+		if len(a.members) == 0 && (len(a.events) == 0 || a.events[len(a.events)-1].At < now-presenceMaxTTL) {
+			delete(p.accs, acc) // purged or nothing happened for a while - free up RAM
+		}
+	}
+}
+
+func (p *presenceRegistry) event(a *presenceAcc, id, typ string, now int64) {
+	a.gen++
+	a.events = append(a.events, PresenceEvent{Gen: a.gen, ID: id, Type: typ, At: now})
+	if len(a.events) > presenceEventsLen {
+		a.events = a.events[len(a.events)-presenceEventsLen:]
+	}
+	p.c.Broadcast()
+}
+
+func (p *presenceRegistry) Heartbeat(acc, id string, ttl int, meta []byte) int64 {
+	p.l.Lock()
+	defer p.l.Unlock()
+	now := time.Now().Unix()
+	a, ok := p.accs[acc]
+	if !ok {
+		a = &presenceAcc{members: map[string]*PresenceMember{}}
+		p.accs[acc] = a
+	}
+	m, ok := a.members[id]
+	if !ok {
+		m = &PresenceMember{ID: id, Since: now}
+		a.members[id] = m
+		p.event(a, id, "join", now)
+	}
+	m.Till = now + int64(ttl)
+	if len(meta) > 0 {
+		m.Meta = append(json.RawMessage{}, meta...)
+	}
+	return a.gen
+}
+
+func (p *presenceRegistry) Leave(acc, id string) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	a, ok := p.accs[acc]
+	if !ok {
+		return
+	}
+	if _, ok := a.members[id]; ok {
+		delete(a.members, id)
+		p.event(a, id, "leave", time.Now().Unix())
+	}
+}
+
+// Purge removes all members and events of the account, returns number of members removed
+func (p *presenceRegistry) Purge(acc string) int {
+	p.l.Lock()
+	defer p.l.Unlock()
+	a, ok := p.accs[acc]
+	if !ok {
+		return 0
+	}
+	n := len(a.members)
+	a.members = map[string]*PresenceMember{}
+	a.events = nil
+	a.gen++ // keep generation growing for clients waiting on changes
+	p.c.Broadcast()
+	return n
+}
+
+func (p *presenceRegistry) Get(acc, id string) (PresenceMember, bool) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	a, ok := p.accs[acc]
+	if !ok {
+		return PresenceMember{}, false
+	}
+	m, ok := a.members[id]
+	if !ok || m.Till < time.Now().Unix() {
+		return PresenceMember{}, false
+	}
+	return *m, true
+}
+
+// List returns alive members under the prefix. If gen is not 0 - blocks
+// up to wait seconds until membership generation differs from gen.
+func (p *presenceRegistry) List(acc, prefix string, gen int64, wait int) PresenceList {
+	start := time.Now().Unix()
+	p.l.Lock()
+	defer p.l.Unlock()
+	for gen != 0 && int(time.Now().Unix()-start) < wait {
+		a, ok := p.accs[acc]
+		if ok && a.gen != gen {
+			break
+		}
+		p.c.Wait()
+	}
+	var res PresenceList
+	a, ok := p.accs[acc]
+	if !ok {
+		return res
+	}
+	res.Gen = a.gen
+	now := time.Now().Unix()
+	for id, m := range a.members {
+		if strings.HasPrefix(id, prefix) && m.Till >= now {
+			res.Members = append(res.Members, *m)
+		}
+	}
+	sort.Slice(res.Members, func(i, j int) bool {
+		return res.Members[i].ID < res.Members[j].ID
+	})
+	if gen != 0 {
+		for _, e := range a.events {
+			if e.Gen > gen && strings.HasPrefix(e.ID, prefix) {
+				res.Events = append(res.Events, e)
+			}
+		}
+	}
+	return res
+}
+
+// HeartbeatHandler registers client as alive for ?ttl= seconds.
+// Body is an optional JSON with client metadata.
+func HeartbeatHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl := ctx.QueryArgs().GetUintOrZero("ttl")
+	if ttl <= 0 || ttl > presenceMaxTTL {
+		ctx.Error("ttl is not in range 1~3600", 400)
+		return
+	}
+	meta := ctx.Request.Body()
+	if len(meta) > 0 && !json.Valid(meta) {
+		ctx.Error("metadata should be a valid json", 400)
+		return
+	}
+	gen := presence.Heartbeat(acc, id, ttl, meta)
+	d, err := json.Marshal(PresenceList{Gen: gen})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func LeaveHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	presence.Leave(acc, id)
+}
+
+func GetPresenceHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	m, ok := presence.Get(acc, id)
+	if !ok {
+		ctx.Error("not alive", 404)
+		return
+	}
+	d, err := json.Marshal(m)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// ListPresenceHandler lists alive members with ?prefix=. If ?gen= is set
+// request blocks up to ?wait= seconds till membership changes and returns
+// events that happened after gen.
+func ListPresenceHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	args := ctx.QueryArgs()
+	gen := int64(args.GetUintOrZero("gen"))
+	wait := args.GetUintOrZero("wait")
+	if wait > 60 {
+		wait = 60
+	}
+	res := presence.List(acc, string(args.Peek("prefix")), gen, wait)
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
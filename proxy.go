@@ -0,0 +1,239 @@
+// Real client IPs behind load balancers. With Protocol enabled every
+// connection starts with PROXY protocol header (v1 or v2) and its source
+// address is used as the remote address of the connection. Requests from
+// Trusted proxies take client IP from X-Forwarded-For (or Header), the
+// rightmost address that is not a trusted proxy wins, so clients can't
+// spoof it by sending their own header. Client IP is used by per-IP limits,
+// allow list and the request log.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const proxyHeaderTimeout = time.Second * 5
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+type ProxyConfig struct {
+	Protocol bool     `yaml:"Protocol"` // connections start with PROXY protocol header
+	Trusted  []string `yaml:"Trusted"`  // CIDRs or IPs of proxies, if set only they can send PROXY header
+	Header   string   `yaml:"Header"`   // header with client IPs, default X-Forwarded-For
+}
+
+var trustedProxies []*net.IPNet
+
+func parseTrusted(list []string) ([]*net.IPNet, error) {
+	var res []*net.IPNet
+	for _, v := range list {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("bad trusted proxy %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted proxy %q: %w", v, err)
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns IP of the client that sent the request
+func clientIP(ctx *fasthttp.RequestCtx) string {
+	ip := ctx.RemoteIP()
+	if !isTrustedProxy(ip) {
+		return ip.String()
+	}
+	header := config.Proxy.Header
+	if header == "" {
+		header = "X-Forwarded-For"
+	}
+	var hops []string
+	ctx.Request.Header.VisitAll(func(k, v []byte) {
+		if strings.EqualFold(string(k), header) {
+			hops = append(hops, strings.Split(string(v), ",")...)
+		}
+	})
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break // garbage from the client, don't look further
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// proxyListener reads PROXY headers of accepted connections in background,
+// so slow clients don't block accepting of others
+type proxyListener struct {
+	net.Listener
+	conns chan net.Conn
+	errs  chan error
+}
+
+func newProxyListener(ln net.Listener) *proxyListener {
+	l := &proxyListener{Listener: ln, conns: make(chan net.Conn), errs: make(chan error)}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				l.errs <- err
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					continue
+				}
+				return
+			}
+			go l.handshake(c)
+		}
+	}()
+	return l
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errs:
+		return nil, err
+	}
+}
+
+func (l *proxyListener) handshake(c net.Conn) {
+	addr, ok := c.RemoteAddr().(*net.TCPAddr)
+	if ok && len(trustedProxies) > 0 && !isTrustedProxy(addr.IP) {
+		l.conns <- c // direct connection, header from it can't be trusted
+		return
+	}
+	c.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	r := bufio.NewReader(c)
+	remote, err := readProxyHeader(r)
+	if err != nil {
+		log.Printf("proxy protocol from %v: %v", c.RemoteAddr(), err)
+		c.Close()
+		return
+	}
+	c.SetReadDeadline(time.Time{})
+	if remote == nil { // LOCAL or UNKNOWN - connection of the proxy itself
+		remote = c.RemoteAddr()
+	}
+	l.conns <- &proxyConn{Conn: c, r: r, remote: remote}
+}
+
+// readProxyHeader returns source address from PROXY header v1 or v2
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(b, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(b, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	return nil, fmt.Errorf("no PROXY header")
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > 107 || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("bad v1 header")
+	}
+	f := strings.Fields(string(line[:len(line)-2]))
+	if len(f) >= 2 && f[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(f) != 6 || (f[1] != "TCP4" && f[1] != "TCP6") {
+		return nil, fmt.Errorf("bad v1 header")
+	}
+	ip := net.ParseIP(f[2])
+	port, err := strconv.Atoi(f[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("bad v1 source address")
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	h := make([]byte, 16)
+	_, err := io.ReadFull(r, h)
+	if err != nil {
+		return nil, err
+	}
+	if h[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version %v", h[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(h[14:16]))
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, err
+	}
+	if h[12]&0xf == 0 { // LOCAL
+		return nil, nil
+	}
+	switch h[13] >> 4 {
+	case 1: // IPv4
+		if len(body) < 12 {
+			return nil, fmt.Errorf("short v2 IPv4 address")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 2: // IPv6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("short v2 IPv6 address")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil // UNSPEC or unix sockets
+}
@@ -0,0 +1,157 @@
+// Purge removes all data of the account: records of every primitive,
+// expiration index entries, in-memory locks, presence and logged requests.
+// Deleted ranges are compacted, so data doesn't stay on disk as tombstoned
+// records. Report of the deletion is signed with HMAC-SHA256 using PurgeKey
+// from config, so it can be verified later.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type PurgeReport struct {
+	Account  string
+	Started  time.Time
+	Finished time.Time
+	Records  map[int]int64 // deleted records by storage prefix
+	TTL      int64         // expiration index entries
+	Locks    int           // in-memory locks and barriers released
+	Presence int           // presence members removed
+	Requests int           // logged requests scrubbed
+	Backups  string        // backups are not indexed by the server
+}
+
+type PurgeResponse struct {
+	Report    json.RawMessage
+	Signature string `json:",omitempty"` // hex HMAC-SHA256 of Report bytes
+}
+
+func purgeAccount(acc string, r *PurgeReport) error {
+	b := store.DB().NewBatch()
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	for p := 1; p < 256; p++ {
+		// Prefix|Account - single per-account record (sequences, TSO)
+		_, closer, err := snap.Get(compID1(p, acc))
+		if err == nil {
+			closer.Close()
+			r.Records[p]++
+			err = b.Delete(compID1(p, acc), pebble.NoSync)
+		}
+		if err != nil && err != pebble.ErrNotFound {
+			return err
+		}
+		// Prefix|Account|0|... - all records of the account
+		start := compID(p, acc, "")
+		iter, err := snap.NewIter(&pebble.IterOptions{LowerBound: start, UpperBound: prefixEnd(start)})
+		if err != nil {
+			return err
+		}
+		for iter.First(); iter.Valid(); iter.Next() {
+			r.Records[p]++
+		}
+		err = iter.Close()
+		if err != nil {
+			return err
+		}
+		if r.Records[p] == 0 {
+			delete(r.Records, p)
+			continue
+		}
+		err = b.DeleteRange(start, prefixEnd(start), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+	}
+	// expiration indexes are ordered by time, scan them whole
+	accKey := append([]byte(acc), 0)
+	for _, p := range []byte{cd.TTLPrefix, cd.IdemExpiryPrefix} {
+		iter, err := snap.NewIter(&pebble.IterOptions{
+			LowerBound: []byte{p},
+			UpperBound: []byte{p + 1},
+		})
+		if err != nil {
+			return err
+		}
+		for iter.First(); iter.Valid(); iter.Next() {
+			k := iter.Key()
+			if len(k) > 9 && bytes.HasPrefix(k[9:], accKey) {
+				r.TTL++
+				err = b.Delete(append([]byte{}, k...), pebble.NoSync)
+				if err != nil {
+					iter.Close()
+					return err
+				}
+			}
+		}
+		err = iter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return b.Commit(pebble.NoSync)
+}
+
+// PurgeHandler - DELETE /admin/purge/:acc
+func PurgeHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	r := PurgeReport{
+		Account: acc,
+		Started: time.Now(),
+		Records: map[int]int64{},
+		Backups: "not indexed",
+	}
+	err = store.Singleton([]byte(acc), func() error {
+		return purgeAccount(acc, &r)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	for p := range r.Records {
+		start := compID(p, acc, "")
+		err := store.DB().Compact(start, prefixEnd(start), true)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	r.Locks = memPurge(acc) + rwPurge(acc) + barrierPurge(acc)
+	r.Presence = presence.Purge(acc)
+	r.Requests = reqLog.purge(acc)
+	rcache.reset()
+	aliasPurge(acc)
+	r.Finished = time.Now()
+	var res PurgeResponse
+	res.Report, err = json.Marshal(r)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if config.PurgeKey != "" {
+		m := hmac.New(sha256.New, []byte(config.PurgeKey))
+		m.Write(res.Report)
+		res.Signature = hex.EncodeToString(m.Sum(nil))
+	}
+	log.Printf("purged account %q", acc)
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
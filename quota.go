@@ -0,0 +1,258 @@
+// Hierarchical quotas are counters organized as a path, for ex.
+// "org/project/user". Consuming from "org/project/user" consumes from
+// "org" and "org/project" as well, and fails if any of the levels
+// doesn't have enough quota left. All levels are updated atomically.
+//
+// Levels used above QuotaWarn percent of their limit are reported in
+// responses and X-Quota-Warning header, crossing the soft limit pushes
+// a warning to QuotaWarnList of the account.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type QuotaLevel struct {
+	Path    string
+	Limit   int64
+	Used    int64
+	Warning bool `json:",omitempty"` // used above soft limit
+}
+
+type QuotaResponse struct {
+	Levels   []QuotaLevel
+	Rejected string `json:",omitempty"` // path of the level that rejected consumption
+}
+
+type QuotaWarning struct {
+	Path  string
+	Limit int64
+	Used  int64
+	At    int64
+}
+
+// quotaWarn checks if quota is used above soft limit
+func quotaWarn(q cd.Quota) bool {
+	return config.QuotaWarn > 0 && q.Limit > 0 && q.Used*100 >= q.Limit*int64(config.QuotaWarn)
+}
+
+func quotaLevel(path string, q cd.Quota) QuotaLevel {
+	return QuotaLevel{Path: path, Limit: q.Limit, Used: q.Used, Warning: quotaWarn(q)}
+}
+
+func getQuotaPath(ctx *fasthttp.RequestCtx) (string, error) {
+	path := strings.Trim(ctx.UserValue("path").(string), "/")
+	if len(path) == 0 || len(path) > 1024 {
+		return "", fmt.Errorf("quota path len is not in range 0~1024")
+	}
+	return path, nil
+}
+
+// quotaLevels returns all ancestors of the path including path itself
+func quotaLevels(path string) []string {
+	parts := strings.Split(path, "/")
+	res := make([]string, len(parts))
+	for i := range parts {
+		res[i] = strings.Join(parts[:i+1], "/")
+	}
+	return res
+}
+
+func getQuota(b pebble.Reader, acc, path string) (cd.Quota, error) {
+	var q cd.Quota
+	d, closer, err := b.Get(compID(cd.QuotaPrefix, acc, path))
+	if err == pebble.ErrNotFound {
+		return q, nil
+	}
+	if err != nil {
+		return q, err
+	}
+	defer closer.Close()
+	_, err = q.UnmarshalMsg(d)
+	return q, err
+}
+
+func putQuota(b *pebble.Batch, acc, path string, q cd.Quota) error {
+	if q.Limit == 0 && q.Used == 0 {
+		return b.Delete(compID(cd.QuotaPrefix, acc, path), pebble.NoSync)
+	}
+	d, err := q.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.QuotaPrefix, acc, path), d, pebble.NoSync)
+}
+
+func writeQuotaResponse(ctx *fasthttp.RequestCtx, res QuotaResponse) {
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var warn []string
+	for _, l := range res.Levels {
+		if l.Warning {
+			warn = append(warn, l.Path)
+		}
+	}
+	if len(warn) > 0 {
+		ctx.Response.Header.Set("X-Quota-Warning", strings.Join(warn, ","))
+	}
+	if res.Rejected != "" {
+		ctx.SetStatusCode(429)
+		setErrorCode(ctx, "QUOTA_EXCEEDED", false)
+	}
+	ctx.Response.SetBody(d)
+}
+
+func GetQuotaHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	path, err := getQuotaPath(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var res QuotaResponse
+	for _, l := range quotaLevels(path) {
+		q, err := getQuota(store.DB(), acc, l)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		res.Levels = append(res.Levels, quotaLevel(l, q))
+	}
+	writeQuotaResponse(ctx, res)
+}
+
+// SetQuotaLimitHandler sets ?limit= of a single level. 0 removes the limit.
+func SetQuotaLimitHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	path, err := getQuotaPath(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	limit, err := strconv.ParseInt(string(ctx.QueryArgs().Peek("limit")), 10, 64)
+	if err != nil || limit < 0 {
+		ctx.Error("limit should be a positive number", 400)
+		return
+	}
+	var res QuotaResponse
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		q, err := getQuota(b, acc, path)
+		if err != nil {
+			return err
+		}
+		q.Limit = limit
+		res.Levels = []QuotaLevel{quotaLevel(path, q)}
+		err = putQuota(b, acc, path, q)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	writeQuotaResponse(ctx, res)
+}
+
+// ConsumeQuotaHandler consumes ?n= from every level of the path.
+// Negative n returns quota back.
+func ConsumeQuotaHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	path, err := getQuotaPath(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	n := int64(1)
+	if ctx.QueryArgs().Has("n") {
+		n, err = strconv.ParseInt(string(ctx.QueryArgs().Peek("n")), 10, 64)
+		if err != nil {
+			ctx.Error("n should be a number", 400)
+			return
+		}
+	}
+	var res QuotaResponse
+	var warnings []json.RawMessage
+	var m cd.ListMeta
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		levels := quotaLevels(path)
+		quotas := make([]cd.Quota, len(levels))
+		for i, l := range levels {
+			q, err := getQuota(b, acc, l)
+			if err != nil {
+				return err
+			}
+			if n > 0 && q.Limit != 0 && q.Used+n > q.Limit && res.Rejected == "" {
+				res.Rejected = l
+			}
+			quotas[i] = q
+		}
+		for i, l := range levels {
+			q := &quotas[i]
+			if res.Rejected == "" {
+				warned := quotaWarn(*q)
+				q.Used += n
+				if q.Used < 0 {
+					q.Used = 0
+				}
+				err := putQuota(b, acc, l, *q)
+				if err != nil {
+					return err
+				}
+				if !warned && quotaWarn(*q) {
+					d, err := json.Marshal(QuotaWarning{Path: l, Limit: q.Limit, Used: q.Used, At: time.Now().Unix()})
+					if err != nil {
+						return err
+					}
+					warnings = append(warnings, d)
+				}
+			}
+			res.Levels = append(res.Levels, quotaLevel(l, *q))
+		}
+		if res.Rejected != "" {
+			return nil
+		}
+		if len(warnings) > 0 && config.QuotaWarnList != "" {
+			var err error
+			m, err = listPush(b, acc, config.QuotaWarnList, warnings, false, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if m.Version != 0 && !isDryRun(ctx) {
+		store.notifier(acc).NotifyVersion(listWatchKey(config.QuotaWarnList), m.Version)
+	}
+	writeQuotaResponse(ctx, res)
+}
@@ -0,0 +1,137 @@
+// Rate of change of atomic counters. Every write stores counter value
+// into a ring of per-minute samples (slot = minute % rateSlots), so
+// storage per counter is bounded and no cleanup is needed.
+//
+// Account|0|ID|0|Slot - sample
+package main
+
+import (
+	"clouddragon/cd"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+// a bit more than an hour, so 1h window always has a sample before it
+const rateSlots = 64
+
+var rateWindows = []struct {
+	Name    string
+	Minutes int64
+}{
+	{"1m", 1},
+	{"5m", 5},
+	{"1h", 60},
+}
+
+type Rate struct {
+	Delta   int64   // change of the counter over the window
+	PerSec  float64 // Delta / window length
+	Partial bool    `json:",omitempty"` // history doesn't cover whole window
+}
+
+type RateResponse struct {
+	Value int64
+	Rates map[string]Rate
+}
+
+// sampleCounter records value of the counter for current minute
+func sampleCounter(b *pebble.Batch, acc, key string, val int64) error {
+	m := time.Now().Unix() / 60
+	s := cd.RateSample{Minute: m, Value: val}
+	d, err := s.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID2(cd.RatePrefix, acc, key, string([]byte{byte(m % rateSlots)})), d, pebble.NoSync)
+}
+
+func GetRateHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	var res RateResponse
+	res.Value, err = getCard(snap, compID(cd.AtomicPrefix, acc, id))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	st, err := getStats(snap, acc, statsCounter, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	prefix := compID2(cd.RatePrefix, acc, id, "")
+	iter, err := snap.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	var samples []cd.RateSample
+	for iter.First(); iter.Valid(); iter.Next() {
+		var s cd.RateSample
+		_, err := s.UnmarshalMsg(iter.Value())
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		samples = append(samples, s)
+	}
+
+	now := time.Now()
+	res.Rates = map[string]Rate{}
+	for _, w := range rateWindows {
+		start := now.Unix()/60 - w.Minutes // window starts at the beginning of this minute
+		base := cd.RateSample{Minute: start}
+		best := int64(-1)
+		var oldest *cd.RateSample
+		for i, s := range samples {
+			if s.Minute < start && s.Minute > best {
+				best = s.Minute
+				base.Value = s.Value
+			}
+			if s.Minute >= start && (oldest == nil || s.Minute < oldest.Minute) {
+				oldest = &samples[i]
+			}
+		}
+		var r Rate
+		if best < 0 {
+			switch {
+			case len(samples) == 0: // no writes recorded
+				base.Value = res.Value
+			case st == nil || st.Created < start*60:
+				// counter existed before the window, but samples were overwritten
+				base = *oldest
+				r.Partial = true
+			}
+			// otherwise counter was created within the window and started from 0
+		}
+		r.Delta = res.Value - base.Value
+		elapsed := now.Sub(time.Unix(base.Minute*60, 0)).Seconds()
+		if elapsed > 0 {
+			r.PerSec = float64(r.Delta) / elapsed
+		}
+		res.Rates[w.Name] = r
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,162 @@
+// Batch read fetches values of different primitives in one request.
+// All values are read from the same snapshot, so they are consistent
+// with each other.
+package main
+
+import (
+	"clouddragon/cd"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const readMaxItems = 1000
+
+type ReadRequest struct {
+	Counters  []string
+	KV        []string
+	Gauges    []string
+	Hashes    map[string][]string // hash id -> fields
+	Sets      []string            // cardinality of sets
+	Lists     []string            // length of lists
+	Sequences []string            // last issued values of sequences
+}
+
+type ReadResponse struct {
+	Counters  map[string]int64                      `json:",omitempty"`
+	KV        []KV                                  `json:",omitempty"`
+	Gauges    map[string]GaugeResponse              `json:",omitempty"`
+	Hashes    map[string]map[string]json.RawMessage `json:",omitempty"`
+	Sets      map[string]int64                      `json:",omitempty"`
+	Lists     map[string]int64                      `json:",omitempty"`
+	Sequences map[string]SeqResponse                `json:",omitempty"`
+}
+
+func (r ReadRequest) size() int {
+	n := len(r.Counters) + len(r.KV) + len(r.Gauges) + len(r.Sets) + len(r.Lists) + len(r.Sequences)
+	for _, f := range r.Hashes {
+		n += len(f)
+	}
+	return n
+}
+
+func batchRead(snap *pebble.Snapshot, acc string, req ReadRequest) (ReadResponse, error) {
+	var res ReadResponse
+	if len(req.Counters) > 0 {
+		res.Counters = map[string]int64{}
+	}
+	for _, k := range req.Counters {
+		v, err := getCard(snap, compID(cd.AtomicPrefix, acc, resolveAlias(acc, aliasCounter, k)))
+		if err != nil {
+			return res, err
+		}
+		res.Counters[k] = v
+	}
+	for _, k := range req.KV {
+		v, err := getKV(snap, acc, resolveAlias(acc, aliasKV, k))
+		if err != nil {
+			return res, err
+		}
+		kv := KV{Key: k}
+		if v != nil {
+			kv.Value = v.Data
+			kv.Version = v.Version
+		}
+		res.KV = append(res.KV, kv)
+	}
+	if len(req.Gauges) > 0 {
+		res.Gauges = map[string]GaugeResponse{}
+	}
+	for _, k := range req.Gauges {
+		g, err := getGauge(snap, acc, k)
+		if err != nil {
+			return res, err
+		}
+		if g != nil {
+			res.Gauges[k] = toGaugeResponse(*g)
+		}
+	}
+	if len(req.Hashes) > 0 {
+		res.Hashes = map[string]map[string]json.RawMessage{}
+	}
+	for id, fields := range req.Hashes {
+		h := map[string]json.RawMessage{}
+		for _, f := range fields {
+			d, closer, err := snap.Get(compID2(cd.HashPrefix, acc, id, f))
+			if err == pebble.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return res, err
+			}
+			h[f] = append(json.RawMessage{}, d...)
+			closer.Close()
+		}
+		res.Hashes[id] = h
+	}
+	if len(req.Sets) > 0 {
+		res.Sets = map[string]int64{}
+	}
+	for _, k := range req.Sets {
+		c, err := getCard(snap, compID(cd.SetPrefix, acc, k))
+		if err != nil {
+			return res, err
+		}
+		res.Sets[k] = c
+	}
+	if len(req.Lists) > 0 {
+		res.Lists = map[string]int64{}
+	}
+	for _, k := range req.Lists {
+		m, err := getListMeta(snap, acc, k)
+		if err != nil {
+			return res, err
+		}
+		res.Lists[k] = m.Tail - m.Head
+	}
+	if len(req.Sequences) > 0 {
+		res.Sequences = map[string]SeqResponse{}
+	}
+	for _, k := range req.Sequences {
+		s, err := getSeq(snap, acc, k)
+		if err != nil {
+			return res, err
+		}
+		if s != nil {
+			res.Sequences[k] = toSeqResponse(k, s)
+		}
+	}
+	return res, nil
+}
+
+func ReadHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req ReadRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if req.size() > readMaxItems {
+		ctx.Error("too many items to read", 400)
+		return
+	}
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	res, err := batchRead(snap, acc, req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,294 @@
+// Rebuild of secondary structures (geo, search and expiration indexes)
+// walks all KV values and indexes them again, then drops index entries of
+// keys that are gone or no longer indexed by config. It runs in background
+// with limited rate, one account chunk at a time under Store.Singleton, so
+// it races with nothing and doesn't block startup. Cursor is persisted
+// with every chunk, interrupted rebuild resumes after restart.
+//
+// Prefix - cursor (last processed key)
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+// max keys processed under a single Singleton call
+const rebuildBatch = 100
+
+const defaultRebuildRate = 10000
+
+// ranges walked by rebuild in order
+var rebuildPrefixes = []byte{cd.KVPrefix, cd.GeoPrefix, cd.SearchPrefix}
+
+type RebuildState struct {
+	Running  bool
+	Started  time.Time `json:",omitempty"`
+	Finished time.Time `json:",omitempty"`
+	Rate     int       // max keys per second
+	Keys     int64     // keys processed by this run
+	Fixed    int64     // index entries of missing keys dropped
+	Cursor   string    `json:",omitempty"` // last processed key
+	Error    string    `json:",omitempty"`
+}
+
+var rebuildMu sync.Mutex
+var rebuildState RebuildState
+var rebuildStop bool
+
+func rebuildCursorKey() []byte {
+	return compID1(cd.RebuildPrefix, "")
+}
+
+// rebuildChunk returns account and keys of the next chunk, starting after cursor
+func rebuildChunk(cursor []byte) (string, [][]byte, error) {
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{rebuildPrefixes[0]},
+		UpperBound: []byte{rebuildPrefixes[len(rebuildPrefixes)-1] + 1},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	defer iter.Close()
+	var acc []byte
+	var keys [][]byte
+	valid := iter.First()
+	if cursor != nil {
+		valid = iter.SeekGE(cursor)
+		if valid && bytes.Equal(iter.Key(), cursor) {
+			valid = iter.Next()
+		}
+	}
+	for ; valid && len(keys) < rebuildBatch; valid = iter.Next() {
+		k := iter.Key()
+		if bytes.IndexByte(rebuildPrefixes, k[0]) < 0 {
+			continue // in between of rebuilt ranges
+		}
+		i := bytes.IndexByte(k[1:], 0)
+		if i < 0 {
+			continue
+		}
+		if acc != nil && !bytes.Equal(acc, k[1:1+i]) {
+			break // one account per chunk
+		}
+		acc = append([]byte{}, k[1:1+i]...)
+		keys = append(keys, append([]byte{}, k...))
+	}
+	return string(acc), keys, nil
+}
+
+// rebuildKey updates indexes of a single key, returns true if stale index entry was dropped
+func rebuildKey(b *pebble.Batch, acc string, k []byte) (bool, error) {
+	prefix := k[0]
+	id := string(k[len(acc)+2:])
+	if prefix != cd.KVPrefix {
+		// index entries: Prefix|Account|0|k|0|Key - reverse index of the key
+		sub, key, ok := bytes.Cut([]byte(id), []byte{0})
+		if !ok || string(sub) != "k" {
+			return false, nil
+		}
+		id = string(key)
+	}
+	d, closer, err := b.Get(compID(cd.KVPrefix, acc, id))
+	if err != nil && err != pebble.ErrNotFound {
+		return false, err
+	}
+	var v *cd.KV
+	if err == nil {
+		v = &cd.KV{}
+		_, err = v.UnmarshalMsg(d)
+		closer.Close()
+		if err != nil {
+			return false, fmt.Errorf("%q: %w", k, err)
+		}
+	}
+	switch prefix {
+	case cd.KVPrefix:
+		if v == nil { // deleted in the meantime
+			return false, nil
+		}
+		err = indexGeo(acc, b, id, v.Data, false)
+		if err != nil {
+			return false, err
+		}
+		err = indexSearch(acc, b, id, v.Data, false)
+		if err != nil {
+			return false, err
+		}
+		if v.Expires != 0 {
+			return false, setTTLIndex(b, acc, id, v.Expires, false)
+		}
+	case cd.GeoPrefix:
+		if v == nil || !geoIndexed(id) {
+			return true, unindexGeo(acc, b, id)
+		}
+	case cd.SearchPrefix:
+		if v == nil || searchConfig(id) == nil {
+			return true, unindexSearch(acc, b, id)
+		}
+	}
+	return false, nil
+}
+
+func rebuild(rate int) {
+	release := store.acquire()
+	defer release()
+	d, closer, err := store.DB().Get(rebuildCursorKey())
+	if err != nil && err != pebble.ErrNotFound {
+		log.Print("rebuild: ", err)
+		return
+	}
+	var cursor []byte
+	if err == nil {
+		cursor = append([]byte{}, d...)
+		closer.Close()
+	}
+	var acc string
+	var chunk [][]byte
+	var keys, fixed int64
+	started := time.Now()
+	for {
+		rebuildMu.Lock()
+		stop := rebuildStop
+		rebuildState.Keys, rebuildState.Fixed, rebuildState.Cursor = keys, fixed, string(cursor)
+		rebuildMu.Unlock()
+		if stop {
+			break
+		}
+		acc, chunk, err = rebuildChunk(cursor)
+		if err != nil {
+			break
+		}
+		if len(chunk) == 0 { // done
+			var done func()
+			done, err = store.beginWrite()
+			if err == nil {
+				err = store.DB().Delete(rebuildCursorKey(), pebble.Sync)
+				done()
+			}
+			cursor = nil
+			break
+		}
+		err = store.Singleton([]byte(acc), func() error {
+			b := store.DB().NewIndexedBatch() // inside, so DB can't be switched meanwhile
+			for _, k := range chunk {
+				f, err := rebuildKey(b, acc, k)
+				if err != nil {
+					return err
+				}
+				if f {
+					fixed++
+				}
+			}
+			err := b.Set(rebuildCursorKey(), chunk[len(chunk)-1], pebble.NoSync)
+			if err != nil {
+				return err
+			}
+			return b.Commit(pebble.NoSync)
+		})
+		if err != nil {
+			break
+		}
+		cursor = chunk[len(chunk)-1]
+		keys += int64(len(chunk))
+		// sleep to keep the rate
+		ahead := time.Duration(keys)*time.Second/time.Duration(rate) - time.Since(started)
+		if ahead > 0 {
+			time.Sleep(ahead)
+		}
+	}
+	rebuildMu.Lock()
+	defer rebuildMu.Unlock()
+	rebuildState.Running = false
+	rebuildState.Finished = time.Now()
+	rebuildState.Keys, rebuildState.Fixed, rebuildState.Cursor = keys, fixed, string(cursor)
+	if err != nil {
+		rebuildState.Error = err.Error()
+		log.Print("rebuild: ", err)
+	}
+}
+
+// startRebuild starts rebuild in background, unless it's running already
+func startRebuild(rate int) bool {
+	rebuildMu.Lock()
+	defer rebuildMu.Unlock()
+	if rebuildState.Running {
+		return false
+	}
+	rebuildState = RebuildState{Running: true, Started: time.Now(), Rate: rate}
+	rebuildStop = false
+	go rebuild(rate)
+	return true
+}
+
+// ResumeRebuild continues rebuild interrupted by restart
+func ResumeRebuild() {
+	_, closer, err := store.DB().Get(rebuildCursorKey())
+	if err != nil {
+		return
+	}
+	closer.Close()
+	log.Print("resuming index rebuild")
+	startRebuild(defaultRebuildRate)
+}
+
+func writeRebuildState(ctx *fasthttp.RequestCtx) {
+	rebuildMu.Lock()
+	d, err := json.Marshal(rebuildState)
+	rebuildMu.Unlock()
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetRebuildHandler - GET /admin/rebuild
+func GetRebuildHandler(ctx *fasthttp.RequestCtx) {
+	writeRebuildState(ctx)
+}
+
+// StartRebuildHandler - POST /admin/rebuild?rate= starts rebuild or resumes stopped one.
+// With ?restart=1 rebuild starts from the beginning.
+func StartRebuildHandler(ctx *fasthttp.RequestCtx) {
+	rate := ctx.QueryArgs().GetUintOrZero("rate")
+	if rate <= 0 {
+		rate = defaultRebuildRate
+	}
+	if ctx.QueryArgs().GetBool("restart") {
+		rebuildMu.Lock()
+		running := rebuildState.Running
+		rebuildMu.Unlock()
+		if running {
+			ctx.Error("rebuild is running", 409)
+			return
+		}
+		err := store.DB().Delete(rebuildCursorKey(), pebble.Sync)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	if !startRebuild(rate) {
+		ctx.Error("rebuild is running", 409)
+		return
+	}
+	ctx.SetStatusCode(202)
+	writeRebuildState(ctx)
+}
+
+// StopRebuildHandler - DELETE /admin/rebuild stops rebuild after current chunk, it can be resumed later
+func StopRebuildHandler(ctx *fasthttp.RequestCtx) {
+	rebuildMu.Lock()
+	rebuildStop = true
+	rebuildMu.Unlock()
+	writeRebuildState(ctx)
+}
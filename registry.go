@@ -0,0 +1,237 @@
+// Instance registry detects several active instances serving the same
+// accounts, for ex. two primaries behind a load balancer by mistake, which
+// breaks exclusivity of locks and leases. Every Interval seconds instance
+// writes its info to Path (directory on shared storage) and reads info of
+// others, and/or asks Peers for their info. Another active instance of the
+// same Cluster seen within 3 intervals is a duplicate: it's logged on every
+// check, shown in GET /admin/instance and can be alerted on (Duplicates rule).
+// Followers that didn't promote and fenced instances are not active.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type RegistryConfig struct {
+	Cluster  string   `yaml:"Cluster"`  // name of the deployment, instances of the same cluster shouldn't be active together
+	Path     string   `yaml:"Path"`     // directory on shared storage to advertise instances in
+	Peers    []string `yaml:"Peers"`    // instance URLs of other instances, for ex. http://cd-2:8080/admin/instance
+	Interval int      `yaml:"Interval"` // seconds between checks, default 5
+}
+
+type InstanceInfo struct {
+	ID      string
+	Cluster string
+	Host    string
+	Addr    string
+	Epoch   int64
+	Active  bool
+	Started int64
+	Seen    int64 // unix seconds of the last advertisement
+}
+
+type InstanceState struct {
+	InstanceInfo
+	Checked    int64          `json:",omitempty"`
+	Duplicates []InstanceInfo // other active instances of the cluster
+	Errors     []string       `json:",omitempty"` // failed registry reads or peer checks
+}
+
+var instanceID = newInstanceID()
+var instanceStarted = time.Now().Unix()
+
+var registryMu sync.Mutex
+var registryState InstanceState
+
+var registryClient = &fasthttp.Client{}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// instanceActive returns false if instance doesn't serve clients on its own
+func instanceActive() bool {
+	if store.Fenced() {
+		return false
+	}
+	if config.Failover.Primary == "" {
+		return true
+	}
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+	return failoverState.Promoted
+}
+
+func selfInfo(cfg RegistryConfig) InstanceInfo {
+	host, _ := os.Hostname()
+	return InstanceInfo{
+		ID:      instanceID,
+		Cluster: cfg.Cluster,
+		Host:    host,
+		Addr:    config.ListenAddr,
+		Epoch:   epoch.Load(),
+		Active:  instanceActive(),
+		Started: instanceStarted,
+		Seen:    time.Now().Unix(),
+	}
+}
+
+// advertise writes info of the instance to the registry directory
+func advertise(cfg RegistryConfig, self InstanceInfo) error {
+	d, err := json.Marshal(self)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(cfg.Path, cfg.Cluster+"."+self.ID+".json")
+	err = os.WriteFile(name+".tmp", d, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name) // others never read half-written file
+}
+
+// readRegistry returns instances of the cluster advertised in the registry directory
+func readRegistry(cfg RegistryConfig) ([]InstanceInfo, error) {
+	names, err := filepath.Glob(filepath.Join(cfg.Path, cfg.Cluster+".*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var res []InstanceInfo
+	for _, name := range names {
+		d, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		var i InstanceInfo
+		err = json.Unmarshal(d, &i)
+		if err != nil {
+			return res, fmt.Errorf("%v: %w", name, err)
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+func checkPeer(url string) (InstanceInfo, error) {
+	var i InstanceInfo
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(url)
+	err := registryClient.DoTimeout(req, resp, time.Second*2)
+	if err != nil {
+		return i, err
+	}
+	if resp.StatusCode() != 200 {
+		return i, fmt.Errorf("peer returned %v", resp.StatusCode())
+	}
+	err = json.Unmarshal(resp.Body(), &i)
+	i.Seen = time.Now().Unix() // peer answered just now
+	return i, err
+}
+
+func checkRegistry(cfg RegistryConfig) {
+	self := selfInfo(cfg)
+	stale := self.Seen - int64(cfg.Interval*3)
+	var seen []InstanceInfo
+	var errs []string
+	if cfg.Path != "" {
+		err := advertise(cfg, self)
+		if err != nil {
+			errs = append(errs, "advertise: "+err.Error())
+		}
+		list, err := readRegistry(cfg)
+		if err != nil {
+			errs = append(errs, "registry: "+err.Error())
+		}
+		seen = append(seen, list...)
+	}
+	for _, p := range cfg.Peers {
+		i, err := checkPeer(p)
+		if err != nil {
+			errs = append(errs, p+": "+err.Error())
+			continue
+		}
+		seen = append(seen, i)
+	}
+	dups := []InstanceInfo{}
+	found := map[string]bool{}
+	for _, i := range seen {
+		if i.ID == self.ID || found[i.ID] || i.Cluster != cfg.Cluster || !i.Active || i.Seen < stale {
+			continue
+		}
+		found[i.ID] = true
+		dups = append(dups, i)
+	}
+	if self.Active && len(dups) > 0 {
+		var ids []string
+		for _, i := range dups {
+			ids = append(ids, fmt.Sprintf("%v (%v %v, epoch %v)", i.ID, i.Host, i.Addr, i.Epoch))
+		}
+		log.Printf("DUPLICATE INSTANCE: cluster %q is also served by %v, locks are not exclusive", cfg.Cluster, strings.Join(ids, ", "))
+	}
+	if !self.Active {
+		dups = []InstanceInfo{} // standby instance doesn't conflict with anyone
+	}
+	registryMu.Lock()
+	registryState = InstanceState{InstanceInfo: self, Checked: self.Seen, Duplicates: dups, Errors: errs}
+	registryMu.Unlock()
+}
+
+// duplicateInstances returns number of other active instances of the cluster
+func duplicateInstances() int {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return len(registryState.Duplicates)
+}
+
+func RegistryLoop(cfg RegistryConfig) {
+	if cfg.Path == "" && len(cfg.Peers) == 0 {
+		return
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5
+	}
+	checkRegistry(cfg)
+	for range time.Tick(time.Second * time.Duration(cfg.Interval)) {
+		checkRegistry(cfg)
+	}
+}
+
+// GetInstanceHandler - GET /admin/instance shows this instance and its duplicates.
+// Peers read it to cross-check each other.
+func GetInstanceHandler(ctx *fasthttp.RequestCtx) {
+	registryMu.Lock()
+	res := registryState
+	registryMu.Unlock()
+	if res.Checked == 0 { // registry is not configured
+		res.InstanceInfo = selfInfo(config.Registry)
+		res.Duplicates = []InstanceInfo{}
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,156 @@
+// Request log keeps recent requests in an in-memory ring buffer, so
+// transient incidents can be investigated without permanent access logging.
+// Disabled by default, enabled via RequestLog in config or admin API.
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const maxLoggedError = 256
+
+type LoggedRequest struct {
+	At      time.Time
+	Method  string
+	URI     string
+	IP      string `json:",omitempty"` // client IP, see proxy.go
+	Status  int
+	Latency string
+	Error   string `json:",omitempty"` // response body of failed request, truncated
+}
+
+type requestLog struct {
+	mu   sync.Mutex
+	buf  []LoggedRequest
+	next int
+	full bool
+}
+
+var reqLog requestLog
+
+// resize changes capacity of the buffer dropping logged requests, 0 disables logging
+func (l *requestLog) resize(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = make([]LoggedRequest, n)
+	l.next = 0
+	l.full = false
+}
+
+func (l *requestLog) add(r LoggedRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) == 0 {
+		return
+	}
+	l.buf[l.next] = r
+	l.next++
+	if l.next == len(l.buf) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// recent returns up to n latest requests, newest first, optionally only failed
+func (l *requestLog) recent(n int, failed bool) []LoggedRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := l.next
+	if l.full {
+		count = len(l.buf)
+	}
+	res := []LoggedRequest{}
+	for i := 1; i <= count && len(res) < n; i++ {
+		r := l.buf[(l.next-i+len(l.buf))%len(l.buf)]
+		if failed && r.Status < 400 {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// purge removes requests having the account as a path segment, returns number removed
+func (l *requestLog) purge(acc string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for i, r := range l.buf {
+		path, _, _ := strings.Cut(r.URI, "?")
+		if strings.Contains(path+"/", "/"+acc+"/") {
+			l.buf[i] = LoggedRequest{At: r.At, Method: r.Method, URI: "purged", Status: r.Status, Latency: r.Latency}
+			n++
+		}
+	}
+	return n
+}
+
+func (l *requestLog) enabled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buf) > 0
+}
+
+// reqLogHandler wraps h, recording requests into the ring buffer
+func reqLogHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if !reqLog.enabled() {
+			h(ctx)
+			return
+		}
+		start := time.Now()
+		h(ctx)
+		r := LoggedRequest{
+			At:      start,
+			Method:  string(ctx.Method()),
+			URI:     string(ctx.RequestURI()),
+			IP:      clientIP(ctx),
+			Status:  ctx.Response.StatusCode(),
+			Latency: time.Since(start).String(),
+		}
+		if r.Status >= 400 {
+			body := ctx.Response.Body()
+			if len(body) > maxLoggedError {
+				body = body[:maxLoggedError]
+			}
+			r.Error = string(body)
+		}
+		reqLog.add(r)
+	}
+}
+
+// GetRequestLogHandler returns ?limit= latest requests, only failed ones if ?failed=1
+func GetRequestLogHandler(ctx *fasthttp.RequestCtx) {
+	limit, _, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(reqLog.recent(limit, ctx.QueryArgs().GetBool("failed")))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// SetRequestLogHandler sets ring buffer ?size=, 0 disables logging. Size is
+// stored as RequestLog runtime setting, so it survives restart
+func SetRequestLogHandler(ctx *fasthttp.RequestCtx) {
+	size := ctx.QueryArgs().GetUintOrZero("size")
+	if size < 0 || size > 1000000 {
+		ctx.Error("size is not in range 0~1000000", 400)
+		return
+	}
+	_, err := changeSetting("RequestLog", json.RawMessage(strconv.Itoa(size)), "")
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
@@ -0,0 +1,452 @@
+// Scheduled resets zero an atomic counter every Interval seconds or by
+// Cron schedule (minute hour day month weekday, UTC). Before zeroing, the
+// value of the finished period is added to the counter "<id>/<period start>",
+// both in the same batch, so writes to the counter never fall between
+// the archive and the reset. Period start is formatted as a date if it's
+// midnight UTC (billing periods), full time otherwise.
+//
+// ResetPrefix|Account|0|Counter - reset schedule
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const minResetInterval = 60
+
+type CounterResetConfig struct {
+	Interval int64  `json:",omitempty"` // seconds between resets
+	Cron     string `json:",omitempty"` // for ex. "0 0 1 * *" - first day of every month
+}
+
+type CounterResetStatus struct {
+	CounterResetConfig
+	Start     int64
+	Next      int64
+	LastRun   int64  `json:",omitempty"`
+	LastValue int64  `json:",omitempty"`
+	LastKey   string `json:",omitempty"`
+}
+
+// cronSchedule keeps allowed values of each field as bitmasks
+type cronSchedule struct {
+	minute, hour, day, month, weekday uint64
+	anyDay, anyWeekday                bool
+}
+
+func parseCronField(s string, lo, hi int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if r, st, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(st)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			part, step = r, n
+		}
+		from, to := lo, hi
+		if part != "*" {
+			f, t, isRange := strings.Cut(part, "-")
+			var err error
+			from, err = strconv.Atoi(f)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			to = from
+			if isRange {
+				to, err = strconv.Atoi(t)
+				if err != nil {
+					return 0, fmt.Errorf("bad value %q", part)
+				}
+			} else if step > 1 {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q is out of range %v-%v", part, lo, hi)
+		}
+		for i := from; i <= to; i += step {
+			mask |= 1 << i
+		}
+	}
+	return mask, nil
+}
+
+func parseCron(s string) (*cronSchedule, error) {
+	f := strings.Fields(s)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("cron should have 5 fields: minute hour day month weekday")
+	}
+	var c cronSchedule
+	var err error
+	for i, r := range []struct {
+		mask   *uint64
+		lo, hi int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.day, 1, 31}, {&c.month, 1, 12}, {&c.weekday, 0, 7}} {
+		*r.mask, err = parseCronField(f[i], r.lo, r.hi)
+		if err != nil {
+			return nil, fmt.Errorf("cron: %v", err)
+		}
+	}
+	if c.weekday&(1<<7) != 0 { // 7 is Sunday too
+		c.weekday |= 1
+	}
+	c.anyDay, c.anyWeekday = f[2] == "*", f[4] == "*"
+	return &c, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day := c.day&(1<<t.Day()) != 0
+	weekday := c.weekday&(1<<int(t.Weekday())) != 0
+	if c.anyDay || c.anyWeekday { // like in cron - if both are set, any of them matches
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// next returns first matching minute after t, zero time if there is none in 5 years
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// nextReset returns time of the reset after "after"
+func nextReset(r *cd.CounterReset, after int64) (int64, error) {
+	if r.Cron == "" {
+		next := r.Next
+		if next == 0 {
+			next = r.Start
+		}
+		for next <= after { // keep the schedule if the server was down for a few periods
+			next += r.Interval
+		}
+		return next, nil
+	}
+	c, err := parseCron(r.Cron)
+	if err != nil {
+		return 0, err
+	}
+	next := c.next(time.Unix(after, 0))
+	if next.IsZero() {
+		return 0, fmt.Errorf("cron %q never matches", r.Cron)
+	}
+	return next.Unix(), nil
+}
+
+// archiveKey returns counter that keeps value of the period started at start
+func archiveKey(id string, start int64) string {
+	t := time.Unix(start, 0).UTC()
+	if t.Truncate(time.Hour * 24).Equal(t) {
+		return id + "/" + t.Format(time.DateOnly)
+	}
+	return id + "/" + t.Format(time.RFC3339)
+}
+
+func getCounterReset(b pebble.Reader, acc, id string) (*cd.CounterReset, error) {
+	d, closer, err := b.Get(compID(cd.ResetPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var r cd.CounterReset
+	_, err = r.UnmarshalMsg(d)
+	return &r, err
+}
+
+func putCounterReset(b *pebble.Batch, acc, id string, r *cd.CounterReset) error {
+	d, err := r.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.ResetPrefix, acc, id), d, pebble.NoSync)
+}
+
+func toCounterResetStatus(r *cd.CounterReset) CounterResetStatus {
+	return CounterResetStatus{
+		CounterResetConfig: CounterResetConfig{Interval: r.Interval, Cron: r.Cron},
+		Start:              r.Start,
+		Next:               r.Next,
+		LastRun:            r.LastRun,
+		LastValue:          r.LastValue,
+		LastKey:            r.LastKey,
+	}
+}
+
+func writeCounterResetStatus(ctx *fasthttp.RequestCtx, r *cd.CounterReset) {
+	d, err := json.Marshal(toCounterResetStatus(r))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// resetCounter archives the value of the counter and zeroes it.
+// Scheduled resets are skipped if they aren't due yet, manual ones run right away.
+func resetCounter(b *pebble.Batch, acc, id string, manual bool) (*cd.CounterReset, error) {
+	r, err := getCounterReset(b, acc, id)
+	if err != nil || r == nil {
+		return r, err
+	}
+	now := time.Now().Unix()
+	if !manual && r.Next > now {
+		return r, nil
+	}
+	at := now
+	if !manual {
+		at = r.Next // period ends at scheduled time, even if the loop was late
+	}
+	key := resolveAlias(acc, aliasCounter, id)
+	val, err := getCard(b, compID(cd.AtomicPrefix, acc, key))
+	if err != nil {
+		return nil, err
+	}
+	r.LastKey = archiveKey(key, r.Start)
+	archived, err := getCard(b, compID(cd.AtomicPrefix, acc, r.LastKey))
+	if err != nil {
+		return nil, err
+	}
+	err = SetInt64(compID(cd.AtomicPrefix, acc, r.LastKey), archived+val, b)
+	if err != nil {
+		return nil, err
+	}
+	err = touchStats(b, acc, statsCounter, r.LastKey)
+	if err != nil {
+		return nil, err
+	}
+	err = SetInt64(compID(cd.AtomicPrefix, acc, key), 0, b)
+	if err != nil {
+		return nil, err
+	}
+	err = touchStats(b, acc, statsCounter, key)
+	if err != nil {
+		return nil, err
+	}
+	err = sampleCounter(b, acc, key, 0)
+	if err != nil {
+		return nil, err
+	}
+	r.LastRun, r.LastValue, r.Start = now, val, at
+	r.Next, err = nextReset(r, max(now, at))
+	if err != nil {
+		return nil, err
+	}
+	return r, putCounterReset(b, acc, id, r)
+}
+
+// ResetLoop runs due counter resets of all accounts every second
+func ResetLoop() {
+	t := time.NewTicker(time.Second)
+	for range t.C {
+		release, err := store.beginWrite()
+		if err != nil {
+			continue // writes are paused or stopped
+		}
+		runResets()
+		release()
+	}
+}
+
+// runResets runs counter resets that are due
+func runResets() {
+	type due struct{ acc, id string }
+	var list []due
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.ResetPrefix},
+		UpperBound: []byte{cd.ResetPrefix + 1},
+	})
+	if err != nil {
+		log.Print("counter reset: ", err)
+		return
+	}
+	now := time.Now().Unix()
+	for iter.First(); iter.Valid(); iter.Next() {
+		var r cd.CounterReset
+		_, err := r.UnmarshalMsg(iter.Value())
+		if err != nil || r.Next > now {
+			continue
+		}
+		parts := strings.SplitN(string(iter.Key()[1:]), string([]byte{0}), 2)
+		if len(parts) == 2 {
+			list = append(list, due{parts[0], parts[1]})
+		}
+	}
+	iter.Close()
+	for _, d := range list {
+		b := store.DB().NewIndexedBatch()
+		err := store.Singleton([]byte(d.acc), func() error {
+			_, err := resetCounter(b, d.acc, d.id, false)
+			if err != nil {
+				return err
+			}
+			return b.Commit(pebble.NoSync)
+		})
+		if err != nil {
+			log.Printf("counter reset %v/%v: %v", d.acc, d.id, err)
+		}
+	}
+}
+
+func GetCounterResetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	r, err := getCounterReset(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if r == nil {
+		ctx.Error("not found", 404)
+		return
+	}
+	writeCounterResetStatus(ctx, r)
+}
+
+// SetCounterResetHandler creates or updates reset schedule, current period starts now
+func SetCounterResetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req CounterResetConfig
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if (req.Interval == 0) == (req.Cron == "") {
+		ctx.Error("either Interval or Cron should be set", 400)
+		return
+	}
+	if req.Cron == "" && req.Interval < minResetInterval {
+		ctx.Error(fmt.Sprintf("Interval should be at least %v seconds", minResetInterval), 400)
+		return
+	}
+	now := time.Now().Unix()
+	r := &cd.CounterReset{Interval: req.Interval, Cron: req.Cron, Start: now}
+	r.Next, err = nextReset(r, now)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		old, err := getCounterReset(b, acc, id)
+		if err != nil {
+			return err
+		}
+		if old != nil { // keep the period that is already counting
+			r.Start, r.LastRun, r.LastValue, r.LastKey = old.Start, old.LastRun, old.LastValue, old.LastKey
+		}
+		err = putCounterReset(b, acc, id, r)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	writeCounterResetStatus(ctx, r)
+}
+
+// RunCounterResetHandler resets the counter right away, next scheduled reset is kept
+func RunCounterResetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var r *cd.CounterReset
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		r, err = resetCounter(b, acc, id, true)
+		if err != nil || r == nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if r == nil {
+		ctx.Error("not found", 404)
+		return
+	}
+	writeCounterResetStatus(ctx, r)
+}
+
+// DeleteCounterResetHandler removes the schedule, counter and archives are kept
+func DeleteCounterResetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := b.Delete(compID(cd.ResetPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
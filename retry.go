@@ -0,0 +1,59 @@
+// Retry-After hints are calculated from the current state of the server
+// instead of a constant, so clients back off just long enough:
+// lock conflicts - time left till the lock expires,
+// DB stopped - time it would take to flush requests in flight.
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"clouddragon/cd"
+
+	"github.com/valyala/fasthttp"
+)
+
+// RetryAfter estimates how long it'll take to flush all pending requests
+// based on the duration and size of the last WAL write.
+func (p *Store) RetryAfter() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	batches := 1
+	if p.lastCount > 0 {
+		batches += p.pending / p.lastCount
+	}
+	return p.lastFlush * time.Duration(batches)
+}
+
+// setRetryAfter sets Retry-After header in seconds, rounding up.
+func setRetryAfter(ctx *fasthttp.RequestCtx, d time.Duration) {
+	sec := int64((d + time.Second - 1) / time.Second)
+	if sec < 1 {
+		sec = 1
+	}
+	ctx.Response.Header.Set("Retry-After", strconv.FormatInt(sec, 10))
+}
+
+// retryError writes the error of request locking lockID and sets
+// Retry-After header for errors worth retrying.
+func retryError(ctx *fasthttp.RequestCtx, acc, lockID string, err error) {
+	switch {
+	case errors.Is(err, ErrStopped):
+		ctx.Error(err.Error(), 503)
+		setRetryAfter(ctx, store.RetryAfter())
+	case errors.Is(err, ErrFenced):
+		ctx.Error(err.Error(), 503)
+	case errors.Is(err, cd.ErrNotLocked):
+		ctx.Error(err.Error(), 409)
+		if till := memLockTill(acc, lockID); till > 0 {
+			setRetryAfter(ctx, untilTTL(till))
+		}
+	case errors.Is(err, cd.ErrVersionMismatch), errors.Is(err, cd.ErrValueMismatch), errors.Is(err, ErrDeadlock), errors.Is(err, ErrLockConflict):
+		ctx.Error(err.Error(), 409)
+	case errors.Is(err, ErrValueTooLarge):
+		ctx.Error(err.Error(), 413)
+	default:
+		ctx.Error(err.Error(), 400)
+	}
+}
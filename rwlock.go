@@ -0,0 +1,305 @@
+// Read-write locks allow many concurrent readers or a single writer.
+// Handles and TTLs work the same way as for fast locks: lock is held for
+// ?dur= seconds unless released or extended with its handle. Waiting
+// writer blocks new readers, so writers don't starve on busy keys.
+// Read-write locks are kept in memory only and are lost on restart.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type rwLock struct {
+	writer         int64           // handle of the writer, 0 - none
+	writerTill     int64           // unix seconds
+	readers        map[int64]int64 // handle -> till
+	waitingWriters int
+}
+
+type rwLockMutex struct {
+	c *sync.Cond
+	l sync.Mutex
+	m map[string]*rwLock
+}
+
+var rwmu = func() []*rwLockMutex {
+	res := make([]*rwLockMutex, mCount)
+	for i := range res {
+		km := &rwLockMutex{m: map[string]*rwLock{}}
+		km.c = sync.NewCond(&km.l)
+		res[i] = km
+		go km.sweepLoop()
+	}
+	return res
+}()
+
+func chooseRWLock(id string) *rwLockMutex {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return rwmu[h.Sum64()%mCount]
+}
+
+// sweepLoop expires locks and wakes up waiters to handle their timeouts
+func (km *rwLockMutex) sweepLoop() {
+	for range time.Tick(time.Second) {
+		km.l.Lock()
+		now := ttlNow().Unix()
+		for k := range km.m {
+			km.expire(k, now)
+		}
+		km.c.Broadcast()
+		km.l.Unlock()
+	}
+}
+
+// expire releases expired holders and drops unused lock
+func (km *rwLockMutex) expire(key string, now int64) {
+	r := km.m[key]
+	if r == nil {
+		return
+	}
+	if r.writer != 0 && r.writerTill <= now {
+		r.writer = 0
+	}
+	for h, till := range r.readers {
+		if till <= now {
+			delete(r.readers, h)
+		}
+	}
+	if r.writer == 0 && len(r.readers) == 0 && r.waitingWriters == 0 {
+		delete(km.m, key)
+	}
+}
+
+func (km *rwLockMutex) get(key string) *rwLock {
+	r := km.m[key]
+	if r == nil {
+		r = &rwLock{readers: map[int64]int64{}}
+		km.m[key] = r
+	}
+	return r
+}
+
+func (km *rwLockMutex) Lock(key string, write bool, dur, wait int) (int64, bool) {
+	start := ttlNow().Unix()
+	km.l.Lock()
+	defer km.l.Unlock()
+	for {
+		now := ttlNow().Unix()
+		km.expire(key, now)
+		r := km.get(key)
+		if r.writer == 0 && ((write && len(r.readers) == 0) || (!write && r.waitingWriters == 0)) {
+			handle := atomic.AddInt64(&handleCounter, 1)
+			if write {
+				r.writer, r.writerTill = handle, now+int64(dur)
+			} else {
+				r.readers[handle] = now + int64(dur)
+			}
+			return handle, true
+		}
+		if wait == 0 || int(now-start) > wait {
+			km.expire(key, now)
+			return 0, false
+		}
+		if write {
+			r.waitingWriters++
+		}
+		km.c.Wait()
+		if write {
+			r.waitingWriters--
+		}
+	}
+}
+
+func (km *rwLockMutex) Unlock(key string, handle int64) error {
+	km.l.Lock()
+	defer km.l.Unlock()
+	km.expire(key, ttlNow().Unix())
+	r := km.m[key]
+	switch {
+	case r != nil && r.writer == handle:
+		r.writer = 0
+	case r != nil && r.readers[handle] != 0:
+		delete(r.readers, handle)
+	default:
+		return fmt.Errorf("lock not found")
+	}
+	km.expire(key, ttlNow().Unix())
+	km.c.Broadcast()
+	return nil
+}
+
+func (km *rwLockMutex) Extend(key string, handle int64, dur int) error {
+	km.l.Lock()
+	defer km.l.Unlock()
+	now := ttlNow().Unix()
+	km.expire(key, now)
+	r := km.m[key]
+	switch {
+	case r != nil && r.writer == handle:
+		r.writerTill = now + int64(dur)
+	case r != nil && r.readers[handle] != 0:
+		r.readers[handle] = now + int64(dur)
+	default:
+		return fmt.Errorf("lock not found")
+	}
+	return nil
+}
+
+type RWLockResponse struct {
+	ID             string
+	Handle         int64 `json:",omitempty"`
+	Writer         bool  // locked by writer
+	Readers        int
+	WaitingWriters int   `json:",omitempty"`
+	Till           int64 `json:",omitempty"` // when current holders expire
+}
+
+func (km *rwLockMutex) info(key string) RWLockResponse {
+	km.l.Lock()
+	defer km.l.Unlock()
+	km.expire(key, ttlNow().Unix())
+	var res RWLockResponse
+	r := km.m[key]
+	if r == nil {
+		return res
+	}
+	res.Writer, res.Readers, res.WaitingWriters = r.writer != 0, len(r.readers), r.waitingWriters
+	if r.writer != 0 {
+		res.Till = r.writerTill
+	}
+	for _, till := range r.readers {
+		res.Till = max(res.Till, till)
+	}
+	return res
+}
+
+// rwPurge releases all read-write locks of the account, returns number of locks released
+func rwPurge(acc string) int {
+	prefix := acc + string([]byte{0})
+	n := 0
+	for _, km := range rwmu {
+		km.l.Lock()
+		for k := range km.m {
+			if strings.HasPrefix(k, prefix) {
+				delete(km.m, k)
+				n++
+			}
+		}
+		km.c.Broadcast()
+		km.l.Unlock()
+	}
+	return n
+}
+
+func writeRWLockResponse(ctx *fasthttp.RequestCtx, res RWLockResponse) {
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func GetRWLockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	cid := acc + string([]byte{0}) + id
+	res := chooseRWLock(cid).info(cid)
+	res.ID = id
+	writeRWLockResponse(ctx, res)
+}
+
+// RWLockHandler acquires ?mode=read (default) or ?mode=write lock for ?dur= seconds
+// waiting up to ?wait= seconds. With ?handle= lock is extended instead.
+func RWLockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	dur, wait, err := getLockArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var write bool
+	switch string(ctx.QueryArgs().Peek("mode")) {
+	case "", "read":
+	case "write":
+		write = true
+	default:
+		ctx.Error("mode should be read or write", 400)
+		return
+	}
+	cid := acc + string([]byte{0}) + id
+	km := chooseRWLock(cid)
+	handle := int64(ctx.QueryArgs().GetUintOrZero("handle"))
+	if handle != 0 {
+		err = km.Extend(cid, handle, dur)
+		if err != nil {
+			ctx.Error(err.Error(), 409)
+			return
+		}
+	} else {
+		var ok bool
+		handle, ok = km.Lock(cid, write, dur, wait)
+		if !ok {
+			till := km.info(cid).Till
+			ctx.Error(cd.ErrNotLocked.Error(), 409)
+			if till > 0 {
+				setRetryAfter(ctx, untilTTL(till))
+			}
+			return
+		}
+	}
+	res := km.info(cid)
+	res.ID, res.Handle = id, handle
+	writeRWLockResponse(ctx, res)
+}
+
+// RWUnlockHandler releases the lock held with ?handle=
+func RWUnlockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	cid := acc + string([]byte{0}) + id
+	km := chooseRWLock(cid)
+	err = km.Unlock(cid, int64(ctx.QueryArgs().GetUintOrZero("handle")))
+	if err != nil {
+		ctx.Error(err.Error(), 409)
+		return
+	}
+	res := km.info(cid)
+	res.ID = id
+	writeRWLockResponse(ctx, res)
+}
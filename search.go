@@ -0,0 +1,212 @@
+// Search index maps tokens of KV keys and values to the keys, so records
+// can be found by a fragment of their key or field value.
+//
+// Only records with key prefix listed in Search config are indexed.
+// Text is split into lowercase alphanumeric tokens. Query token matches
+// every indexed token it is a prefix of.
+//
+// Account|0|t|0|Token|0|Key - token index
+// Account|0|k|0|Key         - tokens of the record to remove old index
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const searchMaxScan = 10000 // max index entries scanned per query token
+
+type SearchConfig struct {
+	Prefix string   `yaml:"Prefix"`
+	Fields []string `yaml:"Fields"` // top-level JSON fields to index, all string fields if empty
+}
+
+type SearchResponse struct {
+	Keys []string
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func searchConfig(key string) *SearchConfig {
+	for i, c := range config.Search {
+		if strings.HasPrefix(key, c.Prefix) {
+			return &config.Search[i]
+		}
+	}
+	return nil
+}
+
+// searchTokens returns unique tokens of the key and indexed fields of the value
+func searchTokens(c *SearchConfig, key string, value []byte) []string {
+	texts := []string{key}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(value, &obj) == nil {
+		for k, v := range obj {
+			if len(c.Fields) > 0 && !contains(c.Fields, k) {
+				continue
+			}
+			var s string
+			if json.Unmarshal(v, &s) == nil {
+				texts = append(texts, s)
+			} else if len(c.Fields) > 0 { // numbers, bools, etc. only if field is listed explicitly
+				texts = append(texts, string(v))
+			}
+		}
+	} else {
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			texts = append(texts, s)
+		}
+	}
+	uniq := map[string]bool{}
+	var res []string
+	for _, t := range texts {
+		for _, tok := range tokenize(t) {
+			if !uniq[tok] && len(tok) <= 256 {
+				uniq[tok] = true
+				res = append(res, tok)
+			}
+		}
+	}
+	return res
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// indexSearch updates search index of the KV record. Should be called on every KV write.
+func indexSearch(acc string, b *pebble.Batch, key string, value []byte, del bool) error {
+	c := searchConfig(key)
+	if c == nil {
+		return nil
+	}
+	err := unindexSearch(acc, b, key)
+	if err != nil {
+		return err
+	}
+	if del {
+		return nil
+	}
+	tokens := searchTokens(c, key, value)
+	for _, t := range tokens {
+		err = b.Set(compID2(cd.SearchPrefix, acc, "t", t+string([]byte{0})+key), nil, pebble.NoSync)
+		if err != nil {
+			return err
+		}
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	return b.Set(compID2(cd.SearchPrefix, acc, "k", key), []byte(strings.Join(tokens, string([]byte{0}))), pebble.NoSync)
+}
+
+// unindexSearch removes all tokens of the key from search index
+func unindexSearch(acc string, b *pebble.Batch, key string) error {
+	revKey := compID2(cd.SearchPrefix, acc, "k", key)
+	d, closer, err := b.Get(revKey)
+	if err == pebble.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	old := strings.Split(string(d), string([]byte{0}))
+	closer.Close()
+	for _, t := range old {
+		err = b.Delete(compID2(cd.SearchPrefix, acc, "t", t+string([]byte{0})+key), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+	}
+	return b.Delete(revKey, pebble.NoSync)
+}
+
+// searchToken returns keys having token starting with t
+func searchToken(snap *pebble.Snapshot, acc, t string) (map[string]bool, error) {
+	prefix := compID2(cd.SearchPrefix, acc, "t", t)
+	iter, err := snap.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	res := map[string]bool{}
+	scanned := 0
+	for iter.First(); iter.Valid() && scanned < searchMaxScan; iter.Next() {
+		scanned++
+		k := iter.Key()[len(prefix)-len(t):]
+		res[string(k[bytes.IndexByte(k, 0)+1:])] = true
+	}
+	return res, nil
+}
+
+// SearchHandler returns keys matching all tokens of ?q=
+func SearchHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	limit, _, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	tokens := tokenize(string(ctx.QueryArgs().Peek("q")))
+	if len(tokens) == 0 || len(tokens) > 10 {
+		ctx.Error("q should contain 1~10 words", 400)
+		return
+	}
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	var keys map[string]bool
+	for _, t := range tokens {
+		found, err := searchToken(snap, acc, t)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if keys == nil {
+			keys = found
+			continue
+		}
+		for k := range keys {
+			if !found[k] {
+				delete(keys, k)
+			}
+		}
+	}
+	res := SearchResponse{Keys: []string{}}
+	for k := range keys {
+		res.Keys = append(res.Keys, k)
+	}
+	sort.Strings(res.Keys)
+	if len(res.Keys) > limit {
+		res.Keys = res.Keys[:limit]
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,536 @@
+// Sequences issue numbers that are never repeated, like sequences of SQL
+// databases. Start and step are set by the first request (?start=&step=,
+// default 1 and 1) so migrated sequences continue from their last value;
+// later requests with different parameters are rejected. Every issued
+// number is persisted before it's returned. ?n= allocates a range of
+// values with a single write. PUT sets the last issued value, for ex. to
+// the max ID of re-imported data. ?format= of POST or PUT stores a template
+// issued values are returned formatted with, for ex. INV-%08d. ?max= makes
+// the sequence cyclic: the value after max is start again (for negative
+// step max is the lowest value), rollovers are counted. Sequences of the
+// account are listed page by page with their last issued values.
+//
+// SeqPrefix|Account|0|ID - sequence
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+var ErrSeqParams = errors.New("sequence exists with different start, step or max")
+var ErrSeqExhausted = errors.New("sequence reached the limit of int64")
+var ErrSeqRange = errors.New("value is out of start~max range of the sequence")
+
+const (
+	seqMaxBatch  = 100000
+	seqMaxFormat = 100
+	seqMaxWidth  = 20 // digits of int64
+)
+
+type SeqResponse struct {
+	ID        string
+	Value     int64 // last issued value
+	Start     int64
+	Step      int64
+	Max       *int64 `json:",omitempty"` // set for cyclic sequences
+	Rollovers int64  `json:",omitempty"`
+	Format    string `json:",omitempty"`
+	Formatted string `json:",omitempty"` // Value in Format
+	Created   int64
+	Updated   int64
+}
+
+// SeqRangeResponse is the sequence with values issued by the request, First~Last inclusive
+type SeqRangeResponse struct {
+	SeqResponse
+	First    int64
+	Last     int64
+	Count    int
+	Rollover bool     `json:",omitempty"` // values wrapped back to Start
+	Numbers  []string `json:",omitempty"` // First~Last in Format
+}
+
+type ListSeqResponse struct {
+	Seqs   []SeqResponse
+	Cursor string `json:",omitempty"` // pass as ?cursor= to get next page
+}
+
+func getSeq(b pebble.Reader, acc, id string) (*cd.Seq, error) {
+	d, closer, err := b.Get(compID(cd.SeqPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var s cd.Seq
+	_, err = s.UnmarshalMsg(d)
+	return &s, err
+}
+
+func putSeq(b *pebble.Batch, acc, id string, s *cd.Seq) error {
+	d, err := s.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID(cd.SeqPrefix, acc, id), d, pebble.NoSync)
+}
+
+// seqAdd returns v+step*k, false on int64 overflow
+func seqAdd(v, step int64, k int) (int64, bool) {
+	if k == 0 {
+		return v, true
+	}
+	if step > 0 && step > math.MaxInt64/int64(k) || step < 0 && step < math.MinInt64/int64(k) {
+		return 0, false
+	}
+	d := step * int64(k)
+	if d > 0 && v > math.MaxInt64-d || d < 0 && v < math.MinInt64-d {
+		return 0, false
+	}
+	return v + d, true
+}
+
+// seqNext returns the value after v, true if a cyclic sequence wrapped back to Start
+func seqNext(s *cd.Seq, v int64) (int64, bool, error) {
+	next, ok := seqAdd(v, s.Step, 1)
+	if s.Cycle && (!ok || s.Step > 0 && next > s.Max || s.Step < 0 && next < s.Max) {
+		return s.Start, true, nil
+	}
+	if !ok {
+		return 0, false, ErrSeqExhausted
+	}
+	return next, false, nil
+}
+
+// seqInRange reports whether v is within Start~Max of a cyclic sequence
+func seqInRange(s *cd.Seq, v int64) bool {
+	if !s.Cycle {
+		return true
+	}
+	if s.Step > 0 {
+		return v >= s.Start && v <= s.Max
+	}
+	return v <= s.Start && v >= s.Max
+}
+
+func getInt64Arg(ctx *fasthttp.RequestCtx, name string, def int64) (int64, bool, error) {
+	if !ctx.QueryArgs().Has(name) {
+		return def, false, nil
+	}
+	v, err := strconv.ParseInt(string(ctx.QueryArgs().Peek(name)), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%v should be an integer", name)
+	}
+	return v, true, nil
+}
+
+// checkSeqFormat allows templates with a single integer verb (%d, %x or %X with
+// flags and width up to seqMaxWidth), so formatted ranges stay small
+func checkSeqFormat(f string) error {
+	if len(f) > seqMaxFormat {
+		return fmt.Errorf("format should be up to %v bytes", seqMaxFormat)
+	}
+	verbs := 0
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(f) && f[i] == '%' {
+			continue
+		}
+		for i < len(f) && strings.IndexByte("-+0 ", f[i]) >= 0 {
+			i++
+		}
+		w := i
+		for i < len(f) && f[i] >= '0' && f[i] <= '9' {
+			i++
+		}
+		if width, _ := strconv.Atoi(f[w:i]); i-w > 2 || width > seqMaxWidth {
+			return fmt.Errorf("format width should be up to %d", seqMaxWidth)
+		}
+		if i == len(f) || strings.IndexByte("dxX", f[i]) < 0 {
+			return fmt.Errorf("format should use %%d, %%x or %%X verbs only")
+		}
+		verbs++
+	}
+	if verbs != 1 {
+		return fmt.Errorf("format should have exactly one verb for the value")
+	}
+	return nil
+}
+
+// getSeqFormat parses ?format=, nil if it's not set
+func getSeqFormat(ctx *fasthttp.RequestCtx) (*string, error) {
+	if !ctx.QueryArgs().Has("format") {
+		return nil, nil
+	}
+	f := string(ctx.QueryArgs().Peek("format"))
+	if f == "" {
+		return &f, nil // removes the format
+	}
+	return &f, checkSeqFormat(f)
+}
+
+func formatSeq(s *cd.Seq, v int64) string {
+	if s.Format == "" {
+		return ""
+	}
+	return fmt.Sprintf(s.Format, v)
+}
+
+type seqParams struct {
+	Start, Step, Max          int64
+	HasStart, HasStep, HasMax bool
+}
+
+// getSeqParams parses ?start=&step=&max= sequence is created with
+func getSeqParams(ctx *fasthttp.RequestCtx) (p seqParams, err error) {
+	p.Start, p.HasStart, err = getInt64Arg(ctx, "start", 1)
+	if err != nil {
+		return
+	}
+	p.Step, p.HasStep, err = getInt64Arg(ctx, "step", 1)
+	if err != nil {
+		return
+	}
+	if p.Step == 0 {
+		return p, fmt.Errorf("step can't be 0")
+	}
+	p.Max, p.HasMax, err = getInt64Arg(ctx, "max", 0)
+	if err != nil {
+		return
+	}
+	if p.HasMax && (p.Step > 0 && p.Max < p.Start || p.Step < 0 && p.Max > p.Start) {
+		return p, fmt.Errorf("max should be past start in the direction of step")
+	}
+	return
+}
+
+func (p seqParams) newSeq(now int64) *cd.Seq {
+	return &cd.Seq{Start: p.Start, Step: p.Step, Cycle: p.HasMax, Max: p.Max, Created: now}
+}
+
+// matches reports whether parameters set by the request are the ones s was created with
+func (p seqParams) matches(s *cd.Seq) bool {
+	return (!p.HasStart || p.Start == s.Start) && (!p.HasStep || p.Step == s.Step) &&
+		(!p.HasMax || s.Cycle && p.Max == s.Max)
+}
+
+func toSeqResponse(id string, s *cd.Seq) SeqResponse {
+	res := SeqResponse{ID: id, Value: s.Value, Start: s.Start, Step: s.Step, Rollovers: s.Rollovers, Format: s.Format, Formatted: formatSeq(s, s.Value), Created: s.Created, Updated: s.Updated}
+	if s.Cycle {
+		res.Max = &s.Max
+	}
+	return res
+}
+
+func writeSeqResponse(ctx *fasthttp.RequestCtx, id string, s *cd.Seq) {
+	d, err := json.Marshal(toSeqResponse(id, s))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetSeqHandler - GET /db/:acc/seq/:id returns last issued value and parameters
+func GetSeqHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	s, err := getSeq(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if s == nil {
+		ctx.Error("sequence not found", 404)
+		return
+	}
+	writeSeqResponse(ctx, id, s)
+}
+
+// ListSeqHandler - GET /db/:acc/seq?prefix=&limit=&cursor= lists sequences page by page
+func ListSeqHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	limit, cursor, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	prefix := compID(cd.SeqPrefix, acc, string(ctx.QueryArgs().Peek("prefix")))
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	res := ListSeqResponse{Seqs: []SeqResponse{}}
+	accPrefix := compID(cd.SeqPrefix, acc, "")
+	for iter.SeekGE(append(accPrefix, cursor...)); iter.Valid(); iter.Next() {
+		id := string(bytes.TrimPrefix(iter.Key(), accPrefix))
+		if id == cursor && cursor != "" {
+			continue
+		}
+		if len(res.Seqs) == limit {
+			res.Cursor = res.Seqs[len(res.Seqs)-1].ID
+			break
+		}
+		var s cd.Seq
+		_, err := s.UnmarshalMsg(iter.Value())
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		res.Seqs = append(res.Seqs, toSeqResponse(id, &s))
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// NextSeqHandler - POST /db/:acc/seq/:id?start=&step=&max=&n=&format= issues the
+// next n values (1 by default), creating the sequence with the parameters on
+// the first request
+func NextSeqHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	p, err := getSeqParams(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	format, err := getSeqFormat(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	n := 1
+	if ctx.QueryArgs().Has("n") {
+		n, err = ctx.QueryArgs().GetUint("n")
+		if err != nil || n == 0 || n > seqMaxBatch {
+			ctx.Error(fmt.Sprintf("n should be in range 1~%d", seqMaxBatch), 400)
+			return
+		}
+	}
+	var s *cd.Seq
+	var first int64
+	var rollovers int64
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		s, err = getSeq(b, acc, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		rollovers = 0
+		if s == nil {
+			s = p.newSeq(now)
+			first = p.Start
+		} else {
+			if !p.matches(s) {
+				return ErrSeqParams
+			}
+			v, wrapped, err := seqNext(s, s.Value)
+			if err != nil {
+				return err
+			}
+			if wrapped {
+				rollovers++
+			}
+			first = v
+		}
+		last := first
+		if s.Cycle {
+			for i := 1; i < n; i++ {
+				v, wrapped, _ := seqNext(s, last)
+				if wrapped {
+					rollovers++
+				}
+				last = v
+			}
+		} else {
+			v, ok := seqAdd(first, s.Step, n-1)
+			if !ok {
+				return ErrSeqExhausted
+			}
+			last = v
+		}
+		s.Value = last
+		s.Rollovers += rollovers
+		s.Updated = now
+		if format != nil {
+			s.Format = *format
+		}
+		err = putSeq(b, acc, id, s)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if errors.Is(err, ErrSeqParams) || errors.Is(err, ErrSeqExhausted) {
+		ctx.Error(err.Error(), 409)
+		return
+	}
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	res := SeqRangeResponse{SeqResponse: toSeqResponse(id, s), First: first, Last: s.Value, Count: n, Rollover: rollovers > 0}
+	if s.Format != "" {
+		res.Numbers = make([]string, n)
+		v := first
+		for i := range res.Numbers {
+			res.Numbers[i] = formatSeq(s, v)
+			v, _, _ = seqNext(s, v)
+		}
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// SetSeqHandler - PUT /db/:acc/seq/:id?if-current=&start=&step=&max=&format= with
+// the number in the body sets it as the last issued value, next POST continues
+// from it. With ?if-current= only if the last issued value matches (409
+// otherwise). Missing sequence is created with ?start=&step=&max=, values of
+// cyclic sequences should be within start~max.
+func SetSeqHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	p, err := getSeqParams(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	format, err := getSeqFormat(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	current, hasCurrent, err := getInt64Arg(ctx, "if-current", 0)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(ctx.Request.Body())), 10, 64)
+	if err != nil {
+		ctx.Error("body should be an integer", 400)
+		return
+	}
+	var s *cd.Seq
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		s, err = getSeq(b, acc, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		switch {
+		case hasCurrent && (s == nil || s.Value != current):
+			return fmt.Errorf("%w: last issued value is not %v", cd.ErrValueMismatch, current)
+		case s == nil:
+			s = p.newSeq(now)
+		case !p.matches(s):
+			return ErrSeqParams
+		}
+		if !seqInRange(s, v) {
+			return ErrSeqRange
+		}
+		s.Value = v
+		s.Updated = now
+		if format != nil {
+			s.Format = *format
+		}
+		err = putSeq(b, acc, id, s)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if errors.Is(err, ErrSeqParams) || errors.Is(err, ErrSeqRange) {
+		ctx.Error(err.Error(), 409)
+		return
+	}
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	writeSeqResponse(ctx, id, s)
+}
+
+// DeleteSeqHandler - DELETE /db/:acc/seq/:id, next request starts the sequence over
+func DeleteSeqHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		err := b.Delete(compID(cd.SeqPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+}
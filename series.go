@@ -0,0 +1,249 @@
+// Time series store numeric points ordered by timestamp, one key per point.
+// Reads can downsample points into intervals server-side.
+//
+// Account|0|ID              - retention in seconds (0 - keep forever)
+// Account|0|ID|0|Timestamp  - value
+//
+// Points older than retention are removed with single range delete on
+// every append.
+package main
+
+import (
+	"clouddragon/cd"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const seriesMaxPoints = 10000
+
+type Point struct {
+	T int64 // unix ms
+	V float64
+}
+
+type SeriesRequest struct {
+	Points []Point
+}
+
+type SeriesResponse struct {
+	Points []Point
+}
+
+func seriesKey(acc, id string, t int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t)^(1<<63))
+	return compID2(cd.SeriesPrefix, acc, id, string(b))
+}
+
+func parseSeriesKey(prefix, key []byte) int64 {
+	return int64(binary.BigEndian.Uint64(key[len(prefix):]) ^ (1 << 63))
+}
+
+// AppendSeriesHandler appends points to the series. Timestamp defaults to now.
+// Optional ?retention= (seconds) is stored for the series.
+func AppendSeriesHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req SeriesRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if len(req.Points) > seriesMaxPoints {
+		ctx.Error(fmt.Sprintf("up to %d points can be appended at once", seriesMaxPoints), 400)
+		return
+	}
+	now := time.Now().UnixMilli()
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		retKey := compID(cd.SeriesPrefix, acc, id)
+		retention, err := getCard(b, retKey)
+		if err != nil {
+			return err
+		}
+		if ctx.QueryArgs().Has("retention") {
+			retention = int64(ctx.QueryArgs().GetUintOrZero("retention"))
+			err = b.Set(retKey, Int64ToByte(retention), pebble.NoSync)
+			if err != nil {
+				return err
+			}
+		}
+		for _, p := range req.Points {
+			if p.T == 0 {
+				p.T = now
+			}
+			err = b.Set(seriesKey(acc, id, p.T), Int64ToByte(int64(math.Float64bits(p.V))), pebble.NoSync)
+			if err != nil {
+				return err
+			}
+		}
+		if retention > 0 {
+			err = b.DeleteRange(compID2(cd.SeriesPrefix, acc, id, ""),
+				seriesKey(acc, id, now-retention*1000), pebble.NoSync)
+			if err != nil {
+				return err
+			}
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
+
+type seriesBucket struct {
+	t                   int64
+	min, max, sum, last float64
+	count               int64
+}
+
+func (s *seriesBucket) value(agg string) float64 {
+	switch agg {
+	case "min":
+		return s.min
+	case "max":
+		return s.max
+	case "sum":
+		return s.sum
+	case "count":
+		return float64(s.count)
+	case "last":
+		return s.last
+	}
+	return s.sum / float64(s.count)
+}
+
+// GetSeriesHandler returns points within ?from=&to= (unix ms). With ?step= (ms)
+// points are aggregated into intervals using ?agg=avg|min|max|sum|count|last.
+func GetSeriesHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	args := ctx.QueryArgs()
+	from, to := int64(math.MinInt64), int64(math.MaxInt64)
+	if args.Has("from") {
+		from, err = strconv.ParseInt(string(args.Peek("from")), 10, 64)
+		if err != nil {
+			ctx.Error("from should be a number", 400)
+			return
+		}
+	}
+	if args.Has("to") {
+		to, err = strconv.ParseInt(string(args.Peek("to")), 10, 64)
+		if err != nil {
+			ctx.Error("to should be a number", 400)
+			return
+		}
+	}
+	step := int64(args.GetUintOrZero("step"))
+	agg := string(args.Peek("agg"))
+	switch agg {
+	case "", "avg", "min", "max", "sum", "count", "last":
+	default:
+		ctx.Error("agg should be one of avg|min|max|sum|count|last", 400)
+		return
+	}
+
+	prefix := compID2(cd.SeriesPrefix, acc, id, "")
+	opts := &pebble.IterOptions{
+		LowerBound: seriesKey(acc, id, from),
+		UpperBound: prefixEnd(prefix),
+	}
+	if to != math.MaxInt64 {
+		opts.UpperBound = seriesKey(acc, id, to+1)
+	}
+	iter, err := store.DB().NewIter(opts)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	res := SeriesResponse{Points: []Point{}}
+	var cur *seriesBucket
+	for iter.First(); iter.Valid() && len(res.Points) < seriesMaxPoints; iter.Next() {
+		p := Point{
+			T: parseSeriesKey(prefix, iter.Key()),
+			V: math.Float64frombits(uint64(ByteToInt64(iter.Value()))),
+		}
+		if step == 0 {
+			res.Points = append(res.Points, p)
+			continue
+		}
+		bt := p.T - ((p.T%step)+step)%step // start of the interval
+		if cur != nil && cur.t != bt {
+			res.Points = append(res.Points, Point{T: cur.t, V: cur.value(agg)})
+			cur = nil
+		}
+		if cur == nil {
+			cur = &seriesBucket{t: bt, min: p.V, max: p.V}
+		}
+		cur.min = math.Min(cur.min, p.V)
+		cur.max = math.Max(cur.max, p.V)
+		cur.sum += p.V
+		cur.last = p.V
+		cur.count++
+	}
+	if cur != nil {
+		res.Points = append(res.Points, Point{T: cur.t, V: cur.value(agg)})
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func DeleteSeriesHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		prefix := compID2(cd.SeriesPrefix, acc, id, "")
+		err := b.DeleteRange(prefix, prefixEnd(prefix), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		err = b.Delete(compID(cd.SeriesPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
@@ -0,0 +1,242 @@
+// Sets store each member under a separate key, so adding members to a big
+// set doesn't rewrite the whole set. Cardinality is kept in a separate
+// counter to avoid scanning the set.
+//
+// Account|0|ID        - cardinality
+// Account|0|ID|0|Member - member
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const maxPageSize = 1000
+
+type SetRequest struct {
+	Add    []string
+	Remove []string
+}
+
+type SetResponse struct {
+	Card     int64
+	Added    int      `json:",omitempty"`
+	Removed  int      `json:",omitempty"`
+	Contains *bool    `json:",omitempty"`
+	Members  []string `json:",omitempty"`
+	Cursor   string   `json:",omitempty"` // pass as ?cursor= to get next page
+}
+
+func getCard(b pebble.Reader, key []byte) (int64, error) {
+	d, closer, err := b.Get(key)
+	if err == pebble.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	return ByteToInt64(d), nil
+}
+
+func exists(b pebble.Reader, key []byte) (bool, error) {
+	_, closer, err := b.Get(key)
+	if err == pebble.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+// getPage parses ?limit= of paginated listings
+func getPage(ctx *fasthttp.RequestCtx) (int, string, error) {
+	limit := 100
+	if ctx.QueryArgs().Has("limit") {
+		limit = ctx.QueryArgs().GetUintOrZero("limit")
+		if limit <= 0 || limit > maxPageSize {
+			return 0, "", fmt.Errorf("limit is not in range 1~%d", maxPageSize)
+		}
+	}
+	return limit, string(ctx.QueryArgs().Peek("cursor")), nil
+}
+
+// GetSetHandler checks ?member= or lists members page by page
+func GetSetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	limit, cursor, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	var res SetResponse
+	res.Card, err = getCard(snap, compID(cd.SetPrefix, acc, id))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if ctx.QueryArgs().Has("member") {
+		ok, err := exists(snap, compID2(cd.SetPrefix, acc, id, string(ctx.QueryArgs().Peek("member"))))
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		res.Contains = &ok
+	} else {
+		prefix := compID2(cd.SetPrefix, acc, id, "")
+		iter, err := snap.NewIter(&pebble.IterOptions{
+			LowerBound: prefix,
+			UpperBound: prefixEnd(prefix),
+		})
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		defer iter.Close()
+		res.Members = []string{}
+		for iter.SeekGE(compID2(cd.SetPrefix, acc, id, cursor)); iter.Valid(); iter.Next() {
+			m := string(iter.Key()[len(prefix):])
+			if m == cursor && cursor != "" {
+				continue
+			}
+			if len(res.Members) == limit {
+				res.Cursor = res.Members[len(res.Members)-1]
+				break
+			}
+			res.Members = append(res.Members, m)
+		}
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// UpdateSetHandler adds and removes members
+func UpdateSetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req SetRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var res SetResponse
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		cardKey := compID(cd.SetPrefix, acc, id)
+		res.Card, err = getCard(b, cardKey)
+		if err != nil {
+			return err
+		}
+		for _, m := range req.Add {
+			key := compID2(cd.SetPrefix, acc, id, m)
+			ok, err := exists(b, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+			err = b.Set(key, nil, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+			res.Added++
+			res.Card++
+		}
+		for _, m := range req.Remove {
+			key := compID2(cd.SetPrefix, acc, id, m)
+			ok, err := exists(b, key)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			err = b.Delete(key, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+			res.Removed++
+			res.Card--
+		}
+		if res.Card == 0 {
+			err = b.Delete(cardKey, pebble.NoSync)
+		} else {
+			err = b.Set(cardKey, Int64ToByte(res.Card), pebble.NoSync)
+		}
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func DeleteSetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		prefix := compID2(cd.SetPrefix, acc, id, "")
+		err := b.DeleteRange(prefix, prefixEnd(prefix), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		err = b.Delete(compID(cd.SetPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}
@@ -0,0 +1,329 @@
+// Runtime settings can be changed via admin API without restart. Changes
+// are stored in the DB and applied over config file on startup, so they
+// survive restarts, every change is kept in the history. Reverting the
+// setting brings back the value from config file.
+//
+// SettingsPrefix|0|Name - current value
+// SettingsLogPrefix|0|At(8 bytes BE, unix ns) - change
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const maxSettingHistory = 1000
+
+type runtimeSetting struct {
+	desc  string
+	get   func() any
+	set   func(v json.RawMessage) error // validates and stores value into config
+	apply func()                        // makes running server use the new value
+}
+
+func intSetting(desc string, lo, hi int64, get func() int64, set func(int64), apply func()) runtimeSetting {
+	return runtimeSetting{
+		desc: desc,
+		get:  func() any { return get() },
+		set: func(v json.RawMessage) error {
+			var n int64
+			err := json.Unmarshal(v, &n)
+			if err != nil {
+				return err
+			}
+			if n < lo || n > hi {
+				return fmt.Errorf("value is not in range %v~%v", lo, hi)
+			}
+			set(n)
+			return nil
+		},
+		apply: apply,
+	}
+}
+
+func boolSetting(desc string, p *bool) runtimeSetting {
+	return runtimeSetting{
+		desc: desc,
+		get:  func() any { return *p },
+		set: func(v json.RawMessage) error {
+			return json.Unmarshal(v, p)
+		},
+	}
+}
+
+var applyCache = func() {
+	rcache.resize(config.CacheSize, time.Duration(config.NegativeCache)*time.Millisecond)
+}
+
+var settings = map[string]runtimeSetting{
+	"RequestLog": intSetting("number of recent requests to keep for debugging", 0, 1000000,
+		func() int64 { return int64(config.RequestLog) }, func(n int64) { config.RequestLog = int(n) },
+		func() { reqLog.resize(config.RequestLog) }),
+	"CacheSize": intSetting("bytes of memory for read cache, 0 - disabled", 0, 1<<40,
+		func() int64 { return config.CacheSize }, func(n int64) { config.CacheSize = n }, applyCache),
+	"NegativeCache": intSetting("milliseconds to cache missing keys for", 0, 3600000,
+		func() int64 { return int64(config.NegativeCache) }, func(n int64) { config.NegativeCache = int(n) }, applyCache),
+	"QuotaWarn": intSetting("% of quota limit to warn about, 0 - disabled", 0, 100,
+		func() int64 { return int64(config.QuotaWarn) }, func(n int64) { config.QuotaWarn = int(n) }, nil),
+	"MaxValueSize": intSetting("bytes of KV value, 0 - no limit", 0, 1<<30,
+		func() int64 { return int64(config.Limits.MaxValueSize) }, func(n int64) { config.Limits.MaxValueSize = int(n) }, nil),
+	"MaxKeyLen": intSetting("KV key length, 0 - no limit", 0, 1<<20,
+		func() int64 { return int64(config.Limits.MaxKeyLen) }, func(n int64) { config.Limits.MaxKeyLen = int(n) }, nil),
+	"MaxCounterLen": intSetting("atomic counter ID length, 0 - no limit", 0, 1<<20,
+		func() int64 { return int64(config.Limits.MaxCounterLen) }, func(n int64) { config.Limits.MaxCounterLen = int(n) }, nil),
+	"VerifyChecksums": boolSetting("verify checksums of KV values on read", &config.VerifyChecksums),
+	"PersistLocks":    boolSetting("write extensions of fast locks to disk", &config.PersistLocks),
+}
+
+// values of the settings from config file, to revert to
+var fileSettings = map[string]json.RawMessage{}
+
+// settingsMu serializes changes of settings
+var settingsMu sync.Mutex
+
+type SettingInfo struct {
+	Name        string
+	Value       json.RawMessage
+	File        json.RawMessage // value from config file
+	Description string
+	Changed     int64  `json:",omitempty"` // when value was changed via API
+	By          string `json:",omitempty"`
+}
+
+type SettingChange struct {
+	Name string
+	Old  json.RawMessage `json:",omitempty"` // empty - value of config file
+	New  json.RawMessage `json:",omitempty"` // empty - reverted to config file
+	At   int64
+	By   string `json:",omitempty"`
+}
+
+func settingValue(s runtimeSetting) json.RawMessage {
+	d, _ := json.Marshal(s.get())
+	return d
+}
+
+// InitSettings applies values changed via API over the config file, call before settings are used
+func InitSettings() {
+	for name, s := range settings {
+		fileSettings[name] = settingValue(s)
+	}
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.SettingsPrefix},
+		UpperBound: []byte{cd.SettingsPrefix + 1},
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer iter.Close()
+	for iter.First(); iter.Valid(); iter.Next() {
+		name := string(bytes.TrimPrefix(iter.Key(), compID(cd.SettingsPrefix, "", "")))
+		s, ok := settings[name]
+		if !ok {
+			continue // setting was removed
+		}
+		var v cd.Setting
+		_, err := v.UnmarshalMsg(iter.Value())
+		if err != nil {
+			panic(err)
+		}
+		err = s.set(v.Value)
+		if err != nil {
+			panic(fmt.Sprintf("setting %v: %v", name, err))
+		}
+	}
+}
+
+func getSetting(b pebble.Reader, name string) (*cd.Setting, error) {
+	d, closer, err := b.Get(compID(cd.SettingsPrefix, "", name))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var v cd.Setting
+	_, err = v.UnmarshalMsg(d)
+	return &v, err
+}
+
+func settingLogKey(at time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(at.UnixNano()))
+	return compID(cd.SettingsLogPrefix, "", string(b))
+}
+
+// changeSetting stores new value of the setting, nil value reverts it to config file
+func changeSetting(name string, value json.RawMessage, by string) (SettingInfo, error) {
+	s, ok := settings[name]
+	if !ok {
+		return SettingInfo{}, fmt.Errorf("unknown setting %q", name)
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	cur, err := getSetting(store.DB(), name)
+	if err != nil {
+		return SettingInfo{}, err
+	}
+	now := time.Now()
+	change := cd.SettingChange{Name: name, New: value, At: now.Unix(), By: by}
+	if cur != nil {
+		change.Old = cur.Value
+	}
+	old := settingValue(s)
+	next := value
+	if next == nil {
+		next = fileSettings[name]
+	}
+	err = s.set(next)
+	if err != nil {
+		return SettingInfo{}, err
+	}
+	next = settingValue(s) // normalized
+	if value != nil {
+		change.New = next
+	}
+	b := store.DB().NewBatch()
+	if value == nil {
+		err = b.Delete(compID(cd.SettingsPrefix, "", name), pebble.NoSync)
+	} else {
+		var d []byte
+		d, err = (&cd.Setting{Value: next, Changed: now.Unix(), By: by}).MarshalMsg(nil)
+		if err == nil {
+			err = b.Set(compID(cd.SettingsPrefix, "", name), d, pebble.NoSync)
+		}
+	}
+	if err == nil {
+		var d []byte
+		d, err = change.MarshalMsg(nil)
+		if err == nil {
+			err = b.Set(settingLogKey(now), d, pebble.NoSync)
+		}
+	}
+	if err == nil {
+		err = b.Commit(pebble.Sync)
+	}
+	if err != nil {
+		s.set(old) // keep running with what is stored
+		return SettingInfo{}, err
+	}
+	if s.apply != nil {
+		s.apply()
+	}
+	return settingInfo(name, s)
+}
+
+func settingInfo(name string, s runtimeSetting) (SettingInfo, error) {
+	res := SettingInfo{Name: name, Value: settingValue(s), File: fileSettings[name], Description: s.desc}
+	cur, err := getSetting(store.DB(), name)
+	if err != nil || cur == nil {
+		return res, err
+	}
+	res.Changed, res.By = cur.Changed, cur.By
+	return res, nil
+}
+
+func writeSettingInfo(ctx *fasthttp.RequestCtx, res SettingInfo) {
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetSettingsHandler - GET /admin/settings lists runtime settings
+func GetSettingsHandler(ctx *fasthttp.RequestCtx) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	res := []SettingInfo{}
+	for name, s := range settings {
+		info, err := settingInfo(name, s)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		res = append(res, info)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// SetSettingHandler - PUT /admin/settings/:name?by= with JSON value in the body
+func SetSettingHandler(ctx *fasthttp.RequestCtx) {
+	name, _ := ctx.UserValue("name").(string)
+	body := bytes.TrimSpace(ctx.Request.Body())
+	if len(body) == 0 || !json.Valid(body) {
+		ctx.Error("body should be JSON value of the setting", 400)
+		return
+	}
+	res, err := changeSetting(name, append(json.RawMessage{}, body...), string(ctx.QueryArgs().Peek("by")))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	writeSettingInfo(ctx, res)
+}
+
+// RevertSettingHandler - DELETE /admin/settings/:name?by= reverts the setting to config file
+func RevertSettingHandler(ctx *fasthttp.RequestCtx) {
+	name, _ := ctx.UserValue("name").(string)
+	res, err := changeSetting(name, nil, string(ctx.QueryArgs().Peek("by")))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	writeSettingInfo(ctx, res)
+}
+
+// GetSettingHistoryHandler - GET /admin/settings/history?name=&limit= newest changes first
+func GetSettingHistoryHandler(ctx *fasthttp.RequestCtx) {
+	name := string(ctx.QueryArgs().Peek("name"))
+	limit := ctx.QueryArgs().GetUintOrZero("limit")
+	if limit <= 0 || limit > maxSettingHistory {
+		limit = 100
+	}
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.SettingsLogPrefix},
+		UpperBound: []byte{cd.SettingsLogPrefix + 1},
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	res := []SettingChange{}
+	for iter.Last(); iter.Valid() && len(res) < limit; iter.Prev() {
+		var c cd.SettingChange
+		_, err := c.UnmarshalMsg(iter.Value())
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if name != "" && c.Name != name {
+			continue
+		}
+		res = append(res, SettingChange{Name: c.Name, Old: c.Old, New: c.New, At: c.At, By: c.By})
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
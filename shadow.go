@@ -0,0 +1,188 @@
+// Shadow mode forwards a copy of every incoming request to another instance
+// (for ex. new version being rolled out) and compares responses in background,
+// logging divergences. Requests are mirrored by a pool of workers, requests
+// of one account are handled by the same worker in the order they finished
+// on this node. If shadow can't keep up - extra requests are dropped, so
+// production traffic is never slowed down.
+//
+// Admin requests, watches, long polls (wait) and event streams aren't
+// mirrored - they would hold workers for minutes and their responses depend
+// on timing. Responses are compared by status and body, fields of JSON
+// bodies that differ between instances anyway (handles, timestamps) are
+// ignored, see ShadowConfig.Ignore.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type ShadowConfig struct {
+	Addr    string   `yaml:"Addr"`    // host:port of the instance to mirror requests to
+	Queue   int      `yaml:"Queue"`   // max requests waiting to be mirrored, default 10000
+	Timeout int      `yaml:"Timeout"` // shadow request timeout in seconds, default 10
+	Workers int      `yaml:"Workers"` // requests mirrored concurrently, default 16
+	Ignore  []string `yaml:"Ignore"`  // JSON fields not compared, default shadowIgnore
+}
+
+// shadowIgnore are response fields that differ between instances
+var shadowIgnore = []string{"Handle", "Till", "Expires", "TTL", "At", "TS", "Wall", "Logical"}
+
+// shadowBodyPrefix is how much of diverged body is logged
+const shadowBodyPrefix = 64
+
+type shadowReq struct {
+	req    *fasthttp.Request
+	status int
+	body   []byte
+}
+
+var shadowDropped int64
+
+// shadowHandler wraps h, mirroring requests if shadow address is configured
+func shadowHandler(cfg ShadowConfig, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if cfg.Addr == "" {
+		return h
+	}
+	if cfg.Queue <= 0 {
+		cfg.Queue = 10000
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 16
+	}
+	if cfg.Ignore == nil {
+		cfg.Ignore = shadowIgnore
+	}
+	ignore := map[string]bool{}
+	for _, f := range cfg.Ignore {
+		ignore[f] = true
+	}
+	workers := make([]chan shadowReq, cfg.Workers)
+	for i := range workers {
+		workers[i] = make(chan shadowReq, max(cfg.Queue/cfg.Workers, 1))
+		go shadowLoop(cfg, ignore, workers[i])
+	}
+	return func(ctx *fasthttp.RequestCtx) {
+		h(ctx)
+		if ctx.Response.IsBodyStream() {
+			return // event streams aren't mirrored, reading the body would drain the stream
+		}
+		if shadowSkip(ctx) {
+			return
+		}
+		r := shadowReq{
+			req:    fasthttp.AcquireRequest(),
+			status: ctx.Response.StatusCode(),
+			body:   append([]byte{}, ctx.Response.Body()...),
+		}
+		ctx.Request.CopyTo(r.req)
+		hs := fnv.New32a()
+		hs.Write(shadowAcc(ctx.Path()))
+		select {
+		case workers[hs.Sum32()%uint32(len(workers))] <- r:
+		default:
+			fasthttp.ReleaseRequest(r.req)
+			if n := atomic.AddInt64(&shadowDropped, 1); n%1000 == 1 {
+				log.Printf("shadow: queue is full, %v requests dropped", n)
+			}
+		}
+	}
+}
+
+// shadowSkip reports whether request shouldn't be mirrored
+func shadowSkip(ctx *fasthttp.RequestCtx) bool {
+	path := ctx.Path()
+	if bytes.HasPrefix(path, []byte("/admin/")) || bytes.HasPrefix(path, []byte("/watch/")) {
+		return true
+	}
+	if w := ctx.QueryArgs().Peek("wait"); len(w) > 0 && string(w) != "0" {
+		return true
+	}
+	if body := ctx.Request.Body(); bytes.Contains(body, []byte(`"LockWait"`)) {
+		var req struct{ LockWait int }
+		return json.Unmarshal(body, &req) != nil || req.LockWait > 0
+	}
+	return false
+}
+
+// shadowAcc returns account of /db/:acc/... path, path itself otherwise
+func shadowAcc(path []byte) []byte {
+	rest, ok := bytes.CutPrefix(path, []byte("/db/"))
+	if !ok {
+		return path
+	}
+	acc, _, _ := bytes.Cut(rest, []byte("/"))
+	return acc
+}
+
+func shadowLoop(cfg ShadowConfig, ignore map[string]bool, ch chan shadowReq) {
+	c := newOutboundClient()
+	resp := fasthttp.AcquireResponse()
+	for r := range ch {
+		r.req.SetHost(cfg.Addr)
+		err := c.DoTimeout(r.req, resp, time.Second*time.Duration(cfg.Timeout))
+		uri := r.req.URI().RequestURI()
+		if err != nil {
+			log.Printf("shadow: %s %s: %v", r.req.Header.Method(), uri, err)
+		} else if resp.StatusCode() != r.status || !shadowEqual(r.body, resp.Body(), ignore) {
+			log.Printf("shadow: divergence %s %s: status %v != %v, body %s != %s",
+				r.req.Header.Method(), uri, r.status, resp.StatusCode(), shadowBody(r.body), shadowBody(resp.Body()))
+		}
+		fasthttp.ReleaseRequest(r.req)
+		resp.Reset()
+	}
+}
+
+// shadowEqual compares response bodies, ignored fields of JSON bodies are
+// skipped at any depth
+func shadowEqual(a, b []byte, ignore map[string]bool) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(shadowStrip(va, ignore), shadowStrip(vb, ignore))
+}
+
+func shadowStrip(v interface{}, ignore map[string]bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if ignore[k] {
+				delete(t, k)
+				continue
+			}
+			t[k] = shadowStrip(e, ignore)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = shadowStrip(e, ignore)
+		}
+	}
+	return v
+}
+
+// shadowBody describes body for the log - size, hash and short prefix
+func shadowBody(b []byte) string {
+	h := fnv.New32a()
+	h.Write(b)
+	s := strconv.Quote(string(b[:min(len(b), shadowBodyPrefix)]))
+	if len(b) > shadowBodyPrefix {
+		s += "..."
+	}
+	return fmt.Sprintf("[%d bytes %08x %s]", len(b), h.Sum32(), s)
+}
@@ -0,0 +1,162 @@
+// Snowflake IDs are 64-bit unique IDs ordered by the time they were issued:
+// milliseconds since snowflakeEpoch, NodeID of the instance and a counter
+// within the millisecond, so up to 4096 IDs per millisecond per generator.
+// Instances issuing IDs of the same generator must have different NodeID.
+//
+// Like timestamp oracle generator reserves a range of time ahead and
+// persists only its upper bound, so there is no disk write per call. After
+// reboot it continues from the reserved bound even if the clock went back.
+// When the clock goes back or the counter runs out IDs borrow the next
+// milliseconds, they never repeat and keep increasing.
+//
+// SnowflakePrefix|Account|0|ID - reserved bound, ms since snowflakeEpoch
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	snowflakeEpoch    = int64(1577836800000) // 2020-01-01 UTC, unix ms
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+	snowflakeReserve  = int64(3000) // ms of IDs reserved with single disk write
+	snowflakeMaxBatch = 10000
+)
+
+var snowflakeNode int64
+
+type snowflakeState struct {
+	mu     sync.Mutex
+	loaded bool
+	ms     int64 // millisecond of the last issued ID
+	seq    int64 // next counter value within ms
+	mark   int64 // all milliseconds below this one are reserved on disk
+}
+
+type SnowflakeResponse struct {
+	ID    string
+	Node  int64
+	Count int
+	IDs   []int64
+}
+
+var (
+	snowflakeMu     sync.Mutex
+	snowflakeStates = map[string]*snowflakeState{}
+)
+
+// InitSnowflake sets node part of issued IDs
+func InitSnowflake(node int) error {
+	if node < 0 || node > snowflakeMaxNode {
+		return fmt.Errorf("NodeID should be in range 0~%d", snowflakeMaxNode)
+	}
+	snowflakeNode = int64(node)
+	return nil
+}
+
+func getSnowflake(acc, id string) *snowflakeState {
+	key := acc + string([]byte{0}) + id
+	snowflakeMu.Lock()
+	defer snowflakeMu.Unlock()
+	s, ok := snowflakeStates[key]
+	if !ok {
+		s = &snowflakeState{}
+		snowflakeStates[key] = s
+	}
+	return s
+}
+
+// allocSnowflake returns n increasing IDs. IDs are returned only after
+// their time range has been reserved on disk.
+func allocSnowflake(acc, id string, n int) ([]int64, error) {
+	s := getSnowflake(acc, id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := compID(cd.SnowflakePrefix, acc, id)
+	if !s.loaded {
+		d, closer, err := store.DB().Get(key)
+		if err != nil && err != pebble.ErrNotFound {
+			return nil, err
+		}
+		if err == nil {
+			s.mark = ByteToInt64(d)
+			s.ms = s.mark
+			closer.Close()
+		}
+		s.loaded = true
+	}
+
+	now := time.Now().UnixMilli() - snowflakeEpoch
+	ms, seq := s.ms, s.seq
+	if now > ms {
+		ms, seq = now, 0
+	}
+	ids := make([]int64, n)
+	for i := range ids {
+		if seq > snowflakeMaxSeq {
+			ms, seq = ms+1, 0
+		}
+		ids[i] = ms<<(snowflakeNodeBits+snowflakeSeqBits) | snowflakeNode<<snowflakeSeqBits | seq
+		seq++
+	}
+	if ms >= s.mark {
+		mark := max(now, ms) + snowflakeReserve
+		b := store.DB().NewBatch()
+		err := store.Singleton([]byte(acc), func() error {
+			err := SetInt64(key, mark, b)
+			if err != nil {
+				return err
+			}
+			return b.Commit(pebble.NoSync)
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.mark = mark
+	}
+	s.ms, s.seq = ms, seq
+	return ids, nil
+}
+
+// SnowflakeHandler - POST /db/:acc/id/:id?n= issues n IDs (1 by default)
+func SnowflakeHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	n := 1
+	if ctx.QueryArgs().Has("n") {
+		n, err = ctx.QueryArgs().GetUint("n")
+		if err != nil || n == 0 || n > snowflakeMaxBatch {
+			ctx.Error(fmt.Sprintf("n should be in range 1~%d", snowflakeMaxBatch), 400)
+			return
+		}
+	}
+	ids, err := allocSnowflake(acc, id, n)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(SnowflakeResponse{ID: id, Node: snowflakeNode, Count: n, IDs: ids})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,196 @@
+// Key-level statistics keep creation time, last modification time and
+// number of writes for KV values, atomic counters and locks, so stale
+// locks and abandoned counters can be found. Stats cost a read and a write
+// per write, so they are tracked only with KeyStats in config.
+//
+// Account|0|Kind|0|ID - stats
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	statsKV      = "kv"
+	statsCounter = "counter"
+	statsLock    = "lock"
+)
+
+type KeyStats struct {
+	Key      string `json:",omitempty"`
+	Created  int64
+	Modified int64
+	Writes   int64
+}
+
+type StatsResponse struct {
+	Keys   []KeyStats
+	Cursor string `json:",omitempty"` // pass as ?cursor= to get next page
+}
+
+func getStats(b pebble.Reader, acc, kind, id string) (*cd.KeyStats, error) {
+	d, closer, err := b.Get(compID2(cd.StatsPrefix, acc, kind, id))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var s cd.KeyStats
+	_, err = s.UnmarshalMsg(d)
+	return &s, err
+}
+
+// touchStats records a write to the key
+func touchStats(b *pebble.Batch, acc, kind, id string) error {
+	if !config.KeyStats {
+		return nil
+	}
+	s, err := getStats(b, acc, kind, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if s == nil {
+		s = &cd.KeyStats{Created: now}
+	}
+	s.Modified = now
+	s.Writes++
+	d, err := s.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	return b.Set(compID2(cd.StatsPrefix, acc, kind, id), d, pebble.NoSync)
+}
+
+// statsNeeded reports whether features relying on stats are configured -
+// tiering picks cold values by modification time, lock alerts use it as
+// the time lock is held since
+func statsNeeded(c Config) bool {
+	if c.Tiering.URL != "" {
+		return true
+	}
+	for _, r := range c.Alerts {
+		if r.Lock != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func deleteStats(b *pebble.Batch, acc, kind, id string) error {
+	return b.Delete(compID2(cd.StatsPrefix, acc, kind, id), pebble.NoSync)
+}
+
+func getStatsKind(ctx *fasthttp.RequestCtx) (string, error) {
+	kind := ctx.UserValue("kind").(string)
+	switch kind {
+	case statsKV, statsCounter, statsLock:
+		return kind, nil
+	}
+	return "", fmt.Errorf("kind should be one of: kv, counter, lock")
+}
+
+// GetStatsHandler returns stats of a single key
+func GetStatsHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	kind, err := getStatsKind(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	s, err := getStats(store.DB(), acc, kind, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if s == nil {
+		ctx.Error("not found", 404)
+		return
+	}
+	d, err := json.Marshal(KeyStats{Key: id, Created: s.Created, Modified: s.Modified, Writes: s.Writes})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// ListStatsHandler lists stats of keys of the kind page by page,
+// optionally only keys not modified since ?before= (unix seconds)
+func ListStatsHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	kind, err := getStatsKind(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	limit, cursor, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	before := int64(ctx.QueryArgs().GetUintOrZero("before"))
+	prefix := compID2(cd.StatsPrefix, acc, kind, "")
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	res := StatsResponse{Keys: []KeyStats{}}
+	scanned := 0
+	last := ""
+	for iter.SeekGE(compID2(cd.StatsPrefix, acc, kind, cursor)); iter.Valid(); iter.Next() {
+		key := string(bytes.TrimPrefix(iter.Key(), prefix))
+		if key == cursor && cursor != "" {
+			continue
+		}
+		if len(res.Keys) == limit || scanned == maxPageSize*10 {
+			res.Cursor = last
+			break
+		}
+		scanned++
+		last = key
+		var s cd.KeyStats
+		_, err := s.UnmarshalMsg(iter.Value())
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if before > 0 && s.Modified >= before {
+			continue
+		}
+		res.Keys = append(res.Keys, KeyStats{Key: key, Created: s.Created, Modified: s.Modified, Writes: s.Writes})
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
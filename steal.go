@@ -0,0 +1,266 @@
+// Stealing breaks a stuck lock: operator force-acquires a held persistent
+// or fast lock for a new owner. Lock gets a new handle and fencing token,
+// so the previous holder can't extend or release it and writes guarded by
+// its token are rejected. Persistent lock is detached from its lease, lock
+// of a Consul session wakes up blocking queries of the key. Subscribers of
+// lock events (the previous holder included) get "steal" event with the
+// previous owner and the reason. Every steal is recorded in the audit log.
+// Stealing needs AdminToken or StealToken of config as bearer token and is
+// disabled if neither is set.
+//
+// StealLogPrefix|0|At(8 bytes BE, unix ns) - steal
+package main
+
+import (
+	"clouddragon/cd"
+	"crypto/subtle"
+	"encoding/binary"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const maxStealLog = 1000
+
+type LockStealEntry struct {
+	Acc       string
+	ID        string
+	Fast      bool            `json:",omitempty"`
+	PrevOwner json.RawMessage `json:",omitempty"`
+	PrevToken int64           `json:",omitempty"`
+	PrevLease string          `json:",omitempty"`
+	Owner     json.RawMessage `json:",omitempty"`
+	Token     int64
+	By        string `json:",omitempty"`
+	Reason    string `json:",omitempty"`
+	At        int64
+}
+
+func stealLogKey(at time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(at.UnixNano()))
+	return compID(cd.StealLogPrefix, "", string(b))
+}
+
+// checkStealAuth responds with an error unless request has admin or steal token
+func checkStealAuth(ctx *fasthttp.RequestCtx) bool {
+	if config.AdminToken == "" && config.StealToken == "" {
+		ctx.Error("lock stealing is disabled, set AdminToken or StealToken", 403)
+		return false
+	}
+	token, ok := strings.CutPrefix(string(ctx.Request.Header.Peek("Authorization")), "Bearer ")
+	for _, t := range []string{config.AdminToken, config.StealToken} {
+		if ok && t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	ctx.Error("unauthorized", 401)
+	return false
+}
+
+// commitSteal records the steal in the audit log and commits the batch
+func commitSteal(ctx *fasthttp.RequestCtx, b *pebble.Batch, s *cd.LockSteal, at time.Time) error {
+	d, err := s.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	err = b.Set(stealLogKey(at), d, pebble.NoSync)
+	if err != nil {
+		return err
+	}
+	return commitBatch(ctx, b)
+}
+
+// stealPLock gives persistent lock to the owner, returns nil if it isn't held
+func stealPLock(b *pebble.Batch, acc, id string, ttl int, owner []byte, s *cd.LockSteal) (*cd.Lock, error) {
+	l, err := getPLock(b, acc, id)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	s.PrevOwner, s.PrevToken, s.PrevLease = l.Owner, l.Token, l.Lease
+	token, err := nextPLockToken(b, acc, id)
+	if err != nil {
+		return nil, err
+	}
+	l = &cd.Lock{Handle: time.Now().UnixNano(), Token: token, Owner: owner, Till: ttlNow().Unix() + int64(ttl)}
+	d, err := l.MarshalMsg(nil)
+	if err != nil {
+		return nil, err
+	}
+	err = b.Set(compID(cd.PLockPrefix, acc, id), d, pebble.NoSync)
+	if err != nil {
+		return nil, err
+	}
+	if s.PrevLease != "" {
+		lease, err := getLease(b, acc, s.PrevLease)
+		if err != nil {
+			return nil, err
+		}
+		if lease != nil && lease.Behavior != "" {
+			err = consulTouch(b, acc, id)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return l, nil
+}
+
+// stealFastLock gives fast lock to the owner and commits the batch, returns
+// nil if it isn't held. Shard is locked till the commit, so the lock is
+// changed in memory only if it's written to disk as well.
+func stealFastLock(ctx *fasthttp.RequestCtx, b *pebble.Batch, acc, id string, ttl int, owner []byte, s *cd.LockSteal, at time.Time) (*cd.Lock, error) {
+	cid := acc + string([]byte{0}) + id
+	km := chooseLock(cid)
+	km.l.Lock()
+	defer km.l.Unlock()
+	prev, ok := km.m[cid]
+	if !ok || prev.released {
+		return nil, nil
+	}
+	s.Fast, s.PrevOwner = true, prev.owner
+	token, err := nextFenceToken(b, acc, id)
+	if err != nil {
+		return nil, err
+	}
+	l := &cd.Lock{Handle: atomic.AddInt64(&handleCounter, 1), Till: ttlNow().Unix() + int64(ttl), Token: token, Owner: owner}
+	d, err := l.MarshalMsg(nil)
+	if err != nil {
+		return nil, err
+	}
+	err = b.Set(compID(cd.LocksPrefix, acc, id), d, pebble.NoSync)
+	if err != nil {
+		return nil, err
+	}
+	s.Token = l.Token
+	err = commitSteal(ctx, b, s, at)
+	if err != nil {
+		return nil, err
+	}
+	if !isDryRun(ctx) {
+		km.steal(cid, prev, l.Handle, ttl, owner, s.Reason)
+	}
+	return l, nil
+}
+
+// StealLockHandler - POST /admin/steal/:acc/:id?ttl=&by=&reason= with owner
+// metadata in the body takes held lock (persistent one first) for a new owner
+func StealLockHandler(ctx *fasthttp.RequestCtx) {
+	if !checkStealAuth(ctx) {
+		return
+	}
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl, err := getPLockTTL(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	owner := append([]byte{}, ctx.Request.Body()...)
+	now := time.Now()
+	s := cd.LockSteal{
+		Acc:    acc,
+		ID:     id,
+		Owner:  owner,
+		By:     string(ctx.QueryArgs().Peek("by")),
+		Reason: string(ctx.QueryArgs().Peek("reason")),
+		At:     now.Unix(),
+	}
+	var l *cd.Lock
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = stealPLock(b, acc, id, ttl, owner, &s)
+		if err != nil {
+			return err
+		}
+		if l != nil {
+			s.Token = l.Token
+			return commitSteal(ctx, b, &s, now)
+		}
+		l, err = stealFastLock(ctx, b, acc, id, ttl, owner, &s, now)
+		if err != nil || l != nil {
+			return err
+		}
+		return b.Close()
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if l == nil {
+		ctx.Error("lock is not held", 404)
+		return
+	}
+	if !s.Fast && !isDryRun(ctx) { // fast lock published the event while it was stolen
+		cid := acc + string([]byte{0}) + id
+		km := chooseLock(cid)
+		km.l.Lock()
+		lockEvents.publishEvent(cid, LockEvent{Type: lockStolen, Till: l.Till, Owner: ownerJSON(owner), Previous: ownerJSON(s.PrevOwner), Reason: s.Reason})
+		km.l.Unlock()
+	}
+	writePLockResponse(ctx, PLockResponse{ID: id, Locked: true, Fast: s.Fast, Till: l.Till, Token: l.Token, Owner: ownerJSON(l.Owner), Handle: l.Handle})
+}
+
+// GetStealLogHandler - GET /admin/steals?acc=&limit= lists stolen locks, newest first
+func GetStealLogHandler(ctx *fasthttp.RequestCtx) {
+	if !checkStealAuth(ctx) {
+		return
+	}
+	acc := string(ctx.QueryArgs().Peek("acc"))
+	limit := ctx.QueryArgs().GetUintOrZero("limit")
+	if limit <= 0 || limit > maxStealLog {
+		limit = 100
+	}
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.StealLogPrefix},
+		UpperBound: []byte{cd.StealLogPrefix + 1},
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	res := []LockStealEntry{}
+	for iter.Last(); iter.Valid() && len(res) < limit; iter.Prev() {
+		var s cd.LockSteal
+		_, err := s.UnmarshalMsg(iter.Value())
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if acc != "" && s.Acc != acc {
+			continue
+		}
+		res = append(res, LockStealEntry{
+			Acc:       s.Acc,
+			ID:        s.ID,
+			Fast:      s.Fast,
+			PrevOwner: ownerJSON(s.PrevOwner),
+			PrevToken: s.PrevToken,
+			PrevLease: s.PrevLease,
+			Owner:     ownerJSON(s.Owner),
+			Token:     s.Token,
+			By:        s.By,
+			Reason:    s.Reason,
+			At:        s.At,
+		})
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -22,16 +22,19 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"hash/fnv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/pebble"
 )
 
+var ErrStopped = errors.New("DB stopped")
+
 type Store struct {
-	db      *pebble.DB
+	db      atomic.Pointer[dbRef] // swapped by Switch
 	kmu     []*kmutex
 	nf      []*notifier
 	mu      sync.Mutex
@@ -39,7 +42,15 @@ type Store struct {
 	b       *pebble.Batch
 	count   int  // number of requests processed from last WAL write
 	stopped bool // graceful shudown
+	paused  bool // writes are paused during data directory switch
+	fenced  bool // newer epoch seen, writes are refused
 	pending int  // number of requests inflight (track for graceful shutdown)
+	writers int  // number of write requests and background writes in flight
+
+	lastFlush time.Duration // duration of last WAL write
+	lastCount int           // number of requests flushed by last WAL write
+	flushes   flushStats
+	writes    map[string]int64 // by account, for hot account detection
 }
 type SchedQueueMsg struct {
 	QID  string `json:"qid,omitempty"` // id of the queue
@@ -52,12 +63,21 @@ type SchedQueueMsg struct {
 // boost to performance
 const mCount = 100
 
+// dbRef counts users of the DB, so Switch can close the old one after
+// the last of them is done
+type dbRef struct {
+	db    *pebble.DB
+	users atomic.Int64
+}
+
 func NewStore(db *pebble.DB) *Store {
 	s := &Store{
-		db:   db,
-		done: make(chan struct{}),
-		b:    db.NewBatch(),
+		done:    make(chan struct{}),
+		b:       db.NewBatch(),
+		flushes: newFlushStats(),
+		writes:  map[string]int64{},
 	}
+	s.db.Store(&dbRef{db: db})
 	for i := 0; i < mCount; i++ {
 		s.kmu = append(s.kmu, newLocker())
 	}
@@ -67,6 +87,44 @@ func NewStore(db *pebble.DB) *Store {
 	return s
 }
 
+// DB returns current DB. Code that reads or writes it outside of HTTP
+// handlers should acquire it (or beginWrite) for the duration of use.
+func (p *Store) DB() *pebble.DB {
+	return p.db.Load().db
+}
+
+// acquire marks current DB as used till release is called
+func (p *Store) acquire() (release func()) {
+	for {
+		ref := p.db.Load()
+		ref.users.Add(1)
+		if p.db.Load() == ref {
+			return func() { ref.users.Add(-1) }
+		}
+		ref.users.Add(-1) // switched meanwhile, Switch might not see us
+	}
+}
+
+// beginWrite acquires DB for the write outside of Singleton, writes that
+// create batch before Singleton or don't use it at all should be done
+// between beginWrite and release, so Switch can wait for them.
+func (p *Store) beginWrite() (release func(), err error) {
+	p.mu.Lock()
+	if p.stopped || p.paused {
+		p.mu.Unlock()
+		return nil, ErrStopped
+	}
+	p.writers++
+	p.mu.Unlock()
+	done := p.acquire()
+	return func() {
+		done()
+		p.mu.Lock()
+		p.writers--
+		p.mu.Unlock()
+	}, nil
+}
+
 // Flush ensure that all in-memory writes that happened before had
 // been flushed to persistent storage.
 // In this code writes are written as "async" pebble writes, which
@@ -80,11 +138,15 @@ func (p *Store) Flush() int {
 	done := p.done // all previous updates are waiting on this chan
 	pending := p.pending
 	b := p.b
-	p.b = p.db.NewBatch()
+	ref := p.db.Load() // swapped together with p.b
+	ref.users.Add(1)
+	defer ref.users.Add(-1)
+	p.b = ref.db.NewBatch()
 	p.done = make(chan struct{}) // create new chan for future updates to wait on
 	p.mu.Unlock()
 
 	if count > 0 {
+		start := time.Now()
 		err := b.LogData([]byte("f"), pebble.Sync)
 		if err != nil {
 			panic(err)
@@ -93,6 +155,11 @@ func (p *Store) Flush() int {
 		if err != nil {
 			panic(err)
 		}
+		p.mu.Lock()
+		p.lastFlush = time.Since(start)
+		p.lastCount = count
+		p.flushes.record(p.lastFlush, count)
+		p.mu.Unlock()
 	}
 	close(done)
 	return pending
@@ -143,6 +210,7 @@ func (p *Store) singletonUpdate(key []byte, f SingletonFunc) error {
 		kid := h.Sum64()
 		p.kmu[kid%mCount].Lock(kid)
 		defer p.kmu[kid%mCount].Unlock(kid)
+		defer rcache.written(key) // see cache.go
 	}
 	return f()
 }
@@ -159,12 +227,17 @@ func (p *Store) notifier(key string) *notifier {
 // SingletonFunc will simply call Store
 func (p *Store) Singleton(key []byte, f SingletonFunc) error {
 	p.mu.Lock()
-	if p.stopped {
+	if p.stopped || p.paused {
 		p.mu.Unlock()
-		return fmt.Errorf("DB stopped")
+		return ErrStopped
+	}
+	if p.fenced {
+		p.mu.Unlock()
+		return ErrFenced
 	}
 	p.pending++
 	p.count++
+	p.countWrite(key)
 	p.mu.Unlock()
 
 	defer func() {
@@ -186,6 +259,25 @@ func (p *Store) Singleton(key []byte, f SingletonFunc) error {
 	return nil
 }
 
+// Fence refuses all further writes
+func (p *Store) Fence() {
+	p.mu.Lock()
+	p.fenced = true
+	p.mu.Unlock()
+}
+
+func (p *Store) Unfence() {
+	p.mu.Lock()
+	p.fenced = false
+	p.mu.Unlock()
+}
+
+func (p *Store) Fenced() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fenced
+}
+
 // copied this implementation from someone on the web
 type kmutex struct {
 	c *sync.Cond
@@ -0,0 +1,156 @@
+// Blue/green switching of data directory. Writes are paused, current
+// DB is checkpointed (hard-linked) into the new DBPath, new DB is opened
+// (optionally upgrading storage format) and starts serving requests.
+// Writes are unavailable only for the duration of checkpoint + open.
+//
+// Pause covers whole write requests (any method but GET and HEAD) and
+// background writes, not only Store.Singleton - batch created on the old
+// DB must not be committed after the switch. Write requests in flight are
+// given switchDrainTimeout to finish, otherwise switch fails. Every request
+// and background job holds reference to the DB it started with, old DB is
+// closed after the last of them is done.
+//
+// DBPath in config.yml should be updated afterwards, otherwise old
+// directory will be opened after restart.
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const switchDrainTimeout = 10 * time.Second
+
+type SwitchRequest struct {
+	DBPath             string
+	FormatMajorVersion pebble.FormatMajorVersion // 0 - keep current format
+}
+
+type SwitchResponse struct {
+	DBPath             string
+	FormatMajorVersion pebble.FormatMajorVersion
+	Paused             string // duration writes were unavailable
+}
+
+// Switch moves the store to a new data directory.
+func (p *Store) Switch(path string, format pebble.FormatMajorVersion) error {
+	p.mu.Lock()
+	if p.stopped || p.paused {
+		p.mu.Unlock()
+		return ErrStopped
+	}
+	p.paused = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.paused = false
+		p.mu.Unlock()
+	}()
+
+	// wait till all writes in flight are done and flushed
+	deadline := time.Now().Add(switchDrainTimeout)
+	for {
+		p.mu.Lock()
+		pending := p.pending + p.writers
+		p.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d writes in flight didn't finish in %v", pending, switchDrainTimeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	path, err := filepath.Abs(path) // checkpoint fails to sync parent of relative path
+	if err != nil {
+		return err
+	}
+	err = p.DB().Checkpoint(path, pebble.WithFlushedWAL())
+	if err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	opts := config.DBOptions
+	opts.WALDir = "" // checkpoint has its WAL inside, WAL dir is used by the old DB
+	db, err := pebble.Open(path, &opts)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	if format > db.FormatMajorVersion() {
+		err = db.RatchetFormatMajorVersion(format)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("upgrade format: %w", err)
+		}
+	}
+	p.mu.Lock()
+	old := p.db.Swap(&dbRef{db: db})
+	p.b = db.NewBatch()
+	p.mu.Unlock()
+
+	go func() {
+		for old.users.Load() > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		err := old.db.Close()
+		if err != nil {
+			log.Print("failed to close old db: ", err)
+		}
+	}()
+	return nil
+}
+
+// dbHandler holds reference to the DB for the duration of the request,
+// write requests are refused while writes are paused
+func dbHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if ctx.IsGet() || ctx.IsHead() || string(ctx.Path()) == "/admin/switch" {
+			release := store.acquire()
+			defer release()
+			h(ctx)
+			return
+		}
+		release, err := store.beginWrite()
+		if err != nil {
+			ctx.Error(err.Error(), 503)
+			return
+		}
+		defer release()
+		h(ctx)
+	}
+}
+
+func SwitchHandler(ctx *fasthttp.RequestCtx) {
+	var req SwitchRequest
+	err := json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if req.DBPath == "" {
+		ctx.Error("DBPath is empty", 400)
+		return
+	}
+	start := time.Now()
+	err = store.Switch(req.DBPath, req.FormatMajorVersion)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	log.Print("switched to ", req.DBPath)
+	d, err := json.Marshal(SwitchResponse{
+		DBPath:             req.DBPath,
+		FormatMajorVersion: store.DB().FormatMajorVersion(),
+		Paused:             time.Since(start).String(),
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
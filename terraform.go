@@ -0,0 +1,234 @@
+// Terraform HTTP state backend. State is kept as KV value "tfstate/<name>"
+// and the lock as persistent lock of the same ID with Terraform lock info
+// as its owner, so both survive restarts. Terraform doesn't refresh locks,
+// lock expires after ?ttl= seconds of the lock address (default 30 days),
+// stale locks are released with terraform force-unlock.
+//
+//	terraform {
+//	  backend "http" {
+//	    address        = "http://cd:8080/tf/my_env/network"
+//	    lock_address   = "http://cd:8080/tf/my_env/network"
+//	    unlock_address = "http://cd:8080/tf/my_env/network"
+//	  }
+//	}
+package main
+
+import (
+	"clouddragon/cd"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const tfStatePrefix = "tfstate/"
+
+const tfLockTTL = 86400 * 30
+
+// TFLockInfo is the part of Terraform lock info we need, the rest is stored as is
+type TFLockInfo struct {
+	ID string
+}
+
+func tfLockID(owner []byte) string {
+	var info TFLockInfo
+	json.Unmarshal(owner, &info)
+	return info.ID
+}
+
+// tfLocked responds with 423 and info of the current lock, like Terraform expects
+func tfLocked(ctx *fasthttp.RequestCtx, l *cd.Lock) {
+	ctx.SetStatusCode(423)
+	ctx.SetContentType("application/json")
+	ctx.Response.SetBody(l.Owner)
+}
+
+func getTFArgs(ctx *fasthttp.RequestCtx) (string, string, error) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return acc, tfStatePrefix + id, nil
+}
+
+// GetTFStateHandler - GET /tf/:acc/:name returns the state, 404 if there is none yet
+func GetTFStateHandler(ctx *fasthttp.RequestCtx) {
+	acc, key, err := getTFArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	v, err := getKV(store.DB(), acc, key)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if v == nil {
+		ctx.Error("not found", 404)
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.Response.SetBody(v.Data)
+}
+
+// writeTFState writes or deletes the state if it isn't locked by another ?ID=
+func writeTFState(ctx *fasthttp.RequestCtx, del bool) {
+	acc, key, err := getTFArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	lockID := string(ctx.QueryArgs().Peek("ID"))
+	kv := &KV{Key: key, Delete: del, ContentType: "application/json"}
+	if !del {
+		kv.Value = append(json.RawMessage{}, ctx.Request.Body()...)
+		err = checkValueSize(accountLimits(acc), kv.Value)
+		if err != nil {
+			retryError(ctx, acc, "", err)
+			return
+		}
+	}
+	var l *cd.Lock
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = getPLock(b, acc, key)
+		if err != nil {
+			return err
+		}
+		if l != nil && tfLockID(l.Owner) != lockID {
+			return b.Close()
+		}
+		seqID := compID1(cd.VerSequencePrefix, acc)
+		seq, err := GetInt64(seqID, b)
+		if err != nil {
+			return err
+		}
+		kv.Version = 1
+		if seq != nil {
+			kv.Version = *seq
+		}
+		err = handleKVSet(acc, b, kv)
+		if err != nil {
+			return err
+		}
+		err = SetInt64(seqID, kv.Version+1, b)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if l != nil && tfLockID(l.Owner) != lockID {
+		tfLocked(ctx, l)
+		return
+	}
+	store.notifier(acc).NotifyVersion(key, kv.Version)
+}
+
+// SetTFStateHandler - POST /tf/:acc/:name?ID= stores the state
+func SetTFStateHandler(ctx *fasthttp.RequestCtx) {
+	writeTFState(ctx, false)
+}
+
+// DeleteTFStateHandler - DELETE /tf/:acc/:name?ID= deletes the state
+func DeleteTFStateHandler(ctx *fasthttp.RequestCtx) {
+	writeTFState(ctx, true)
+}
+
+// TFLockHandler - LOCK /tf/:acc/:name?ttl= with Terraform lock info in the body
+func TFLockHandler(ctx *fasthttp.RequestCtx) {
+	acc, key, err := getTFArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ttl := tfLockTTL
+	if ctx.QueryArgs().Has("ttl") {
+		ttl, err = getPLockTTL(ctx)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+	}
+	owner := append([]byte{}, ctx.Request.Body()...)
+	id := tfLockID(owner)
+	if id == "" {
+		ctx.Error("body should be lock info with ID", 400)
+		return
+	}
+	var l *cd.Lock
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = getPLock(b, acc, key)
+		if err != nil {
+			return err
+		}
+		if l != nil { // already locked, by us or someone else
+			return b.Close()
+		}
+		token, err := nextPLockToken(b, acc, key)
+		if err != nil {
+			return err
+		}
+		c := cd.Lock{Handle: time.Now().UnixNano(), Token: token, Owner: owner, Till: ttlNow().Unix() + int64(ttl)}
+		d, err := c.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		err = b.Set(compID(cd.PLockPrefix, acc, key), d, pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if l != nil && tfLockID(l.Owner) != id {
+		tfLocked(ctx, l)
+		return
+	}
+}
+
+// TFUnlockHandler - UNLOCK /tf/:acc/:name releases the lock with ID from the body
+func TFUnlockHandler(ctx *fasthttp.RequestCtx) {
+	acc, key, err := getTFArgs(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id := tfLockID(ctx.Request.Body())
+	var l *cd.Lock
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		l, err = getPLock(b, acc, key)
+		if err != nil {
+			return err
+		}
+		if l == nil || tfLockID(l.Owner) != id {
+			return b.Close()
+		}
+		err = b.Delete(compID(cd.PLockPrefix, acc, key), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		retryError(ctx, acc, "", err)
+		return
+	}
+	if l != nil && tfLockID(l.Owner) != id {
+		tfLocked(ctx, l)
+		return
+	}
+}
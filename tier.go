@@ -0,0 +1,229 @@
+// Cold data tiering moves KV values that weren't modified for Days to
+// object storage over HTTP (PUT/GET to URL/account/key/version, for ex.
+// S3-compatible gateway or presigning proxy). Pebble keeps a stub with
+// the object URL, value is fetched back transparently on read and
+// verified by its checksum. Writes replace the stub as usual - objects
+// of overwritten and deleted values are not removed from the storage.
+// Reads don't update key stats, so last modification time is used
+// instead of last access time.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type TieringConfig struct {
+	URL      string            `yaml:"URL"`      // base URL of the bucket, empty disables tiering
+	Days     int               `yaml:"Days"`     // move values not modified for Days, default 30
+	MinSize  int               `yaml:"MinSize"`  // smaller values stay local, default 4096 bytes
+	Interval int               `yaml:"Interval"` // hours between runs, default 24
+	Headers  map[string]string `yaml:"Headers"`  // added to every request, for ex. Authorization
+}
+
+var tierClient = &fasthttp.Client{}
+
+const tierTimeout = time.Second * 30
+
+func tierRequest(method, u string, body []byte) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(u)
+	req.Header.SetMethod(method)
+	for k, v := range config.Tiering.Headers {
+		req.Header.Set(k, v)
+	}
+	req.SetBody(body)
+	err := tierClient.DoTimeout(req, resp, tierTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() >= 300 {
+		return nil, fmt.Errorf("%v %v returned %v", method, u, resp.StatusCode())
+	}
+	return append([]byte{}, resp.Body()...), nil
+}
+
+// loadCold fetches value of the stub from object storage
+func loadCold(v *cd.KV) error {
+	if !v.Cold {
+		return nil
+	}
+	d, err := tierRequest("GET", string(v.Data), nil)
+	if err != nil {
+		return fmt.Errorf("load cold value: %w", err)
+	}
+	if v.Sum != 0 && v.Sum != crc32.Checksum(d, crcTable) {
+		return cd.ErrChecksum
+	}
+	v.Data, v.Cold = d, false
+	return nil
+}
+
+func coldURL(acc, key string, version int64) string {
+	return strings.TrimSuffix(config.Tiering.URL, "/") + "/" + url.PathEscape(acc) + "/" +
+		url.PathEscape(key) + "/" + strconv.FormatInt(version, 10)
+}
+
+// tierValue uploads the value and replaces it with stub, unless it was changed in the meantime
+func tierValue(acc, key string, v cd.KV) error {
+	u := coldURL(acc, key, v.Version)
+	_, err := tierRequest("PUT", u, v.Data)
+	if err != nil {
+		return err
+	}
+	b := store.DB().NewIndexedBatch()
+	return store.Singleton([]byte(acc), func() error {
+		d, closer, err := b.Get(compID(cd.KVPrefix, acc, key))
+		if err == pebble.ErrNotFound {
+			return b.Close()
+		}
+		if err != nil {
+			return err
+		}
+		var cur cd.KV
+		_, err = cur.UnmarshalMsg(d)
+		closer.Close()
+		if err != nil {
+			return err
+		}
+		if cur.Version != v.Version || cur.Cold {
+			return b.Close()
+		}
+		cur.Data, cur.Cold = []byte(u), true
+		d, err = cur.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		err = b.Set(compID(cd.KVPrefix, acc, key), d, pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return b.Commit(pebble.NoSync)
+	})
+}
+
+// tierCold moves all cold values to object storage, returns number of values moved
+func tierCold(cfg TieringConfig) (int, error) {
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	iter, err := snap.NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.KVPrefix},
+		UpperBound: []byte{cd.KVPrefix + 1},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+	before := time.Now().Unix() - int64(cfg.Days)*86400
+	n := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		k := iter.Key()[1:]
+		i := bytes.IndexByte(k, 0)
+		if i < 0 {
+			continue
+		}
+		acc, key := string(k[:i]), string(k[i+1:])
+		var v cd.KV
+		_, err := v.UnmarshalMsg(iter.Value())
+		if err != nil {
+			return n, err
+		}
+		if v.Cold || v.Expires != 0 || len(v.Data) < cfg.MinSize {
+			continue
+		}
+		st, err := getStats(snap, acc, statsKV, key)
+		if err != nil {
+			return n, err
+		}
+		if st != nil && st.Modified > before {
+			continue
+		}
+		v.Data = append([]byte{}, v.Data...)
+		err = tierValue(acc, key, v)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func tieringDefaults(cfg TieringConfig) TieringConfig {
+	if cfg.Days <= 0 {
+		cfg.Days = 30
+	}
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = 4096
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24
+	}
+	return cfg
+}
+
+var tierMu sync.Mutex // single run at a time
+
+func runTiering(cfg TieringConfig) (int, error) {
+	if !tierMu.TryLock() {
+		return 0, fmt.Errorf("tiering is running")
+	}
+	defer tierMu.Unlock()
+	return tierCold(tieringDefaults(cfg))
+}
+
+func TierLoop(cfg TieringConfig) {
+	if cfg.URL == "" {
+		return
+	}
+	cfg = tieringDefaults(cfg)
+	for range time.Tick(time.Hour * time.Duration(cfg.Interval)) {
+		release, err := store.beginWrite()
+		if err != nil {
+			continue // writes are paused or stopped
+		}
+		n, err := runTiering(cfg)
+		release()
+		if err != nil {
+			log.Print("tiering: ", err)
+		}
+		log.Printf("tiering: moved %v values to object storage", n)
+	}
+}
+
+type TierResponse struct {
+	Moved int
+}
+
+// TierHandler - POST /admin/tier moves cold values to object storage right away
+func TierHandler(ctx *fasthttp.RequestCtx) {
+	if config.Tiering.URL == "" {
+		ctx.Error("tiering is not configured", 400)
+		return
+	}
+	n, err := runTiering(config.Tiering)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(TierResponse{Moved: n})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
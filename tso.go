@@ -0,0 +1,134 @@
+// Timestamp oracle issues strictly increasing timestamps per account
+// (Percolator-style). Timestamp is physical time in milliseconds shifted
+// by tsoLogicalBits, lower bits are used as a counter, so single millisecond
+// can fit ~260k timestamps.
+//
+// Instead of writing every timestamp to disk we reserve a range ahead of
+// time and persist only the upper bound of that range. After reboot oracle
+// continues from the reserved bound, skipping the unused part of the range.
+package main
+
+import (
+	"clouddragon/cd"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	tsoLogicalBits = 18
+	tsoReserve     = int64(3000) // ms of timestamps reserved with single disk write
+	tsoMaxBatch    = 100000
+)
+
+type tsoState struct {
+	mu     sync.Mutex
+	loaded bool
+	last   int64 // last issued timestamp
+	mark   int64 // all timestamps below this one are reserved on disk
+}
+
+type TSOResponse struct {
+	First int64
+	Last  int64
+	Count int
+}
+
+var (
+	tsoMu     sync.Mutex
+	tsoStates = map[string]*tsoState{}
+)
+
+func getTSO(acc string) *tsoState {
+	tsoMu.Lock()
+	defer tsoMu.Unlock()
+	s, ok := tsoStates[acc]
+	if !ok {
+		s = &tsoState{}
+		tsoStates[acc] = s
+	}
+	return s
+}
+
+// allocTSO returns n consecutive timestamps. Range is returned only
+// after it has been reserved on disk.
+func allocTSO(acc string, n int) (TSOResponse, error) {
+	s := getTSO(acc)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		d, closer, err := store.DB().Get(compID1(cd.TSOPrefix, acc))
+		if err != nil && err != pebble.ErrNotFound {
+			return TSOResponse{}, err
+		}
+		if err == nil {
+			s.mark = ByteToInt64(d)
+			s.last = s.mark
+			closer.Close()
+		}
+		s.loaded = true
+	}
+
+	now := time.Now().UnixMilli()
+	first := now << tsoLogicalBits
+	if first <= s.last {
+		first = s.last + 1
+	}
+	last := first + int64(n) - 1
+	if last >= s.mark {
+		mark := (now + tsoReserve) << tsoLogicalBits
+		if mark <= last {
+			mark = last + 1
+		}
+		b := store.DB().NewBatch()
+		err := store.Singleton([]byte(acc), func() error {
+			err := SetInt64(compID1(cd.TSOPrefix, acc), mark, b)
+			if err != nil {
+				return err
+			}
+			return b.Commit(pebble.NoSync)
+		})
+		if err != nil {
+			return TSOResponse{}, err
+		}
+		s.mark = mark
+	}
+	s.last = last
+	return TSOResponse{
+		First: first,
+		Last:  last,
+		Count: n,
+	}, nil
+}
+
+// TSOHandler allocates ?n= timestamps (1 by default)
+func TSOHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	n := 1
+	if ctx.QueryArgs().Has("n") {
+		n, err = ctx.QueryArgs().GetUint("n")
+		if err != nil || n == 0 || n > tsoMaxBatch {
+			ctx.Error(fmt.Sprintf("n should be in range 1~%d", tsoMaxBatch), 400)
+			return
+		}
+	}
+	res, err := allocTSO(acc, n)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,384 @@
+// KV values can expire after TTL seconds. Expired values are hidden from
+// reads right away and deleted by the sweeper in background.
+// Sweeper deletes values in small batches per account, so it never holds
+// the account for long and doesn't block the flush loop. Operators can
+// preview keys of the account expiring soon and inspect TTL of a key.
+//
+// Sweeper scans expiration index of all accounts, preview scans index of
+// the account, both are updated together.
+//
+// TTLPrefix|Expires(8 bytes BE)|Account|0|Key - expiration index
+// AccTTLPrefix|Account|0|Expires(8 bytes BE)|Key - expiration index of the account
+// AccTTLPrefix - marker that index of the account was built from expiration index
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	ttlSweepBatch = 1000
+	maxTTLPreview = 7 * 24 * 60 // minutes
+)
+
+func ttlKey(expires int64, acc, key string) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(expires))
+	return compID1(cd.TTLPrefix, string(b)+acc+string([]byte{0})+key)
+}
+
+func accTTLKey(expires int64, acc, key string) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(expires))
+	return compID(cd.AccTTLPrefix, acc, string(b)+key)
+}
+
+// setTTLIndex adds (or with del removes) the key to expiration indexes
+func setTTLIndex(b *pebble.Batch, acc, key string, expires int64, del bool) error {
+	for _, k := range [][]byte{ttlKey(expires, acc, key), accTTLKey(expires, acc, key)} {
+		var err error
+		if del {
+			err = b.Delete(k, pebble.NoSync)
+		} else {
+			err = b.Set(k, nil, pebble.NoSync)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitTTLIndex builds expiration index of accounts for values stored
+// before it was introduced
+func InitTTLIndex() {
+	marker := []byte{cd.AccTTLPrefix}
+	_, closer, err := store.DB().Get(marker)
+	if err == nil {
+		closer.Close()
+		return
+	}
+	if err != pebble.ErrNotFound {
+		panic(err)
+	}
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.TTLPrefix},
+		UpperBound: []byte{cd.TTLPrefix + 1},
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer iter.Close()
+	b := store.DB().NewBatch()
+	for iter.First(); iter.Valid(); iter.Next() {
+		k := iter.Key()[1:]
+		if len(k) < 8 {
+			continue
+		}
+		acc, key, ok := strings.Cut(string(k[8:]), string([]byte{0}))
+		if !ok {
+			continue
+		}
+		err = b.Set(accTTLKey(int64(binary.BigEndian.Uint64(k[:8])), acc, key), nil, pebble.NoSync)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = b.Set(marker, nil, pebble.NoSync)
+	if err != nil {
+		panic(err)
+	}
+	err = b.Commit(pebble.Sync)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// getExpires returns expiration of currently stored value, even if it's expired
+func getExpires(b pebble.Reader, acc, key string) (int64, error) {
+	d, closer, err := b.Get(compID(cd.KVPrefix, acc, key))
+	if err == pebble.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	var v cd.KV
+	_, err = v.UnmarshalMsg(d)
+	return v.Expires, err
+}
+
+// updateTTL moves the key in expiration index from old expiration time to the new one
+func updateTTL(b *pebble.Batch, acc, key string, expires int64) error {
+	old, err := getExpires(b, acc, key)
+	if err != nil {
+		return err
+	}
+	if old == expires {
+		return nil
+	}
+	if old != 0 {
+		err = setTTLIndex(b, acc, key, old, true)
+		if err != nil {
+			return err
+		}
+	}
+	if expires == 0 {
+		return nil
+	}
+	return setTTLIndex(b, acc, key, expires, false)
+}
+
+type ttlEntry struct {
+	expires int64
+	key     string
+}
+
+// sweepTTL deletes up to ttlSweepBatch expired values, returns number deleted
+func (p *Store) sweepTTL() (int, error) {
+	iter, err := p.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.TTLPrefix},
+		UpperBound: ttlKey(time.Now().Unix()+1, "", ""),
+	})
+	if err != nil {
+		return 0, err
+	}
+	byAcc := map[string][]ttlEntry{}
+	n := 0
+	for iter.First(); iter.Valid() && n < ttlSweepBatch; iter.Next() {
+		k := iter.Key()[1:]
+		if len(k) < 8 {
+			continue
+		}
+		i := bytes.IndexByte(k[8:], 0)
+		if i < 0 {
+			continue
+		}
+		acc := string(k[8 : 8+i])
+		byAcc[acc] = append(byAcc[acc], ttlEntry{
+			expires: int64(binary.BigEndian.Uint64(k[:8])),
+			key:     string(k[8+i+1:]),
+		})
+		n++
+	}
+	err = iter.Close()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for acc, entries := range byAcc {
+		b := p.DB().NewIndexedBatch()
+		err := p.Singleton([]byte(acc), func() error {
+			for _, e := range entries {
+				exp, err := getExpires(b, acc, e.key)
+				if err != nil {
+					return err
+				}
+				if exp != e.expires { // value was overwritten in the meantime
+					err = setTTLIndex(b, acc, e.key, e.expires, true)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				err = handleKVSet(acc, b, &KV{Key: e.key, Delete: true})
+				if err != nil {
+					return err
+				}
+				deleted++
+			}
+			return b.Commit(pebble.NoSync)
+		})
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// SweepLoop deletes expired values and idempotency IDs and revokes expired leases every second
+func (p *Store) SweepLoop() {
+	t := time.NewTicker(time.Second)
+	for range t.C {
+		release, err := p.beginWrite()
+		if err != nil {
+			continue // writes are paused or stopped
+		}
+		p.sweep()
+		release()
+	}
+}
+
+// sweep deletes expired values and idempotency IDs and revokes expired leases
+func (p *Store) sweep() {
+	for {
+		n, err := p.sweepTTL()
+		if err != nil {
+			log.Print("ttl sweep: ", err)
+		}
+		if n < ttlSweepBatch || err != nil {
+			break
+		}
+	}
+	_, err := p.sweepLeases()
+	if err != nil {
+		log.Print("lease sweep: ", err)
+	}
+	for {
+		n, err := p.sweepIdempotency()
+		if err != nil {
+			log.Print("idempotency sweep: ", err)
+		}
+		if n < ttlSweepBatch || err != nil {
+			break
+		}
+	}
+}
+
+type ExpiringKey struct {
+	Key     string
+	Expires int64 `json:",omitempty"` // unix seconds, 0 - never
+	TTL     int64 `json:",omitempty"` // seconds left
+}
+
+type ListExpiringResponse struct {
+	Keys   []ExpiringKey // soonest first
+	Cursor string        `json:",omitempty"` // pass as ?cursor= to get next page
+}
+
+// parseTTLCursor parses Expires:Key cursor of the expiration preview
+func parseTTLCursor(cursor string) (int64, string, error) {
+	exp, key, ok := strings.Cut(cursor, ":")
+	if !ok {
+		return 0, "", fmt.Errorf("invalid cursor")
+	}
+	e, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid cursor")
+	}
+	return e, key, nil
+}
+
+// ListExpiringHandler - GET /db/:acc/ttl?within=&limit=&cursor= lists KV keys
+// expiring within the next ?within= minutes (60 by default).
+func ListExpiringHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	limit, cursor, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	within := 60
+	if ctx.QueryArgs().Has("within") {
+		within = ctx.QueryArgs().GetUintOrZero("within")
+		if within <= 0 || within > maxTTLPreview {
+			ctx.Error(fmt.Sprintf("within should be in range 1~%d minutes", maxTTLPreview), 400)
+			return
+		}
+	}
+	now := time.Now().Unix()
+	start := accTTLKey(now+1, acc, "") // expired values are already hidden
+	var curExp int64
+	var curKey string
+	if cursor != "" {
+		curExp, curKey, err = parseTTLCursor(cursor)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if k := accTTLKey(curExp, acc, curKey); bytes.Compare(k, start) > 0 {
+			start = k
+		}
+	}
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: start,
+		UpperBound: accTTLKey(now+int64(within)*60+1, acc, ""),
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	prefix := compID(cd.AccTTLPrefix, acc, "")
+	res := ListExpiringResponse{Keys: []ExpiringKey{}}
+	for iter.First(); iter.Valid(); iter.Next() {
+		k := bytes.TrimPrefix(iter.Key(), prefix)
+		if len(k) < 8 {
+			continue
+		}
+		exp := int64(binary.BigEndian.Uint64(k[:8]))
+		key := string(k[8:])
+		if cursor != "" && exp == curExp && key == curKey {
+			continue
+		}
+		if len(res.Keys) == limit {
+			last := res.Keys[len(res.Keys)-1]
+			res.Cursor = strconv.FormatInt(last.Expires, 10) + ":" + last.Key
+			break
+		}
+		cur, err := getExpires(store.DB(), acc, key)
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if cur != exp { // value was overwritten, index entry is left for the sweeper
+			continue
+		}
+		res.Keys = append(res.Keys, ExpiringKey{Key: key, Expires: exp, TTL: exp - now})
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetTTLHandler - GET /db/:acc/ttl/:id returns expiration and remaining TTL of the KV key
+func GetTTLHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	v, err := cachedKV(acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if v == nil {
+		ctx.Error("not found", 404)
+		return
+	}
+	res := ExpiringKey{Key: id, Expires: v.Expires}
+	if v.Expires != 0 {
+		res.TTL = v.Expires - time.Now().Unix()
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
@@ -0,0 +1,152 @@
+// TTL clock is used for expiration of locks and leases instead of the wall
+// clock, so NTP corrections and VM pauses don't release every lock at once.
+// It's the wall clock minus an offset: every time the wall clock jumps
+// relative to the monotonic clock by more than ClockJump seconds the jump
+// is added to the offset, so TTL clock keeps counting at the monotonic pace
+// and held locks and leases expire after their real durations. Jumps are
+// logged and listed in GET /admin/clock. Offset is persisted, expirations
+// stored on disk stay valid after restart.
+//
+// Till values of locks and leases in responses are TTL clock times, they
+// differ from wall clock by Offset after a jump.
+//
+// ClockOffsetPrefix - offset in milliseconds
+package main
+
+import (
+	"clouddragon/cd"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultClockJump = 1 // seconds
+	maxClockJumps    = 100
+)
+
+type ClockJump struct {
+	At   int64 // unix milliseconds of wall clock after the jump
+	Jump int64 // milliseconds, negative - wall clock went back
+}
+
+type ClockResponse struct {
+	Wall   int64 // unix milliseconds
+	TTL    int64 // unix milliseconds of TTL clock
+	Offset int64 // Wall - TTL
+	Jumps  []ClockJump
+}
+
+type jumpClock struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	last      time.Time // previous reading with monotonic clock
+	offset    time.Duration
+	persisted time.Duration
+	jumps     []ClockJump
+}
+
+var ttlClock = &jumpClock{threshold: time.Second * defaultClockJump}
+
+// InitTTLClock loads the offset, call before locks and leases are restored
+func InitTTLClock(threshold int) {
+	if threshold > 0 {
+		ttlClock.threshold = time.Second * time.Duration(threshold)
+	}
+	d, closer, err := store.DB().Get(compID1(cd.ClockOffsetPrefix, ""))
+	if err != nil && err != pebble.ErrNotFound {
+		panic(err)
+	}
+	if err == nil {
+		ttlClock.offset = time.Duration(ByteToInt64(d)) * time.Millisecond
+		ttlClock.persisted = ttlClock.offset
+		closer.Close()
+	}
+}
+
+// ttlNow returns current time of TTL clock
+func ttlNow() time.Time {
+	return ttlClock.Now()
+}
+
+// untilTTL returns time left till unix seconds of TTL clock
+func untilTTL(till int64) time.Duration {
+	return time.Unix(till, 0).Sub(ttlNow())
+}
+
+func (c *jumpClock) Now() time.Time {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.IsZero() {
+		jump := now.Round(0).Sub(c.last.Round(0)) - now.Sub(c.last)
+		if jump > c.threshold || jump < -c.threshold {
+			c.offset += jump
+			c.jumps = append(c.jumps, ClockJump{At: now.UnixMilli(), Jump: jump.Milliseconds()})
+			if len(c.jumps) > maxClockJumps {
+				c.jumps = c.jumps[1:]
+			}
+			log.Printf("clock: wall clock jumped by %v, locks and leases keep their durations, TTL clock offset %v", jump, c.offset)
+		}
+	}
+	c.last = now
+	return now.Add(-c.offset).Round(0)
+}
+
+// persist writes changed offset to disk, called only by TTLClockLoop.
+// Mutex isn't held while writing, so clock readers don't wait for fsync.
+func (c *jumpClock) persist() error {
+	c.mu.Lock()
+	offset, persisted := c.offset, c.persisted
+	c.mu.Unlock()
+	if offset == persisted {
+		return nil
+	}
+	err := store.DB().Set(compID1(cd.ClockOffsetPrefix, ""), Int64ToByte(offset.Milliseconds()), pebble.Sync)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.persisted = offset
+	c.mu.Unlock()
+	return nil
+}
+
+// TTLClockLoop detects jumps while there are no requests and persists the offset
+func TTLClockLoop() {
+	for range time.Tick(time.Second) {
+		ttlNow()
+		release, err := store.beginWrite()
+		if err != nil {
+			continue // writes are paused or stopped
+		}
+		err = ttlClock.persist()
+		release()
+		if err != nil {
+			log.Print("clock: ", err)
+		}
+	}
+}
+
+// GetClockHandler - GET /admin/clock
+func GetClockHandler(ctx *fasthttp.RequestCtx) {
+	ttl := ttlNow()
+	ttlClock.mu.Lock()
+	res := ClockResponse{
+		Wall:   ttl.Add(ttlClock.offset).UnixMilli(),
+		TTL:    ttl.UnixMilli(),
+		Offset: ttlClock.offset.Milliseconds(),
+		Jumps:  append([]ClockJump{}, ttlClock.jumps...),
+	}
+	ttlClock.mu.Unlock()
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
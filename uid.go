@@ -0,0 +1,169 @@
+// ULIDs and UUIDv7 are 128-bit IDs sortable by creation time: unix
+// milliseconds followed by random bits. Nothing is stored, any instance can
+// issue them. IDs issued by the instance within the same millisecond
+// increment the random part of the previous ID instead (monotonic ULIDs,
+// monotonic random method of UUIDv7), so they are strictly increasing even in a
+// batch or when the clock goes back.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const uidMaxBatch = 10000
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type UIDResponse struct {
+	Count int
+	IDs   []string
+}
+
+// uidGen issues increasing random parts of 128-bit IDs
+type uidGen struct {
+	mu   sync.Mutex
+	bits int // random bits after the timestamp
+	ms   int64
+	rnd  [10]byte // big endian, only lower bits are used
+}
+
+var (
+	ulidGen  = &uidGen{bits: 80}
+	uuid7Gen = &uidGen{bits: 74}
+)
+
+func (g *uidGen) randomize() error {
+	_, err := rand.Read(g.rnd[:])
+	if err != nil {
+		return err
+	}
+	g.rnd[0] &= byte(0xff >> (81 - g.bits)) // top bit is left for increments within millisecond
+	return nil
+}
+
+// increment adds 1 to the random part, false if it overflowed
+func (g *uidGen) increment() bool {
+	for i := len(g.rnd) - 1; i >= 0; i-- {
+		g.rnd[i]++
+		if g.rnd[i] != 0 {
+			break
+		}
+	}
+	return g.rnd[0]&^byte(0xff>>(80-g.bits)) == 0 && g.rnd != [10]byte{}
+}
+
+// next calls f with timestamp and random part of n increasing IDs
+func (g *uidGen) next(n int, f func(ms int64, rnd [10]byte)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := 0; i < n; i++ {
+		now := time.Now().UnixMilli()
+		if now > g.ms {
+			g.ms = now
+			err := g.randomize()
+			if err != nil {
+				return err
+			}
+		} else if !g.increment() {
+			g.ms++ // borrow the next millisecond
+			err := g.randomize()
+			if err != nil {
+				return err
+			}
+		}
+		f(g.ms, g.rnd)
+	}
+	return nil
+}
+
+// formatULID encodes 48-bit timestamp and 80-bit random part in Crockford's base32
+func formatULID(ms int64, rnd [10]byte) string {
+	var b [16]byte
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(b[6:], rnd[:])
+	var s [26]byte
+	var acc uint32
+	bits := 2 // 130 bits of 26 chars, the first char carries 3 bits
+	k := 0
+	for _, c := range b {
+		acc = acc<<8 | uint32(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			s[k] = crockford[(acc>>bits)&31]
+			k++
+		}
+	}
+	return string(s[:])
+}
+
+// formatUUID7 lays out 48-bit timestamp, version, 12 bits of rand_a, variant and 62 bits of rand_b
+func formatUUID7(ms int64, rnd [10]byte) string {
+	var b [16]byte
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	// rnd holds 74 bits: 12 of rand_a followed by 62 of rand_b
+	hi := uint64(rnd[0])<<56 | uint64(rnd[1])<<48 | uint64(rnd[2])<<40 | uint64(rnd[3])<<32 |
+		uint64(rnd[4])<<24 | uint64(rnd[5])<<16 | uint64(rnd[6])<<8 | uint64(rnd[7])
+	lo := uint64(rnd[8])<<8 | uint64(rnd[9])
+	randA := hi >> 46 & 0xfff
+	randB := (hi<<16 | lo) & (1<<62 - 1)
+	b[6] = 0x70 | byte(randA>>8)
+	b[7] = byte(randA)
+	b[8] = 0x80 | byte(randB>>56)
+	for i := 9; i < 16; i++ {
+		b[i] = byte(randB >> (8 * (15 - i)))
+	}
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func writeUIDs(ctx *fasthttp.RequestCtx, g *uidGen, format func(int64, [10]byte) string) {
+	_, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	n := 1
+	if ctx.QueryArgs().Has("n") {
+		n, err = ctx.QueryArgs().GetUint("n")
+		if err != nil || n == 0 || n > uidMaxBatch {
+			ctx.Error(fmt.Sprintf("n should be in range 1~%d", uidMaxBatch), 400)
+			return
+		}
+	}
+	res := UIDResponse{Count: n, IDs: make([]string, 0, n)}
+	err = g.next(n, func(ms int64, rnd [10]byte) {
+		res.IDs = append(res.IDs, format(ms, rnd))
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 500)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// ULIDHandler - POST /db/:acc/ulid?n= issues n ULIDs (1 by default)
+func ULIDHandler(ctx *fasthttp.RequestCtx) {
+	writeUIDs(ctx, ulidGen, formatULID)
+}
+
+// UUIDHandler - POST /db/:acc/uuid?n= issues n UUIDv7 (1 by default)
+func UUIDHandler(ctx *fasthttp.RequestCtx) {
+	writeUIDs(ctx, uuid7Gen, formatUUID7)
+}
@@ -33,6 +33,7 @@ func GetInt64(key []byte, b *pebble.Batch) (*int64, error) {
 func SetInt64(key []byte, val int64, b *pebble.Batch) error {
 	buf := make([]byte, 8)
 	binary.LittleEndian.PutUint64(buf, uint64(val))
+	rcache.invalidate(key)
 	return b.Set(key, buf, pebble.NoSync)
 }
 
@@ -56,6 +57,32 @@ func compID1(prefix int, id string) []byte {
 	return b
 }
 
+// TableID|Account|0|ID|0|Sub
+// used for primitives that store each element under separate key
+func compID2(prefix int, acc, id, sub string) []byte {
+	b := make([]byte, 0, len(id)+len(acc)+len(sub)+3)
+	b = append(b, byte(prefix))
+	b = append(b, acc...)
+	b = append(b, 0)
+	b = append(b, id...)
+	b = append(b, 0)
+	b = append(b, sub...)
+	return b
+}
+
+// prefixEnd returns smallest key that is bigger than all keys with prefix p.
+// Used as UpperBound for iteration over prefix.
+func prefixEnd(p []byte) []byte {
+	end := append([]byte{}, p...)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil // prefix is all 0xff - no upper bound
+}
+
 // TableID|ID
 // 0 byte delimited is used to construct composite key from Acc and ID
 func fromCompID1(key []byte) string {
@@ -64,13 +91,30 @@ func fromCompID1(key []byte) string {
 
 func getAcc(ctx *fasthttp.RequestCtx) (string, error) {
 	acc := ctx.UserValue("acc").(string)
+	return acc, checkAcc(acc)
+}
+
+func checkAcc(acc string) error {
 	if len(acc) > 255 || len(acc) == 0 {
-		return "", fmt.Errorf("len is not in range 0~255")
+		return fmt.Errorf("len is not in range 0~255")
 	}
 	for _, v := range acc {
 		if v == 0 {
-			return "", fmt.Errorf("0 is not allowed as a character in acc name")
+			return fmt.Errorf("0 is not allowed as a character in acc name")
+		}
+	}
+	return nil
+}
+
+func getID(ctx *fasthttp.RequestCtx) (string, error) {
+	id, _ := ctx.UserValue("id").(string)
+	if len(id) > 1024 || len(id) == 0 {
+		return "", fmt.Errorf("id len is not in range 0~1024")
+	}
+	for _, v := range id {
+		if v == 0 {
+			return "", fmt.Errorf("0 is not allowed as a character in id")
 		}
 	}
-	return acc, nil
+	return id, nil
 }
@@ -0,0 +1,143 @@
+// Vector clocks kept on behalf of clients.
+//
+// Each writer sends clock it has seen last time along with its node name.
+// Server merges it with the stored clock, increments counter of the node
+// and reports if writer didn't see the latest stored state, i.e. update
+// is concurrent to some other update and might need conflict resolution.
+package main
+
+import (
+	"clouddragon/cd"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type VClockRequest struct {
+	Node  string
+	Clock map[string]int64
+}
+
+type VClockResponse struct {
+	Clock      map[string]int64
+	Previous   map[string]int64 `json:",omitempty"` // stored clock before update
+	Concurrent bool             // writer haven't seen Previous clock
+}
+
+// descends reports whether clock a has seen all events of clock b
+func descends(a, b map[string]int64) bool {
+	for k, v := range b {
+		if a[k] < v {
+			return false
+		}
+	}
+	return true
+}
+
+func getVClock(b pebble.Reader, acc, id string) (map[string]int64, error) {
+	d, closer, err := b.Get(compID(cd.VClockPrefix, acc, id))
+	if err == pebble.ErrNotFound {
+		return map[string]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var v cd.VClock
+	_, err = v.UnmarshalMsg(d)
+	if err != nil {
+		return nil, err
+	}
+	if v.Clock == nil {
+		v.Clock = map[string]int64{}
+	}
+	return v.Clock, nil
+}
+
+func GetVClockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	c, err := getVClock(store.DB(), acc, id)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(VClockResponse{Clock: c})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+func UpdateVClockHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req VClockRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if req.Node == "" {
+		ctx.Error("node is empty", 400)
+		return
+	}
+	var res VClockResponse
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		prev, err := getVClock(b, acc, id)
+		if err != nil {
+			return err
+		}
+		res.Concurrent = !descends(req.Clock, prev)
+		res.Previous = prev
+		res.Clock = make(map[string]int64, len(prev)+1)
+		for k, v := range prev {
+			res.Clock[k] = v
+		}
+		for k, v := range req.Clock {
+			if res.Clock[k] < v {
+				res.Clock[k] = v
+			}
+		}
+		res.Clock[req.Node]++
+		v := cd.VClock{Clock: res.Clock}
+		d, err := v.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		err = b.Set(compID(cd.VClockPrefix, acc, id), d, pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
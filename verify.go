@@ -0,0 +1,255 @@
+// Integrity verification periodically walks the whole keyspace with
+// limited rate and checks invariants of every primitive:
+// records decode, KV checksums match, counters are 8 bytes, cardinality of sets, sorted sets,
+// hashes and lists matches the number of stored elements.
+// Block checksums are verified by pebble itself while reading.
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type VerifyConfig struct {
+	Interval int `yaml:"Interval"` // hours between runs, default 24, negative disables
+	Rate     int `yaml:"Rate"`     // max keys checked per second, default 10000
+}
+
+type VerifyReport struct {
+	Running  bool
+	Started  time.Time
+	Finished time.Time `json:",omitempty"`
+	Keys     int64     // keys checked
+	Errors   int64     // invariant violations found
+	Problems []string  `json:",omitempty"` // first 100 problems
+}
+
+const maxVerifyProblems = 100
+
+var verifyMu sync.Mutex
+var lastVerify VerifyReport
+
+func (r *VerifyReport) problem(format string, args ...interface{}) {
+	r.Errors++
+	if len(r.Problems) < maxVerifyProblems {
+		r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	}
+}
+
+type msgpDecoder interface {
+	UnmarshalMsg([]byte) ([]byte, error)
+}
+
+// records that must be decodable, by prefix
+var verifyDecoders = map[byte]func() msgpDecoder{
+	cd.LocksPrefix:       func() msgpDecoder { return &cd.Lock{} },
+	cd.VClockPrefix:      func() msgpDecoder { return &cd.VClock{} },
+	cd.CheckoutPrefix:    func() msgpDecoder { return &cd.Checkout{} },
+	cd.ClaimPrefix:       func() msgpDecoder { return &cd.Claim{} },
+	cd.PartitionPrefix:   func() msgpDecoder { return &cd.PartitionGroup{} },
+	cd.QuotaPrefix:       func() msgpDecoder { return &cd.Quota{} },
+	cd.HoldPrefix:        func() msgpDecoder { return &cd.Hold{} },
+	cd.HistogramPrefix:   func() msgpDecoder { return &cd.Histogram{} },
+	cd.GaugePrefix:       func() msgpDecoder { return &cd.Gauge{} },
+	cd.StatsPrefix:       func() msgpDecoder { return &cd.KeyStats{} },
+	cd.RatePrefix:        func() msgpDecoder { return &cd.RateSample{} },
+	cd.ExportPrefix:      func() msgpDecoder { return &cd.Export{} },
+	cd.PLockPrefix:       func() msgpDecoder { return &cd.Lock{} },
+	cd.SettingsPrefix:    func() msgpDecoder { return &cd.Setting{} },
+	cd.SettingsLogPrefix: func() msgpDecoder { return &cd.SettingChange{} },
+	cd.FlagPrefix:        func() msgpDecoder { return &cd.Flag{} },
+	cd.ExperimentPrefix:  func() msgpDecoder { return &cd.Experiment{} },
+	cd.AssignmentPrefix:  func() msgpDecoder { return &cd.Assignment{} },
+	cd.WebhookKeyPrefix:  func() msgpDecoder { return &cd.WebhookKey{} },
+	cd.SeqPrefix:         func() msgpDecoder { return &cd.Seq{} },
+	cd.LockGroupPrefix:   func() msgpDecoder { return &cd.LockGroup{} },
+	cd.StealLogPrefix:    func() msgpDecoder { return &cd.LockSteal{} },
+}
+
+// verifyGroup counts elements of a single set/zset/hash/list
+type verifyGroup struct {
+	prefix   byte
+	key      []byte // Prefix|Account|0|ID
+	expected int64
+	count    int64
+}
+
+func (g *verifyGroup) check(r *VerifyReport) {
+	if g.key != nil && g.expected != g.count {
+		r.problem("%q: cardinality %v, but %v elements stored", g.key, g.expected, g.count)
+	}
+}
+
+// splitKey splits Prefix|Account|0|ID|0|Sub into Prefix|Account|0|ID and Sub
+func splitKey(k []byte) ([]byte, []byte, bool) {
+	i := bytes.IndexByte(k, 0)
+	if i < 0 {
+		return k, nil, false
+	}
+	j := bytes.IndexByte(k[i+1:], 0)
+	if j < 0 {
+		return k, nil, false
+	}
+	return k[:i+1+j], k[i+2+j:], true
+}
+
+// Verify walks the DB snapshot checking at most rate keys per second
+func Verify(rate int) VerifyReport {
+	r := VerifyReport{Running: true, Started: time.Now()}
+	verifyMu.Lock()
+	if lastVerify.Running {
+		verifyMu.Unlock()
+		return lastVerify
+	}
+	lastVerify = r
+	verifyMu.Unlock()
+
+	release := store.acquire()
+	defer release()
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	iter, err := snap.NewIter(&pebble.IterOptions{})
+	if err != nil {
+		r.problem("iterate: %v", err)
+	} else {
+		var g verifyGroup
+		for iter.First(); iter.Valid(); iter.Next() {
+			verifyKey(&r, &g, iter.Key(), iter.Value())
+			r.Keys++
+			if r.Keys%1000 == 0 {
+				// sleep to keep the rate
+				ahead := time.Duration(r.Keys)*time.Second/time.Duration(rate) - time.Since(r.Started)
+				if ahead > 0 {
+					time.Sleep(ahead)
+				}
+				verifyMu.Lock()
+				lastVerify.Keys, lastVerify.Errors = r.Keys, r.Errors
+				verifyMu.Unlock()
+			}
+		}
+		g.check(&r)
+		if err := iter.Close(); err != nil {
+			r.problem("iterate: %v", err)
+		}
+	}
+	r.Running = false
+	r.Finished = time.Now()
+	verifyMu.Lock()
+	lastVerify = r
+	verifyMu.Unlock()
+	log.Printf("verify: %v keys checked, %v errors", r.Keys, r.Errors)
+	for _, p := range r.Problems {
+		log.Print("verify: ", p)
+	}
+	return r
+}
+
+func verifyKey(r *VerifyReport, g *verifyGroup, k, v []byte) {
+	prefix := k[0]
+	if prefix == cd.KVPrefix {
+		var kv cd.KV
+		_, err := kv.UnmarshalMsg(v)
+		if err != nil {
+			r.problem("%q: decode: %v", k, err)
+		} else if !kv.Cold && kv.Sum != 0 && kv.Sum != crc32.Checksum(kv.Data, crcTable) {
+			r.problem("%q: %v", k, cd.ErrChecksum)
+		}
+		return
+	}
+	if dec, ok := verifyDecoders[prefix]; ok {
+		_, err := dec().UnmarshalMsg(v)
+		if err != nil {
+			r.problem("%q: decode: %v", k, err)
+		}
+		return
+	}
+	switch prefix {
+	case cd.AtomicPrefix:
+		if len(v) != 8 {
+			r.problem("%q: counter is %v bytes long", k, len(v))
+		}
+	case cd.EpochPrefix, cd.FenceTokenPrefix, cd.PLockTokenPrefix, cd.ClockOffsetPrefix, cd.SnowflakePrefix:
+		if len(v) != 8 {
+			r.problem("%q: value is %v bytes long", k, len(v))
+		}
+	case cd.SetPrefix, cd.ZSetPrefix, cd.HashPrefix, cd.ListPrefix:
+		head, sub, isElem := splitKey(k)
+		if g.prefix != prefix || !bytes.Equal(g.key, head) {
+			g.check(r)
+			*g = verifyGroup{prefix: prefix, key: append([]byte{}, head...)}
+		}
+		if isElem {
+			// sorted set stores member->score and score->member, count only one
+			if prefix != cd.ZSetPrefix || (len(sub) > 0 && sub[0] == 'm') {
+				g.count++
+			}
+			return
+		}
+		if prefix == cd.ListPrefix {
+			var m cd.ListMeta
+			_, err := m.UnmarshalMsg(v)
+			if err != nil {
+				r.problem("%q: decode: %v", k, err)
+				return
+			}
+			g.expected = m.Tail - m.Head
+			return
+		}
+		if len(v) != 8 {
+			r.problem("%q: cardinality is %v bytes long", k, len(v))
+			return
+		}
+		g.expected = ByteToInt64(v)
+	}
+}
+
+// VerifyLoop runs verification every interval hours
+func VerifyLoop(cfg VerifyConfig) {
+	if cfg.Interval < 0 {
+		return
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = 24
+	}
+	if cfg.Rate <= 0 {
+		cfg.Rate = 10000
+	}
+	t := time.NewTicker(time.Hour * time.Duration(cfg.Interval))
+	for range t.C {
+		Verify(cfg.Rate)
+	}
+}
+
+// GetVerifyHandler returns report of the last (or currently running) verification
+func GetVerifyHandler(ctx *fasthttp.RequestCtx) {
+	verifyMu.Lock()
+	d, err := json.Marshal(lastVerify)
+	verifyMu.Unlock()
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// StartVerifyHandler starts verification in background with optional ?rate=
+func StartVerifyHandler(ctx *fasthttp.RequestCtx) {
+	rate := ctx.QueryArgs().GetUintOrZero("rate")
+	if rate <= 0 {
+		rate = config.Verify.Rate
+	}
+	if rate <= 0 {
+		rate = 10000
+	}
+	go Verify(rate)
+	ctx.SetStatusCode(202)
+}
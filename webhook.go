@@ -0,0 +1,191 @@
+// Webhook deliveries (alerts, failover events, exports) are signed with
+// every webhook key, see client.WebhookHeader for the format. To rotate
+// the key create a new one, move consumers to it and delete the old one.
+// Consumers verify deliveries with client.VerifyWebhook or by forwarding
+// header and body to POST /webhook/verify. No keys - deliveries are not
+// signed.
+//
+// WebhookKeyPrefix|0|ID - key
+package main
+
+import (
+	"bytes"
+	"clouddragon/cd"
+	"clouddragon/client"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+const defaultWebhookTolerance = 300
+
+type WebhookKey struct {
+	ID      string
+	Secret  string `json:",omitempty"` // shown only when the key is created
+	Created int64
+}
+
+type WebhookVerifyResponse struct {
+	Valid bool
+	KeyID string `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+var webhookKeysMu sync.Mutex
+var webhookKeys = map[string]cd.WebhookKey{}
+
+// InitWebhookKeys loads signing keys, call before webhooks are sent
+func InitWebhookKeys() {
+	iter, err := store.DB().NewIter(&pebble.IterOptions{
+		LowerBound: []byte{cd.WebhookKeyPrefix},
+		UpperBound: []byte{cd.WebhookKeyPrefix + 1},
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer iter.Close()
+	webhookKeysMu.Lock()
+	defer webhookKeysMu.Unlock()
+	for iter.First(); iter.Valid(); iter.Next() {
+		var k cd.WebhookKey
+		_, err := k.UnmarshalMsg(iter.Value())
+		if err != nil {
+			panic(err)
+		}
+		webhookKeys[string(bytes.TrimPrefix(iter.Key(), compID(cd.WebhookKeyPrefix, "", "")))] = k
+	}
+}
+
+// webhookSignature returns value of client.WebhookHeader for the body, empty if there are no keys
+func webhookSignature(body []byte) string {
+	webhookKeysMu.Lock()
+	defer webhookKeysMu.Unlock()
+	if len(webhookKeys) == 0 {
+		return ""
+	}
+	t := time.Now().Unix()
+	parts := []string{"t=" + strconv.FormatInt(t, 10)}
+	for id, k := range webhookKeys {
+		parts = append(parts, "v1="+id+":"+client.WebhookSignature(k.Secret, t, body))
+	}
+	return strings.Join(parts, ",")
+}
+
+// signWebhook adds signature header to the delivery with body set already
+func signWebhook(req *fasthttp.Request) {
+	if sig := webhookSignature(req.Body()); sig != "" {
+		req.Header.Set(client.WebhookHeader, sig)
+	}
+}
+
+// ListWebhookKeysHandler - GET /admin/webhook/keys lists keys without secrets
+func ListWebhookKeysHandler(ctx *fasthttp.RequestCtx) {
+	res := []WebhookKey{}
+	webhookKeysMu.Lock()
+	for id, k := range webhookKeys {
+		res = append(res, WebhookKey{ID: id, Created: k.Created})
+	}
+	webhookKeysMu.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Created < res[j].Created })
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// CreateWebhookKeyHandler - POST /admin/webhook/keys creates a new key, its secret is in the response
+func CreateWebhookKeyHandler(ctx *fasthttp.RequestCtx) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id := newInstanceID()
+	k := cd.WebhookKey{Secret: hex.EncodeToString(secret), Created: time.Now().Unix()}
+	d, err := k.MarshalMsg(nil)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	webhookKeysMu.Lock()
+	defer webhookKeysMu.Unlock()
+	err = store.DB().Set(compID(cd.WebhookKeyPrefix, "", id), d, pebble.Sync)
+	if err != nil {
+		retryError(ctx, "", "", err)
+		return
+	}
+	webhookKeys[id] = k
+	d, err = json.Marshal(WebhookKey{ID: id, Secret: k.Secret, Created: k.Created})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// DeleteWebhookKeyHandler - DELETE /admin/webhook/keys/:id stops signing with the key
+func DeleteWebhookKeyHandler(ctx *fasthttp.RequestCtx) {
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	webhookKeysMu.Lock()
+	defer webhookKeysMu.Unlock()
+	if _, ok := webhookKeys[id]; !ok {
+		ctx.Error("key not found", 404)
+		return
+	}
+	err = store.DB().Delete(compID(cd.WebhookKeyPrefix, "", id), pebble.Sync)
+	if err != nil {
+		retryError(ctx, "", "", err)
+		return
+	}
+	delete(webhookKeys, id)
+}
+
+// VerifyWebhookHandler - POST /webhook/verify?tolerance= with the delivery
+// signature in client.WebhookHeader and its body as is
+func VerifyWebhookHandler(ctx *fasthttp.RequestCtx) {
+	tolerance := defaultWebhookTolerance
+	if ctx.QueryArgs().Has("tolerance") {
+		tolerance = ctx.QueryArgs().GetUintOrZero("tolerance")
+	}
+	var res WebhookVerifyResponse
+	t, sigs, err := client.ParseWebhookHeader(string(ctx.Request.Header.Peek(client.WebhookHeader)))
+	switch {
+	case err != nil:
+		res.Error = err.Error()
+	case tolerance > 0 && time.Since(time.Unix(t, 0)).Abs() > time.Duration(tolerance)*time.Second:
+		res.Error = client.ErrStaleSignature.Error()
+	default:
+		res.Error = client.ErrBadSignature.Error()
+		webhookKeysMu.Lock()
+		for id, sig := range sigs {
+			k, ok := webhookKeys[id]
+			if ok && hmac.Equal([]byte(sig), []byte(client.WebhookSignature(k.Secret, t, ctx.Request.Body()))) {
+				res = WebhookVerifyResponse{Valid: true, KeyID: id}
+				break
+			}
+		}
+		webhookKeysMu.Unlock()
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
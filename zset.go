@@ -0,0 +1,355 @@
+// Sorted sets keep members ordered by score using pebble key order.
+// Every member is stored twice - in score index for range queries and in
+// member index to find current score of the member.
+//
+// Account|0|ID                      - cardinality
+// Account|0|ID|0|m|Member           - score of the member
+// Account|0|ID|0|s|Score|Member     - score index
+//
+// Score is encoded so that byte order of encoded floats matches their
+// numeric order.
+package main
+
+import (
+	"clouddragon/cd"
+	"encoding/binary"
+	"math"
+	"strconv"
+
+	"github.com/cockroachdb/pebble"
+	json "github.com/goccy/go-json"
+	"github.com/valyala/fasthttp"
+)
+
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+type ZSetRequest struct {
+	Add    []ZMember // adds member or updates its score
+	Remove []string
+}
+
+type ZSetResponse struct {
+	Card    int64
+	Added   int       `json:",omitempty"`
+	Removed int       `json:",omitempty"`
+	Score   *float64  `json:",omitempty"` // score of ?member=
+	Members []ZMember `json:",omitempty"`
+}
+
+func encodeScore(f float64) []byte {
+	u := math.Float64bits(f)
+	if u&(1<<63) != 0 {
+		u = ^u // negative - reverse order of all bits
+	} else {
+		u |= 1 << 63
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, u)
+	return b
+}
+
+func decodeScore(b []byte) float64 {
+	u := binary.BigEndian.Uint64(b)
+	if u&(1<<63) != 0 {
+		u &^= 1 << 63
+	} else {
+		u = ^u
+	}
+	return math.Float64frombits(u)
+}
+
+func zMemberKey(acc, id, member string) []byte {
+	return compID2(cd.ZSetPrefix, acc, id, "m"+member)
+}
+
+func zScoreKey(acc, id string, score []byte, member string) []byte {
+	return compID2(cd.ZSetPrefix, acc, id, "s"+string(score)+member)
+}
+
+func zScorePrefix(acc, id string) []byte {
+	return compID2(cd.ZSetPrefix, acc, id, "s")
+}
+
+func parseZMember(prefix, key []byte) ZMember {
+	k := key[len(prefix):]
+	return ZMember{
+		Score:  decodeScore(k[:8]),
+		Member: string(k[8:]),
+	}
+}
+
+func zRemove(b *pebble.Batch, acc, id, member string) (bool, error) {
+	mk := zMemberKey(acc, id, member)
+	d, closer, err := b.Get(mk)
+	if err == pebble.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	score := append([]byte{}, d...)
+	closer.Close()
+	err = b.Delete(mk, pebble.NoSync)
+	if err != nil {
+		return false, err
+	}
+	return true, b.Delete(zScoreKey(acc, id, score, member), pebble.NoSync)
+}
+
+func zSetCard(b *pebble.Batch, acc, id string, card int64) error {
+	if card == 0 {
+		return b.Delete(compID(cd.ZSetPrefix, acc, id), pebble.NoSync)
+	}
+	return b.Set(compID(cd.ZSetPrefix, acc, id), Int64ToByte(card), pebble.NoSync)
+}
+
+func writeZSetResponse(ctx *fasthttp.RequestCtx, res ZSetResponse) {
+	d, err := json.Marshal(res)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	ctx.Response.SetBody(d)
+}
+
+// GetZSetHandler returns score of ?member=, members by rank with ?rank=&limit=
+// or members with scores within ?min=&max= range.
+func GetZSetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	limit, _, err := getPage(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	args := ctx.QueryArgs()
+	snap := store.DB().NewSnapshot()
+	defer snap.Close()
+	var res ZSetResponse
+	res.Card, err = getCard(snap, compID(cd.ZSetPrefix, acc, id))
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	if args.Has("member") {
+		d, closer, err := snap.Get(zMemberKey(acc, id, string(args.Peek("member"))))
+		if err != nil && err != pebble.ErrNotFound {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		if err == nil {
+			s := decodeScore(d)
+			res.Score = &s
+			closer.Close()
+		}
+		writeZSetResponse(ctx, res)
+		return
+	}
+
+	prefix := zScorePrefix(acc, id)
+	opts := &pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixEnd(prefix),
+	}
+	if args.Has("min") {
+		min, err := strconv.ParseFloat(string(args.Peek("min")), 64)
+		if err != nil {
+			ctx.Error("min should be a number", 400)
+			return
+		}
+		opts.LowerBound = append(prefix[:len(prefix):len(prefix)], encodeScore(min)...)
+	}
+	if args.Has("max") {
+		max, err := strconv.ParseFloat(string(args.Peek("max")), 64)
+		if err != nil {
+			ctx.Error("max should be a number", 400)
+			return
+		}
+		opts.UpperBound = prefixEnd(append(prefix[:len(prefix):len(prefix)], encodeScore(max)...))
+	}
+	rank := args.GetUintOrZero("rank")
+	iter, err := snap.NewIter(opts)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	defer iter.Close()
+	res.Members = []ZMember{}
+	for iter.First(); iter.Valid() && len(res.Members) < limit; iter.Next() {
+		if rank > 0 {
+			rank--
+			continue
+		}
+		res.Members = append(res.Members, parseZMember(prefix, iter.Key()))
+	}
+	writeZSetResponse(ctx, res)
+}
+
+func UpdateZSetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var req ZSetRequest
+	err = json.Unmarshal(ctx.Request.Body(), &req)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	var res ZSetResponse
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		res.Card, err = getCard(b, compID(cd.ZSetPrefix, acc, id))
+		if err != nil {
+			return err
+		}
+		for _, m := range req.Add {
+			existed, err := zRemove(b, acc, id, m.Member)
+			if err != nil {
+				return err
+			}
+			score := encodeScore(m.Score)
+			err = b.Set(zMemberKey(acc, id, m.Member), score, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+			err = b.Set(zScoreKey(acc, id, score, m.Member), nil, pebble.NoSync)
+			if err != nil {
+				return err
+			}
+			if !existed {
+				res.Added++
+				res.Card++
+			}
+		}
+		for _, m := range req.Remove {
+			existed, err := zRemove(b, acc, id, m)
+			if err != nil {
+				return err
+			}
+			if existed {
+				res.Removed++
+				res.Card--
+			}
+		}
+		err = zSetCard(b, acc, id, res.Card)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	writeZSetResponse(ctx, res)
+}
+
+// PopMinHandler removes and returns ?n= members with the lowest scores
+func PopMinHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	n := 1
+	if ctx.QueryArgs().Has("n") {
+		n = ctx.QueryArgs().GetUintOrZero("n")
+		if n <= 0 || n > maxPageSize {
+			ctx.Error("n is not in range 1~1000", 400)
+			return
+		}
+	}
+	var res ZSetResponse
+	b := store.DB().NewIndexedBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		res.Card, err = getCard(b, compID(cd.ZSetPrefix, acc, id))
+		if err != nil {
+			return err
+		}
+		prefix := zScorePrefix(acc, id)
+		iter, err := b.NewIter(&pebble.IterOptions{
+			LowerBound: prefix,
+			UpperBound: prefixEnd(prefix),
+		})
+		if err != nil {
+			return err
+		}
+		for iter.First(); iter.Valid() && len(res.Members) < n; iter.Next() {
+			res.Members = append(res.Members, parseZMember(prefix, iter.Key()))
+		}
+		err = iter.Close()
+		if err != nil {
+			return err
+		}
+		for _, m := range res.Members {
+			_, err := zRemove(b, acc, id, m.Member)
+			if err != nil {
+				return err
+			}
+			res.Card--
+		}
+		err = zSetCard(b, acc, id, res.Card)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	writeZSetResponse(ctx, res)
+}
+
+func DeleteZSetHandler(ctx *fasthttp.RequestCtx) {
+	acc, err := getAcc(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	id, err := getID(ctx)
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+	b := store.DB().NewBatch()
+	err = store.Singleton([]byte(acc), func() error {
+		prefix := compID2(cd.ZSetPrefix, acc, id, "")
+		err := b.DeleteRange(prefix, prefixEnd(prefix), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		err = b.Delete(compID(cd.ZSetPrefix, acc, id), pebble.NoSync)
+		if err != nil {
+			return err
+		}
+		return commitBatch(ctx, b)
+	})
+	if err != nil {
+		ctx.Error(err.Error(), 400)
+		return
+	}
+}